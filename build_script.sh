@@ -6,5 +6,8 @@ docker build -f go/gateway/Dockerfile -t news_feed_gateway:latest .
 # Users service
 docker build -f go/user/Dockerfile -t news_feed_user_service:latest .
 
+# Todo service
+docker build -f go/todo/Dockerfile -t news_feed_todo_service:latest .
+
 # Deploy docker services defined in docker-compose.yml file
 docker compose up --build
\ No newline at end of file
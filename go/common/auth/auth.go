@@ -11,13 +11,19 @@ import (
 	"time"
 
 	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/util"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// JWTService handles JWT token operations
+// JWTService handles JWT token operations. Tokens are signed either with a
+// shared HS256 secret or, if keys is set, with the asymmetric signingKey and
+// validated with the public keys from keys. Services that only validate
+// tokens have no signingKey.
 type JWTService struct {
 	secretKey     []byte
+	signingKey    *SigningKey
+	keys          KeySource
 	issuer        string
 	accessExpiry  time.Duration
 	refreshExpiry time.Duration
@@ -29,6 +35,17 @@ type Claims struct {
 	Username string      `json:"username"`
 	Email    string      `json:"email"`
 	Role     models.Role `json:"role,omitempty"`
+	// SessionID is the family of the refresh token issued along with the
+	// access token. Revoking the family revokes the access token too.
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// RefreshClaims represents the claims of a refresh token. Each refresh token
+// has its own ID and belongs to the family of tokens issued since the user
+// logged in, so the user service can rotate and revoke them.
+type RefreshClaims struct {
+	Family string `json:"family"`
 	jwt.RegisteredClaims
 }
 
@@ -40,6 +57,12 @@ type TokenPair struct {
 	TokenType    string `json:"token_type"`
 }
 
+// Audiences of the two kinds of tokens, so one cannot be used as the other
+const (
+	accessAudience  = "news-feed-api"
+	refreshAudience = "news-feed-refresh"
+)
+
 // Context keys for storing user info
 type contextKey string
 
@@ -49,6 +72,8 @@ const (
 	EmailKey    contextKey = "email"
 	UserRoleKey contextKey = "user_role"
 	ClaimsKey   contextKey = "claims"
+	// TokenKey holds the access token the claims were read from
+	TokenKey contextKey = "token"
 )
 
 // NewJWTService creates a new JWT service
@@ -61,18 +86,40 @@ func NewJWTService(secretKey, issuer string) *JWTService {
 	}
 }
 
-// GenerateTokenPair creates both access and refresh tokens
+// NewAsymmetricJWTService creates a JWT service signing tokens with
+// signingKey, which may be nil for services that only validate tokens, and
+// validating them with the keys from keys
+func NewAsymmetricJWTService(signingKey *SigningKey, keys KeySource, issuer string) *JWTService {
+	return &JWTService{
+		signingKey:    signingKey,
+		keys:          keys,
+		issuer:        issuer,
+		accessExpiry:  15 * time.Minute,
+		refreshExpiry: 7 * 24 * time.Hour,
+	}
+}
+
+// GenerateTokenPair creates both access and refresh tokens, starting a new
+// family of refresh tokens
 func (j *JWTService) GenerateTokenPair(user *models.User) (*TokenPair, error) {
+	tokens, _, err := j.GenerateTokenPairInFamily(user, util.NewUUID())
+	return tokens, err
+}
+
+// GenerateTokenPairInFamily creates both access and refresh tokens, the
+// refresh token belonging to family. It also returns the claims of the
+// refresh token.
+func (j *JWTService) GenerateTokenPairInFamily(user *models.User, family string) (*TokenPair, *RefreshClaims, error) {
 	// Generate access token
-	accessToken, err := j.generateAccessToken(user)
+	accessToken, err := j.generateAccessToken(user, family)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
 
 	// Generate refresh token
-	refreshToken, err := j.generateRefreshToken(user.ID)
+	refreshToken, refreshClaims, err := j.generateRefreshToken(user.ID, family)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
 
 	return &TokenPair{
@@ -80,53 +127,93 @@ func (j *JWTService) GenerateTokenPair(user *models.User) (*TokenPair, error) {
 		RefreshToken: refreshToken,
 		ExpiresIn:    int64(j.accessExpiry.Seconds()),
 		TokenType:    "Bearer",
-	}, nil
+	}, refreshClaims, nil
 }
 
-// generateAccessToken creates a new JWT access token
-func (j *JWTService) generateAccessToken(user *models.User) (string, error) {
+// generateAccessToken creates a new JWT access token with a new ID
+func (j *JWTService) generateAccessToken(user *models.User, session string) (string, error) {
 	claims := &Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role,
+		UserID:    user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: session,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        util.NewUUID(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.accessExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    j.issuer,
 			Subject:   user.ID,
-			Audience:  []string{"news-feed-api"},
+			Audience:  []string{accessAudience},
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secretKey)
+	return j.sign(claims)
 }
 
-// generateRefreshToken creates a simple refresh token
-func (j *JWTService) generateRefreshToken(userID string) (string, error) {
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.refreshExpiry)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Issuer:    j.issuer,
-		Subject:   userID,
-		Audience:  []string{"news-feed-refresh"},
+// generateRefreshToken creates a refresh token of family with a new ID
+func (j *JWTService) generateRefreshToken(userID string, family string) (string, *RefreshClaims, error) {
+	claims := &RefreshClaims{
+		Family: family,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.refreshExpiry)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    j.issuer,
+			Subject:   userID,
+			Audience:  []string{refreshAudience},
+			ID:        util.NewUUID(),
+		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secretKey)
+	signed, err := j.sign(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
 }
 
-// ValidateAccessToken validates and parses a JWT access token
-func (j *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
+// sign signs claims with the signing key, putting its id in the kid header
+func (j *JWTService) sign(claims jwt.Claims) (string, error) {
+	if j.keys == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(j.secretKey)
+	}
+	if j.signingKey == nil {
+		return "", ErrCannotSign
+	}
+	token := jwt.NewWithClaims(j.signingKey.Method, claims)
+	token.Header["kid"] = j.signingKey.ID
+	return token.SignedString(j.signingKey.Private)
+}
+
+// verificationKey returns the key validating token. The algorithm of the
+// token must be the one of the key, so a public key is never taken for an
+// HS256 secret.
+func (j *JWTService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if j.keys == nil {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("invalid signing method: %v", token.Header["alg"])
 		}
 		return j.secretKey, nil
-	})
+	}
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		return nil, errors.New("token has no key id")
+	}
+	return j.keys.VerificationKey(kid, token.Method.Alg())
+}
+
+// PublicKeys returns the keys tokens are validated with, to be published as
+// a JWKS document. It returns nil for services using a shared secret or
+// fetching the keys from elsewhere.
+func (j *JWTService) PublicKeys() *KeySet {
+	keys, _ := j.keys.(*KeySet)
+	return keys
+}
+
+// ValidateAccessToken validates and parses a JWT access token
+func (j *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, j.verificationKey, jwt.WithIssuer(j.issuer), jwt.WithAudience(accessAudience))
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -136,8 +223,9 @@ func (j *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
 		return nil, errors.New("invalid token")
 	}
 
+	// Tokens without an ID could not be revoked
 	claims, ok := token.Claims.(*Claims)
-	if !ok {
+	if !ok || claims.ID == "" {
 		return nil, errors.New("invalid token claims")
 	}
 
@@ -146,27 +234,31 @@ func (j *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
 
 // ValidateRefreshToken validates a refresh token and returns the user ID
 func (j *JWTService) ValidateRefreshToken(tokenString string) (string, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("invalid signing method: %v", token.Header["alg"])
-		}
-		return j.secretKey, nil
-	})
+	claims, err := j.ParseRefreshToken(tokenString)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// ParseRefreshToken validates a refresh token and returns its claims
+func (j *JWTService) ParseRefreshToken(tokenString string) (*RefreshClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &RefreshClaims{}, j.verificationKey, jwt.WithIssuer(j.issuer), jwt.WithAudience(refreshAudience))
 
 	if err != nil {
-		return "", fmt.Errorf("failed to parse refresh token: %w", err)
+		return nil, fmt.Errorf("failed to parse refresh token: %w", err)
 	}
 
 	if !token.Valid {
-		return "", errors.New("invalid refresh token")
+		return nil, errors.New("invalid refresh token")
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok {
-		return "", errors.New("invalid refresh token claims")
+	claims, ok := token.Claims.(*RefreshClaims)
+	if !ok || claims.Subject == "" || claims.Family == "" || claims.ID == "" {
+		return nil, errors.New("invalid refresh token claims")
 	}
 
-	return claims.Subject, nil
+	return claims, nil
 }
 
 // ExtractTokenFromHeader extracts JWT token from Authorization header
@@ -227,6 +319,20 @@ func WithUserContext(ctx context.Context, claims *Claims) context.Context {
 	return ctx
 }
 
+// WithAccessToken adds the access token a request was made with to context
+func WithAccessToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, TokenKey, token)
+}
+
+// GetAccessTokenFromContext extracts the access token from context
+func GetAccessTokenFromContext(ctx context.Context) (string, error) {
+	token, ok := ctx.Value(TokenKey).(string)
+	if !ok || token == "" {
+		return "", errors.New("access token not found in context")
+	}
+	return token, nil
+}
+
 // GetUserIDFromContext extracts user ID from context
 func GetUserIDFromContext(ctx context.Context) (string, error) {
 	userID, ok := ctx.Value(UserIDKey).(string)
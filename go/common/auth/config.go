@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	// SecretEnv is the environment variable holding the signing key. It takes
+	// precedence over the key in a config file.
+	SecretEnv = "JWT_SECRET"
+	// MinSecretLength is the shortest signing key accepted, in bytes
+	MinSecretLength = 32
+	// DefaultIssuer is the issuer of tokens if the config does not name one
+	DefaultIssuer = "news-feed"
+)
+
+// ErrInvalidSecret is returned for signing keys that are missing or too short
+var ErrInvalidSecret = errors.New("invalid JWT signing key")
+
+// Config is how tokens are signed and validated. With a shared Secret, the
+// user service issuing tokens and every service validating them must have the
+// same Secret. With asymmetric keys only the user service holds the private
+// SigningKey; other services validate tokens with public VerificationKeys or
+// the keys fetched from JWKSURL. Every service must have the same Issuer.
+type Config struct {
+	Secret string `json:"secret"`
+	Issuer string `json:"issuer"`
+	// SigningKey is the PEM file of the RSA or Ed25519 private key tokens
+	// are signed with. Setting it, VerificationKeys or JWKSURL replaces Secret.
+	SigningKey *KeyFile `json:"signing_key,omitempty"`
+	// VerificationKeys are PEM files of further keys tokens are validated
+	// with, such as the previous signing key while keys are rotated
+	VerificationKeys []KeyFile `json:"verification_keys,omitempty"`
+	// JWKSURL is the JWKS document of the user service, which services
+	// validating tokens fetch the keys from
+	JWKSURL string `json:"jwks_url,omitempty"`
+	// JWKSRefreshInterval is how long fetched keys are used before they are
+	// fetched again, five minutes by default
+	JWKSRefreshInterval string `json:"jwks_refresh_interval,omitempty"`
+}
+
+// NewJWTServiceFromConfig creates a JWT service with the asymmetric keys of
+// config if it has any, and otherwise one signing with the key in the
+// JWT_SECRET environment variable, or config.Secret if it is not set
+func NewJWTServiceFromConfig(config Config) (*JWTService, error) {
+	if config.SigningKey != nil || len(config.VerificationKeys) > 0 || config.JWKSURL != "" {
+		return newAsymmetricJWTServiceFromConfig(config)
+	}
+
+	secret := os.Getenv(SecretEnv)
+	if secret == "" {
+		secret = config.Secret
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("%w: set %s or the auth secret in the config", ErrInvalidSecret, SecretEnv)
+	}
+	if len(secret) < MinSecretLength {
+		return nil, fmt.Errorf("%w: must be at least %d bytes", ErrInvalidSecret, MinSecretLength)
+	}
+	return NewJWTService(secret, config.issuer()), nil
+}
+
+func newAsymmetricJWTServiceFromConfig(config Config) (*JWTService, error) {
+	var signingKey *SigningKey
+	var keys []*VerificationKey
+	if config.SigningKey != nil {
+		var err error
+		if signingKey, err = LoadSigningKey(*config.SigningKey); err != nil {
+			return nil, err
+		}
+		keys = append(keys, signingKey.Verification())
+	}
+	for _, keyFile := range config.VerificationKeys {
+		key, err := LoadVerificationKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	ids := make(map[string]bool)
+	for _, key := range keys {
+		if ids[key.ID] {
+			return nil, fmt.Errorf("auth config has two keys with id %s", key.ID)
+		}
+		ids[key.ID] = true
+	}
+
+	if config.JWKSURL != "" {
+		if len(keys) > 0 {
+			return nil, errors.New("auth config has both keys and a JWKS url")
+		}
+		refresh := DefaultJWKSRefreshInterval
+		if config.JWKSRefreshInterval != "" {
+			var err error
+			if refresh, err = time.ParseDuration(config.JWKSRefreshInterval); err != nil {
+				return nil, fmt.Errorf("invalid JWKS refresh interval %q: %w", config.JWKSRefreshInterval, err)
+			}
+		}
+		return NewAsymmetricJWTService(nil, NewRemoteKeySet(config.JWKSURL, refresh), config.issuer()), nil
+	}
+	return NewAsymmetricJWTService(signingKey, NewKeySet(keys...), config.issuer()), nil
+}
+
+func (config Config) issuer() string {
+	if config.Issuer == "" {
+		return DefaultIssuer
+	}
+	return config.Issuer
+}
@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// JWKSPath is where the user service serves its verification keys
+	JWKSPath = "/.well-known/jwks.json"
+	// DefaultJWKSRefreshInterval is how long fetched keys are used before
+	// they are fetched again
+	DefaultJWKSRefreshInterval = 5 * time.Minute
+	// minJWKSFetchInterval is how often keys are fetched at most, so tokens
+	// with unknown key ids cannot make every request fetch them
+	minJWKSFetchInterval = 10 * time.Second
+)
+
+// JWK is a public key in a JSON Web Key Set
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as served at JWKSPath
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the keys of the set as a JSON Web Key Set
+func (s *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{Keys: []JWK{}}
+	for _, key := range s.keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = encodeInt(public.N)
+			jwk.E = encodeInt(big.NewInt(int64(public.E)))
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+// KeySet returns the signing keys of the set. Keys of other types or uses
+// are left out.
+func (jwks *JWKS) KeySet() (*KeySet, error) {
+	set := NewKeySet()
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		public, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		if public == nil {
+			continue
+		}
+		key, err := newVerificationKey(jwk.Kid, public)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", jwk.Kid, err)
+		}
+		if jwk.Alg != "" && jwk.Alg != key.Method.Alg() {
+			return nil, fmt.Errorf("key %s: algorithm %s does not match the key", jwk.Kid, jwk.Alg)
+		}
+		set.keys = append(set.keys, key)
+	}
+	return set, nil
+}
+
+// publicKey decodes the key, or returns nil for key types that are not used
+func (jwk *JWK) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, nil
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, nil
+	}
+}
+
+// JWKSHandler serves the keys of keys as a JSON Web Key Set
+func JWKSHandler(keys *KeySet) http.Handler {
+	data, err := json.Marshal(keys.JWKS())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			http.Error(w, "Failed to encode keys", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(DefaultJWKSRefreshInterval.Seconds())))
+		w.Write(data)
+	})
+}
+
+// RemoteKeySet is a key source fetching the keys from a JWKS document, such
+// as the one served by the user service. Fetched keys are cached for the
+// refresh interval, and fetched again earlier for tokens signed with a key
+// that is not among them, which happens once keys are rotated.
+type RemoteKeySet struct {
+	url              string
+	client           *http.Client
+	refresh          time.Duration
+	minFetchInterval time.Duration
+
+	// mu guards the fields below. It is never held while keys are fetched,
+	// so token checks go on with the cached keys during a fetch.
+	mu          sync.RWMutex
+	keys        *KeySet
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	// fetching is closed once the fetch in flight is done, nil if there is
+	// none; fetchErr is how it went
+	fetching chan struct{}
+	fetchErr error
+}
+
+var (
+	errFetchedRecently = errors.New("keys were fetched recently")
+	errFetchInProgress = errors.New("keys are being fetched")
+)
+
+func NewRemoteKeySet(url string, refresh time.Duration) *RemoteKeySet {
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefreshInterval
+	}
+	return &RemoteKeySet{
+		url:              url,
+		client:           &http.Client{Timeout: 10 * time.Second},
+		refresh:          refresh,
+		minFetchInterval: minJWKSFetchInterval,
+	}
+}
+
+// VerificationKey returns the key with id kid if it is used with alg
+func (r *RemoteKeySet) VerificationKey(kid string, alg string) (crypto.PublicKey, error) {
+	keys, fresh := r.cached()
+	if keys == nil {
+		if err := r.fetch(true); err != nil {
+			return nil, err
+		}
+		keys, _ = r.cached()
+	} else if !fresh {
+		// Stale keys are still used while they are fetched again, or if they
+		// cannot be fetched
+		if r.fetch(false) == nil {
+			keys, _ = r.cached()
+		}
+	}
+
+	key, err := keys.VerificationKey(kid, alg)
+	if errors.Is(err, ErrUnknownKey) && r.fetch(true) == nil {
+		// The key may have been added since the keys were fetched
+		keys, _ = r.cached()
+		key, err = keys.VerificationKey(kid, alg)
+	}
+	return key, err
+}
+
+// cached returns the fetched keys, if any, and whether they are fresh
+func (r *RemoteKeySet) cached() (*KeySet, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.keys, time.Since(r.fetchedAt) <= r.refresh
+}
+
+// fetch replaces the keys with the ones served at the url, unless they were
+// fetched very recently. Only one fetch is in flight at a time; with wait,
+// callers wait for it and get its result, otherwise they return right away.
+func (r *RemoteKeySet) fetch(wait bool) error {
+	r.mu.Lock()
+	if done := r.fetching; done != nil {
+		r.mu.Unlock()
+		if !wait {
+			return errFetchInProgress
+		}
+		<-done
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.fetchErr
+	}
+	if time.Since(r.attemptedAt) < r.minFetchInterval {
+		r.mu.Unlock()
+		return errFetchedRecently
+	}
+	r.attemptedAt = time.Now()
+	done := make(chan struct{})
+	r.fetching = done
+	r.mu.Unlock()
+
+	keys, err := r.get()
+	if err != nil {
+		log.Printf("Failed to fetch keys from %s: %v", r.url, err)
+	}
+
+	r.mu.Lock()
+	if err == nil {
+		r.keys = keys
+		r.fetchedAt = time.Now()
+	}
+	r.fetchErr = err
+	r.fetching = nil
+	r.mu.Unlock()
+	close(done)
+	return err
+}
+
+func (r *RemoteKeySet) get() (*KeySet, error) {
+	resp, err := r.client.Get(r.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var jwks JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+	return jwks.KeySet()
+}
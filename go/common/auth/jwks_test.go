@@ -0,0 +1,223 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// jwksServer serves the public keys of a service and counts the requests.
+// While held, requests signal arrived and wait for release to be closed.
+type jwksServer struct {
+	mu       sync.Mutex
+	handler  http.Handler
+	requests int
+	arrived  chan struct{}
+	release  chan struct{}
+}
+
+func (s *jwksServer) serve(service *JWTService) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = JWKSHandler(service.PublicKeys())
+}
+
+func (s *jwksServer) hold(arrived chan struct{}, release chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.arrived, s.release = arrived, release
+}
+
+func (s *jwksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *jwksServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	handler, arrived, release := s.handler, s.arrived, s.release
+	s.mu.Unlock()
+	if release != nil {
+		arrived <- struct{}{}
+		<-release
+	}
+	handler.ServeHTTP(w, r)
+}
+
+func TestJWKS(t *testing.T) {
+	edPath, edKid := generateKey(t, "EdDSA")
+	rsaPath, rsaKid := generateKey(t, "RS256")
+	service, err := NewJWTServiceFromConfig(Config{
+		SigningKey:       &KeyFile{Path: edPath},
+		VerificationKeys: []KeyFile{{Path: rsaPath}},
+	})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	JWKSHandler(service.PublicKeys()).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, JWKSPath, nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/json", recorder.Header().Get("Content-Type"))
+
+	var jwks JWKS
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, JWK{Kty: "OKP", Kid: edKid, Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: jwks.Keys[0].X}, jwks.Keys[0])
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+	// Only public keys are published
+	assert.NotContains(t, recorder.Body.String(), `"d"`)
+
+	// The keys read back are the ones published
+	keys, err := jwks.KeySet()
+	require.NoError(t, err)
+	for i, kid := range []string{edKid, rsaKid} {
+		assert.Equal(t, kid, keys.Keys()[i].ID)
+		assert.Equal(t, kid, Thumbprint(keys.Keys()[i].Public))
+	}
+
+	// Keys not used for signing are left out
+	jwks.Keys = append(jwks.Keys, JWK{Kty: "RSA", Kid: "enc", Use: "enc"}, JWK{Kty: "EC", Kid: "ec"})
+	keys, err = jwks.KeySet()
+	require.NoError(t, err)
+	assert.Len(t, keys.Keys(), 2)
+	jwks.Keys[0].Alg = "RS256"
+	_, err = jwks.KeySet()
+	assert.Error(t, err)
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	user := &models.User{ID: "user123", Username: "john_doe"}
+	oldPath, _ := generateKey(t, "EdDSA")
+	newPath, _ := generateKey(t, "EdDSA")
+	old, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: oldPath}})
+	require.NoError(t, err)
+
+	keys := &jwksServer{}
+	keys.serve(old)
+	server := httptest.NewServer(keys)
+	defer server.Close()
+
+	validating, err := NewJWTServiceFromConfig(Config{JWKSURL: server.URL + JWKSPath})
+	require.NoError(t, err)
+	assert.Nil(t, validating.PublicKeys())
+	remote := validating.keys.(*RemoteKeySet)
+	remote.minFetchInterval = 0
+
+	// Fetched keys are cached
+	oldTokens, err := old.GenerateTokenPair(user)
+	require.NoError(t, err)
+	for range 3 {
+		claims, err := validating.ValidateAccessToken(oldTokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, "user123", claims.UserID)
+	}
+	assert.Equal(t, 1, keys.count())
+
+	// Tokens signed with a new key make the keys be fetched again
+	rotated, err := NewJWTServiceFromConfig(Config{
+		SigningKey:       &KeyFile{Path: newPath},
+		VerificationKeys: []KeyFile{{Path: oldPath + ".pub"}},
+	})
+	require.NoError(t, err)
+	keys.serve(rotated)
+	newTokens, err := rotated.GenerateTokenPair(user)
+	require.NoError(t, err)
+	for _, tokens := range []*TokenPair{newTokens, oldTokens} {
+		_, err = validating.ValidateAccessToken(tokens.AccessToken)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, keys.count())
+
+	// Unknown keys are fetched for at most once in a while
+	remote.minFetchInterval = time.Hour
+	forgedPath, _ := generateKey(t, "EdDSA")
+	forged, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: forgedPath}})
+	require.NoError(t, err)
+	forgedTokens, err := forged.GenerateTokenPair(user)
+	require.NoError(t, err)
+	for range 3 {
+		_, err = validating.ValidateAccessToken(forgedTokens.AccessToken)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	}
+	assert.Equal(t, 2, keys.count())
+
+	// Stale keys are used while they cannot be fetched
+	server.Close()
+	remote.minFetchInterval = 0
+	remote.refresh = 0
+	_, err = validating.ValidateAccessToken(newTokens.AccessToken)
+	assert.NoError(t, err)
+
+	unreachable := NewRemoteKeySet(server.URL+JWKSPath, time.Minute)
+	_, err = NewAsymmetricJWTService(nil, unreachable, DefaultIssuer).ValidateAccessToken(newTokens.AccessToken)
+	assert.Error(t, err)
+}
+
+func TestRemoteKeySet_FetchInFlight(t *testing.T) {
+	user := &models.User{ID: "user123", Username: "john_doe"}
+	path, _ := generateKey(t, "EdDSA")
+	issuing, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: path}})
+	require.NoError(t, err)
+	keys := &jwksServer{}
+	keys.serve(issuing)
+	server := httptest.NewServer(keys)
+	defer server.Close()
+
+	remote := NewRemoteKeySet(server.URL+JWKSPath, time.Minute)
+	remote.minFetchInterval = 0
+	validating := NewAsymmetricJWTService(nil, remote, DefaultIssuer)
+	tokens, err := issuing.GenerateTokenPair(user)
+	require.NoError(t, err)
+	_, err = validating.ValidateAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+
+	// Tokens signed with unknown keys make the keys be fetched, which hangs
+	arrived, release := make(chan struct{}, 2), make(chan struct{})
+	keys.hold(arrived, release)
+	forgedPath, _ := generateKey(t, "EdDSA")
+	forged, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: forgedPath}})
+	require.NoError(t, err)
+	forgedTokens, err := forged.GenerateTokenPair(user)
+	require.NoError(t, err)
+	var wg sync.WaitGroup
+	check := func() {
+		defer wg.Done()
+		_, err := validating.ValidateAccessToken(forgedTokens.AccessToken)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	}
+	wg.Add(1)
+	go check()
+	<-arrived
+	remote.mu.Lock()
+	remote.minFetchInterval = time.Hour
+	remote.mu.Unlock()
+	wg.Add(1)
+	go check()
+
+	// Tokens signed with known keys are checked meanwhile
+	checked := make(chan error)
+	go func() {
+		_, err := validating.ValidateAccessToken(tokens.AccessToken)
+		checked <- err
+	}()
+	select {
+	case err := <-checked:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("token check waited for the keys to be fetched")
+	}
+
+	// Only one fetch was made
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 2, keys.count())
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// MinRSAKeyBits is the smallest RSA key accepted
+	MinRSAKeyBits = 2048
+	// rsaKeyBits is the size of generated RSA keys
+	rsaKeyBits = 3072
+)
+
+var (
+	// ErrUnknownKey is returned for tokens signed with a key that is not among
+	// the verification keys
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrCannotSign is returned when a service that only validates tokens is
+	// asked to issue them
+	ErrCannotSign = errors.New("no signing key configured")
+)
+
+// KeyFile names a PEM file holding a key. ID is the key id put in the kid
+// header of tokens; it defaults to the RFC 7638 thumbprint of the key.
+type KeyFile struct {
+	ID   string `json:"id,omitempty"`
+	Path string `json:"path"`
+}
+
+// SigningKey is the private key tokens are signed with
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+}
+
+// VerificationKey is a public key tokens are validated with
+type VerificationKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Public crypto.PublicKey
+}
+
+// KeySource looks up the key validating tokens signed with algorithm alg by
+// the key with id kid
+type KeySource interface {
+	VerificationKey(kid string, alg string) (crypto.PublicKey, error)
+}
+
+// KeySet is a fixed set of verification keys. While keys are rotated it holds
+// the new key along with the old ones tokens may still be signed with.
+type KeySet struct {
+	keys []*VerificationKey
+}
+
+func NewKeySet(keys ...*VerificationKey) *KeySet {
+	return &KeySet{keys: keys}
+}
+
+// Keys returns the keys in the set
+func (s *KeySet) Keys() []*VerificationKey {
+	return s.keys
+}
+
+// VerificationKey returns the key with id kid if it is used with alg
+func (s *KeySet) VerificationKey(kid string, alg string) (crypto.PublicKey, error) {
+	for _, key := range s.keys {
+		if key.ID != kid {
+			continue
+		}
+		if key.Method.Alg() != alg {
+			return nil, fmt.Errorf("key %s is not used with %s", kid, alg)
+		}
+		return key.Public, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+}
+
+// LoadSigningKey reads the private key in the PEM file of keyFile
+func LoadSigningKey(keyFile KeyFile) (*SigningKey, error) {
+	private, err := readPrivateKey(keyFile.Path)
+	if err != nil {
+		return nil, err
+	}
+	verification, err := newVerificationKey(keyFile.ID, private.Public())
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", keyFile.Path, err)
+	}
+	return &SigningKey{ID: verification.ID, Method: verification.Method, Private: private}, nil
+}
+
+// LoadVerificationKey reads the public key in the PEM file of keyFile. The
+// file may hold a private key too, of which the public key is used.
+func LoadVerificationKey(keyFile KeyFile) (*VerificationKey, error) {
+	data, err := os.ReadFile(keyFile.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", keyFile.Path)
+	}
+
+	var public crypto.PublicKey
+	switch block.Type {
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		public, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		var private crypto.Signer
+		private, err = parsePrivateKey(block)
+		if err == nil {
+			public = private.Public()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", keyFile.Path, err)
+	}
+
+	key, err := newVerificationKey(keyFile.ID, public)
+	if err != nil {
+		return nil, fmt.Errorf("verification key %s: %w", keyFile.Path, err)
+	}
+	return key, nil
+}
+
+// Verification returns the public half of the signing key
+func (k *SigningKey) Verification() *VerificationKey {
+	return &VerificationKey{ID: k.ID, Method: k.Method, Public: k.Private.Public()}
+}
+
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	private, err := parsePrivateKey(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key %s: %w", path, err)
+	}
+	return private, nil
+}
+
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// GenerateKeyFiles generates a key pair for alg, "EdDSA" or "RS256", and
+// writes the private key to the PEM file at path and the public key next to
+// it with a .pub suffix. Existing files are not overwritten. It returns the
+// id of the key.
+func GenerateKeyFiles(path string, alg string) (string, error) {
+	var private crypto.Signer
+	var err error
+	switch alg {
+	case jwt.SigningMethodEdDSA.Alg():
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q, use EdDSA or RS256", alg)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode private key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %w", err)
+	}
+	if err := writePEM(path, "PRIVATE KEY", privateDER, 0600); err != nil {
+		return "", fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := writePEM(path+".pub", "PUBLIC KEY", publicDER, 0644); err != nil {
+		return "", fmt.Errorf("failed to write public key: %w", err)
+	}
+	return Thumbprint(private.Public()), nil
+}
+
+func writePEM(path string, kind string, der []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if err := pem.Encode(file, &pem.Block{Type: kind, Bytes: der}); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// newVerificationKey picks the signing method for public and names it id, or
+// its thumbprint if id is empty
+func newVerificationKey(id string, public crypto.PublicKey) (*VerificationKey, error) {
+	var method jwt.SigningMethod
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		if key.N.BitLen() < MinRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", MinRSAKeyBits)
+		}
+		method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", public)
+	}
+	if id == "" {
+		id = Thumbprint(public)
+	}
+	return &VerificationKey{ID: id, Method: method, Public: public}, nil
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of an RSA or Ed25519 public key
+func Thumbprint(public crypto.PublicKey) string {
+	var members any
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		// Members in lexicographic order, as the thumbprint requires
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{encodeInt(big.NewInt(int64(key.E))), "RSA", encodeInt(key.N)}
+	case ed25519.PublicKey:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{"Ed25519", "OKP", base64.RawURLEncoding.EncodeToString(key)}
+	default:
+		return ""
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func encodeInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
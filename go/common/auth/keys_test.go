@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// generateKey writes a key pair for alg to a temporary directory and returns
+// the path of the private key and the key id
+func generateKey(t *testing.T, alg string) (string, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "signing.pem")
+	kid, err := GenerateKeyFiles(path, alg)
+	require.NoError(t, err)
+	return path, kid
+}
+
+func TestAsymmetricSigning(t *testing.T) {
+	user := &models.User{ID: "user123", Username: "john_doe"}
+
+	for _, alg := range []string{"EdDSA", "RS256"} {
+		t.Run(alg, func(t *testing.T) {
+			path, kid := generateKey(t, alg)
+			issuing, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: path}})
+			require.NoError(t, err)
+			tokens, err := issuing.GenerateTokenPair(user)
+			require.NoError(t, err)
+
+			token, _, err := jwt.NewParser().ParseUnverified(tokens.AccessToken, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, alg, token.Header["alg"])
+			assert.Equal(t, kid, token.Header["kid"])
+			_, err = issuing.ParseRefreshToken(tokens.RefreshToken)
+			require.NoError(t, err)
+
+			// Services with the public key validate tokens but cannot issue them
+			validating, err := NewJWTServiceFromConfig(Config{VerificationKeys: []KeyFile{{Path: path + ".pub"}}})
+			require.NoError(t, err)
+			claims, err := validating.ValidateAccessToken(tokens.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "user123", claims.UserID)
+			_, err = validating.GenerateTokenPair(user)
+			assert.ErrorIs(t, err, ErrCannotSign)
+		})
+	}
+}
+
+func TestAsymmetricSigning_Rotation(t *testing.T) {
+	user := &models.User{ID: "user123", Username: "john_doe"}
+	oldPath, oldKid := generateKey(t, "EdDSA")
+	newPath, newKid := generateKey(t, "RS256")
+
+	old, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: oldPath}})
+	require.NoError(t, err)
+	oldTokens, err := old.GenerateTokenPair(user)
+	require.NoError(t, err)
+
+	// The new key signs while tokens signed with the old one stay valid
+	rotated, err := NewJWTServiceFromConfig(Config{
+		SigningKey:       &KeyFile{Path: newPath},
+		VerificationKeys: []KeyFile{{Path: oldPath + ".pub"}},
+	})
+	require.NoError(t, err)
+	newTokens, err := rotated.GenerateTokenPair(user)
+	require.NoError(t, err)
+	for _, tokens := range []*TokenPair{oldTokens, newTokens} {
+		_, err = rotated.ValidateAccessToken(tokens.AccessToken)
+		assert.NoError(t, err)
+	}
+	var kids []string
+	for _, key := range rotated.PublicKeys().Keys() {
+		kids = append(kids, key.ID)
+	}
+	assert.Equal(t, []string{newKid, oldKid}, kids)
+
+	// Once the old key is retired, so are its tokens
+	retired, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: newPath}})
+	require.NoError(t, err)
+	_, err = retired.ValidateAccessToken(oldTokens.AccessToken)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = retired.ValidateAccessToken(newTokens.AccessToken)
+	assert.NoError(t, err)
+}
+
+func TestAsymmetricSigning_Rejected(t *testing.T) {
+	user := &models.User{ID: "user123", Username: "john_doe"}
+	path, kid := generateKey(t, "EdDSA")
+	service, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: path}})
+	require.NoError(t, err)
+
+	// Tokens signed with a shared secret are not accepted, even with the id
+	// of a known key
+	tokens, err := NewJWTService("a-shared-secret-of-at-least-32-bytes", DefaultIssuer).GenerateTokenPair(user)
+	require.NoError(t, err)
+	_, err = service.ValidateAccessToken(tokens.AccessToken)
+	assert.Error(t, err)
+
+	claims := &Claims{UserID: "user123", RegisteredClaims: jwt.RegisteredClaims{
+		ID: "token", Issuer: DefaultIssuer, Audience: []string{accessAudience},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	forged.Header["kid"] = kid
+	signed, err := forged.SignedString([]byte(kid))
+	require.NoError(t, err)
+	_, err = service.ValidateAccessToken(signed)
+	assert.Error(t, err)
+
+	// Tokens without a key id are not accepted
+	unnamed := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	signingKey, err := LoadSigningKey(KeyFile{Path: path})
+	require.NoError(t, err)
+	signed, err = unnamed.SignedString(signingKey.Private)
+	require.NoError(t, err)
+	_, err = service.ValidateAccessToken(signed)
+	assert.ErrorContains(t, err, "no key id")
+}
+
+func TestNewJWTServiceFromConfig_Keys(t *testing.T) {
+	path, _ := generateKey(t, "EdDSA")
+
+	_, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: filepath.Join(t.TempDir(), "missing.pem")}})
+	assert.Error(t, err)
+	// Public keys cannot sign
+	_, err = NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{Path: path + ".pub"}})
+	assert.Error(t, err)
+	_, err = NewJWTServiceFromConfig(Config{
+		SigningKey:       &KeyFile{Path: path},
+		VerificationKeys: []KeyFile{{Path: path + ".pub"}},
+	})
+	assert.ErrorContains(t, err, "two keys")
+	_, err = NewJWTServiceFromConfig(Config{VerificationKeys: []KeyFile{{Path: path}}, JWKSURL: "http://localhost/jwks.json"})
+	assert.Error(t, err)
+
+	// Configured ids replace the thumbprints
+	service, err := NewJWTServiceFromConfig(Config{SigningKey: &KeyFile{ID: "2026-10", Path: path}})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", service.PublicKeys().Keys()[0].ID)
+
+	// Existing key files are not overwritten
+	_, err = GenerateKeyFiles(path, "EdDSA")
+	assert.Error(t, err)
+	_, err = GenerateKeyFiles(strings.TrimSuffix(path, ".pem")+"-other.pem", "ES256")
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+// Command jwtkeys generates a key pair for signing tokens. The private key is
+// written to -out, and the public key, which services validating tokens can
+// be given instead of the user service's JWKS document, next to it with a
+// .pub suffix:
+//
+//	jwtkeys -alg EdDSA -out ./user/config/keys/signing-2026-10.pem
+//
+// It prints the key id tokens signed with the key carry in their kid header.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+)
+
+func main() {
+	alg := flag.String("alg", "EdDSA", "signing algorithm, EdDSA or RS256")
+	out := flag.String("out", "", "file to write the private key to")
+	flag.Parse()
+	if *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	kid, err := auth.GenerateKeyFiles(*out, *alg)
+	if err != nil {
+		log.Fatalf("Generating keys failed: %v", err)
+	}
+	fmt.Printf("Wrote %s and %s.pub with key id %s\n", *out, *out, kid)
+}
@@ -0,0 +1,196 @@
+// Command memdbbackup backs up, restores and exports mem db tables.
+//
+// A backup holds every table under the given directories and can be taken
+// while the services using them are running:
+//
+//	memdbbackup backup -root ./user/data/user_db -root ./todo/data/todo_db -out backup.tar.gz
+//
+// Restoring checks the archive against its manifest before replacing the
+// tables of each directory. The services must be stopped first.
+//
+//	memdbbackup restore -in backup.tar.gz -root ./user/data/user_db -root ./todo/data/todo_db
+//
+// A table can be exported as NDJSON or CSV from a backup, or from a snapshot
+// of a directory taken on the spot:
+//
+//	memdbbackup export -in backup.tar.gz -model todo -table todos -format csv -out todos.csv
+//	memdbbackup export -root ./todo/data/todo_db -model todo -table todos
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/models"
+)
+
+// rootsFlag collects the directories given with a repeated -root flag
+type rootsFlag []string
+
+func (roots *rootsFlag) String() string {
+	return strings.Join(*roots, ",")
+}
+
+func (roots *rootsFlag) Set(value string) error {
+	*roots = append(*roots, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "backup":
+		err = backup(os.Args[2:])
+	case "restore":
+		err = restore(os.Args[2:])
+	case "export":
+		err = export(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: memdbbackup backup|restore|export [flags]")
+	os.Exit(2)
+}
+
+func backup(args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	var roots rootsFlag
+	flags.Var(&roots, "root", "directory holding tables, can be repeated")
+	out := flags.String("out", "", "archive to write, defaults to backup-<time>.tar.gz")
+	flags.Parse(args)
+	if len(roots) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *out == "" {
+		*out = "backup-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+	}
+
+	// Write next to the archive and move it in place once it is complete
+	tmpPath := *out + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	manifest, err := memdb.Backup(file, roots...)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, *out)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	printManifest(manifest)
+	fmt.Printf("Wrote backup to %s\n", *out)
+	return nil
+}
+
+func restore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	var roots rootsFlag
+	flags.Var(&roots, "root", "directory to restore the tables of, can be repeated")
+	in := flags.String("in", "", "archive to restore from")
+	flags.Parse(args)
+	if *in == "" || len(roots) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	archive, err := readArchive(*in)
+	if err != nil {
+		return err
+	}
+	printManifest(&archive.Manifest)
+	return archive.Restore(roots...)
+}
+
+func export(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	in := flags.String("in", "", "archive to export from")
+	root := flags.String("root", "", "directory to take a snapshot of instead of reading an archive")
+	model := flags.String("model", "", `model stored in the table, "todo" or "user"`)
+	table := flags.String("table", "", "table to export, <dir>/<table> if the name is not unique; defaults to the plural of the model")
+	format := flags.String("format", string(memdb.ExportNDJSON), `"ndjson" or "csv"`)
+	out := flags.String("out", "", "file to write, defaults to standard output")
+	flags.Parse(args)
+	if (*in == "") == (*root == "") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *table == "" {
+		*table = *model + "s"
+	}
+
+	var archive *memdb.Archive
+	var err error
+	if *in != "" {
+		archive, err = readArchive(*in)
+	} else {
+		var buf bytes.Buffer
+		if _, err = memdb.Backup(&buf, *root); err == nil {
+			archive, err = memdb.ReadArchive(&buf)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	switch *model {
+	case "todo":
+		return memdb.Export[*models.Todo](archive, *table, memdb.ExportFormat(*format), w)
+	case "user":
+		return memdb.Export[*models.User](archive, *table, memdb.ExportFormat(*format), w)
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	return nil
+}
+
+func readArchive(path string) (*memdb.Archive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return memdb.ReadArchive(file)
+}
+
+func printManifest(manifest *memdb.Manifest) {
+	fmt.Printf("Backup taken %s\n", manifest.CreatedAt.Format(time.RFC3339))
+	for _, table := range manifest.Tables {
+		fmt.Printf("  %-30s %8d items  %-5s %10d bytes  sha256 %s\n",
+			table.File, table.Items, table.Codec, table.Size, table.SHA256)
+	}
+}
@@ -0,0 +1,95 @@
+// Command memdbconvert rewrites a mem db table in the current log format with
+// the chosen codec. It migrates tables stored in the old JSON table files or
+// in logs without a header, and switches existing logs between codecs.
+//
+//	memdbconvert -root ./data/user_db -model user -codec proto
+//
+// The service using the table must not be running during the conversion.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/models"
+)
+
+func main() {
+	rootPath := flag.String("root", ".", "directory holding the table files")
+	model := flag.String("model", "", `model stored in the table, "todo" or "user"`)
+	table := flag.String("table", "", "table name, defaults to the plural of the model")
+	codecName := flag.String("codec", memdb.ProtoCodec.Name(), `codec to store the table with, "json" or "proto"`)
+	flag.Parse()
+
+	codec, err := memdb.LookupCodec(*codecName)
+	if err != nil {
+		log.Fatalln("Invalid codec: ", err)
+	}
+	if *table == "" {
+		*table = *model + "s"
+	}
+
+	switch *model {
+	case "todo":
+		err = convert[*models.Todo](*rootPath, *table, codec)
+	case "user":
+		err = convert[*models.User](*rootPath, *table, codec)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Could not convert table %s: %v", *table, err)
+	}
+}
+
+// convert opens the table with codec, which migrates it, and compacts it
+func convert[T common.Serializable](rootPath string, table string, codec memdb.Codec) error {
+	logPath := filepath.Join(rootPath, table+".log")
+	before := fileSize(logPath)
+	if before == 0 {
+		before = fileSize(filepath.Join(rootPath, table+".json"))
+	}
+
+	opts := []memdb.Option{memdb.WithCodec(codec)}
+	// Transactions the table has not applied yet are still in the
+	// transaction log, encoded with the old codec. Apply them first.
+	if _, err := os.Stat(filepath.Join(rootPath, "transactions.log")); err == nil {
+		store, err := memdb.OpenStore(rootPath, true)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		opts = append(opts, memdb.WithStore(store))
+	}
+
+	mem, err := memdb.Initialize[T](table, rootPath, true, opts...)
+	if err != nil {
+		return err
+	}
+	if err := mem.Compact(); err != nil {
+		mem.Close()
+		return err
+	}
+	items := len(mem.Data)
+	if err := mem.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Converted %d items of table %s to %s: %d bytes before, %d bytes after\n",
+		items, table, codec.Name(), before, fileSize(logPath))
+	return nil
+}
+
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
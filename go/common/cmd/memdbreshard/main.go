@@ -0,0 +1,89 @@
+// Command memdbreshard changes the number of shards a sharded mem db table is
+// spread over. It copies the table from its current shard directories into
+// new ones for the new shard count:
+//
+//	memdbreshard -root ./todo/data/todo_db -model todo -key user_id -from 4 -to 8
+//
+// The old shard directories are left in place, so the service can go back to
+// them, unless -remove is given. The service using the table must not be
+// running while the table is copied.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db/sharddb"
+	"github.com/Hanasou/news_feed/go/common/models"
+)
+
+func main() {
+	rootPath := flag.String("root", ".", "directory holding the shard directories")
+	model := flag.String("model", "", `model stored in the table, "todo" or "user"`)
+	table := flag.String("table", "", "table name, defaults to the plural of the model")
+	shardKey := flag.String("key", "id", "field the table is sharded by")
+	from := flag.Int("from", 0, "current number of shards")
+	to := flag.Int("to", 0, "new number of shards")
+	remove := flag.Bool("remove", false, "remove the old shard directories once the table is copied")
+	flag.Parse()
+	if *from < 1 || *to < 1 || *from == *to {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *table == "" {
+		*table = *model + "s"
+	}
+
+	var err error
+	switch *model {
+	case "todo":
+		err = reshard[*models.Todo](*rootPath, *table, *shardKey, *from, *to)
+	case "user":
+		err = reshard[*models.User](*rootPath, *table, *shardKey, *from, *to)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("Could not reshard table %s: %v", *table, err)
+	}
+
+	if *remove {
+		for shard := range *from {
+			if err := os.RemoveAll(sharddb.ShardDir(*rootPath, shard, *from)); err != nil {
+				log.Fatalf("Could not remove old shard %d: %v", shard, err)
+			}
+		}
+		fmt.Printf("Removed the %d old shards\n", *from)
+	}
+}
+
+func reshard[T common.Serializable](rootPath string, table string, shardKey string, from int, to int) error {
+	if _, err := os.Stat(sharddb.ShardDir(rootPath, 0, from)); err != nil {
+		return err
+	}
+	source, err := sharddb.OpenMemDb[T](table, rootPath, from, shardKey, true)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := sharddb.OpenMemDb[T](table, rootPath, to, shardKey, true)
+	if err != nil {
+		return err
+	}
+	report, err := sharddb.Rebalance(source, target)
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+	for shard := range to {
+		fmt.Printf("  %s: %d items\n", sharddb.ShardDir(rootPath, shard, to), report.PerShard[shard])
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Command replctl inspects and changes the replication roles of service
+// instances. It talks to the replication port of an instance, not the port
+// clients use.
+//
+//	replctl status -addr localhost:50072
+//
+// When the leader fails, promote one of its followers and point the other
+// followers at it:
+//
+//	replctl promote -addr localhost:50072
+//	replctl follow -addr localhost:50073 -leader localhost:50072
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/grpc/replicationpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	flags := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	addr := flags.String("addr", "localhost:50071", "replication address of the instance")
+	leader := flags.String("leader", "", "replication address of the new leader, for follow")
+	timeout := flags.Duration("timeout", 10*time.Second, "how long to wait for the instance")
+	flags.Parse(os.Args[2:])
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Could not connect to %s: %v", *addr, err)
+	}
+	defer conn.Close()
+	client := replicationpb.NewReplicationServiceClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var status *replicationpb.StatusResponse
+	switch os.Args[1] {
+	case "status":
+		status, err = client.Status(ctx, &replicationpb.StatusRequest{})
+	case "promote":
+		var response *replicationpb.PromoteResponse
+		if response, err = client.Promote(ctx, &replicationpb.PromoteRequest{}); err == nil {
+			status = response.Status
+		}
+	case "follow":
+		if *leader == "" {
+			flags.Usage()
+			os.Exit(2)
+		}
+		var response *replicationpb.FollowResponse
+		if response, err = client.Follow(ctx, &replicationpb.FollowRequest{LeaderAddress: *leader}); err == nil {
+			status = response.Status
+		}
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatalf("%s failed: %v", os.Args[1], err)
+	}
+	printStatus(*addr, status)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: replctl status|promote|follow [flags]")
+	os.Exit(2)
+}
+
+func printStatus(addr string, status *replicationpb.StatusResponse) {
+	fmt.Printf("%s is a %s", addr, status.Role)
+	if status.LeaderAddress != "" {
+		fmt.Printf(" of %s", status.LeaderAddress)
+	}
+	fmt.Println()
+	for _, table := range status.Tables {
+		fmt.Printf("  %-20s at change %d\n", table.Table, table.Seq)
+	}
+}
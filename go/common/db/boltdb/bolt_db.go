@@ -0,0 +1,665 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+// FileName is the name of the database file created under the root path.
+// Every table of a service lives in the same file.
+const FileName = "data.bolt"
+
+// openTimeout is how long Initialize waits for another process to release
+// the database file
+const openTimeout = time.Second
+
+// Driver for data held in an embedded bbolt key-value store. Each item is
+// stored as a JSON document under its id in a bucket named after the table.
+// The file is memory mapped, so only the pages being read have to be in
+// memory and the operating system's page cache bounds how much of the table
+// is kept there.
+//
+// Secondary indexes live in a bucket per field, <table>/index/<field>, whose
+// keys are the JSON encoding of the field value followed by a zero byte and
+// the id. Changes are kept in <table>/changes. Every write updates the item,
+// its index entries and the change history in a single transaction.
+//
+// A database file can only be open in one process at a time. Tables opened
+// in the same process share it.
+type BoltDb[T common.Serializable] struct {
+	Table    string
+	FilePath string
+
+	file        *sharedFile
+	indexes     []indexSpec
+	historySize int
+}
+
+// Option configures a BoltDb table at Initialize
+type Option func(*options)
+
+type options struct {
+	indexes       []indexSpec
+	changeHistory int
+}
+
+type indexSpec struct {
+	field  string
+	unique bool
+}
+
+// WithIndex declares a secondary index on field
+func WithIndex(field string) Option {
+	return func(o *options) {
+		o.indexes = append(o.indexes, indexSpec{field: field})
+	}
+}
+
+// WithUniqueIndex declares a secondary index on field that rejects two items
+// with the same value
+func WithUniqueIndex(field string) Option {
+	return func(o *options) {
+		o.indexes = append(o.indexes, indexSpec{field: field, unique: true})
+	}
+}
+
+// WithChangeHistory sets how many recent changes the table keeps for
+// watchers, db.DefaultChangeHistory by default
+func WithChangeHistory(size int) Option {
+	return func(o *options) {
+		o.changeHistory = size
+	}
+}
+
+// sharedFile is a database file opened by one or more tables
+type sharedFile struct {
+	path string
+	bolt *bolt.DB
+	refs int
+	// changed is notified after every write to a table of the file
+	changed db.Broadcast
+}
+
+var (
+	filesMu sync.Mutex
+	files   = map[string]*sharedFile{}
+)
+
+// openFile opens the database file at path, or returns it if another table
+// has it open already
+func openFile(path string) (*sharedFile, error) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	if file, ok := files[path]; ok {
+		file.refs++
+		return file, nil
+	}
+	boltDb, err := bolt.Open(path, 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, err
+	}
+	file := &sharedFile{path: path, bolt: boltDb, refs: 1}
+	files[path] = file
+	return file, nil
+}
+
+// release closes the file once no table uses it anymore
+func (file *sharedFile) release() error {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	file.refs--
+	if file.refs > 0 {
+		return nil
+	}
+	delete(files, file.path)
+	return file.bolt.Close()
+}
+
+func Initialize[T common.Serializable](table string, rootPath string, opts ...Option) (*BoltDb[T], error) {
+	if table == "" || strings.Contains(table, "/") {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	config := &options{changeHistory: db.DefaultChangeHistory}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if err := common.ValidateFields[T]("id"); err != nil {
+		log.Printf("Could not initialize table %s: %v", table, err)
+		return nil, err
+	}
+	for _, spec := range config.indexes {
+		if err := common.ValidateFields[T](spec.field); err != nil {
+			log.Printf("Could not declare index on %s.%s: %v", table, spec.field, err)
+			return nil, err
+		}
+	}
+
+	filePath := filepath.Join(rootPath, FileName)
+	file, err := openFile(filePath)
+	if err != nil {
+		log.Printf("Could not open bolt database %s: %v", filePath, err)
+		return nil, err
+	}
+	bdb := &BoltDb[T]{
+		Table:       table,
+		FilePath:    filePath,
+		file:        file,
+		indexes:     config.indexes,
+		historySize: config.changeHistory,
+	}
+	if err := file.bolt.Update(bdb.createBuckets); err != nil {
+		log.Printf("Could not create buckets for table %s: %v", table, err)
+		file.release()
+		return nil, err
+	}
+	return bdb, nil
+}
+
+func (bdb *BoltDb[T]) itemsBucket() []byte {
+	return []byte(bdb.Table)
+}
+
+func (bdb *BoltDb[T]) indexBucket(field string) []byte {
+	return []byte(bdb.Table + "/index/" + field)
+}
+
+func (bdb *BoltDb[T]) changesBucket() []byte {
+	return []byte(bdb.Table + "/changes")
+}
+
+// createBuckets creates the buckets of the table. Indexes that are new are
+// built from the items already there, and indexes that are no longer
+// declared are dropped so they cannot go stale.
+func (bdb *BoltDb[T]) createBuckets(tx *bolt.Tx) error {
+	items, err := tx.CreateBucketIfNotExists(bdb.itemsBucket())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.CreateBucketIfNotExists(bdb.changesBucket()); err != nil {
+		return err
+	}
+
+	declared := map[string]bool{}
+	for _, spec := range bdb.indexes {
+		declared[string(bdb.indexBucket(spec.field))] = true
+		if tx.Bucket(bdb.indexBucket(spec.field)) != nil {
+			continue
+		}
+		bucket, err := tx.CreateBucket(bdb.indexBucket(spec.field))
+		if err != nil {
+			return err
+		}
+		err = items.ForEach(func(id, data []byte) error {
+			item, err := decode[T](data)
+			if err != nil {
+				return err
+			}
+			key, err := indexKey(item, spec.field, string(id))
+			if err != nil {
+				return err
+			}
+			if spec.unique {
+				if err := checkUnique(bucket, spec.field, key, string(id)); err != nil {
+					return err
+				}
+			}
+			return bucket.Put(key, nil)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	stale := [][]byte{}
+	prefix := []byte(bdb.Table + "/index/")
+	err = tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+		if bytes.HasPrefix(name, prefix) && !declared[string(name)] {
+			stale = append(stale, bytes.Clone(name))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range stale {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close releases the database file
+func (bdb *BoltDb[T]) Close() error {
+	return bdb.file.release()
+}
+
+func decode[T common.Serializable](data []byte) (T, error) {
+	var item T
+	if err := json.Unmarshal(data, &item); err != nil {
+		log.Printf("Error unmarshalling stored item: %v", err)
+		return item, err
+	}
+	return item, nil
+}
+
+func (bdb *BoltDb[T]) Upsert(item T) error {
+	return bdb.upsert(item, false, 0)
+}
+
+// UpsertIfVersion implements the DbDriver interface
+func (bdb *BoltDb[T]) UpsertIfVersion(item T, version int64) error {
+	return bdb.upsert(item, true, version)
+}
+
+func (bdb *BoltDb[T]) upsert(item T, conditional bool, version int64) error {
+	id, err := common.GetID(item)
+	if err != nil {
+		return err
+	}
+	// Stamp a copy so the caller's item only changes if the write succeeds
+	data, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	stored, err := decode[T](data)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var current int64
+	err = bdb.file.bolt.Update(func(tx *bolt.Tx) error {
+		before, err := bdb.get(tx, id)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+		if before != nil {
+			current = db.VersionOf(*before)
+		}
+		if conditional {
+			if err := db.CheckVersion(id, version, current); err != nil {
+				return err
+			}
+		}
+		return bdb.write(tx, id, before, stored, now)
+	})
+	if err != nil {
+		log.Printf("Upsert into %s failed: %v", bdb.Table, err)
+		return err
+	}
+	// Let the caller know the version it just wrote
+	db.Stamp(item, current, now)
+	bdb.file.changed.Notify()
+	return nil
+}
+
+// get returns the stored item with the given id, whether it is in the trash
+// or not
+func (bdb *BoltDb[T]) get(tx *bolt.Tx, id string) (*T, error) {
+	data := tx.Bucket(bdb.itemsBucket()).Get([]byte(id))
+	if data == nil {
+		return nil, db.ErrNotFound
+	}
+	item, err := decode[T](data)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// write stores item under id with the next version, replacing before, and
+// records the change
+func (bdb *BoltDb[T]) write(tx *bolt.Tx, id string, before *T, item T, now time.Time) error {
+	var current int64
+	if before != nil {
+		current = db.VersionOf(*before)
+	}
+	db.Stamp(item, current, now)
+	data, err := json.Marshal(item)
+	if err != nil {
+		log.Printf("Error marshalling item to JSON: %v", err)
+		return err
+	}
+	if err := bdb.reindex(tx, id, before, &item); err != nil {
+		return err
+	}
+	items := tx.Bucket(bdb.itemsBucket())
+	beforeData := bytes.Clone(items.Get([]byte(id)))
+	if err := items.Put([]byte(id), data); err != nil {
+		return err
+	}
+	return bdb.record(tx, id, beforeData, data)
+}
+
+// remove permanently deletes the item with the given id and records the
+// change. It does nothing if there is no such item.
+func (bdb *BoltDb[T]) remove(tx *bolt.Tx, id string) error {
+	before, err := bdb.get(tx, id)
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := bdb.reindex(tx, id, before, nil); err != nil {
+		return err
+	}
+	items := tx.Bucket(bdb.itemsBucket())
+	beforeData := bytes.Clone(items.Get([]byte(id)))
+	if err := items.Delete([]byte(id)); err != nil {
+		return err
+	}
+	return bdb.record(tx, id, beforeData, nil)
+}
+
+// GetByID implements the DbDriver interface
+func (bdb *BoltDb[T]) GetByID(id string) (T, error) {
+	var item T
+	err := bdb.file.bolt.View(func(tx *bolt.Tx) error {
+		stored, err := bdb.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if db.IsDeleted(*stored) {
+			return db.ErrNotFound
+		}
+		item = *stored
+		return nil
+	})
+	return item, err
+}
+
+// GetAll implements the DbDriver interface. It loads every item of the table
+// into memory; use Query with a Limit to read a large table in pages.
+func (bdb *BoltDb[T]) GetAll() ([]T, error) {
+	result := make([]T, 0)
+	err := bdb.file.bolt.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bdb.itemsBucket()).ForEach(func(_, data []byte) error {
+			item, err := decode[T](data)
+			if err != nil {
+				return err
+			}
+			if !db.IsDeleted(item) {
+				result = append(result, item)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Delete implements the DbDriver interface. Soft deletable items are moved
+// to the trash, other items are purged. Deleting an item that is not there,
+// or already in the trash, does nothing.
+func (bdb *BoltDb[T]) Delete(id string) error {
+	if !db.IsSoftDeletable[T]() {
+		return bdb.Purge(id)
+	}
+	err := bdb.setDeletedAt(id, time.Now())
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Restore implements the DbDriver interface
+func (bdb *BoltDb[T]) Restore(id string) error {
+	return bdb.setDeletedAt(id, time.Time{})
+}
+
+// setDeletedAt moves the item with the given id to the trash, or out of it
+// for the zero time. It returns db.ErrNotFound if there is no such item or it
+// already is where it should go.
+func (bdb *BoltDb[T]) setDeletedAt(id string, deletedAt time.Time) error {
+	now := time.Now()
+	err := bdb.file.bolt.Update(func(tx *bolt.Tx) error {
+		before, err := bdb.get(tx, id)
+		if err != nil {
+			return err
+		}
+		if db.IsDeleted(*before) == !deletedAt.IsZero() {
+			return db.ErrNotFound
+		}
+		// A second copy, so that before keeps the stored image
+		item, err := bdb.get(tx, id)
+		if err != nil {
+			return err
+		}
+		deletable, ok := any(*item).(db.SoftDeletable)
+		if !ok {
+			return db.ErrNotFound
+		}
+		deletable.SetDeletedAt(deletedAt)
+		return bdb.write(tx, id, before, *item, now)
+	})
+	if err != nil {
+		return err
+	}
+	bdb.file.changed.Notify()
+	return nil
+}
+
+// Purge implements the DbDriver interface
+func (bdb *BoltDb[T]) Purge(id string) error {
+	err := bdb.file.bolt.Update(func(tx *bolt.Tx) error {
+		return bdb.remove(tx, id)
+	})
+	if err != nil {
+		log.Printf("Delete from %s failed: %v", bdb.Table, err)
+		return err
+	}
+	bdb.file.changed.Notify()
+	return nil
+}
+
+// PurgeDeleted implements the db.Purger interface
+func (bdb *BoltDb[T]) PurgeDeleted(before time.Time) (int, error) {
+	if !db.IsSoftDeletable[T]() {
+		return 0, nil
+	}
+	purged := 0
+	err := bdb.file.bolt.Update(func(tx *bolt.Tx) error {
+		ids := []string{}
+		err := tx.Bucket(bdb.itemsBucket()).ForEach(func(id, data []byte) error {
+			item, err := decode[T](data)
+			if err != nil {
+				return err
+			}
+			if db.DeletedBefore(item, before) {
+				ids = append(ids, string(id))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := bdb.remove(tx, id); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Purge of %s failed: %v", bdb.Table, err)
+		return 0, err
+	}
+	if purged > 0 {
+		bdb.file.changed.Notify()
+	}
+	return purged, nil
+}
+
+func (bdb *BoltDb[T]) GetByField(field string, value any) (T, error) {
+	var zero T
+	if err := common.ValidateFields[T](field); err != nil {
+		return zero, err
+	}
+	items, err := bdb.find(map[string]any{field: value}, 1)
+	if err != nil {
+		return zero, err
+	}
+	if len(items) == 0 {
+		return zero, db.ErrNotFound
+	}
+	return items[0], nil
+}
+
+func (bdb *BoltDb[T]) GetByFilter(filters map[string]any) ([]T, error) {
+	if err := db.ValidateFilters[T](filters); err != nil {
+		return nil, err
+	}
+	return bdb.find(filters, 0)
+}
+
+// find returns the items that are not in the trash and whose fields equal
+// filters, at most limit of them unless limit is 0
+func (bdb *BoltDb[T]) find(filters map[string]any, limit int) ([]T, error) {
+	result := make([]T, 0)
+	err := bdb.file.bolt.View(func(tx *bolt.Tx) error {
+		return bdb.scan(tx, filters, "", func(item T) (bool, error) {
+			if db.IsDeleted(item) {
+				return true, nil
+			}
+			matches, err := db.FromFilters(filters).Matches(item)
+			if err != nil || !matches {
+				return true, err
+			}
+			result = append(result, item)
+			return limit == 0 || len(result) < limit, nil
+		})
+	})
+	return result, err
+}
+
+// scan feeds visit the items with ids after afterID that may have the values
+// of equalities in order of id, stopping when it returns false. Only the
+// items found in the most selective index on the fields of equalities are
+// visited; every item if none of the fields is indexed.
+func (bdb *BoltDb[T]) scan(tx *bolt.Tx, equalities map[string]any, afterID string, visit func(T) (bool, error)) error {
+	ids, narrowed, err := bdb.candidates(tx, equalities)
+	if err != nil {
+		return err
+	}
+	items := tx.Bucket(bdb.itemsBucket())
+	if narrowed {
+		for _, id := range ids {
+			if afterID != "" && id <= afterID {
+				continue
+			}
+			data := items.Get([]byte(id))
+			if data == nil {
+				continue
+			}
+			item, err := decode[T](data)
+			if err != nil {
+				return err
+			}
+			if more, err := visit(item); err != nil || !more {
+				return err
+			}
+		}
+		return nil
+	}
+	cursor := items.Cursor()
+	id, data := cursor.First()
+	if afterID != "" {
+		id, data = cursor.Seek([]byte(afterID))
+		if id != nil && string(id) == afterID {
+			id, data = cursor.Next()
+		}
+	}
+	for ; id != nil; id, data = cursor.Next() {
+		item, err := decode[T](data)
+		if err != nil {
+			return err
+		}
+		if more, err := visit(item); err != nil || !more {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query implements the DbDriver interface. Equality conditions on indexed
+// fields at the top of the query are answered from the index. Queries sorted
+// by id only read as many items as the page needs. Queries sorted by other
+// fields read every matching item, but with a Limit only hold the ones up to
+// the end of the page in memory; without one they hold them all.
+func (bdb *BoltDb[T]) Query(query db.Query) (*db.Page[T], error) {
+	if err := db.ValidateQuery[T](query); err != nil {
+		return nil, err
+	}
+	if len(query.OrderBy) > 0 {
+		collector, err := db.NewCollector[T](query)
+		if err != nil {
+			return nil, err
+		}
+		err = bdb.file.bolt.View(func(tx *bolt.Tx) error {
+			return bdb.scan(tx, query.Where.Equalities(), "", func(item T) (bool, error) {
+				return true, collector.Add(item)
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return collector.Page()
+	}
+
+	afterID := ""
+	if query.After != "" {
+		_, id, err := db.DecodeCursor(query.After, nil)
+		if err != nil {
+			return nil, err
+		}
+		afterID = id
+	}
+	page := &db.Page[T]{Items: make([]T, 0)}
+	skipped := 0
+	more := false
+	err := bdb.file.bolt.View(func(tx *bolt.Tx) error {
+		return bdb.scan(tx, query.Where.Equalities(), afterID, func(item T) (bool, error) {
+			if !query.IncludeDeleted && db.IsDeleted(item) {
+				return true, nil
+			}
+			matches, err := query.Where.Matches(item)
+			if err != nil || !matches {
+				return true, err
+			}
+			if skipped < query.Offset {
+				skipped++
+				return true, nil
+			}
+			if query.Limit > 0 && len(page.Items) == query.Limit {
+				more = true
+				return false, nil
+			}
+			page.Items = append(page.Items, item)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if more && len(page.Items) > 0 {
+		cursor, err := db.EncodeCursor(page.Items[len(page.Items)-1], nil)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor
+	}
+	return page, nil
+}
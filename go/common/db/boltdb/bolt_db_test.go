@@ -0,0 +1,339 @@
+package boltdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTodos(t *testing.T, rootPath string, opts ...Option) *BoltDb[*models.Todo] {
+	t.Helper()
+	todos, err := Initialize[*models.Todo]("todos", rootPath, append([]Option{WithIndex("user_id")}, opts...)...)
+	require.NoError(t, err)
+	t.Cleanup(func() { todos.Close() })
+	return todos
+}
+
+func TestBoltDb_CRUD(t *testing.T) {
+	todos := openTodos(t, t.TempDir())
+
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo2", Text: "second", Done: true, UserId: "user1"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo3", Text: "third", UserId: "user2"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "first, edited", UserId: "user1"}))
+
+	todo, err := todos.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "first, edited", todo.Text)
+
+	all, err := todos.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	require.NoError(t, todos.Purge("todo3"))
+	_, err = todos.GetByID("todo3")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = Initialize[*models.Todo]("todos/index", t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestBoltDb_Filters(t *testing.T) {
+	todos := openTodos(t, t.TempDir())
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "open", UserId: "user1"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo2", Text: "finished", Done: true, UserId: "user1"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo3", Text: "other", UserId: "user2"}))
+	// Moving a todo to another user moves its index entry
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo3", Text: "other", UserId: "user3"}))
+
+	userTodos, err := todos.GetByFilter(map[string]any{"user_id": "user1"})
+	require.NoError(t, err)
+	assert.Len(t, userTodos, 2)
+	userTodos, err = todos.GetByFilter(map[string]any{"user_id": "user2"})
+	require.NoError(t, err)
+	assert.Empty(t, userTodos)
+
+	open, err := todos.GetByFilter(map[string]any{"user_id": "user1", "done": false})
+	require.NoError(t, err)
+	require.Len(t, open, 1)
+	assert.Equal(t, "todo1", open[0].Id)
+
+	todo, err := todos.GetByField("text", "finished")
+	require.NoError(t, err)
+	assert.Equal(t, "todo2", todo.Id)
+
+	_, err = todos.GetByField("text", "missing")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	_, err = todos.GetByFilter(map[string]any{"UserId": "user1"})
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+}
+
+func TestBoltDb_UniqueIndex(t *testing.T) {
+	rootPath := t.TempDir()
+	users, err := Initialize[*models.User]("users", rootPath, WithUniqueIndex("username"), WithUniqueIndex("email"))
+	require.NoError(t, err)
+	defer users.Close()
+
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice", Email: "alice@example.com", Role: models.Admin}))
+	err = users.Upsert(&models.User{ID: "u2", Username: "alice", Email: "other@example.com"})
+	assert.ErrorIs(t, err, db.ErrUniqueViolation)
+	// The failed write left nothing behind
+	_, err = users.GetByField("email", "other@example.com")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+
+	user, err := users.GetByField("username", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, models.Admin, user.Role)
+
+	admins, err := users.GetByFilter(map[string]any{"role": models.Admin})
+	require.NoError(t, err)
+	assert.Len(t, admins, 1)
+
+	// A name is free again once its user is renamed
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alicia", Email: "alice@example.com"}))
+	require.NoError(t, users.Upsert(&models.User{ID: "u2", Username: "alice", Email: "other@example.com"}))
+}
+
+func TestBoltDb_TablesShareFileAndSurviveReopen(t *testing.T) {
+	rootPath := t.TempDir()
+	todos, err := Initialize[*models.Todo]("todos", rootPath)
+	require.NoError(t, err)
+	users, err := Initialize[*models.User]("users", rootPath)
+	require.NoError(t, err)
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "kept", UserId: "u1"}))
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, todos.Close())
+	require.NoError(t, users.Close())
+
+	// The index declared on reopening is built from the stored todos
+	reopened := openTodos(t, rootPath)
+	todo, err := reopened.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "kept", todo.Text)
+	userTodos, err := reopened.GetByFilter(map[string]any{"user_id": "u1"})
+	require.NoError(t, err)
+	assert.Len(t, userTodos, 1)
+	require.NoError(t, reopened.Close())
+
+	// An index that is no longer declared is dropped
+	plain, err := Initialize[*models.Todo]("todos", rootPath)
+	require.NoError(t, err)
+	defer plain.Close()
+	err = plain.file.bolt.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket(plain.indexBucket("user_id")))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestBoltDb_QueryMatchesInMemoryEvaluation(t *testing.T) {
+	todos := openTodos(t, t.TempDir())
+	all := []*models.Todo{
+		{Id: "t1", Text: "buy milk", UserId: "user1"},
+		{Id: "t2", Text: "buy bread", Done: true, UserId: "user1"},
+		{Id: "t3", Text: "walk dog", UserId: "user2"},
+		{Id: "t4", Text: "call mom", Done: true, UserId: "user2"},
+		{Id: "t5", Text: "Buy stamps", UserId: "user3"},
+		{Id: "t6", Text: "write report", UserId: "user3"},
+	}
+	for _, todo := range all {
+		require.NoError(t, todos.Upsert(todo))
+	}
+
+	queries := []db.Query{
+		{},
+		{Where: db.Where("user_id", db.Eq, "user1")},
+		{Where: db.And(db.Where("user_id", db.Eq, "user2"), db.Where("done", db.Eq, true))},
+		{Where: db.Where("done", db.Ne, true)},
+		{Where: db.Where("text", db.Prefix, "buy")},
+		{Where: db.Where("text", db.Contains, "o"), Limit: 2, Offset: 1},
+		{Where: db.Where("user_id", db.In, []string{"user2", "user3"}), OrderBy: []db.Order{{Field: "text", Desc: true}}},
+		{Where: db.Or(db.Where("user_id", db.Eq, "user3"), db.And(db.Where("done", db.Eq, true), db.Where("text", db.Lt, "c")))},
+		{OrderBy: []db.Order{{Field: "done"}, {Field: "user_id", Desc: true}}, Limit: 4, Offset: 1},
+	}
+	for i, query := range queries {
+		want, err := db.RunQuery(all, query)
+		require.NoError(t, err)
+		got, err := todos.Query(query)
+		require.NoError(t, err, "query %d", i)
+		assert.Equal(t, todoIds(want.Items), todoIds(got.Items), "query %d", i)
+		assert.Equal(t, want.NextCursor, got.NextCursor, "query %d", i)
+	}
+}
+
+func TestBoltDb_QueryCursorPagination(t *testing.T) {
+	todos := openTodos(t, t.TempDir())
+	for i := 0; i < 25; i++ {
+		require.NoError(t, todos.Upsert(&models.Todo{Id: fmt.Sprintf("t%02d", i), Text: fmt.Sprintf("item %d", i%7), Done: i%3 == 0, UserId: fmt.Sprintf("user%d", i%2)}))
+	}
+
+	queries := []db.Query{
+		{OrderBy: []db.Order{{Field: "done", Desc: true}, {Field: "text"}}, Limit: 4},
+		{Limit: 4},
+		{Where: db.Where("user_id", db.Eq, "user1"), Limit: 3},
+	}
+	for i, query := range queries {
+		seen := map[string]bool{}
+		for {
+			page, err := todos.Query(query)
+			require.NoError(t, err)
+			for _, todo := range page.Items {
+				assert.False(t, seen[todo.Id], "duplicate %s in query %d", todo.Id, i)
+				seen[todo.Id] = true
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.After = page.NextCursor
+		}
+		if query.Where == nil {
+			assert.Len(t, seen, 25, "query %d", i)
+		} else {
+			assert.Len(t, seen, 12, "query %d", i)
+		}
+	}
+}
+
+func todoIds(todos []*models.Todo) []string {
+	result := make([]string, len(todos))
+	for i, todo := range todos {
+		result[i] = todo.Id
+	}
+	return result
+}
+
+func TestBoltDb_Versions(t *testing.T) {
+	todos := openTodos(t, t.TempDir())
+
+	todo := &models.Todo{Id: "todo1", Text: "first"}
+	require.NoError(t, todos.Upsert(todo))
+	require.NoError(t, todos.Upsert(todo))
+	assert.Equal(t, int64(2), todo.Version)
+	assert.NotZero(t, todo.UpdatedAt)
+
+	stale := &models.Todo{Id: "todo1", Text: "stale"}
+	err := todos.UpsertIfVersion(stale, 1)
+	var conflict *db.VersionConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(2), conflict.Actual)
+	assert.Zero(t, stale.Version)
+
+	require.NoError(t, todos.UpsertIfVersion(&models.Todo{Id: "todo1", Text: "current"}, 2))
+	assert.ErrorIs(t, todos.UpsertIfVersion(&models.Todo{Id: "todo1"}, 0), db.ErrVersionConflict)
+	assert.ErrorIs(t, todos.UpsertIfVersion(&models.Todo{Id: "todo2"}, 4), db.ErrVersionConflict)
+	require.NoError(t, todos.UpsertIfVersion(&models.Todo{Id: "todo2", Text: "new"}, 0))
+
+	stored, err := todos.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "current", stored.Text)
+	assert.Equal(t, int64(3), stored.Version)
+}
+
+func TestBoltDb_Watch(t *testing.T) {
+	rootPath := t.TempDir()
+	todos := openTodos(t, rootPath, WithChangeHistory(3))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "first"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := todos.Watch(ctx, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "edited"}))
+	// A write through another table of the same file wakes the watcher up
+	other := openTodos(t, rootPath)
+	require.NoError(t, other.Purge("todo1"))
+
+	expected := []struct {
+		op     db.ChangeOp
+		before string
+		after  string
+	}{
+		{db.Insert, "", "first"},
+		{db.Update, "first", "edited"},
+		{db.Delete, "edited", ""},
+	}
+	for i, want := range expected {
+		select {
+		case event := <-sub.Events():
+			assert.Equal(t, uint64(i+1), event.Seq)
+			assert.Equal(t, want.op, event.Op)
+			assert.Equal(t, "todo1", event.ID)
+			if want.before != "" {
+				assert.Equal(t, want.before, event.Before.Text)
+			} else {
+				assert.Nil(t, event.Before)
+			}
+			if want.after != "" {
+				assert.Equal(t, want.after, event.After.Text)
+			} else {
+				assert.Nil(t, event.After)
+			}
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "no event received")
+		}
+	}
+
+	latest, err := todos.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), latest)
+
+	// Changes that fell out of the history cannot be resumed from
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo2", Text: "second"}))
+	_, err = todos.Watch(ctx, 0)
+	assert.ErrorIs(t, err, db.ErrChangesExpired)
+	_, err = todos.Watch(ctx, 1)
+	assert.NoError(t, err)
+}
+
+func TestBoltDb_SoftDelete(t *testing.T) {
+	todos := openTodos(t, t.TempDir())
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo2", Text: "second", UserId: "user1"}))
+
+	require.NoError(t, todos.Delete("todo1"))
+	// Deleting again is a no-op
+	require.NoError(t, todos.Delete("todo1"))
+	_, err := todos.GetByID("todo1")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	_, err = todos.GetByField("text", "first")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	filtered, err := todos.GetByFilter(map[string]any{"user_id": "user1"})
+	require.NoError(t, err)
+	assert.Len(t, filtered, 1)
+	page, err := todos.Query(db.Query{})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	page, err = todos.Query(db.Query{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+
+	require.NoError(t, todos.Restore("todo1"))
+	todo, err := todos.GetByID("todo1")
+	require.NoError(t, err)
+	assert.True(t, todo.GetDeletedAt().IsZero())
+	assert.Equal(t, int64(3), todo.Version)
+	assert.ErrorIs(t, todos.Restore("todo1"), db.ErrNotFound)
+
+	require.NoError(t, todos.Delete("todo1"))
+	require.NoError(t, todos.Delete("todo2"))
+	purged, err := todos.PurgeDeleted(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.ErrorIs(t, todos.Restore("todo1"), db.ErrNotFound)
+	page, err = todos.Query(db.Query{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+	userTodos, err := todos.GetByFilter(map[string]any{"user_id": "user1"})
+	require.NoError(t, err)
+	assert.Empty(t, userTodos)
+}
@@ -0,0 +1,115 @@
+package boltdb
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Changes are recorded in the <table>/changes bucket in the same transaction
+// as the write, keyed by their big endian sequence number so that they are
+// stored in order. Sequence numbers come from the bucket sequence, so they
+// are never reused. Each write drops the change that has fallen out of the
+// history.
+
+// maxFetchedChanges caps the number of changes read for a watcher at once
+const maxFetchedChanges = 256
+
+// change is a stored change event
+type change struct {
+	Op     db.ChangeOp     `json:"op"`
+	ID     string          `json:"id"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// record adds a change from the stored document before to after, either of
+// which is nil for inserts and deletes
+func (bdb *BoltDb[T]) record(tx *bolt.Tx, id string, before []byte, after []byte) error {
+	entry := change{ID: id, Before: before, After: after}
+	switch {
+	case before == nil:
+		entry.Op = db.Insert
+	case after == nil:
+		entry.Op = db.Delete
+	default:
+		entry.Op = db.Update
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	bucket := tx.Bucket(bdb.changesBucket())
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	if err := bucket.Put(seqKey(seq), data); err != nil {
+		return err
+	}
+	if seq > uint64(bdb.historySize) {
+		return bucket.Delete(seqKey(seq - uint64(bdb.historySize)))
+	}
+	return nil
+}
+
+// LatestSeq implements the db.Watchable interface
+func (bdb *BoltDb[T]) LatestSeq() (uint64, error) {
+	var seq uint64
+	err := bdb.file.bolt.View(func(tx *bolt.Tx) error {
+		seq = tx.Bucket(bdb.changesBucket()).Sequence()
+		return nil
+	})
+	return seq, err
+}
+
+// Watch implements the db.Watchable interface. Only one process can have the
+// file open, so every write goes through a table of this process and wakes
+// watchers up; there is nothing to poll for.
+func (bdb *BoltDb[T]) Watch(ctx context.Context, after uint64) (*db.Subscription[T], error) {
+	return db.Subscribe(ctx, after, bdb.changesAfter, &bdb.file.changed, 0)
+}
+
+// changesAfter returns the next changes after seq
+func (bdb *BoltDb[T]) changesAfter(after uint64) ([]db.ChangeEvent[T], error) {
+	events := []db.ChangeEvent[T]{}
+	err := bdb.file.bolt.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(bdb.changesBucket()).Cursor()
+		for key, data := cursor.Seek(seqKey(after + 1)); key != nil && len(events) < maxFetchedChanges; key, data = cursor.Next() {
+			var entry change
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			event := db.ChangeEvent[T]{Seq: binary.BigEndian.Uint64(key), Op: entry.Op, ID: entry.ID}
+			if entry.Before != nil {
+				if err := json.Unmarshal(entry.Before, &event.Before); err != nil {
+					return err
+				}
+			}
+			if entry.After != nil {
+				if err := json.Unmarshal(entry.After, &event.After); err != nil {
+					return err
+				}
+			}
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(events) > 0 && events[0].Seq > after+1 {
+		// Everything up to events[0] was pruned
+		return nil, db.ErrChangesExpired
+	}
+	return events, nil
+}
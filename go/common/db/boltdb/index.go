@@ -0,0 +1,127 @@
+package boltdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+	bolt "go.etcd.io/bbolt"
+)
+
+// An index entry is the JSON encoding of the normalized field value, a zero
+// byte and the id, with no value. JSON escapes zero bytes inside strings, so
+// the entries for a value are exactly those starting with its prefix. Items
+// in the trash stay indexed, so they keep their unique values until purged.
+
+// valuePrefix returns the prefix of the index entries for value
+func valuePrefix(value any) ([]byte, error) {
+	encoded, err := json.Marshal(db.Normalize(value))
+	if err != nil {
+		return nil, err
+	}
+	return append(encoded, 0), nil
+}
+
+// indexKey returns the index entry of item for field
+func indexKey(item common.Serializable, field string, id string) ([]byte, error) {
+	value, err := common.GetField(item, field)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := valuePrefix(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, id...), nil
+}
+
+// checkUnique returns db.ErrUniqueViolation if an item other than id already
+// has the value of key
+func checkUnique(bucket *bolt.Bucket, field string, key []byte, id string) error {
+	prefix := key[:bytes.IndexByte(key, 0)+1]
+	cursor := bucket.Cursor()
+	for entry, _ := cursor.Seek(prefix); entry != nil && bytes.HasPrefix(entry, prefix); entry, _ = cursor.Next() {
+		if string(entry[len(prefix):]) != id {
+			return fmt.Errorf("%w: %s %s is already taken", db.ErrUniqueViolation, field, prefix[:len(prefix)-1])
+		}
+	}
+	return nil
+}
+
+// reindex moves the index entries of id from before to after. Either may be
+// nil for inserts and deletes.
+func (bdb *BoltDb[T]) reindex(tx *bolt.Tx, id string, before *T, after *T) error {
+	for _, spec := range bdb.indexes {
+		bucket := tx.Bucket(bdb.indexBucket(spec.field))
+		var oldKey, newKey []byte
+		var err error
+		if before != nil {
+			if oldKey, err = indexKey(*before, spec.field, id); err != nil {
+				return err
+			}
+		}
+		if after != nil {
+			if newKey, err = indexKey(*after, spec.field, id); err != nil {
+				return err
+			}
+		}
+		if bytes.Equal(oldKey, newKey) {
+			continue
+		}
+		if newKey != nil && spec.unique {
+			if err := checkUnique(bucket, spec.field, newKey, id); err != nil {
+				return err
+			}
+		}
+		if oldKey != nil {
+			if err := bucket.Delete(oldKey); err != nil {
+				return err
+			}
+		}
+		if newKey != nil {
+			if err := bucket.Put(newKey, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// candidates returns the ids, in order, of the items that may have the
+// values of equalities according to the most selective index on one of their
+// fields. narrowed is false if none of the fields is indexed.
+func (bdb *BoltDb[T]) candidates(tx *bolt.Tx, equalities map[string]any) (ids []string, narrowed bool, err error) {
+	for _, spec := range bdb.indexes {
+		value, ok := equalities[spec.field]
+		if !ok {
+			continue
+		}
+		prefix, err := valuePrefix(value)
+		if err != nil {
+			return nil, false, err
+		}
+		set := map[string]struct{}{}
+		cursor := tx.Bucket(bdb.indexBucket(spec.field)).Cursor()
+		for entry, _ := cursor.Seek(prefix); entry != nil && bytes.HasPrefix(entry, prefix); entry, _ = cursor.Next() {
+			set[string(entry[len(prefix):])] = struct{}{}
+		}
+		if !narrowed || len(set) < len(ids) {
+			ids = sortedIDs(set)
+			narrowed = true
+		}
+	}
+	return ids, narrowed, nil
+}
+
+// sortedIDs returns the ids of a set in order
+func sortedIDs(set map[string]struct{}) []string {
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// ChangeOp is the kind of write a change event records
+type ChangeOp string
+
+const (
+	Insert ChangeOp = "insert"
+	Update ChangeOp = "update"
+	Delete ChangeOp = "delete"
+)
+
+// DefaultChangeHistory is the number of recent changes a driver keeps for
+// watchers to resume from
+const DefaultChangeHistory = 10000
+
+// ErrChangesExpired is returned when a watcher asks for changes older than
+// the driver still keeps. The watcher has to read the table again and watch
+// from LatestSeq.
+var ErrChangesExpired = errors.New("changes are no longer available")
+
+// ChangeEvent is a single write to a table. Sequence numbers start at 1 and
+// increase by one with every change to the table. Before is the zero value
+// for inserts and After is the zero value for deletes.
+type ChangeEvent[T common.Serializable] struct {
+	Seq    uint64
+	Op     ChangeOp
+	ID     string
+	Before T
+	After  T
+}
+
+// Watchable is implemented by drivers that can stream their changes.
+//
+// To follow a table without missing a change, take LatestSeq, read the data,
+// then Watch from that sequence number. Changes made while reading are
+// delivered again, so applying them has to be idempotent, which is the case
+// when applying the After image (or a delete) by ID.
+type Watchable[T common.Serializable] interface {
+	// LatestSeq returns the sequence number of the last change, 0 if there
+	// has been none
+	LatestSeq() (uint64, error)
+	// Watch streams the changes after seq in order until ctx is done
+	Watch(ctx context.Context, after uint64) (*Subscription[T], error)
+}
+
+// Subscription delivers the changes of a table in order. Events is closed
+// when the context of the subscription is done or the subscription fails;
+// Err tells which.
+type Subscription[T common.Serializable] struct {
+	events chan ChangeEvent[T]
+	err    error
+}
+
+// Events returns the channel the changes are delivered on
+func (s *Subscription[T]) Events() <-chan ChangeEvent[T] {
+	return s.events
+}
+
+// Err returns why the subscription ended. It must only be called once Events
+// is closed.
+func (s *Subscription[T]) Err() error {
+	return s.err
+}
+
+// ChangeFetcher returns the changes after seq in order, possibly only the
+// first few of them. It returns ErrChangesExpired if changes right after seq
+// are no longer available.
+type ChangeFetcher[T common.Serializable] func(after uint64) ([]ChangeEvent[T], error)
+
+// Subscribe starts a subscription to the changes after seq. Drivers
+// implement Watch with it: fetch reads the changes, changed is notified
+// whenever there may be new ones and, if pollInterval is set, fetch is also
+// retried that often for changes made by other processes.
+func Subscribe[T common.Serializable](ctx context.Context, after uint64, fetch ChangeFetcher[T], changed *Broadcast, pollInterval time.Duration) (*Subscription[T], error) {
+	wake := changed.Wait()
+	events, err := fetch(after)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &Subscription[T]{events: make(chan ChangeEvent[T])}
+	go func() {
+		defer close(sub.events)
+		var poll <-chan time.Time
+		if pollInterval > 0 {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+		for {
+			for _, event := range events {
+				select {
+				case sub.events <- event:
+					after = event.Seq
+				case <-ctx.Done():
+					sub.err = ctx.Err()
+					return
+				}
+			}
+			if len(events) == 0 {
+				select {
+				case <-wake:
+				case <-poll:
+				case <-ctx.Done():
+					sub.err = ctx.Err()
+					return
+				}
+			}
+			wake = changed.Wait()
+			if events, err = fetch(after); err != nil {
+				sub.err = err
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// Broadcast wakes up every goroutine waiting for the next change. The zero
+// value is ready to use.
+type Broadcast struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// Wait returns a channel that is closed at the next Notify
+func (b *Broadcast) Wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch == nil {
+		b.ch = make(chan struct{})
+	}
+	return b.ch
+}
+
+// Notify wakes up everyone waiting
+func (b *Broadcast) Notify() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ch != nil {
+		close(b.ch)
+		b.ch = nil
+	}
+}
@@ -4,9 +4,27 @@ import "github.com/Hanasou/news_feed/go/common"
 
 type DbDriver[T common.Serializable] interface {
 	Upsert(T) error
+	// UpsertIfVersion writes item only if the stored item is at version and
+	// fails with a VersionConflictError otherwise. Missing items and items
+	// that are not Versioned are at version 0.
+	UpsertIfVersion(item T, version int64) error
 	GetAll() ([]T, error)
 	GetByID(id string) (T, error)
+	// Delete moves SoftDeletable items to the trash and removes other
+	// items permanently
 	Delete(id string) error
+	// Restore takes an item out of the trash
+	Restore(id string) error
+	// Purge permanently removes an item, whether it is in the trash or not
+	Purge(id string) error
 	GetByField(field string, value any) (T, error)
 	GetByFilter(filters map[string]any) ([]T, error)
+	Query(query Query) (*Page[T], error)
+}
+
+// Transaction groups writes to one or more tables so that they take effect
+// together or not at all
+type Transaction interface {
+	Commit() error
+	Rollback() error
 }
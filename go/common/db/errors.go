@@ -0,0 +1,14 @@
+package db
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when no item matches a lookup
+	ErrNotFound = errors.New("item not found")
+	// ErrUniqueViolation is returned when a write would give two items the
+	// same value for a field that has to be unique
+	ErrUniqueViolation = errors.New("unique index violation")
+	// ErrTxDone is returned when a transaction is used after it was
+	// committed or rolled back
+	ErrTxDone = errors.New("transaction has already been committed or rolled back")
+)
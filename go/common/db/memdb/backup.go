@@ -0,0 +1,663 @@
+package memdb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// A backup is a gzipped tar archive holding a manifest.json followed by one
+// compacted log per table, stored as <dir>/<table>.log where dir is the base
+// name of the directory the table was backed up from. The manifest lists the
+// tables with the size and SHA-256 checksum of their log.
+//
+// Backups are taken from the table logs on disk, so they can be taken while
+// the services using the tables are running. Each table is read as of a
+// single point in its log, and committed transactions that a table has not
+// logged yet are taken from the transaction log of its directory, so a
+// transaction is either in the backup of every table it wrote to or in none.
+//
+// Restoring replaces the table logs of a directory and must only be done while
+// no service has the tables open.
+
+const (
+	manifestFileName = "manifest.json"
+	// backupFormatVersion is the version of the archive layout written by
+	// this code. Archives with a newer version are refused.
+	backupFormatVersion = 1
+	// maxSnapshotAttempts bounds how often a snapshot is retried because
+	// the transaction log was compacted while it was taken
+	maxSnapshotAttempts = 5
+)
+
+// ErrInvalidArchive is returned when a backup archive does not match its
+// manifest
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// Manifest describes the contents of a backup archive
+type Manifest struct {
+	FormatVersion int             `json:"format_version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	Tables        []ManifestTable `json:"tables"`
+}
+
+// ManifestTable describes the backup of a single table
+type ManifestTable struct {
+	Dir   string `json:"dir"`
+	Name  string `json:"name"`
+	File  string `json:"file"`
+	Codec string `json:"codec"`
+	Items int    `json:"items"`
+	// Seq is the sequence number of the last change to the table and LastTx
+	// the id of the last transaction applied to it
+	Seq    uint64 `json:"seq"`
+	LastTx uint64 `json:"last_tx"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// tableImage is a table as read from its log, with its items still encoded
+type tableImage struct {
+	name   string
+	codec  Codec
+	seq    uint64
+	lastTx uint64
+	items  map[string]imageItem
+}
+
+type imageItem struct {
+	data []byte
+	time int64
+}
+
+func newTableImage(name string) *tableImage {
+	return &tableImage{name: name, codec: JSONCodec, items: map[string]imageItem{}}
+}
+
+// apply applies a record of the table log, as MemDb.applyRecord does
+func (image *tableImage) apply(record *logRecord) error {
+	switch record.Op {
+	case opUpsert, opDelete:
+		image.applyWrite(txWrite{Op: record.Op, ID: record.ID, Data: record.Data, Time: record.Time})
+		image.seq = max(image.seq, record.Seq)
+	case opTx:
+		for _, write := range record.Writes {
+			image.applyWrite(write)
+		}
+		image.seq = max(image.seq, record.Seq)
+		image.lastTx = record.Tx
+	case opCheckpoint:
+		image.seq = record.Seq
+		image.lastTx = record.Tx
+	default:
+		return fmt.Errorf("unknown log operation %q", record.Op)
+	}
+	return nil
+}
+
+func (image *tableImage) applyWrite(write txWrite) {
+	if write.Op == opDelete {
+		delete(image.items, write.ID)
+		return
+	}
+	image.items[write.ID] = imageItem{data: write.Data, time: write.Time}
+}
+
+// catchUp applies the committed transactions the table has not logged yet
+func (image *tableImage) catchUp(commits []*logRecord) {
+	for _, commit := range commits {
+		if commit.Seq <= image.lastTx {
+			continue
+		}
+		applied := false
+		for _, write := range commit.Writes {
+			if write.Table != image.name {
+				continue
+			}
+			image.applyWrite(write)
+			image.seq++
+			applied = true
+		}
+		if applied {
+			image.lastTx = commit.Seq
+		}
+	}
+}
+
+// ids returns the ids of the items in order
+func (image *tableImage) ids() []string {
+	ids := make([]string, 0, len(image.items))
+	for id := range image.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// encode returns the table as a compacted log in the current format
+func (image *tableImage) encode() ([]byte, error) {
+	header, err := encodeHeader(image.codec)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(header)
+	records := []*logRecord{{Seq: image.seq, Op: opCheckpoint, Tx: image.lastTx}}
+	for _, id := range image.ids() {
+		item := image.items[id]
+		records = append(records, &logRecord{Op: opUpsert, ID: id, Data: item.data, Time: item.time})
+	}
+	for _, record := range records {
+		frame, err := encodeRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(frame)
+	}
+	return buf.Bytes(), nil
+}
+
+// readTableLog reads the table log at path without modifying it
+func readTableLog(name string, path string) (*tableImage, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	image := newTableImage(name)
+	codec, _, err := readLog(file, image.apply)
+	if err != nil {
+		return nil, err
+	}
+	image.codec = codec
+	return image, nil
+}
+
+// snapshotDir reads every table log under rootPath, along with the
+// transactions they have not logged yet
+func snapshotDir(rootPath string) ([]*tableImage, error) {
+	txLogPath := filepath.Join(rootPath, txLogFileName)
+	for attempt := 1; ; attempt++ {
+		before, statErr := os.Stat(txLogPath)
+		if statErr != nil && !errors.Is(statErr, os.ErrNotExist) {
+			return nil, statErr
+		}
+		images, err := readTables(rootPath)
+		if err != nil {
+			return nil, err
+		}
+		if statErr != nil {
+			return images, nil
+		}
+
+		// The transaction log is read after the tables, so it holds every
+		// transaction they have seen. Transactions every table had applied
+		// may have been dropped from it in the meantime though; if it was
+		// compacted, start over.
+		file, err := os.Open(txLogPath)
+		if err != nil {
+			return nil, err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		if !os.SameFile(before, info) {
+			file.Close()
+			if attempt == maxSnapshotAttempts {
+				return nil, fmt.Errorf("transaction log %s kept changing while taking a snapshot", txLogPath)
+			}
+			continue
+		}
+		commits := []*logRecord{}
+		_, _, err = readLog(file, func(record *logRecord) error {
+			if record.Op == opCommit {
+				commits = append(commits, record)
+			}
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			image.catchUp(commits)
+		}
+		return images, nil
+	}
+}
+
+// readTables reads every table log under rootPath
+func readTables(rootPath string) ([]*tableImage, error) {
+	paths, err := filepath.Glob(filepath.Join(rootPath, "*"+logFileExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	images := []*tableImage{}
+	for _, logPath := range paths {
+		if filepath.Base(logPath) == txLogFileName {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(logPath), logFileExtension)
+		image, err := readTableLog(name, logPath)
+		if err != nil {
+			log.Printf("Could not read log %s: %v", logPath, err)
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// Backup writes a backup of every table under each of rootPaths to w and
+// returns its manifest. The base names of rootPaths must be unique.
+func Backup(w io.Writer, rootPaths ...string) (*Manifest, error) {
+	manifest := &Manifest{FormatVersion: backupFormatVersion, CreatedAt: time.Now().UTC(), Tables: []ManifestTable{}}
+	files := map[string][]byte{}
+	dirs := map[string]bool{}
+	for _, rootPath := range rootPaths {
+		dir := filepath.Base(filepath.Clean(rootPath))
+		if dirs[dir] {
+			return nil, fmt.Errorf("more than one directory named %s", dir)
+		}
+		dirs[dir] = true
+
+		images, err := snapshotDir(rootPath)
+		if err != nil {
+			log.Printf("Could not take snapshot of %s: %v", rootPath, err)
+			return nil, err
+		}
+		for _, image := range images {
+			data, err := image.encode()
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(data)
+			table := ManifestTable{
+				Dir:    dir,
+				Name:   image.name,
+				File:   path.Join(dir, image.name+logFileExtension),
+				Codec:  image.codec.Name(),
+				Items:  len(image.items),
+				Seq:    image.seq,
+				LastTx: image.lastTx,
+				Size:   int64(len(data)),
+				SHA256: hex.EncodeToString(sum[:]),
+			}
+			files[table.File] = data
+			manifest.Tables = append(manifest.Tables, table)
+		}
+	}
+
+	if err := writeArchive(w, manifest, files); err != nil {
+		log.Printf("Could not write backup archive: %v", err)
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeArchive(w io.Writer, manifest *Manifest, files map[string][]byte) error {
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := archive.Write(data)
+		return err
+	}
+	if err := add(manifestFileName, manifestData); err != nil {
+		return err
+	}
+	for _, table := range manifest.Tables {
+		if err := add(table.File, files[table.File]); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Archive is a backup archive that has been checked against its manifest
+type Archive struct {
+	Manifest Manifest
+	files    map[string][]byte
+	images   map[string]*tableImage
+}
+
+// ReadArchive reads a backup archive and checks that every table in it
+// matches the manifest
+func ReadArchive(r io.Reader) (*Archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+	reader := tar.NewReader(gz)
+	files := map[string][]byte{}
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		files[header.Name] = data
+	}
+
+	archive := &Archive{files: files, images: map[string]*tableImage{}}
+	manifestData, ok := files[manifestFileName]
+	if !ok {
+		return nil, fmt.Errorf("%w: no %s", ErrInvalidArchive, manifestFileName)
+	}
+	if err := json.Unmarshal(manifestData, &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, manifestFileName, err)
+	}
+	if archive.Manifest.FormatVersion > backupFormatVersion {
+		return nil, fmt.Errorf("backup format version %d is newer than the supported version %d",
+			archive.Manifest.FormatVersion, backupFormatVersion)
+	}
+	if len(files) != len(archive.Manifest.Tables)+1 {
+		return nil, fmt.Errorf("%w: holds files that are not in the manifest", ErrInvalidArchive)
+	}
+	for _, table := range archive.Manifest.Tables {
+		image, err := checkTable(table, files[table.File])
+		if err != nil {
+			return nil, fmt.Errorf("%w: table %s: %v", ErrInvalidArchive, table.File, err)
+		}
+		archive.images[table.File] = image
+	}
+	return archive, nil
+}
+
+// checkTable checks the log of a table against its manifest entry and
+// returns its contents
+func checkTable(table ManifestTable, data []byte) (*tableImage, error) {
+	if table.File != path.Join(table.Dir, table.Name+logFileExtension) {
+		return nil, fmt.Errorf("unexpected file name")
+	}
+	if data == nil {
+		return nil, fmt.Errorf("missing")
+	}
+	if int64(len(data)) != table.Size {
+		return nil, fmt.Errorf("size is %d, expected %d", len(data), table.Size)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != table.SHA256 {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+	image := newTableImage(table.Name)
+	codec, complete, err := readLog(bytes.NewReader(data), image.apply)
+	if err != nil {
+		return nil, err
+	}
+	image.codec = codec
+	switch {
+	case !complete:
+		return nil, fmt.Errorf("log is corrupt")
+	case codec.Name() != table.Codec:
+		return nil, fmt.Errorf("codec is %s, expected %s", codec.Name(), table.Codec)
+	case len(image.items) != table.Items:
+		return nil, fmt.Errorf("holds %d items, expected %d", len(image.items), table.Items)
+	case image.seq != table.Seq || image.lastTx != table.LastTx:
+		return nil, fmt.Errorf("log position does not match the manifest")
+	}
+	return image, nil
+}
+
+// Restore replaces the tables under each of rootPaths with the tables the
+// archive holds for the directory of the same base name. Other tables under
+// rootPaths are left as they are. No service may have the tables open.
+func (archive *Archive) Restore(rootPaths ...string) error {
+	byDir := map[string][]ManifestTable{}
+	for _, table := range archive.Manifest.Tables {
+		byDir[table.Dir] = append(byDir[table.Dir], table)
+	}
+	for _, rootPath := range rootPaths {
+		dir := filepath.Base(filepath.Clean(rootPath))
+		if len(byDir[dir]) == 0 {
+			return fmt.Errorf("backup has no tables for directory %s", dir)
+		}
+	}
+	for _, rootPath := range rootPaths {
+		dir := filepath.Base(filepath.Clean(rootPath))
+		if err := archive.restoreDir(rootPath, byDir[dir]); err != nil {
+			log.Printf("Could not restore %s: %v", rootPath, err)
+			return err
+		}
+		log.Printf("Restored %d tables into %s", len(byDir[dir]), rootPath)
+	}
+	return nil
+}
+
+func (archive *Archive) restoreDir(rootPath string, tables []ManifestTable) error {
+	if err := os.MkdirAll(rootPath, 0755); err != nil {
+		return err
+	}
+
+	// Transactions already in the transaction log must not be applied to
+	// the restored tables, but transaction ids must keep increasing
+	txLogPath := filepath.Join(rootPath, txLogFileName)
+	var lastTx uint64
+	for _, table := range tables {
+		lastTx = max(lastTx, table.LastTx)
+	}
+	_, statErr := os.Stat(txLogPath)
+	if statErr == nil {
+		file, err := os.Open(txLogPath)
+		if err != nil {
+			return err
+		}
+		_, _, err = readLog(file, func(record *logRecord) error {
+			lastTx = max(lastTx, record.Seq)
+			return nil
+		})
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Write everything next to where it goes first, then move it in place
+	staged := [][2]string{}
+	cleanup := func() {
+		for _, files := range staged {
+			os.Remove(files[0])
+		}
+	}
+	stage := func(finalPath string, data []byte) error {
+		tmpPath := finalPath + ".restore"
+		staged = append(staged, [2]string{tmpPath, finalPath})
+		return writeFileSync(tmpPath, data)
+	}
+	if statErr == nil || lastTx > 0 {
+		// A transaction log holding nothing but a checkpoint at lastTx
+		txLog, err := (&tableImage{codec: JSONCodec, seq: lastTx}).encode()
+		if err != nil {
+			return err
+		}
+		if err := stage(txLogPath, txLog); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	for _, table := range tables {
+		if err := stage(filepath.Join(rootPath, table.Name+logFileExtension), archive.files[table.File]); err != nil {
+			cleanup()
+			return err
+		}
+	}
+	for i, files := range staged {
+		if err := os.Rename(files[0], files[1]); err != nil {
+			for _, rest := range staged[i:] {
+				os.Remove(rest[0])
+			}
+			return err
+		}
+	}
+	syncDir(rootPath)
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// image returns the contents of a table of the archive, named either
+// <dir>/<table> or just <table> if no other directory has a table by that
+// name
+func (archive *Archive) image(name string) (*tableImage, error) {
+	if image, ok := archive.images[name+logFileExtension]; ok {
+		return image, nil
+	}
+	var found *tableImage
+	for _, table := range archive.Manifest.Tables {
+		if table.Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("more than one table named %s, use <dir>/%s", name, name)
+		}
+		found = archive.images[table.File]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("backup has no table %s", name)
+	}
+	return found, nil
+}
+
+// ExportFormat is a format tables can be exported in
+type ExportFormat string
+
+const (
+	// ExportNDJSON writes one JSON object per item and line
+	ExportNDJSON ExportFormat = "ndjson"
+	// ExportCSV writes a header row with the field names followed by one
+	// row per item. Fields that are not strings, numbers or booleans are
+	// written as JSON.
+	ExportCSV ExportFormat = "csv"
+)
+
+// Export writes the items of a table of the archive to w in the given
+// format, ordered by id. Items in the trash are included.
+func Export[T common.Serializable](archive *Archive, table string, format ExportFormat, w io.Writer) error {
+	image, err := archive.image(table)
+	if err != nil {
+		return err
+	}
+	items := make([]T, 0, len(image.items))
+	for _, id := range image.ids() {
+		var item T
+		if err := image.codec.Unmarshal(image.items[id].data, &item); err != nil {
+			log.Printf("Error decoding record %s of table %s: %v", id, table, err)
+			return err
+		}
+		items = append(items, item)
+	}
+
+	switch format {
+	case ExportNDJSON:
+		encoder := json.NewEncoder(w)
+		for _, item := range items {
+			if err := encoder.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ExportCSV:
+		return exportCSV(items, w)
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func exportCSV[T common.Serializable](items []T, w io.Writer) error {
+	fields := common.FieldNames[T]()
+	writer := csv.NewWriter(w)
+	if err := writer.Write(fields); err != nil {
+		return err
+	}
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		// Numbers are kept as written, so large integers do not lose
+		// precision
+		values := map[string]any{}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return err
+		}
+		row := make([]string, len(fields))
+		for i, field := range fields {
+			if row[i], err = csvValue(values[field]); err != nil {
+				return err
+			}
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvValue(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	default:
+		data, err := json.Marshal(value)
+		return string(data), err
+	}
+}
@@ -0,0 +1,210 @@
+package memdb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tableDir creates a directory for tables with the given base name
+func tableDir(t *testing.T, name string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.Mkdir(dir, 0755))
+	return dir
+}
+
+func backup(t *testing.T, rootPaths ...string) ([]byte, *Manifest) {
+	t.Helper()
+	var buf bytes.Buffer
+	manifest, err := Backup(&buf, rootPaths...)
+	require.NoError(t, err)
+	return buf.Bytes(), manifest
+}
+
+// rewriteArchive changes the files of an archive without updating the
+// manifest
+func rewriteArchive(t *testing.T, data []byte, change func(name string, content []byte) []byte) []byte {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	reader := tar.NewReader(gz)
+	var buf bytes.Buffer
+	out := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(out)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		content = change(header.Name, content)
+		header.Size = int64(len(content))
+		require.NoError(t, writer.WriteHeader(header))
+		_, err = writer.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, out.Close())
+	return buf.Bytes()
+}
+
+func TestBackup_RestoresEveryTable(t *testing.T) {
+	userRoot := tableDir(t, "user_db")
+	f := openTxFixture(t, userRoot)
+	tx, users, todos := f.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1", Text: "welcome", UserId: "u1"}))
+	require.NoError(t, tx.Commit())
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t2", Text: "second", UserId: "u1"}))
+	todoRoot := tableDir(t, "todo_db")
+	protoTodos := openProtoTodos(t, todoRoot)
+	require.NoError(t, protoTodos.Upsert(&models.Todo{Id: "p1", Text: "stored as proto"}))
+
+	// The tables stay open while the backup is taken
+	archiveData, manifest := backup(t, userRoot, todoRoot)
+	require.Len(t, manifest.Tables, 3)
+	assert.Equal(t, "user_db/todos.log", manifest.Tables[0].File)
+	assert.Equal(t, 2, manifest.Tables[0].Items)
+	assert.Equal(t, uint64(1), manifest.Tables[0].LastTx)
+	assert.Equal(t, "proto", manifest.Tables[2].Codec)
+
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t3", Text: "after the backup"}))
+	f.close()
+	require.NoError(t, protoTodos.Close())
+
+	archive, err := ReadArchive(bytes.NewReader(archiveData))
+	require.NoError(t, err)
+	require.NoError(t, archive.Restore(userRoot, todoRoot))
+
+	restored := openTxFixture(t, userRoot)
+	all, err := restored.todos.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	_, err = restored.todos.GetByID("t3")
+	assert.Error(t, err)
+	latest, err := restored.todos.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Tables[0].Seq, latest)
+	user, err := restored.users.GetByField("username", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", user.ID)
+
+	// Transactions committed after the restore are not mistaken for ones
+	// the tables already applied
+	tx, users, _ = restored.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u2", Username: "bob"}))
+	require.NoError(t, tx.Commit())
+	restored.close()
+	reopened := openTxFixture(t, userRoot)
+	_, err = reopened.users.GetByID("u2")
+	assert.NoError(t, err)
+
+	todo, err := openProtoTodos(t, todoRoot).GetByID("p1")
+	require.NoError(t, err)
+	assert.Equal(t, "stored as proto", todo.Text)
+}
+
+func TestBackup_IncludesTransactionsMissingFromTableLog(t *testing.T) {
+	rootPath := tableDir(t, "db")
+	f := openTxFixture(t, rootPath)
+	todoLog := filepath.Join(rootPath, "todos"+logFileExtension)
+	before, err := os.Stat(todoLog)
+	require.NoError(t, err)
+	tx, users, todos := f.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1", UserId: "u1"}))
+	require.NoError(t, tx.Commit())
+	f.close()
+	// The todos table has not logged the transaction yet
+	require.NoError(t, os.Truncate(todoLog, before.Size()))
+
+	_, manifest := backup(t, rootPath)
+	require.Len(t, manifest.Tables, 2)
+	for _, table := range manifest.Tables {
+		assert.Equal(t, 1, table.Items, table.Name)
+		assert.Equal(t, uint64(1), table.LastTx, table.Name)
+	}
+}
+
+func TestBackup_ReadArchiveRejectsDamagedTables(t *testing.T) {
+	rootPath := tableDir(t, "db")
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "t1", Text: "hello"}))
+	archiveData, _ := backup(t, rootPath)
+
+	damaged := rewriteArchive(t, archiveData, func(name string, content []byte) []byte {
+		if name == "db/todos.log" {
+			content[len(content)-2] ^= 0xff
+		}
+		return content
+	})
+	_, err := ReadArchive(bytes.NewReader(damaged))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+	assert.ErrorContains(t, err, "checksum")
+
+	newer := rewriteArchive(t, archiveData, func(name string, content []byte) []byte {
+		if name == manifestFileName {
+			return bytes.Replace(content, []byte(`"format_version": 1`), []byte(`"format_version": 2`), 1)
+		}
+		return content
+	})
+	_, err = ReadArchive(bytes.NewReader(newer))
+	assert.ErrorContains(t, err, "newer")
+
+	_, err = ReadArchive(strings.NewReader("not an archive"))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+
+	archive, err := ReadArchive(bytes.NewReader(archiveData))
+	require.NoError(t, err)
+	assert.ErrorContains(t, archive.Restore(filepath.Join(t.TempDir(), "other")), "no tables")
+}
+
+func TestBackup_Export(t *testing.T) {
+	rootPath := tableDir(t, "db")
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "t2", Text: "with, comma", UserId: "u1"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "t1", Text: "first", Done: true, UserId: "u1"}))
+	archiveData, _ := backup(t, rootPath)
+	archive, err := ReadArchive(bytes.NewReader(archiveData))
+	require.NoError(t, err)
+
+	var ndjson bytes.Buffer
+	require.NoError(t, Export[*models.Todo](archive, "todos", ExportNDJSON, &ndjson))
+	lines := strings.Split(strings.TrimSpace(ndjson.String()), "\n")
+	require.Len(t, lines, 2)
+	todo := &models.Todo{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), todo))
+	assert.Equal(t, "t1", todo.Id)
+	assert.True(t, todo.Done)
+
+	var out bytes.Buffer
+	require.NoError(t, Export[*models.Todo](archive, "db/todos", ExportCSV, &out))
+	rows, err := csv.NewReader(&out).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	header := map[string]int{}
+	for i, field := range rows[0] {
+		header[field] = i
+	}
+	assert.Equal(t, "t1", rows[1][header["id"]])
+	assert.Equal(t, "true", rows[1][header["done"]])
+	assert.Equal(t, "1", rows[1][header["version"]])
+	assert.Equal(t, "with, comma", rows[2][header["text"]])
+
+	assert.Error(t, Export[*models.Todo](archive, "users", ExportCSV, &out))
+	assert.Error(t, Export[*models.Todo](archive, "todos", "xml", &out))
+}
@@ -0,0 +1,133 @@
+package memdb
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// Every write to a table is a change with its own sequence number. The
+// sequence numbers are those of the table log, so they keep increasing across
+// restarts. The most recent changes are kept in memory, including the ones
+// replayed from the log at startup, for watchers to catch up from.
+
+// maxFetchedChanges caps the number of changes decoded for a watcher at once
+const maxFetchedChanges = 256
+
+// change is a change kept in the history. Items are kept encoded so every
+// watcher decodes its own copy.
+type change struct {
+	seq    uint64
+	op     db.ChangeOp
+	id     string
+	before []byte
+	after  []byte
+}
+
+// WithChangeHistory sets how many recent changes are kept for watchers to
+// resume from. The default is db.DefaultChangeHistory; 0 disables watching.
+func WithChangeHistory(size int) Option {
+	return func(o *options) {
+		o.changeHistory = size
+	}
+}
+
+// publish records the write of after, nil for a delete, to the item with the
+// given id as change seq and wakes up watchers. It has to be called before
+// the write is applied, while the item still holds its old value. Changes
+// that are not newer than the last one are ignored. The caller must hold the
+// write lock.
+func (db *MemDb[T]) publish(seq uint64, id string, after []byte) {
+	if seq <= db.seq {
+		return
+	}
+	db.seq = seq
+	defer db.changed.Notify()
+	if db.historySize <= 0 {
+		return
+	}
+
+	c := change{seq: seq, op: changeInsert, id: id, after: after}
+	if before, exists := db.Data[id]; exists {
+		data, err := json.Marshal(before)
+		if err != nil {
+			log.Printf("Error marshalling item to JSON: %v", err)
+		}
+		c.before = data
+		c.op = changeUpdate
+	}
+	if after == nil {
+		c.op = changeDelete
+	}
+	db.history = append(db.history, c)
+	// Trim now and then rather than on every write
+	if len(db.history) >= 2*db.historySize {
+		db.history = append([]change(nil), db.history[len(db.history)-db.historySize:]...)
+	}
+}
+
+// LatestSeq implements the db.Watchable interface
+func (db *MemDb[T]) LatestSeq() (uint64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.seq, nil
+}
+
+// Watch implements the db.Watchable interface
+func (db *MemDb[T]) Watch(ctx context.Context, after uint64) (*db.Subscription[T], error) {
+	return subscribe(ctx, after, db.changesAfter, &db.changed)
+}
+
+// changesAfter returns the next changes after seq from the history
+func (db *MemDb[T]) changesAfter(after uint64) ([]db.ChangeEvent[T], error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if after >= db.seq {
+		return nil, nil
+	}
+	start := sort.Search(len(db.history), func(i int) bool {
+		return db.history[i].seq > after
+	})
+	if start == len(db.history) || (start == 0 && db.history[0].seq > after+1) {
+		return nil, errChangesExpired
+	}
+	end := min(start+maxFetchedChanges, len(db.history))
+	return decodeChanges[T](db.history[start:end])
+}
+
+func decodeChanges[T common.Serializable](changes []change) ([]db.ChangeEvent[T], error) {
+	events := make([]db.ChangeEvent[T], 0, len(changes))
+	for _, c := range changes {
+		event := db.ChangeEvent[T]{Seq: c.seq, Op: c.op, ID: c.id}
+		if c.before != nil {
+			if err := json.Unmarshal(c.before, &event.Before); err != nil {
+				return nil, err
+			}
+		}
+		if c.after != nil {
+			if err := json.Unmarshal(c.after, &event.After); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// These let MemDb methods, whose receiver shadows the db package, use the
+// change helpers of the db package
+var (
+	changeInsert      = db.Insert
+	changeUpdate      = db.Update
+	changeDelete      = db.Delete
+	errChangesExpired = db.ErrChangesExpired
+)
+
+func subscribe[T common.Serializable](ctx context.Context, after uint64, fetch db.ChangeFetcher[T], changed *db.Broadcast) (*db.Subscription[T], error) {
+	return db.Subscribe(ctx, after, fetch, changed, 0)
+}
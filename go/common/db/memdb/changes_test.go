@@ -0,0 +1,148 @@
+package memdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	dbpkg "github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func nextEvent[T any](t *testing.T, events <-chan T) T {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		require.True(t, ok, "subscription ended")
+		return event
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no event received")
+	}
+	panic("unreachable")
+}
+
+func TestMemDb_WatchStreamsChanges(t *testing.T) {
+	db := openTodos(t, t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub, err := db.Watch(ctx, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "first"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "edited"}))
+	require.NoError(t, db.Delete("todo1"))
+	require.NoError(t, db.Purge("todo1"))
+
+	event := nextEvent(t, sub.Events())
+	assert.Equal(t, uint64(1), event.Seq)
+	assert.Equal(t, dbpkg.Insert, event.Op)
+	assert.Nil(t, event.Before)
+	assert.Equal(t, "first", event.After.Text)
+
+	event = nextEvent(t, sub.Events())
+	assert.Equal(t, uint64(2), event.Seq)
+	assert.Equal(t, dbpkg.Update, event.Op)
+	assert.Equal(t, "first", event.Before.Text)
+	assert.Equal(t, "edited", event.After.Text)
+
+	// Moving an item to the trash updates it
+	event = nextEvent(t, sub.Events())
+	assert.Equal(t, uint64(3), event.Seq)
+	assert.Equal(t, dbpkg.Update, event.Op)
+	assert.True(t, dbpkg.IsDeleted(event.After))
+
+	event = nextEvent(t, sub.Events())
+	assert.Equal(t, uint64(4), event.Seq)
+	assert.Equal(t, dbpkg.Delete, event.Op)
+	assert.Equal(t, "todo1", event.ID)
+	assert.Equal(t, "edited", event.Before.Text)
+	assert.Nil(t, event.After)
+
+	cancel()
+	for range sub.Events() {
+	}
+	assert.ErrorIs(t, sub.Err(), context.Canceled)
+}
+
+func TestMemDb_WatchResumesAfterRestart(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "one"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo2", Text: "two"}))
+	require.NoError(t, db.Close())
+
+	reopened := openTodos(t, rootPath)
+	latest, err := reopened.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), latest)
+
+	// A consumer that saw the first change picks up from there
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := reopened.Watch(ctx, 1)
+	require.NoError(t, err)
+	event := nextEvent(t, sub.Events())
+	assert.Equal(t, uint64(2), event.Seq)
+	assert.Equal(t, "two", event.After.Text)
+
+	// Compaction keeps the sequence but drops the history
+	require.NoError(t, reopened.Upsert(&models.Todo{Id: "todo3", Text: "three"}))
+	assert.Equal(t, uint64(3), nextEvent(t, sub.Events()).Seq)
+	require.NoError(t, reopened.Compact())
+	require.NoError(t, reopened.Close())
+
+	compacted := openTodos(t, rootPath)
+	_, err = compacted.Watch(ctx, 1)
+	assert.ErrorIs(t, err, dbpkg.ErrChangesExpired)
+	sub, err = compacted.Watch(ctx, 3)
+	require.NoError(t, err)
+	require.NoError(t, compacted.Purge("todo1"))
+	event = nextEvent(t, sub.Events())
+	assert.Equal(t, uint64(4), event.Seq)
+	assert.Equal(t, dbpkg.Delete, event.Op)
+}
+
+func TestMemDb_WatchFailsWhenHistoryIsExceeded(t *testing.T) {
+	db, err := Initialize[*models.Todo]("todos", "", false, WithChangeHistory(2))
+	require.NoError(t, err)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, db.Upsert(&models.Todo{Id: id}))
+	}
+
+	_, err = db.Watch(context.Background(), 1)
+	assert.ErrorIs(t, err, dbpkg.ErrChangesExpired)
+	// Seq 3 is still in the history
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := db.Watch(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "d", nextEvent(t, sub.Events()).ID)
+}
+
+func TestTx_WatchSeesEveryWrite(t *testing.T) {
+	f := openTxFixture(t, t.TempDir())
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t0"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := f.todos.Watch(ctx, 1)
+	require.NoError(t, err)
+
+	tx, _, todos := f.begin(t)
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t2"}))
+	require.NoError(t, todos.Purge("t0"))
+	require.NoError(t, tx.Commit())
+
+	var seqs []uint64
+	ids := map[string]dbpkg.ChangeOp{}
+	for range 3 {
+		event := nextEvent(t, sub.Events())
+		seqs = append(seqs, event.Seq)
+		ids[event.ID] = event.Op
+	}
+	assert.Equal(t, []uint64{2, 3, 4}, seqs)
+	assert.Equal(t, map[string]dbpkg.ChangeOp{"t0": dbpkg.Delete, "t1": dbpkg.Insert, "t2": dbpkg.Insert}, ids)
+}
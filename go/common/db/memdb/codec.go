@@ -0,0 +1,118 @@
+package memdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec encodes the items of a table in its log. The name of the codec is
+// kept in the header of the log, so a table is always read back with the
+// codec it was written with. A table opened with a different codec than its
+// log was written with is rewritten with the new one.
+type Codec interface {
+	// Name identifies the codec in log headers, at most 255 bytes
+	Name() string
+	Marshal(item any) ([]byte, error)
+	// Unmarshal decodes data into item, a pointer to the item type
+	Unmarshal(data []byte, item any) error
+}
+
+// ProtoItem is implemented by items that can be stored with ProtoCodec,
+// usually by converting to and from the matching gRPC message
+type ProtoItem interface {
+	MarshalProto() ([]byte, error)
+	UnmarshalProto(data []byte) error
+}
+
+var (
+	// JSONCodec stores items as JSON. It is the default.
+	JSONCodec Codec = jsonCodec{}
+	// ProtoCodec stores items in their protobuf encoding, which is several
+	// times smaller than JSON. Items must implement ProtoItem.
+	ProtoCodec Codec = protoCodec{}
+)
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+)
+
+func init() {
+	RegisterCodec(JSONCodec)
+	RegisterCodec(ProtoCodec)
+}
+
+// RegisterCodec makes a codec available for reading logs written with it
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+}
+
+// LookupCodec returns the registered codec with the given name
+func LookupCodec(name string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec %q", name)
+	}
+	return codec, nil
+}
+
+// WithCodec sets the codec a table is stored with
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Marshal(item any) ([]byte, error) {
+	return json.Marshal(item)
+}
+
+func (jsonCodec) Unmarshal(data []byte, item any) error {
+	return json.Unmarshal(data, item)
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "proto"
+}
+
+func (protoCodec) Marshal(item any) ([]byte, error) {
+	message, ok := item.(ProtoItem)
+	if !ok {
+		return nil, fmt.Errorf("%T cannot be stored with the proto codec", item)
+	}
+	return message.MarshalProto()
+}
+
+func (protoCodec) Unmarshal(data []byte, item any) error {
+	// item points to the item type, which is itself usually a pointer that
+	// has to be allocated first
+	target := reflect.ValueOf(item)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("cannot unmarshal into %T", item)
+	}
+	if elem := target.Elem(); elem.Kind() == reflect.Pointer {
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		target = elem
+	}
+	message, ok := target.Interface().(ProtoItem)
+	if !ok {
+		return fmt.Errorf("%s cannot be stored with the proto codec", target.Type())
+	}
+	return message.UnmarshalProto(data)
+}
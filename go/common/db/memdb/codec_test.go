@@ -0,0 +1,147 @@
+package memdb
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openProtoTodos(t *testing.T, rootPath string) *MemDb[*models.Todo] {
+	t.Helper()
+	db, err := Initialize[*models.Todo]("todos", rootPath, true, WithIndex("user_id"), WithCodec(ProtoCodec))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestCodec_ProtoTableSurvivesRestart(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openProtoTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo2", Text: "second", Done: true, UserId: "user1"}))
+	require.NoError(t, db.Delete("todo2"))
+	require.NoError(t, db.Close())
+
+	header, err := os.ReadFile(filepath.Join(rootPath, "todos.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "MEMDB\x02\x05proto", string(header[:12]))
+
+	// The log says which codec it was written with
+	reopened := openTodos(t, rootPath)
+	todo, err := reopened.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "first", todo.Text)
+	assert.Equal(t, int64(1), todo.Version)
+	_, err = reopened.GetByID("todo2")
+	assert.Error(t, err)
+
+	// Changes replayed from the log can still be watched
+	sub, err := reopened.Watch(context.Background(), 0)
+	require.NoError(t, err)
+	event := nextEvent(t, sub.Events())
+	assert.Equal(t, "first", event.After.Text)
+}
+
+func TestCodec_SwitchingCodecRewritesTheLog(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	for i := range 50 {
+		require.NoError(t, db.Upsert(&models.Todo{Id: fmt.Sprintf("todo%d", i), Text: "some text", UserId: "user1"}))
+	}
+	require.NoError(t, db.Compact())
+	require.NoError(t, db.Close())
+	logPath := filepath.Join(rootPath, "todos.log")
+	jsonSize, err := os.Stat(logPath)
+	require.NoError(t, err)
+
+	converted := openProtoTodos(t, rootPath)
+	require.NoError(t, converted.Close())
+	protoSize, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Less(t, protoSize.Size(), jsonSize.Size()*2/3)
+
+	reopened := openProtoTodos(t, rootPath)
+	byUser, err := reopened.GetByFilter(map[string]any{"user_id": "user1"})
+	require.NoError(t, err)
+	assert.Len(t, byUser, 50)
+}
+
+func TestCodec_UpgradesLogWithoutHeader(t *testing.T) {
+	rootPath := t.TempDir()
+	lines := []string{
+		`{"seq":1,"op":"upsert","id":"todo1","data":{"id":"todo1","text":"old format"}}`,
+		`{"seq":2,"op":"upsert","id":"todo2","data":{"id":"todo2","text":"deleted"}}`,
+		`{"seq":3,"op":"delete","id":"todo2"}`,
+		`{"seq":5,"op":"tx","id":"","tx":1,"data":[{"op":"upsert","id":"todo3","data":{"id":"todo3","text":"in tx"}},{"op":"upsert","id":"todo4","data":{"id":"todo4"}}]}`,
+	}
+	content := ""
+	for _, line := range lines {
+		content += fmt.Sprintf("%08x %s\n", crc32.Checksum([]byte(line), crcTable), line)
+	}
+	logPath := filepath.Join(rootPath, "todos.log")
+	require.NoError(t, os.WriteFile(logPath, []byte(content), 0644))
+
+	db := openTodos(t, rootPath)
+	all, err := db.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	latest, err := db.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), latest)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo5"}))
+	require.NoError(t, db.Close())
+
+	upgraded, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, "MEMDB", string(upgraded[:5]))
+	reopened := openTodos(t, rootPath)
+	all, err = reopened.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+	latest, err = reopened.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(6), latest)
+}
+
+func TestCodec_RefusesNewerFormat(t *testing.T) {
+	rootPath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(rootPath, "todos.log"), []byte("MEMDB\x03\x04json"), 0644))
+	_, err := Initialize[*models.Todo]("todos", rootPath, true)
+	assert.ErrorContains(t, err, "newer")
+}
+
+func TestCodec_ProtoTransactions(t *testing.T) {
+	rootPath := t.TempDir()
+	store, err := OpenStore(rootPath, true)
+	require.NoError(t, err)
+	users, err := Initialize[*models.User]("users", rootPath, true, WithStore(store), WithCodec(ProtoCodec))
+	require.NoError(t, err)
+	todos, err := Initialize[*models.Todo]("todos", rootPath, true, WithStore(store))
+	require.NoError(t, err)
+
+	tx := store.Begin()
+	txUsers, err := Within(tx, users)
+	require.NoError(t, err)
+	txTodos, err := Within(tx, todos)
+	require.NoError(t, err)
+	require.NoError(t, txUsers.Upsert(&models.User{ID: "u1", Username: "alice", Role: models.Admin}))
+	require.NoError(t, txTodos.Upsert(&models.Todo{Id: "t1", UserId: "u1"}))
+	require.NoError(t, tx.Commit())
+	require.NoError(t, users.Close())
+	require.NoError(t, todos.Close())
+	require.NoError(t, store.Close())
+
+	reopened, err := Initialize[*models.User]("users", rootPath, true, WithCodec(ProtoCodec))
+	require.NoError(t, err)
+	defer reopened.Close()
+	user, err := reopened.GetByID("u1")
+	require.NoError(t, err)
+	assert.Equal(t, models.Admin, user.Role)
+}
@@ -0,0 +1,153 @@
+package memdb
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// ErrUniqueViolation is returned when an upsert would give two items the same
+// value for a field with a unique index. It is the same error as
+// db.ErrUniqueViolation.
+var ErrUniqueViolation = db.ErrUniqueViolation
+
+// errNotFound lets MemDb methods, whose receiver shadows the db package,
+// return db.ErrNotFound
+var errNotFound = db.ErrNotFound
+
+// ErrVersionConflict is matched by the error UpsertIfVersion returns for a
+// stale version. It is the same error as db.ErrVersionConflict.
+var ErrVersionConflict = db.ErrVersionConflict
+
+// versionOf, stamp and checkVersion let MemDb methods use the version helpers
+// of the db package
+var (
+	versionOf    = db.VersionOf
+	stamp        = db.Stamp
+	checkVersion = db.CheckVersion
+)
+
+// softDeletable, isDeleted and deletedBefore let MemDb methods use the trash
+// helpers of the db package
+type softDeletable = db.SoftDeletable
+
+var (
+	isDeleted     = db.IsDeleted
+	deletedBefore = db.DeletedBefore
+)
+
+func isSoftDeletable[T common.Serializable]() bool {
+	return db.IsSoftDeletable[T]()
+}
+
+func validateFilters[T common.Serializable](filters map[string]any) error {
+	return db.ValidateFilters[T](filters)
+}
+
+// runQuery lets MemDb methods, whose receiver shadows the db package, run
+// db.RunQuery
+func runQuery[T common.Serializable](items []T, query db.Query) (*db.Page[T], error) {
+	return db.RunQuery(items, query)
+}
+
+// Option configures a MemDb table at Initialize
+type Option func(*options)
+
+type options struct {
+	indexes       []indexSpec
+	store         *Store
+	changeHistory int
+	codec         Codec
+	ttl           time.Duration
+}
+
+type indexSpec struct {
+	field  string
+	unique bool
+}
+
+// WithIndex declares a secondary index on field
+func WithIndex(field string) Option {
+	return func(o *options) {
+		o.indexes = append(o.indexes, indexSpec{field: field})
+	}
+}
+
+// WithUniqueIndex declares a secondary index on field that rejects two items
+// with the same value
+func WithUniqueIndex(field string) Option {
+	return func(o *options) {
+		o.indexes = append(o.indexes, indexSpec{field: field, unique: true})
+	}
+}
+
+// index maps the values of one field to the ids of the items holding them
+type index struct {
+	field   string
+	unique  bool
+	entries map[any]map[string]struct{}
+}
+
+func newIndex(spec indexSpec) *index {
+	return &index{
+		field:   spec.field,
+		unique:  spec.unique,
+		entries: map[any]map[string]struct{}{},
+	}
+}
+
+// indexKey returns the field value of item used as key in the index
+func (idx *index) indexKey(item common.Serializable) (any, error) {
+	value, err := common.GetField(item, idx.field)
+	if err != nil {
+		return nil, err
+	}
+	if value != nil && !reflect.TypeOf(value).Comparable() {
+		return nil, fmt.Errorf("field %s of type %T cannot be indexed", idx.field, value)
+	}
+	return db.Normalize(value), nil
+}
+
+// checkUnique returns ErrUniqueViolation if an item other than id already
+// holds key
+func (idx *index) checkUnique(id string, key any) error {
+	if !idx.unique {
+		return nil
+	}
+	for holder := range idx.entries[key] {
+		if holder != id {
+			return fmt.Errorf("%w: %s %v is already taken", ErrUniqueViolation, idx.field, key)
+		}
+	}
+	return nil
+}
+
+func (idx *index) add(id string, key any) {
+	ids, exists := idx.entries[key]
+	if !exists {
+		ids = map[string]struct{}{}
+		idx.entries[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func (idx *index) remove(id string, key any) {
+	ids := idx.entries[key]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(idx.entries, key)
+	}
+}
+
+// lookup returns the ids of the items whose field may equal value. Keys are
+// normalized with db.Normalize, so callers needing exact equality have to
+// check the candidates again.
+func (idx *index) lookup(value any) map[string]struct{} {
+	if value != nil && !reflect.TypeOf(value).Comparable() {
+		return nil
+	}
+	return idx.entries[db.Normalize(value)]
+}
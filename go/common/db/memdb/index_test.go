@@ -0,0 +1,152 @@
+package memdb
+
+import (
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common"
+	dbpkg "github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openUsers(t *testing.T, rootPath string) *MemDb[*models.User] {
+	t.Helper()
+	db, err := Initialize[*models.User]("users", rootPath, true,
+		WithUniqueIndex("username"), WithUniqueIndex("email"), WithIndex("role"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestIndex_UniqueRejectsDuplicates(t *testing.T) {
+	db := openUsers(t, t.TempDir())
+	require.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alice", Email: "alice@example.com"}))
+
+	err := db.Upsert(&models.User{ID: "u2", Username: "alice", Email: "other@example.com"})
+	assert.ErrorIs(t, err, ErrUniqueViolation)
+	err = db.Upsert(&models.User{ID: "u2", Username: "bob", Email: "alice@example.com"})
+	assert.ErrorIs(t, err, ErrUniqueViolation)
+
+	// A rejected write must not be stored
+	_, err = db.GetByID("u2")
+	assert.Error(t, err)
+
+	// Upserting the same item again is not a conflict with itself
+	assert.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alice", Email: "alice@example.com", Role: models.Admin}))
+}
+
+func TestIndex_FollowsUpdatesAndDeletes(t *testing.T) {
+	db := openUsers(t, t.TempDir())
+	require.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alice", Email: "alice@example.com"}))
+
+	// Renaming frees the old username
+	require.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alicia", Email: "alice@example.com"}))
+	_, err := db.GetByField("username", "alice")
+	assert.Error(t, err)
+	user, err := db.GetByField("username", "alicia")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", user.ID)
+	require.NoError(t, db.Upsert(&models.User{ID: "u2", Username: "alice", Email: "new@example.com"}))
+
+	// Deleting frees the email
+	require.NoError(t, db.Delete("u1"))
+	_, err = db.GetByField("email", "alice@example.com")
+	assert.Error(t, err)
+	assert.NoError(t, db.Upsert(&models.User{ID: "u3", Username: "carol", Email: "alice@example.com"}))
+}
+
+func TestIndex_NonUniqueFilter(t *testing.T) {
+	db := openUsers(t, t.TempDir())
+	require.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alice", Email: "a@example.com", Role: models.Admin}))
+	require.NoError(t, db.Upsert(&models.User{ID: "u2", Username: "bob", Email: "b@example.com", Role: models.Default}))
+	require.NoError(t, db.Upsert(&models.User{ID: "u3", Username: "carol", Email: "c@example.com", Role: models.Admin}))
+
+	admins, err := db.GetByFilter(map[string]any{"role": models.Admin})
+	require.NoError(t, err)
+	assert.Len(t, admins, 2)
+
+	// Indexed and unindexed conditions combine
+	admins, err = db.GetByFilter(map[string]any{"role": models.Admin, "password": ""})
+	require.NoError(t, err)
+	assert.Len(t, admins, 2)
+	admins, err = db.GetByFilter(map[string]any{"role": models.Admin, "username": "carol"})
+	require.NoError(t, err)
+	require.Len(t, admins, 1)
+	assert.Equal(t, "u3", admins[0].ID)
+
+	none, err := db.GetByFilter(map[string]any{"role": "nobody"})
+	require.NoError(t, err)
+	assert.Empty(t, none)
+}
+
+func TestIndex_RebuiltOnReload(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openUsers(t, rootPath)
+	require.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alice", Email: "alice@example.com"}))
+	require.NoError(t, db.Upsert(&models.User{ID: "u2", Username: "bob", Email: "bob@example.com"}))
+	require.NoError(t, db.Delete("u2"))
+	require.NoError(t, db.Close())
+
+	reopened := openUsers(t, rootPath)
+	user, err := reopened.GetByField("email", "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", user.ID)
+	_, err = reopened.GetByField("username", "bob")
+	assert.Error(t, err)
+	assert.ErrorIs(t, reopened.Upsert(&models.User{ID: "u3", Username: "alice", Email: "x@example.com"}), ErrUniqueViolation)
+}
+
+func TestIndex_DuplicatesOnDiskFailInitialize(t *testing.T) {
+	rootPath := t.TempDir()
+	db, err := Initialize[*models.User]("users", rootPath, true)
+	require.NoError(t, err)
+	require.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, db.Upsert(&models.User{ID: "u2", Username: "alice"}))
+	require.NoError(t, db.Close())
+
+	_, err = Initialize[*models.User]("users", rootPath, true, WithUniqueIndex("username"))
+	assert.ErrorIs(t, err, ErrUniqueViolation)
+}
+
+func TestIndex_QueryNarrowsByIndex(t *testing.T) {
+	db := openUsers(t, t.TempDir())
+	require.NoError(t, db.Upsert(&models.User{ID: "u1", Username: "alice", Email: "a@example.com", Role: models.Admin}))
+	require.NoError(t, db.Upsert(&models.User{ID: "u2", Username: "bob", Email: "b@example.com", Role: models.Default}))
+	require.NoError(t, db.Upsert(&models.User{ID: "u3", Username: "carol", Email: "c@example.com", Role: models.Admin}))
+
+	// A plain string finds the models.Role stored in the index
+	page, err := db.Query(dbpkg.Query{
+		Where:   dbpkg.And(dbpkg.Where("role", dbpkg.Eq, "admin"), dbpkg.Where("username", dbpkg.Ne, "alice")),
+		OrderBy: []dbpkg.Order{{Field: "username", Desc: true}},
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Items, 1)
+	assert.Equal(t, "u3", page.Items[0].ID)
+
+	page, err = db.Query(dbpkg.Query{OrderBy: []dbpkg.Order{{Field: "email", Desc: true}}, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, "u3", page.Items[0].ID)
+	assert.Equal(t, "u2", page.Items[1].ID)
+	assert.NotEmpty(t, page.NextCursor)
+
+	page.Items[0].Username = "changed"
+	user, err := db.GetByID("u3")
+	require.NoError(t, err)
+	assert.Equal(t, "carol", user.Username)
+}
+
+func TestIndex_UnknownFieldsAreRejected(t *testing.T) {
+	_, err := Initialize[*models.User]("users", "", false, WithIndex("UserName"))
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+
+	// An empty table still reports misspelled fields instead of matching
+	// nothing
+	db := openUsers(t, t.TempDir())
+	_, err = db.GetByFilter(map[string]any{"Role": "admin"})
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+	_, err = db.GetByField("Username", "alice")
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+	_, err = db.Query(dbpkg.Query{Where: dbpkg.Where("Email", dbpkg.Eq, "x")})
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+}
@@ -1,25 +1,60 @@
 package memdb
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
 )
 
-// Driver for data held in memory
+// minCompactRecords is the log size below which the log is never compacted
+const minCompactRecords = 1000
+
+// Driver for data held in memory. When SaveToDisk is set every write is
+// recorded in the table log at FilePath before it is applied.
+//
+// All DbDriver methods are safe for concurrent use. Writes take the table
+// lock exclusively and reads share it, so a scan always sees the table as of
+// a single point between writes. Items are copied on the way in and out;
+// callers can modify what they pass to or get back from the driver without
+// affecting stored data. Data must not be accessed directly while the driver
+// is in use.
 type MemDb[T common.Serializable] struct {
 	Table      string
 	Data       map[string]T
 	FilePath   string
 	SaveToDisk bool
+
+	mu      sync.RWMutex
+	wal     *writeAheadLog
+	indexes map[string]*index
+	store   *Store
+	lastTx  uint64 // id of the last transaction applied to the table
+	codec   Codec  // codec of the items in the table log
+
+	ttl        time.Duration
+	writeTimes map[string]int64 // when each item was last written, in unix milliseconds
+	expiries   expiryQueue
+
+	seq         uint64 // sequence number of the last change
+	history     []change
+	historySize int
+	changed     db.Broadcast
 }
 
 func (db *MemDb[T]) String() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
 	for key, value := range db.Data {
-		valueJson, err := value.ToJson()
+		valueJson, err := common.ToJson(value)
 		if err != nil {
 			log.Printf("Error converting value to JSON: %v", err)
 			return "MemDb{" + db.Table + ", " + key + ": <error converting to JSON>}"
@@ -29,181 +64,736 @@ func (db *MemDb[T]) String() string {
 	return "MemDb{" + db.Table + "}"
 }
 
-func Initialize[T common.Serializable](table string, rootPath string, saveToDisk bool) (*MemDb[T], error) {
-	data := map[string]T{}
-	filePath := ""
+func Initialize[T common.Serializable](table string, rootPath string, saveToDisk bool, opts ...Option) (*MemDb[T], error) {
+	config := &options{changeHistory: db.DefaultChangeHistory, codec: JSONCodec}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if err := common.ValidateFields[T]("id"); err != nil {
+		log.Printf("Could not initialize table %s: %v", table, err)
+		return nil, err
+	}
+	for _, spec := range config.indexes {
+		if err := common.ValidateFields[T](spec.field); err != nil {
+			log.Printf("Could not declare index on %s.%s: %v", table, spec.field, err)
+			return nil, err
+		}
+	}
+
+	db := &MemDb[T]{
+		Table:       table,
+		Data:        map[string]T{},
+		SaveToDisk:  saveToDisk,
+		indexes:     map[string]*index{},
+		historySize: config.changeHistory,
+		codec:       config.codec,
+		ttl:         config.ttl,
+		writeTimes:  map[string]int64{},
+	}
 	if saveToDisk {
-		var err error
-		filePath = rootPath + "/" + table + ".json"
-		data, err = GetDataFromFile[T](rootPath + "/" + table + ".json")
-		if err != nil {
+		db.FilePath = filepath.Join(rootPath, table+logFileExtension)
+		if err := db.load(filepath.Join(rootPath, table+".json")); err != nil {
 			log.Printf("Could not read data from file for table %s: %v", table, err)
 			return nil, err
 		}
 	}
-	db := &MemDb[T]{
-		Table:      table,
-		Data:       data,
-		FilePath:   filePath,
-		SaveToDisk: saveToDisk,
+	for _, spec := range config.indexes {
+		if err := db.buildIndex(spec); err != nil {
+			log.Printf("Could not build index on %s.%s: %v", table, spec.field, err)
+			db.Close()
+			return nil, err
+		}
+	}
+	if config.store != nil {
+		if err := config.store.attach(db); err != nil {
+			log.Printf("Could not attach table %s to store: %v", table, err)
+			db.Close()
+			return nil, err
+		}
+		db.store = config.store
+	}
+	// Transactions recovered from the store are encoded with the codec the
+	// table had, so the table only switches codecs once it has caught up
+	if db.wal != nil && db.codec.Name() != config.codec.Name() {
+		log.Printf("Converting log %s from %s to %s", db.FilePath, db.codec.Name(), config.codec.Name())
+		db.codec = config.codec
+		db.wal.codec = config.codec
+		if err := db.compact(); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 	return db, nil
 }
 
+// buildIndex indexes every item currently in the table
+func (db *MemDb[T]) buildIndex(spec indexSpec) error {
+	idx := newIndex(spec)
+	for id, item := range db.Data {
+		key, err := idx.indexKey(item)
+		if err != nil {
+			return err
+		}
+		if err := idx.checkUnique(id, key); err != nil {
+			return err
+		}
+		idx.add(id, key)
+	}
+	db.indexes[spec.field] = idx
+	return nil
+}
+
+// indexKeys returns the key of item in every index, failing if it would
+// break a unique index
+func (db *MemDb[T]) indexKeys(id string, item T) (map[string]any, error) {
+	keys := make(map[string]any, len(db.indexes))
+	for field, idx := range db.indexes {
+		key, err := idx.indexKey(item)
+		if err != nil {
+			return nil, err
+		}
+		if err := idx.checkUnique(id, key); err != nil {
+			return nil, err
+		}
+		keys[field] = key
+	}
+	return keys, nil
+}
+
+// put stores item under id and updates the indexes. The caller must hold the
+// write lock and have checked the unique indexes.
+func (db *MemDb[T]) put(id string, item T) {
+	db.unindex(id)
+	for _, idx := range db.indexes {
+		if key, err := idx.indexKey(item); err == nil {
+			idx.add(id, key)
+		}
+	}
+	db.Data[id] = item
+}
+
+// remove deletes the item with the given id and its index entries. The
+// caller must hold the write lock.
+func (db *MemDb[T]) remove(id string) {
+	db.unindex(id)
+	delete(db.Data, id)
+	delete(db.writeTimes, id)
+}
+
+// unindex removes the stored item with the given id from every index
+func (db *MemDb[T]) unindex(id string) {
+	item, exists := db.Data[id]
+	if !exists {
+		return
+	}
+	for _, idx := range db.indexes {
+		if key, err := idx.indexKey(item); err == nil {
+			idx.remove(id, key)
+		}
+	}
+}
+
+// load replays the table log into memory. If there is no log yet but there is
+// a table file in the old JSON format, its contents are imported and written
+// out as the initial log.
+func (db *MemDb[T]) load(legacyPath string) error {
+	_, statErr := os.Stat(db.FilePath)
+	logExists := statErr == nil
+
+	wal, err := openLog(db.FilePath, db.codec)
+	if err != nil {
+		return err
+	}
+	db.wal = wal
+	db.codec = wal.codec
+	if err := wal.recover(db.applyRecord); err != nil {
+		return err
+	}
+	if wal.outdated() {
+		log.Printf("Rewriting log %s in the current format", db.FilePath)
+		if err := db.compact(); err != nil {
+			return err
+		}
+	}
+
+	if !logExists {
+		legacyData, err := GetDataFromFile[T](legacyPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if len(legacyData) > 0 {
+			log.Printf("Importing %d records from %s into %s", len(legacyData), legacyPath, db.FilePath)
+			db.Data = legacyData
+			for id := range legacyData {
+				db.written(id, 0)
+			}
+			return db.compact()
+		}
+	}
+	return nil
+}
+
+// applyRecord applies a replayed log record to the in-memory data
+func (db *MemDb[T]) applyRecord(record *logRecord) error {
+	switch record.Op {
+	case opUpsert, opDelete:
+		return db.applyWrite(record.Seq, txWrite{Op: record.Op, ID: record.ID, Data: record.Data, Time: record.Time})
+	case opTx:
+		first := record.Seq - uint64(len(record.Writes)) + 1
+		for i, write := range record.Writes {
+			if err := db.applyWrite(first+uint64(i), write); err != nil {
+				return err
+			}
+		}
+		db.lastTx = record.Tx
+	case opCheckpoint:
+		db.seq = record.Seq
+		db.lastTx = record.Tx
+	default:
+		return fmt.Errorf("unknown log operation %q", record.Op)
+	}
+	return nil
+}
+
+// applyWrite applies a single upsert or delete, the change with the given
+// sequence number, to the in-memory data. Writes from a compacted snapshot
+// have no sequence number and are not published as changes.
+func (db *MemDb[T]) applyWrite(seq uint64, write txWrite) error {
+	switch write.Op {
+	case opUpsert:
+		var item T
+		if err := db.codec.Unmarshal(write.Data, &item); err != nil {
+			log.Printf("Error decoding record %s from log: %v", write.ID, err)
+			return err
+		}
+		data := write.Data
+		if db.codec != JSONCodec {
+			// Changes are kept as JSON
+			var err error
+			if data, err = json.Marshal(item); err != nil {
+				return err
+			}
+		}
+		db.publish(seq, write.ID, data)
+		db.put(write.ID, item)
+		db.written(write.ID, write.Time)
+	case opDelete:
+		db.publish(seq, write.ID, nil)
+		db.remove(write.ID)
+	default:
+		return fmt.Errorf("unknown log operation %q", write.Op)
+	}
+	return nil
+}
+
+// GetDataFromFile reads a table file in the old JSON format. The file holds a
+// map of id to record or an array of records, optionally followed by records
+// that were appended one per line.
 func GetDataFromFile[T common.Serializable](filePath string) (map[string]T, error) {
 	content, err := os.ReadFile(filePath)
 	if err != nil {
-		log.Printf("Could not read file, %s: %v", filePath, err)
 		return map[string]T{}, err
 	}
 
 	data := map[string]T{}
-	err = json.Unmarshal(content, &data)
-	if err != nil {
-		log.Printf("Error unmarshalling json into serializable data: %v", err)
-		return make(map[string]T), err
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			log.Printf("Error unmarshalling json into serializable data: %v", err)
+			return map[string]T{}, err
+		}
+		items, err := decodeLegacyValue[T](raw)
+		if err != nil {
+			log.Printf("Error unmarshalling json into serializable data: %v", err)
+			return map[string]T{}, err
+		}
+		for _, item := range items {
+			id, err := common.GetID(item)
+			if err != nil {
+				return map[string]T{}, err
+			}
+			data[id] = item
+		}
 	}
 	return data, nil
 }
 
+func decodeLegacyValue[T common.Serializable](raw json.RawMessage) ([]T, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '[' {
+		items := []T{}
+		err := json.Unmarshal(raw, &items)
+		return items, err
+	}
+
+	// An object is either a map of id to record or a single appended record.
+	// Records have at least one non-object field, so a map is an object whose
+	// values are all objects.
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	isMap := true
+	for _, value := range fields {
+		value = bytes.TrimSpace(value)
+		if len(value) == 0 || value[0] != '{' {
+			isMap = false
+			break
+		}
+	}
+	if isMap {
+		items := make([]T, 0, len(fields))
+		for _, value := range fields {
+			var item T
+			if err := json.Unmarshal(value, &item); err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+
+	var item T
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return nil, err
+	}
+	return []T{item}, nil
+}
+
+// cloneItem returns a deep copy of item along with its JSON encoding
+func cloneItem[T common.Serializable](item T) (T, []byte, error) {
+	var clone T
+	data, err := json.Marshal(item)
+	if err != nil {
+		log.Printf("Error marshalling item to JSON: %v", err)
+		return clone, nil, err
+	}
+	if err := json.Unmarshal(data, &clone); err != nil {
+		log.Printf("Error unmarshalling item from JSON: %v", err)
+		return clone, nil, err
+	}
+	return clone, data, nil
+}
+
 func (db *MemDb[T]) Upsert(item T) error {
-	id, _ := item.GetID()
-	db.Data[id] = item
-	if db.FilePath != "" {
-		return db.AppendToFile(item, db.FilePath)
+	return db.upsert(item, false, 0)
+}
+
+// UpsertIfVersion implements the DbDriver interface
+func (db *MemDb[T]) UpsertIfVersion(item T, version int64) error {
+	return db.upsert(item, true, version)
+}
+
+func (db *MemDb[T]) upsert(item T, conditional bool, version int64) error {
+	id, err := common.GetID(item)
+	if err != nil {
+		return err
 	}
+	stored, _, err := cloneItem(item)
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now()
+	if _, err := db.expireDue(now); err != nil {
+		return err
+	}
+	current := db.storedVersion(id)
+	if conditional {
+		if err := checkVersion(id, version, current); err != nil {
+			log.Printf("Upsert into %s rejected: %v", db.Table, err)
+			return err
+		}
+	}
+	if err := db.write(id, stored, now); err != nil {
+		return err
+	}
+	// Let the caller know the version it just wrote
+	stamp(item, current, now)
 	return nil
 }
 
-func (db *MemDb[T]) GetByField(field string, value any) (T, error) {
-	var zero T
-	for _, item := range db.Data {
-		itemField, err := item.GetField(field)
+// write stores item under id with the next version. The caller must hold the
+// write lock.
+func (db *MemDb[T]) write(id string, stored T, now time.Time) error {
+	stamp(stored, db.storedVersion(id), now)
+	data, err := json.Marshal(stored)
+	if err != nil {
+		log.Printf("Error marshalling item to JSON: %v", err)
+		return err
+	}
+	keys, err := db.indexKeys(id, stored)
+	if err != nil {
+		log.Printf("Upsert into %s rejected: %v", db.Table, err)
+		return err
+	}
+	seq := db.seq + 1
+	if db.wal != nil {
+		encoded, err := db.encode(stored, data)
 		if err != nil {
-			return zero, err
+			return err
 		}
-		if itemField == value {
-			return item, nil
+		record := &logRecord{Seq: seq, Op: opUpsert, ID: id, Data: encoded, Time: now.UnixMilli()}
+		if err := db.wal.append(record); err != nil {
+			return err
 		}
 	}
-	return zero, errors.New("item not found")
+	db.publish(seq, id, data)
+	db.unindex(id)
+	for field, key := range keys {
+		db.indexes[field].add(id, key)
+	}
+	db.Data[id] = stored
+	db.written(id, now.UnixMilli())
+	return db.maybeCompact()
 }
 
-// UpsertAndSave upserts an item and immediately saves all data to the table file
-func (db *MemDb[T]) UpsertAndSave(item T) error {
-	// First upsert the item
-	err := db.Upsert(item)
+// encode encodes item for the table log. jsonData is the JSON encoding of
+// item if the caller has it at hand.
+func (db *MemDb[T]) encode(item T, jsonData []byte) ([]byte, error) {
+	if db.codec == JSONCodec && jsonData != nil {
+		return jsonData, nil
+	}
+	data, err := db.codec.Marshal(item)
 	if err != nil {
-		return err
+		log.Printf("Error encoding item with %s codec: %v", db.codec.Name(), err)
+		return nil, err
+	}
+	return data, nil
+}
+
+// storedVersion returns the version of the stored item with the given id, 0
+// if there is none. The caller must hold the lock.
+func (db *MemDb[T]) storedVersion(id string) int64 {
+	item, exists := db.Data[id]
+	if !exists {
+		return 0
 	}
+	return versionOf(item)
+}
 
-	// Then save to file if RootPath is set
-	if db.FilePath != "" {
-		filePath := db.FilePath + "/" + db.Table + ".json"
-		return db.SaveAllDataToFile(filePath)
+func (db *MemDb[T]) GetByField(field string, value any) (T, error) {
+	var zero T
+	if err := common.ValidateFields[T](field); err != nil {
+		return zero, err
 	}
 
-	return nil
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
+	if idx, indexed := db.indexes[field]; indexed {
+		for id := range idx.lookup(value) {
+			item := db.Data[id]
+			if isDeleted(item) || db.expired(id, now) {
+				continue
+			}
+			if itemField, err := common.GetField(item, field); err != nil || itemField != value {
+				continue
+			}
+			clone, _, err := cloneItem(item)
+			return clone, err
+		}
+		return zero, errNotFound
+	}
+	for id, item := range db.Data {
+		if isDeleted(item) || db.expired(id, now) {
+			continue
+		}
+		itemField, err := common.GetField(item, field)
+		if err != nil {
+			return zero, err
+		}
+		if itemField == value {
+			clone, _, err := cloneItem(item)
+			return clone, err
+		}
+	}
+	return zero, errNotFound
 }
 
 func (db *MemDb[T]) GetAll() ([]T, error) {
-	data := []T{}
-	for _, value := range db.Data {
-		data = append(data, value)
+	return db.snapshot(false)
+}
+
+// snapshot returns copies of the items, including those in the trash if
+// includeDeleted is set
+func (db *MemDb[T]) snapshot(includeDeleted bool) ([]T, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
+	data := make([]T, 0, len(db.Data))
+	for id, value := range db.Data {
+		if (!includeDeleted && isDeleted(value)) || db.expired(id, now) {
+			continue
+		}
+		clone, _, err := cloneItem(value)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, clone)
 	}
 	return data, nil
 }
 
-// AppendToFile appends a single serializable item to a file as a JSON line
-func (db *MemDb[T]) AppendToFile(item T, filePath string) error {
-	// Open file in append mode, create if doesn't exist
-	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Printf("Could not open file for appending, %s: %v", filePath, err)
+// Compact rewrites the table log so it holds exactly one record per live
+// item. The new log replaces the old one atomically.
+func (db *MemDb[T]) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.compact()
+}
+
+func (db *MemDb[T]) compact() error {
+	if db.wal == nil {
+		return nil
+	}
+	records := make([]*logRecord, 0, len(db.Data)+1)
+	records = append(records, &logRecord{Seq: db.seq, Op: opCheckpoint, Tx: db.lastTx})
+	for id, item := range db.Data {
+		data, err := db.encode(item, nil)
+		if err != nil {
+			return err
+		}
+		records = append(records, &logRecord{Op: opUpsert, ID: id, Data: data, Time: db.writeTimes[id]})
+	}
+	if err := db.wal.rewrite(records); err != nil {
+		log.Printf("Error compacting log %s: %v", db.FilePath, err)
 		return err
 	}
-	defer file.Close()
+	log.Printf("Compacted log %s to %d records", db.FilePath, len(records))
+	return nil
+}
 
-	// Marshal the item to JSON
-	jsonData, err := json.Marshal(item)
-	if err != nil {
-		log.Printf("Error marshalling item to JSON: %v", err)
-		return err
+// maybeCompact compacts the log once it has grown well past the live data.
+// The caller must hold the write lock.
+func (db *MemDb[T]) maybeCompact() error {
+	if db.wal == nil || db.wal.records < minCompactRecords || db.wal.records < 2*len(db.Data) {
+		return nil
 	}
+	return db.compact()
+}
 
-	// Append the JSON line with a newline
-	_, err = file.Write(append(jsonData, '\n'))
-	if err != nil {
-		log.Printf("Error writing to file %s: %v", filePath, err)
-		return err
+// Close releases the table log. The MemDb must not be written to afterwards.
+func (db *MemDb[T]) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.wal == nil {
+		return nil
 	}
+	err := db.wal.close()
+	db.wal = nil
+	return err
+}
 
-	log.Printf("Successfully appended item to file: %s", filePath)
-	return nil
+// GetByID implements the DbDriver interface
+func (db *MemDb[T]) GetByID(id string) (T, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	item, exists := db.Data[id]
+	if !exists || isDeleted(item) || db.expired(id, time.Now()) {
+		var zero T
+		return zero, errNotFound
+	}
+	clone, _, err := cloneItem(item)
+	return clone, err
 }
 
-// SaveAllDataToFile saves all current data to a file as a JSON array
-func (db *MemDb[T]) SaveAllDataToFile(filePath string) error {
-	// Convert map to slice
-	data := []T{}
-	for _, value := range db.Data {
-		data = append(data, value)
+// Delete implements the DbDriver interface. Deleting an item that is not
+// there, or already in the trash, does nothing.
+func (db *MemDb[T]) Delete(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now()
+	if _, err := db.expireDue(now); err != nil {
+		return err
 	}
 
-	// Marshal to JSON
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+	item, exists := db.Data[id]
+	if !exists || isDeleted(item) {
+		return nil
+	}
+	if !isSoftDeletable[T]() {
+		return db.purge(id)
+	}
+	clone, _, err := cloneItem(item)
 	if err != nil {
-		log.Printf("Error marshalling data to JSON: %v", err)
 		return err
 	}
+	any(clone).(softDeletable).SetDeletedAt(now)
+	return db.write(id, clone, now)
+}
 
-	// Write to file
-	err = os.WriteFile(filePath, jsonData, 0644)
-	if err != nil {
-		log.Printf("Error writing to file %s: %v", filePath, err)
+// Restore implements the DbDriver interface
+func (db *MemDb[T]) Restore(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	now := time.Now()
+	if _, err := db.expireDue(now); err != nil {
 		return err
 	}
 
-	log.Printf("Successfully saved all data to file: %s", filePath)
-	return nil
+	item, exists := db.Data[id]
+	if !exists || !isDeleted(item) {
+		return errNotFound
+	}
+	clone, _, err := cloneItem(item)
+	if err != nil {
+		return err
+	}
+	any(clone).(softDeletable).SetDeletedAt(time.Time{})
+	return db.write(id, clone, now)
 }
 
-// GetByID implements the DbDriver interface
-func (db *MemDb[T]) GetByID(id string) (T, error) {
-	item, exists := db.Data[id]
-	if !exists {
-		return item, errors.New("item not found")
+// Purge implements the DbDriver interface
+func (db *MemDb[T]) Purge(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, err := db.expireDue(time.Now()); err != nil {
+		return err
 	}
-	return item, nil
+	return db.purge(id)
 }
 
-// Delete implements the DbDriver interface
-func (db *MemDb[T]) Delete(id string) error {
-	delete(db.Data, id)
+// PurgeDeleted implements the db.Purger interface
+func (db *MemDb[T]) PurgeDeleted(before time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	if db.SaveToDisk && db.FilePath != "" {
-		return db.SaveAllDataToFile(db.FilePath)
+	purged := 0
+	for id, item := range db.Data {
+		if !deletedBefore(item, before) {
+			continue
+		}
+		if err := db.purge(id); err != nil {
+			return purged, err
+		}
+		purged++
 	}
-	return nil
+	return purged, nil
+}
+
+// purge permanently removes the item with the given id. The caller must hold
+// the write lock.
+func (db *MemDb[T]) purge(id string) error {
+	if _, exists := db.Data[id]; !exists {
+		return nil
+	}
+	seq := db.seq + 1
+	if db.wal != nil {
+		if err := db.wal.append(&logRecord{Seq: seq, Op: opDelete, ID: id}); err != nil {
+			return err
+		}
+	}
+	db.publish(seq, id, nil)
+	db.remove(id)
+	return db.maybeCompact()
 }
 
 func (db *MemDb[T]) GetByFilter(filters map[string]any) ([]T, error) {
+	if err := validateFilters[T](filters); err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
 	result := make([]T, 0)
-	for _, item := range db.Data {
-		matches := true
+	collect := func(id string, item T) error {
+		if isDeleted(item) || db.expired(id, now) {
+			return nil
+		}
 		for field, value := range filters {
-			itemField, err := item.GetField(field)
+			itemField, err := common.GetField(item, field)
 			if err != nil {
-				return nil, err
+				return err
 			}
 			if itemField != value {
-				matches = false
-				break
+				return nil
+			}
+		}
+		clone, _, err := cloneItem(item)
+		if err != nil {
+			return err
+		}
+		result = append(result, clone)
+		return nil
+	}
+
+	if ids, narrowed := db.candidates(filters); narrowed {
+		for id := range ids {
+			if err := collect(id, db.Data[id]); err != nil {
+				return nil, err
 			}
 		}
-		if matches {
-			result = append(result, item)
+		return result, nil
+	}
+	for id, item := range db.Data {
+		if err := collect(id, item); err != nil {
+			return nil, err
 		}
 	}
 	return result, nil
 }
+
+// candidates uses the most selective index among the filtered fields to
+// narrow down the items that need to be checked. It reports false if none of
+// the fields are indexed.
+func (db *MemDb[T]) candidates(filters map[string]any) (map[string]struct{}, bool) {
+	var best map[string]struct{}
+	narrowed := false
+	for field, value := range filters {
+		idx, indexed := db.indexes[field]
+		if !indexed {
+			continue
+		}
+		ids := idx.lookup(value)
+		if !narrowed || len(ids) < len(best) {
+			best = ids
+			narrowed = true
+		}
+	}
+	return best, narrowed
+}
+
+// Query implements the DbDriver interface. Equality conditions on indexed
+// fields at the top of the query are answered from the index.
+func (db *MemDb[T]) Query(query db.Query) (*db.Page[T], error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
+	var items []T
+	if ids, narrowed := db.candidates(query.Where.Equalities()); narrowed {
+		items = make([]T, 0, len(ids))
+		for id := range ids {
+			if !db.expired(id, now) {
+				items = append(items, db.Data[id])
+			}
+		}
+	} else {
+		items = make([]T, 0, len(db.Data))
+		for id, item := range db.Data {
+			if !db.expired(id, now) {
+				items = append(items, item)
+			}
+		}
+	}
+
+	page, err := runQuery(items, query)
+	if err != nil {
+		return nil, err
+	}
+	for i, item := range page.Items {
+		if page.Items[i], _, err = cloneItem(item); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
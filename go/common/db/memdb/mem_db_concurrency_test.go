@@ -0,0 +1,145 @@
+package memdb
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests are meant to be run with the race detector: go test -race
+
+const (
+	stressWorkers    = 8
+	stressIterations = 200
+)
+
+func TestMemDb_ConcurrentWritesAndReads(t *testing.T) {
+	for _, saveToDisk := range []bool{false, true} {
+		t.Run(fmt.Sprintf("saveToDisk=%v", saveToDisk), func(t *testing.T) {
+			db, err := Initialize[*models.Todo]("todos", t.TempDir(), saveToDisk)
+			require.NoError(t, err)
+			defer db.Close()
+
+			var wg sync.WaitGroup
+			errs := make(chan error, stressWorkers*4)
+			for w := 0; w < stressWorkers; w++ {
+				wg.Add(4)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < stressIterations; i++ {
+						id := fmt.Sprintf("todo-%d-%d", w, i%20)
+						if err := db.Upsert(&models.Todo{Id: id, Text: "text", UserId: fmt.Sprintf("user%d", i%2)}); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}(w)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < stressIterations; i++ {
+						if err := db.Delete(fmt.Sprintf("todo-%d-%d", w, i%20)); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}(w)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < stressIterations; i++ {
+						if _, err := db.GetByFilter(map[string]any{"user_id": "user1"}); err != nil {
+							errs <- err
+							return
+						}
+					}
+				}()
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < stressIterations; i++ {
+						if _, err := db.GetAll(); err != nil {
+							errs <- err
+							return
+						}
+						db.GetByID(fmt.Sprintf("todo-%d-%d", w, i%20))
+						db.GetByField("user_id", "user0")
+					}
+				}(w)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMemDb_ScanSeesWholeWrites(t *testing.T) {
+	db, err := Initialize[*models.Todo]("todos", "", false)
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, db.Upsert(&models.Todo{Id: fmt.Sprintf("todo%d", i), UserId: "user1"}))
+	}
+
+	// Writers keep moving todos between users while readers filter on one of
+	// them. Every returned todo must match the filter it was returned for.
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for w := 0; w < stressWorkers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				owner := "user1"
+				if i%2 == 0 {
+					owner = "user2"
+				}
+				db.Upsert(&models.Todo{Id: fmt.Sprintf("todo%d", (w*13+i)%100), UserId: owner})
+			}
+		}(w)
+	}
+
+	for i := 0; i < stressIterations; i++ {
+		todos, err := db.GetByFilter(map[string]any{"user_id": "user1"})
+		require.NoError(t, err)
+		for _, todo := range todos {
+			assert.Equal(t, "user1", todo.UserId)
+			// Mutating a result must not leak into the table
+			todo.UserId = "someone else"
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	all, err := db.GetAll()
+	require.NoError(t, err)
+	for _, todo := range all {
+		assert.NotEqual(t, "someone else", todo.UserId)
+	}
+}
+
+func TestMemDb_CallerCannotMutateStoredItem(t *testing.T) {
+	db, err := Initialize[*models.Todo]("todos", "", false)
+	require.NoError(t, err)
+
+	todo := &models.Todo{Id: "todo1", Text: "original"}
+	require.NoError(t, db.Upsert(todo))
+	todo.Text = "changed after upsert"
+
+	stored, err := db.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "original", stored.Text)
+
+	stored.Text = "changed after read"
+	again, err := db.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "original", again.Text)
+}
@@ -0,0 +1,259 @@
+package memdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dbpkg "github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTodos(t *testing.T, rootPath string) *MemDb[*models.Todo] {
+	t.Helper()
+	db, err := Initialize[*models.Todo]("todos", rootPath, true)
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestMemDb_PersistsAcrossRestart(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo2", Text: "second", UserId: "user1"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "first, edited", Done: true, UserId: "user1"}))
+	require.NoError(t, db.Delete("todo2"))
+	require.NoError(t, db.Close())
+
+	reopened := openTodos(t, rootPath)
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "first, edited", all[0].Text)
+	assert.True(t, all[0].Done)
+}
+
+func TestMemDb_TornWriteIsDiscarded(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "kept"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo2", Text: "also kept"}))
+	require.NoError(t, db.Close())
+
+	// Simulate a process killed halfway through writing a record
+	logPath := filepath.Join(rootPath, "todos.log")
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	frame, err := encodeRecord(&logRecord{Seq: 3, Op: opUpsert, ID: "todo3", Data: []byte(`{"id":"todo3"}`)})
+	require.NoError(t, err)
+	_, err = file.Write(frame[:len(frame)/2])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	sizeWithTornWrite, err := os.Stat(logPath)
+	require.NoError(t, err)
+
+	reopened := openTodos(t, rootPath)
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	info, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), sizeWithTornWrite.Size())
+
+	// Writes after recovery land on a clean record boundary
+	require.NoError(t, reopened.Upsert(&models.Todo{Id: "todo3", Text: "after crash"}))
+	require.NoError(t, reopened.Close())
+	again := openTodos(t, rootPath)
+	item, err := again.GetByID("todo3")
+	require.NoError(t, err)
+	assert.Equal(t, "after crash", item.Text)
+}
+
+// failingFile writes half of the next write and fails it once failWrite is
+// set, and fails truncating while failTruncate is set
+type failingFile struct {
+	logFile
+	failWrite    bool
+	failTruncate bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if !f.failWrite {
+		return f.logFile.Write(p)
+	}
+	f.failWrite = false
+	n, _ := f.logFile.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("input/output error")
+	}
+	return f.logFile.Truncate(size)
+}
+
+func TestMemDb_FailedAppendIsRolledBack(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "before"}))
+
+	file := &failingFile{logFile: db.wal.file, failWrite: true}
+	db.wal.file = file
+	require.Error(t, db.Upsert(&models.Todo{Id: "todo2", Text: "failed"}))
+	_, err := db.GetByID("todo2")
+	require.ErrorIs(t, err, dbpkg.ErrNotFound)
+
+	// Writes acknowledged after the failed one survive a restart
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo3", Text: "after"}))
+	require.NoError(t, db.Close())
+	reopened := openTodos(t, rootPath)
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	item, err := reopened.GetByID("todo3")
+	require.NoError(t, err)
+	assert.Equal(t, "after", item.Text)
+}
+
+func TestMemDb_FailedRollbackStopsWrites(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "before"}))
+
+	db.wal.file = &failingFile{logFile: db.wal.file, failWrite: true, failTruncate: true}
+	require.Error(t, db.Upsert(&models.Todo{Id: "todo2", Text: "failed"}))
+	// Nothing is acknowledged that recovery would drop
+	require.Error(t, db.Upsert(&models.Todo{Id: "todo3", Text: "after"}))
+	require.NoError(t, db.Close())
+
+	reopened := openTodos(t, rootPath)
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "todo1", all[0].Id)
+}
+
+func TestMemDb_ChecksumMismatchStopsReplay(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "good"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo2", Text: "flipped"}))
+	require.NoError(t, db.Close())
+
+	logPath := filepath.Join(rootPath, "todos.log")
+	content, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	content[len(content)-5] ^= 0x01
+	require.NoError(t, os.WriteFile(logPath, content, 0644))
+
+	reopened := openTodos(t, rootPath)
+	_, err = reopened.GetByID("todo1")
+	assert.NoError(t, err)
+	_, err = reopened.GetByID("todo2")
+	assert.Error(t, err)
+}
+
+func TestMemDb_ImportsLegacyJsonTable(t *testing.T) {
+	rootPath := t.TempDir()
+	legacy := `{
+    "todo1": {"id": "todo1", "text": "from map", "user_id": "user1"},
+    "todo2": {"id": "todo2", "text": "stale", "user_id": "user1"}
+}
+{"id":"todo2","text":"appended","user_id":"user1"}
+{"id":"todo3","text":"appended too","user_id":"user2"}
+`
+	require.NoError(t, os.WriteFile(filepath.Join(rootPath, "todos.json"), []byte(legacy), 0644))
+
+	db := openTodos(t, rootPath)
+	all, err := db.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	item, err := db.GetByID("todo2")
+	require.NoError(t, err)
+	assert.Equal(t, "appended", item.Text)
+	require.NoError(t, db.Close())
+
+	// The import is written to the log, so later edits to the old file are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(rootPath, "todos.json"), []byte(`{}`), 0644))
+	reopened := openTodos(t, rootPath)
+	all, err = reopened.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
+
+func TestMemDb_Compact(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	for i := 0; i < 50; i++ {
+		require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "rewritten"}))
+	}
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo2", Text: "second"}))
+
+	logPath := filepath.Join(rootPath, "todos.log")
+	before, err := os.Stat(logPath)
+	require.NoError(t, err)
+	require.NoError(t, db.Compact())
+	after, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Less(t, after.Size(), before.Size())
+
+	// The compacted log is still appendable and replays correctly
+	require.NoError(t, db.Delete("todo2"))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo3", Text: "third"}))
+	require.NoError(t, db.Close())
+
+	reopened := openTodos(t, rootPath)
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	_, err = reopened.GetByID("todo2")
+	assert.Error(t, err)
+}
+
+func TestMemDb_InMemoryOnly(t *testing.T) {
+	db, err := Initialize[*models.Todo]("todos", "", false)
+	require.NoError(t, err)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "volatile"}))
+	require.NoError(t, db.Purge("todo1"))
+	assert.Empty(t, db.Data)
+	assert.Empty(t, db.FilePath)
+}
+
+func TestMemDb_Versions(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+
+	todo := &models.Todo{Id: "todo1", Text: "first"}
+	require.NoError(t, db.Upsert(todo))
+	assert.Equal(t, int64(1), todo.Version)
+	assert.NotZero(t, todo.UpdatedAt)
+
+	// Two clients read version 1, the second write is rejected
+	first := &models.Todo{Id: "todo1", Text: "first client"}
+	second := &models.Todo{Id: "todo1", Text: "second client"}
+	require.NoError(t, db.UpsertIfVersion(first, 1))
+	assert.Equal(t, int64(2), first.Version)
+	err := db.UpsertIfVersion(second, 1)
+	assert.ErrorIs(t, err, dbpkg.ErrVersionConflict)
+	var conflict *dbpkg.VersionConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, int64(2), conflict.Actual)
+	assert.Zero(t, second.Version)
+
+	assert.ErrorIs(t, db.UpsertIfVersion(&models.Todo{Id: "todo1"}, 0), dbpkg.ErrVersionConflict)
+	require.NoError(t, db.UpsertIfVersion(&models.Todo{Id: "todo2", Text: "new"}, 0))
+	require.NoError(t, db.Close())
+
+	reopened := openTodos(t, rootPath)
+	stored, err := reopened.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "first client", stored.Text)
+	assert.Equal(t, int64(2), stored.Version)
+}
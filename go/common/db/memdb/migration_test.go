@@ -0,0 +1,119 @@
+package memdb
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	dbpkg "github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var todoMigrations = []dbpkg.Migration[*models.Todo]{
+	{
+		Version:     1,
+		Description: "Trim whitespace around todo text",
+		Migrate: func(todo *models.Todo) (bool, error) {
+			trimmed := strings.TrimSpace(todo.Text)
+			changed := trimmed != todo.Text
+			todo.Text = trimmed
+			return changed, nil
+		},
+	},
+	{
+		Version:     2,
+		Description: "Assign orphaned todos to the system user",
+		Migrate: func(todo *models.Todo) (bool, error) {
+			if todo.UserId != "" {
+				return false, nil
+			}
+			todo.UserId = "system"
+			return true, nil
+		},
+	},
+}
+
+func openMigrator(t *testing.T, rootPath string, migrations []dbpkg.Migration[*models.Todo]) *dbpkg.Migrator[*models.Todo] {
+	t.Helper()
+	versions, err := Initialize[*dbpkg.SchemaVersion](dbpkg.SchemaVersionTable, rootPath, true)
+	require.NoError(t, err)
+	t.Cleanup(func() { versions.Close() })
+	return &dbpkg.Migrator[*models.Todo]{Table: "todos", Items: openTodos(t, rootPath), Versions: versions, Migrations: migrations}
+}
+
+func TestMigrator_AppliesPendingMigrations(t *testing.T) {
+	rootPath := t.TempDir()
+	migrator := openMigrator(t, rootPath, todoMigrations[:1])
+	for i := range 1200 {
+		require.NoError(t, migrator.Items.Upsert(&models.Todo{Id: fmt.Sprintf("todo%04d", i), Text: " padded ", UserId: "user1"}))
+	}
+	require.NoError(t, migrator.Items.Upsert(&models.Todo{Id: "orphan", Text: "no user"}))
+	require.NoError(t, migrator.Items.Delete("orphan"))
+
+	report, err := migrator.Run()
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.From)
+	assert.Equal(t, 1, report.To)
+	assert.Equal(t, 1201, report.Scanned)
+	assert.Equal(t, 1200, report.Changed[1])
+	todo, err := migrator.Items.GetByID("todo0042")
+	require.NoError(t, err)
+	assert.Equal(t, "padded", todo.Text)
+	assert.Equal(t, int64(2), todo.Version)
+
+	// Running again changes nothing
+	report, err = migrator.Run()
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.From)
+	assert.Equal(t, 0, report.Scanned)
+
+	// A new migration only runs the new step, items in the trash included
+	migrator.Migrations = todoMigrations
+	report, err = migrator.Run()
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.From)
+	assert.Equal(t, 2, report.To)
+	assert.Equal(t, 0, report.Changed[1])
+	assert.Equal(t, 1, report.Changed[2])
+	require.NoError(t, migrator.Items.Restore("orphan"))
+	orphan, err := migrator.Items.GetByID("orphan")
+	require.NoError(t, err)
+	assert.Equal(t, "system", orphan.UserId)
+}
+
+func TestMigrator_DryRunWritesNothing(t *testing.T) {
+	migrator := openMigrator(t, t.TempDir(), todoMigrations)
+	require.NoError(t, migrator.Items.Upsert(&models.Todo{Id: "todo1", Text: "  spaced  "}))
+	migrator.DryRun = true
+
+	report, err := migrator.Run()
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Changed[1])
+	assert.Equal(t, 1, report.Changed[2])
+	assert.Contains(t, report.String(), "would migrate")
+
+	todo, err := migrator.Items.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "  spaced  ", todo.Text)
+	_, err = migrator.Versions.GetByID("todos")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+}
+
+func TestMigrator_RefusesNewerSchema(t *testing.T) {
+	rootPath := t.TempDir()
+	migrator := openMigrator(t, rootPath, todoMigrations)
+	_, err := migrator.Run()
+	require.NoError(t, err)
+
+	// Older code only knows the first migration
+	migrator.Migrations = todoMigrations[:1]
+	_, err = migrator.Run()
+	assert.ErrorIs(t, err, dbpkg.ErrSchemaTooNew)
+
+	migrator.Migrations = []dbpkg.Migration[*models.Todo]{todoMigrations[1], todoMigrations[0]}
+	_, err = migrator.Run()
+	assert.ErrorContains(t, err, "increasing")
+}
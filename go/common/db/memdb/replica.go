@@ -0,0 +1,103 @@
+package memdb
+
+import (
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// A replica is a table that follows the changes of another table, its
+// leader, instead of being written to directly. It applies each change with
+// the sequence number the leader gave it, so the replica can serve watchers
+// and replicas of its own, and it continues the leader's sequence once it is
+// written to, e.g. after it took over from a failed leader.
+//
+// Items are applied as the leader stored them, version and update time
+// included. A TTL counts from when the replica applied the write. Replicas
+// must not expire items themselves, which would give them changes of their
+// own; expired items are left out of reads and deleted when the leader's
+// delete arrives.
+
+// Snapshot returns copies of every item that has not expired, those in the
+// trash included, and the sequence number of the last change they reflect.
+// A replica that is reset to the snapshot can follow the changes after it.
+func (db *MemDb[T]) Snapshot() (uint64, []T, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	now := time.Now()
+	items := make([]T, 0, len(db.Data))
+	for id, item := range db.Data {
+		if db.expired(id, now) {
+			continue
+		}
+		clone, _, err := cloneItem(item)
+		if err != nil {
+			return 0, nil, err
+		}
+		items = append(items, clone)
+	}
+	return db.seq, items, nil
+}
+
+// ApplyChange applies a change of the leader of a replica. Changes that are
+// not newer than LatestSeq have been applied already and are ignored.
+func (db *MemDb[T]) ApplyChange(event db.ChangeEvent[T]) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if event.Seq <= db.seq {
+		return nil
+	}
+
+	write := txWrite{Op: opDelete, ID: event.ID}
+	if event.Op != changeDelete {
+		data, err := db.encode(event.After, nil)
+		if err != nil {
+			return err
+		}
+		write = txWrite{Op: opUpsert, ID: event.ID, Data: data, Time: time.Now().UnixMilli()}
+	}
+	if db.wal != nil {
+		record := &logRecord{Seq: event.Seq, Op: write.Op, ID: write.ID, Data: write.Data, Time: write.Time}
+		if err := db.wal.append(record); err != nil {
+			return err
+		}
+	}
+	if err := db.applyWrite(event.Seq, write); err != nil {
+		return err
+	}
+	return db.maybeCompact()
+}
+
+// Reset replaces the items of a replica with a snapshot of its leader taken
+// at change seq, for a replica that is too far behind to catch up from the
+// changes. Watchers of the replica have to start over.
+func (db *MemDb[T]) Reset(seq uint64, items []T) error {
+	clones := make(map[string]T, len(items))
+	for _, item := range items {
+		id, err := common.GetID(item)
+		if err != nil {
+			return err
+		}
+		if clones[id], _, err = cloneItem(item); err != nil {
+			return err
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for id := range db.Data {
+		db.remove(id)
+	}
+	db.expiries = db.expiries[:0]
+	now := time.Now().UnixMilli()
+	for id, item := range clones {
+		db.put(id, item)
+		db.written(id, now)
+	}
+	db.seq = seq
+	db.history = nil
+	db.changed.Notify()
+	return db.compact()
+}
@@ -0,0 +1,88 @@
+package memdb
+
+import (
+	"context"
+	"testing"
+
+	dbpkg "github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemDb_ReplicaAppliesLeaderChanges(t *testing.T) {
+	leader := openTodos(t, t.TempDir())
+	replicaRoot := t.TempDir()
+	replica := openTodos(t, replicaRoot)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := leader.Watch(ctx, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, leader.Upsert(&models.Todo{Id: "todo1", Text: "first"}))
+	require.NoError(t, leader.Upsert(&models.Todo{Id: "todo1", Text: "edited"}))
+	require.NoError(t, leader.Upsert(&models.Todo{Id: "todo2", Text: "second"}))
+	require.NoError(t, leader.Purge("todo2"))
+	for range 4 {
+		event := nextEvent(t, sub.Events())
+		require.NoError(t, replica.ApplyChange(event))
+		// Applying a change again does nothing
+		require.NoError(t, replica.ApplyChange(event))
+	}
+
+	todo, err := replica.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, "edited", todo.Text)
+	assert.Equal(t, int64(2), todo.Version)
+	_, err = replica.GetByID("todo2")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+
+	// The replica keeps the leader's sequence across a restart and continues
+	// it when written to
+	require.NoError(t, replica.Close())
+	replica = openTodos(t, replicaRoot)
+	latest, err := replica.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), latest)
+	require.NoError(t, replica.Upsert(&models.Todo{Id: "todo3", Text: "after promotion"}))
+	latest, err = replica.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), latest)
+}
+
+func TestMemDb_ReplicaResetsToSnapshot(t *testing.T) {
+	leader := openTodos(t, t.TempDir())
+	require.NoError(t, leader.Upsert(&models.Todo{Id: "todo1", Text: "kept"}))
+	require.NoError(t, leader.Upsert(&models.Todo{Id: "todo2", Text: "trashed"}))
+	require.NoError(t, leader.Delete("todo2"))
+	seq, items, err := leader.Snapshot()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+	assert.Len(t, items, 2)
+
+	replicaRoot := t.TempDir()
+	replica := openTodos(t, replicaRoot)
+	require.NoError(t, replica.Upsert(&models.Todo{Id: "stale", Text: "not on the leader"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := replica.Watch(ctx, 1)
+	require.NoError(t, err)
+
+	require.NoError(t, replica.Reset(seq, items))
+	_, err = replica.GetByID("stale")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	require.NoError(t, replica.Restore("todo2"))
+	// Watchers of the replica cannot tell what changed
+	_, open := <-sub.Events()
+	assert.False(t, open)
+	assert.ErrorIs(t, sub.Err(), dbpkg.ErrChangesExpired)
+
+	require.NoError(t, replica.Close())
+	replica = openTodos(t, replicaRoot)
+	all, err := replica.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+	latest, err := replica.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), latest)
+}
@@ -0,0 +1,84 @@
+package memdb
+
+import (
+	"testing"
+	"time"
+
+	dbpkg "github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemDb_SoftDeleteAndRestore(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo2", Text: "second", UserId: "user1"}))
+
+	require.NoError(t, db.Delete("todo1"))
+	require.NoError(t, db.Delete("todo1"))
+	_, err := db.GetByID("todo1")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	_, err = db.GetByField("text", "first")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	filtered, err := db.GetByFilter(map[string]any{"user_id": "user1"})
+	require.NoError(t, err)
+	assert.Len(t, filtered, 1)
+	page, err := db.Query(dbpkg.Query{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+
+	// The trash survives a restart
+	require.NoError(t, db.Close())
+	db = openTodos(t, rootPath)
+	all, err := db.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 1)
+
+	require.NoError(t, db.Restore("todo1"))
+	todo, err := db.GetByID("todo1")
+	require.NoError(t, err)
+	assert.True(t, todo.GetDeletedAt().IsZero())
+	assert.ErrorIs(t, db.Restore("todo1"), dbpkg.ErrNotFound)
+	assert.ErrorIs(t, db.Restore("missing"), dbpkg.ErrNotFound)
+}
+
+func TestMemDb_PurgeDeleted(t *testing.T) {
+	db := openTodos(t, t.TempDir())
+	require.NoError(t, db.Upsert(&models.Todo{Id: "old"}))
+	require.NoError(t, db.Upsert(&models.Todo{Id: "kept"}))
+	require.NoError(t, db.Delete("old"))
+	cutoff := time.Now().Add(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, db.Delete("kept"))
+
+	purged, err := db.PurgeDeleted(cutoff)
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.ErrorIs(t, db.Restore("old"), dbpkg.ErrNotFound)
+	require.NoError(t, db.Restore("kept"))
+
+	require.NoError(t, db.Purge("kept"))
+	assert.Empty(t, db.Data)
+}
+
+func TestTx_SoftDelete(t *testing.T) {
+	f := openTxFixture(t, t.TempDir())
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t1"}))
+
+	tx, _, todos := f.begin(t)
+	require.NoError(t, todos.Delete("t1"))
+	_, err := todos.GetByID("t1")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	page, err := todos.Query(dbpkg.Query{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	require.NoError(t, todos.Restore("t1"))
+	require.NoError(t, todos.Delete("t1"))
+	require.NoError(t, tx.Commit())
+
+	_, err = f.todos.GetByID("t1")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	require.NoError(t, f.todos.Restore("t1"))
+}
@@ -0,0 +1,118 @@
+package memdb
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// Items expire a TTL after they were last written, or at their own time if
+// they implement db.Expirable. Write times are kept in the table log, so
+// changing the TTL of a table applies to the items already in it. Items
+// written before write times were logged count as written when the table
+// was opened.
+//
+// Expired items are left out of reads right away. They are deleted, which
+// publishes a delete change, by the next write to the table or by ExpireDue,
+// whichever comes first.
+
+// WithTTL makes the items of a table expire ttl after they were last written
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// expiry is an entry of the expiry queue
+type expiry struct {
+	at time.Time
+	id string
+}
+
+// expiryQueue orders the items of a table by expiry time. An item that is
+// written again gets a new entry; the old one is skipped when it comes up.
+type expiryQueue []expiry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x any)        { *q = append(*q, x.(expiry)) }
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	last := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return last
+}
+
+// written records that the item with the given id was written at writtenAt,
+// in unix milliseconds, and schedules its expiry. The caller must hold the
+// write lock.
+func (db *MemDb[T]) written(id string, writtenAt int64) {
+	if writtenAt <= 0 {
+		writtenAt = time.Now().UnixMilli()
+	}
+	db.writeTimes[id] = writtenAt
+	if at := db.expiresAt(id); !at.IsZero() {
+		heap.Push(&db.expiries, expiry{at: at, id: id})
+	}
+	// Drop the entries of items that were written again or deleted once
+	// they pile up
+	if len(db.expiries) > 2*len(db.Data)+minCompactRecords {
+		db.expiries = db.expiries[:0]
+		for id := range db.Data {
+			if at := db.expiresAt(id); !at.IsZero() {
+				db.expiries = append(db.expiries, expiry{at: at, id: id})
+			}
+		}
+		heap.Init(&db.expiries)
+	}
+}
+
+// expiresAt returns when the stored item with the given id expires, the zero
+// time if it does not. The caller must hold the lock.
+func (db *MemDb[T]) expiresAt(id string) time.Time {
+	item, exists := db.Data[id]
+	if !exists {
+		return time.Time{}
+	}
+	return itemExpiresAt(item, time.UnixMilli(db.writeTimes[id]), db.ttl)
+}
+
+// expired reports whether the stored item with the given id has expired by
+// now. The caller must hold the lock.
+func (db *MemDb[T]) expired(id string, now time.Time) bool {
+	at := db.expiresAt(id)
+	return !at.IsZero() && !now.Before(at)
+}
+
+// ExpireDue implements the db.Expirer interface
+func (db *MemDb[T]) ExpireDue(now time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.expireDue(now)
+}
+
+// expireDue deletes the items that have expired by now. The caller must hold
+// the write lock.
+func (db *MemDb[T]) expireDue(now time.Time) (int, error) {
+	expired := 0
+	for len(db.expiries) > 0 && !now.Before(db.expiries[0].at) {
+		next := heap.Pop(&db.expiries).(expiry)
+		if !db.expired(next.id, now) {
+			continue
+		}
+		if err := db.purge(next.id); err != nil {
+			// Try again next time
+			heap.Push(&db.expiries, next)
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// itemExpiresAt lets MemDb methods, whose receiver shadows the db package,
+// use db.ExpiresAt
+var itemExpiresAt = db.ExpiresAt
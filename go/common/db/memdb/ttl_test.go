@@ -0,0 +1,152 @@
+package memdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	dbpkg "github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// session expires at a time of its own
+type session struct {
+	common.Model
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *session) GetExpiresAt() time.Time { return s.ExpiresAt }
+
+func TestTTL_ExpiredItemsAreHiddenFromReads(t *testing.T) {
+	db, err := Initialize[*models.Todo]("todos", t.TempDir(), true, WithIndex("user_id"), WithTTL(50*time.Millisecond))
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", UserId: "user1"}))
+
+	_, err = db.GetByID("todo1")
+	require.NoError(t, err)
+	time.Sleep(60 * time.Millisecond)
+
+	_, err = db.GetByID("todo1")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	_, err = db.GetByField("user_id", "user1")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	byUser, err := db.GetByFilter(map[string]any{"user_id": "user1"})
+	require.NoError(t, err)
+	assert.Empty(t, byUser)
+	page, err := db.Query(dbpkg.Query{})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+
+	// Writing again starts the TTL over
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", UserId: "user1"}))
+	_, err = db.GetByID("todo1")
+	assert.NoError(t, err)
+}
+
+func TestTTL_ItemsExpireAtTheirOwnTime(t *testing.T) {
+	db, err := Initialize[*session]("sessions", t.TempDir(), false, WithTTL(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, db.Upsert(&session{ID: "short", ExpiresAt: time.Now().Add(30 * time.Millisecond)}))
+	require.NoError(t, db.Upsert(&session{ID: "long", ExpiresAt: time.Now().Add(2 * time.Hour)}))
+	time.Sleep(40 * time.Millisecond)
+
+	all, err := db.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	assert.Equal(t, "long", all[0].ID)
+	// The table TTL comes first for the other session
+	assert.WithinDuration(t, time.Now().Add(time.Hour), db.expiresAt("long"), time.Minute)
+}
+
+func TestTTL_ExpireDuePublishesDeletes(t *testing.T) {
+	db, err := Initialize[*models.Todo]("todos", t.TempDir(), true, WithTTL(30*time.Millisecond))
+	require.NoError(t, err)
+	defer db.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub, err := db.Watch(ctx, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1", Text: "short lived"}))
+	expired, err := db.ExpireDue(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, expired)
+
+	expired, err = db.ExpireDue(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assert.Empty(t, db.Data)
+
+	assert.Equal(t, dbpkg.Insert, nextEvent(t, sub.Events()).Op)
+	event := nextEvent(t, sub.Events())
+	assert.Equal(t, dbpkg.Delete, event.Op)
+	assert.Equal(t, "short lived", event.Before.Text)
+}
+
+func TestTTL_RunExpirerSweepsTheTable(t *testing.T) {
+	db, err := Initialize[*models.Todo]("todos", t.TempDir(), false, WithTTL(20*time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "todo1"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dbpkg.RunExpirer(ctx, db, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		db.mu.RLock()
+		defer db.mu.RUnlock()
+		return len(db.Data) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTTL_WriteTimesSurviveRestart(t *testing.T) {
+	rootPath := t.TempDir()
+	db := openTodos(t, rootPath)
+	require.NoError(t, db.Upsert(&models.Todo{Id: "compacted"}))
+	require.NoError(t, db.Compact())
+	require.NoError(t, db.Upsert(&models.Todo{Id: "logged"}))
+	require.NoError(t, db.Close())
+	time.Sleep(60 * time.Millisecond)
+
+	// A TTL set on an existing table applies to the items already in it
+	reopened, err := Initialize[*models.Todo]("todos", rootPath, true, WithTTL(50*time.Millisecond))
+	require.NoError(t, err)
+	defer reopened.Close()
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	// The next write deletes the expired items for good
+	require.NoError(t, reopened.Upsert(&models.Todo{Id: "fresh"}))
+	assert.Len(t, reopened.Data, 1)
+}
+
+func TestTTL_TransactionsSeeExpiredItemsAsGone(t *testing.T) {
+	rootPath := t.TempDir()
+	store, err := OpenStore(rootPath, true)
+	require.NoError(t, err)
+	defer store.Close()
+	users, err := Initialize[*models.User]("users", rootPath, true, WithStore(store), WithUniqueIndex("username"), WithTTL(30*time.Millisecond))
+	require.NoError(t, err)
+	defer users.Close()
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	time.Sleep(40 * time.Millisecond)
+
+	tx := store.Begin()
+	txUsers, err := Within(tx, users)
+	require.NoError(t, err)
+	_, err = txUsers.GetByID("u1")
+	assert.ErrorIs(t, err, dbpkg.ErrNotFound)
+	// The expired user no longer holds the username
+	require.NoError(t, txUsers.Upsert(&models.User{ID: "u2", Username: "alice"}))
+	require.NoError(t, tx.Commit())
+
+	user, err := users.GetByField("username", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "u2", user.ID)
+}
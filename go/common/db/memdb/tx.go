@@ -0,0 +1,728 @@
+package memdb
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// Transactions group writes to several MemDb tables so that they take effect
+// together or not at all. Tables that take part in transactions are attached
+// to a Store with WithStore:
+//
+//	store, _ := memdb.OpenStore(rootPath, true)
+//	users, _ := memdb.Initialize[*models.User]("users", rootPath, true, memdb.WithStore(store))
+//	todos, _ := memdb.Initialize[*models.Todo]("todos", rootPath, true, memdb.WithStore(store))
+//
+//	tx := store.Begin()
+//	txUsers, _ := memdb.Within(tx, users)
+//	txTodos, _ := memdb.Within(tx, todos)
+//	... write through txUsers and txTodos ...
+//	err := tx.Commit()
+//
+// Writes made through a transaction are buffered until Commit and are not
+// visible to readers of the tables before then. Reads through a transaction
+// see the committed data with the transaction's own writes on top.
+//
+// Commit locks every table in the transaction, checks the unique indexes and
+// then appends a single commit record holding all writes to the store's
+// transaction log. Once that record is durable the transaction is committed.
+// Each table then records the writes in its own log as one batch and applies
+// them in memory before the locks are released. If the process stops before
+// every table has done so, the tables catch up from the transaction log when
+// they are attached again.
+
+const txLogFileName = "transactions" + logFileExtension
+
+// ErrTxDone is returned when a transaction is used after it was committed or
+// rolled back. It is the same error as db.ErrTxDone.
+var ErrTxDone = db.ErrTxDone
+
+// txWrite is a single write of a transaction
+type txWrite struct {
+	Table string
+	Op    logOp
+	ID    string
+	// Data is the item encoded with the codec of the table
+	Data []byte
+	// Time is when the write was committed in unix milliseconds
+	Time int64
+}
+
+// txTable is the part of a MemDb the store needs for recovery
+type txTable interface {
+	tableName() string
+	persistent() bool
+	recoverTx(txid uint64, writes []txWrite) error
+}
+
+// committedTx is a transaction from the transaction log that some attached
+// or not yet attached tables may still have to apply
+type committedTx struct {
+	txid   uint64
+	writes []txWrite
+	tables map[string]bool // tables that may not have applied it yet
+}
+
+// Store coordinates transactions across the MemDb tables attached to it
+type Store struct {
+	FilePath   string
+	SaveToDisk bool
+
+	mu      sync.Mutex
+	wal     *writeAheadLog
+	lastTx  uint64 // used instead of the log sequence when not saving to disk
+	tables  map[string]bool
+	pending []*committedTx
+}
+
+// OpenStore opens the transaction log under rootPath
+func OpenStore(rootPath string, saveToDisk bool) (*Store, error) {
+	store := &Store{SaveToDisk: saveToDisk, tables: map[string]bool{}}
+	if !saveToDisk {
+		return store, nil
+	}
+	store.FilePath = filepath.Join(rootPath, txLogFileName)
+	wal, err := openLog(store.FilePath, JSONCodec)
+	if err != nil {
+		log.Printf("Could not open transaction log %s: %v", store.FilePath, err)
+		return nil, err
+	}
+	if err := wal.recover(store.applyRecord); err != nil {
+		log.Printf("Could not open transaction log %s: %v", store.FilePath, err)
+		wal.close()
+		return nil, err
+	}
+	store.wal = wal
+	if wal.outdated() {
+		if err := store.compact(); err != nil {
+			wal.close()
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+func (store *Store) applyRecord(record *logRecord) error {
+	switch record.Op {
+	case opCommit:
+		tables := map[string]bool{}
+		for _, write := range record.Writes {
+			tables[write.Table] = true
+		}
+		store.pending = append(store.pending, &committedTx{txid: record.Seq, writes: record.Writes, tables: tables})
+	case opCheckpoint:
+	default:
+		return fmt.Errorf("unknown transaction log operation %q", record.Op)
+	}
+	return nil
+}
+
+// WithStore attaches a table to a store so it can take part in transactions.
+// Transactions the table missed are applied to it during Initialize.
+func WithStore(store *Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// attach registers a table and brings it up to date with the transaction log
+// Store returns the store the table is attached to, nil if it is not
+func (db *MemDb[T]) Store() *Store {
+	return db.store
+}
+
+func (store *Store) attach(table txTable) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	name := table.tableName()
+	if store.tables[name] {
+		return fmt.Errorf("table %s is already attached", name)
+	}
+	for _, tx := range store.pending {
+		if !tx.tables[name] {
+			continue
+		}
+		if table.persistent() {
+			writes := make([]txWrite, 0, len(tx.writes))
+			for _, write := range tx.writes {
+				if write.Table == name {
+					writes = append(writes, write)
+				}
+			}
+			if err := table.recoverTx(tx.txid, writes); err != nil {
+				return err
+			}
+		}
+		delete(tx.tables, name)
+	}
+	store.tables[name] = true
+	store.prunePending()
+	return nil
+}
+
+// prunePending forgets transactions every table has applied
+func (store *Store) prunePending() {
+	pending := store.pending[:0]
+	for _, tx := range store.pending {
+		if len(tx.tables) > 0 {
+			pending = append(pending, tx)
+		}
+	}
+	store.pending = pending
+}
+
+// maybeCompact drops the transactions every table has applied from the
+// transaction log once it has grown large. The caller must hold the lock.
+func (store *Store) maybeCompact() error {
+	if store.wal == nil || store.wal.records < minCompactRecords {
+		return nil
+	}
+	return store.compact()
+}
+
+func (store *Store) compact() error {
+	// The checkpoint keeps transaction ids increasing across restarts
+	records := []*logRecord{{Seq: store.wal.seq, Op: opCheckpoint}}
+	for _, tx := range store.pending {
+		records = append(records, &logRecord{Seq: tx.txid, Op: opCommit, Writes: tx.writes})
+	}
+	if err := store.wal.rewrite(records); err != nil {
+		log.Printf("Error compacting transaction log %s: %v", store.FilePath, err)
+		return err
+	}
+	return nil
+}
+
+// Close releases the transaction log. Transactions must not be committed
+// afterwards.
+func (store *Store) Close() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.wal == nil {
+		return nil
+	}
+	err := store.wal.close()
+	store.wal = nil
+	return err
+}
+
+// Begin starts a new transaction
+func (store *Store) Begin() *Tx {
+	return &Tx{store: store, tables: map[string]txParticipant{}}
+}
+
+// txParticipant is the buffered writes of a transaction to one table
+type txParticipant interface {
+	tableName() string
+	lock()
+	unlock()
+	validate() error
+	encode(now time.Time) ([]txWrite, error)
+	apply(txid uint64, writes []txWrite) error
+}
+
+// Tx is a transaction over tables of one Store. It implements
+// db.Transaction. A Tx is safe for concurrent use, but is meant to be used
+// by one goroutine at a time.
+type Tx struct {
+	store *Store
+
+	mu     sync.Mutex
+	tables map[string]txParticipant
+	done   bool
+}
+
+// Rollback discards the writes of the transaction
+func (tx *Tx) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.tables = nil
+	return nil
+}
+
+// Commit applies the writes of the transaction to all tables at once. If a
+// write would break a unique index or finds a stale version nothing is
+// applied.
+func (tx *Tx) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	participants := make([]txParticipant, 0, len(tx.tables))
+	for _, participant := range tx.tables {
+		participants = append(participants, participant)
+	}
+	tx.tables = nil
+	return tx.store.commit(participants)
+}
+
+func (store *Store) commit(participants []txParticipant) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	// Lock the tables in a fixed order so concurrent commits cannot deadlock
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].tableName() < participants[j].tableName()
+	})
+	for _, participant := range participants {
+		participant.lock()
+		defer participant.unlock()
+	}
+
+	now := time.Now()
+	writes := []txWrite{}
+	tableWrites := make([][]txWrite, len(participants))
+	for i, participant := range participants {
+		if err := participant.validate(); err != nil {
+			log.Printf("Transaction rejected by table %s: %v", participant.tableName(), err)
+			return err
+		}
+		encoded, err := participant.encode(now)
+		if err != nil {
+			return err
+		}
+		tableWrites[i] = encoded
+		writes = append(writes, encoded...)
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+
+	var txid uint64
+	if store.wal != nil {
+		record := &logRecord{Op: opCommit, Writes: writes}
+		if err := store.wal.append(record); err != nil {
+			return err
+		}
+		txid = record.Seq
+	} else {
+		store.lastTx++
+		txid = store.lastTx
+	}
+
+	// The transaction is committed. A table that fails to log its writes
+	// still applies them in memory and catches up from the transaction log
+	// after a restart.
+	var failed map[string]bool
+	var applyErr error
+	for i, participant := range participants {
+		if err := participant.apply(txid, tableWrites[i]); err != nil {
+			if failed == nil {
+				failed = map[string]bool{}
+			}
+			failed[participant.tableName()] = true
+			applyErr = err
+		}
+	}
+	if failed != nil {
+		store.pending = append(store.pending, &committedTx{txid: txid, writes: writes, tables: failed})
+		return fmt.Errorf("transaction %d committed but not logged by every table: %w", txid, applyErr)
+	}
+	return store.maybeCompact()
+}
+
+// TxTable is the view of a table within a transaction. It implements the
+// DbDriver interface: writes are buffered in the transaction, reads see the
+// committed data of the table with the buffered writes on top.
+type TxTable[T common.Serializable] struct {
+	tx    *Tx
+	table *MemDb[T]
+
+	writes map[string]*stagedWrite[T]
+}
+
+type stagedWrite[T common.Serializable] struct {
+	deleted bool
+	item    T
+
+	// the write only succeeds if the stored item is at version
+	conditional bool
+	version     int64
+}
+
+// Within returns the view of table within tx. The table has to be attached
+// to the store tx was started from.
+func Within[T common.Serializable](tx *Tx, table *MemDb[T]) (*TxTable[T], error) {
+	if table.store != tx.store {
+		return nil, fmt.Errorf("table %s is not attached to the transaction's store", table.Table)
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done {
+		return nil, ErrTxDone
+	}
+	if participant, exists := tx.tables[table.Table]; exists {
+		return participant.(*TxTable[T]), nil
+	}
+	txTable := &TxTable[T]{tx: tx, table: table, writes: map[string]*stagedWrite[T]{}}
+	tx.tables[table.Table] = txTable
+	return txTable, nil
+}
+
+// stage buffers a write unless the transaction is finished
+func (tt *TxTable[T]) stage(id string, write *stagedWrite[T]) error {
+	tt.tx.mu.Lock()
+	defer tt.tx.mu.Unlock()
+	if tt.tx.done {
+		return ErrTxDone
+	}
+	tt.writes[id] = write
+	return nil
+}
+
+// Upsert implements the DbDriver interface
+func (tt *TxTable[T]) Upsert(item T) error {
+	return tt.upsert(item, false, 0)
+}
+
+// UpsertIfVersion implements the DbDriver interface. The version is checked
+// when the transaction commits.
+func (tt *TxTable[T]) UpsertIfVersion(item T, version int64) error {
+	return tt.upsert(item, true, version)
+}
+
+func (tt *TxTable[T]) upsert(item T, conditional bool, version int64) error {
+	id, err := common.GetID(item)
+	if err != nil {
+		return err
+	}
+	stored, _, err := cloneItem(item)
+	if err != nil {
+		return err
+	}
+	return tt.stage(id, &stagedWrite[T]{item: stored, conditional: conditional, version: version})
+}
+
+// Delete implements the DbDriver interface
+func (tt *TxTable[T]) Delete(id string) error {
+	if !isSoftDeletable[T]() {
+		return tt.Purge(id)
+	}
+	item, exists, err := tt.current(id)
+	if err != nil || !exists || isDeleted(item) {
+		return err
+	}
+	any(item).(softDeletable).SetDeletedAt(time.Now())
+	return tt.stage(id, &stagedWrite[T]{item: item})
+}
+
+// Restore implements the DbDriver interface
+func (tt *TxTable[T]) Restore(id string) error {
+	item, exists, err := tt.current(id)
+	if err != nil {
+		return err
+	}
+	if !exists || !isDeleted(item) {
+		return errNotFound
+	}
+	any(item).(softDeletable).SetDeletedAt(time.Time{})
+	return tt.stage(id, &stagedWrite[T]{item: item})
+}
+
+// Purge implements the DbDriver interface
+func (tt *TxTable[T]) Purge(id string) error {
+	return tt.stage(id, &stagedWrite[T]{deleted: true})
+}
+
+// current returns a copy of the item with the given id as the transaction
+// sees it, even if it is in the trash
+func (tt *TxTable[T]) current(id string) (T, bool, error) {
+	tt.tx.mu.Lock()
+	write, staged := tt.writes[id]
+	done := tt.tx.done
+	tt.tx.mu.Unlock()
+
+	var zero T
+	switch {
+	case done:
+		return zero, false, ErrTxDone
+	case !staged:
+		return tt.table.lookup(id)
+	case write.deleted:
+		return zero, false, nil
+	default:
+		clone, _, err := cloneItem(write.item)
+		return clone, true, err
+	}
+}
+
+// GetByID implements the DbDriver interface
+func (tt *TxTable[T]) GetByID(id string) (T, error) {
+	item, exists, err := tt.current(id)
+	if err != nil {
+		return item, err
+	}
+	if !exists || isDeleted(item) {
+		var zero T
+		return zero, errNotFound
+	}
+	return item, nil
+}
+
+// GetAll implements the DbDriver interface
+func (tt *TxTable[T]) GetAll() ([]T, error) {
+	return tt.items(false)
+}
+
+// items returns copies of the items as the transaction sees them, including
+// those in the trash if includeDeleted is set
+func (tt *TxTable[T]) items(includeDeleted bool) ([]T, error) {
+	committed, err := tt.table.snapshot(includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	tt.tx.mu.Lock()
+	defer tt.tx.mu.Unlock()
+	if tt.tx.done {
+		return nil, ErrTxDone
+	}
+	items := make([]T, 0, len(committed)+len(tt.writes))
+	for _, item := range committed {
+		id, err := common.GetID(item)
+		if err != nil {
+			return nil, err
+		}
+		if _, staged := tt.writes[id]; !staged {
+			items = append(items, item)
+		}
+	}
+	for _, write := range tt.writes {
+		if write.deleted || (!includeDeleted && isDeleted(write.item)) {
+			continue
+		}
+		clone, _, err := cloneItem(write.item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, clone)
+	}
+	return items, nil
+}
+
+// GetByField implements the DbDriver interface
+func (tt *TxTable[T]) GetByField(field string, value any) (T, error) {
+	var zero T
+	items, err := tt.GetByFilter(map[string]any{field: value})
+	if err != nil {
+		return zero, err
+	}
+	if len(items) == 0 {
+		return zero, errNotFound
+	}
+	return items[0], nil
+}
+
+// GetByFilter implements the DbDriver interface
+func (tt *TxTable[T]) GetByFilter(filters map[string]any) ([]T, error) {
+	if err := db.ValidateFilters[T](filters); err != nil {
+		return nil, err
+	}
+	items, err := tt.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0)
+	for _, item := range items {
+		matches := true
+		for field, value := range filters {
+			itemField, err := common.GetField(item, field)
+			if err != nil {
+				return nil, err
+			}
+			if itemField != value {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// Query implements the DbDriver interface
+func (tt *TxTable[T]) Query(query db.Query) (*db.Page[T], error) {
+	items, err := tt.items(query.IncludeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	return db.RunQuery(items, query)
+}
+
+func (tt *TxTable[T]) tableName() string {
+	return tt.table.Table
+}
+
+func (tt *TxTable[T]) lock() {
+	tt.table.mu.Lock()
+}
+
+func (tt *TxTable[T]) unlock() {
+	tt.table.mu.Unlock()
+}
+
+func (tt *TxTable[T]) validate() error {
+	// Expired items must not count as conflicting with the transaction
+	if _, err := tt.table.expireDue(time.Now()); err != nil {
+		return err
+	}
+	return tt.table.checkTx(tt.writes)
+}
+
+// encode stamps the buffered items with their new version and returns the
+// writes sorted by id. The caller must hold the table lock.
+func (tt *TxTable[T]) encode(now time.Time) ([]txWrite, error) {
+	ids := make([]string, 0, len(tt.writes))
+	for id := range tt.writes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	writes := make([]txWrite, 0, len(ids))
+	for _, id := range ids {
+		staged := tt.writes[id]
+		if staged.deleted {
+			writes = append(writes, txWrite{Table: tt.table.Table, Op: opDelete, ID: id})
+			continue
+		}
+		stamp(staged.item, tt.table.storedVersion(id), now)
+		data, err := tt.table.codec.Marshal(staged.item)
+		if err != nil {
+			log.Printf("Error encoding item with %s codec: %v", tt.table.codec.Name(), err)
+			return nil, err
+		}
+		writes = append(writes, txWrite{Table: tt.table.Table, Op: opUpsert, ID: id, Data: data, Time: now.UnixMilli()})
+	}
+	return writes, nil
+}
+
+func (tt *TxTable[T]) apply(txid uint64, writes []txWrite) error {
+	tableWrites := make([]txWrite, len(writes))
+	for i, write := range writes {
+		write.Table = ""
+		tableWrites[i] = write
+	}
+	return tt.table.applyTx(txid, tableWrites)
+}
+
+// checkTx returns a VersionConflictError if a conditional write finds a
+// different version, and ErrUniqueViolation if the staged writes would break
+// a unique index. The caller must hold the write lock.
+func (db *MemDb[T]) checkTx(writes map[string]*stagedWrite[T]) error {
+	for id, write := range writes {
+		if write.conditional {
+			if err := checkVersion(id, write.version, db.storedVersion(id)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, idx := range db.indexes {
+		if !idx.unique {
+			continue
+		}
+		taken := map[any]string{}
+		for id, write := range writes {
+			if write.deleted {
+				continue
+			}
+			key, err := idx.indexKey(write.item)
+			if err != nil {
+				return err
+			}
+			if _, exists := taken[key]; exists {
+				return fmt.Errorf("%w: %s %v is already taken", ErrUniqueViolation, idx.field, key)
+			}
+			taken[key] = id
+			// Items written in the same transaction give up their old key
+			for holder := range idx.entries[key] {
+				if _, rewritten := writes[holder]; !rewritten {
+					return fmt.Errorf("%w: %s %v is already taken", ErrUniqueViolation, idx.field, key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applyTx records the writes of a committed transaction in the table log as a
+// single record and applies them. The caller must hold the write lock.
+func (db *MemDb[T]) applyTx(txid uint64, writes []txWrite) error {
+	if len(writes) == 0 {
+		return nil
+	}
+	// Each write is a change of its own, the record takes the sequence
+	// number of the last one
+	first := db.seq + 1
+	var logErr error
+	if db.wal != nil {
+		record := &logRecord{Seq: db.seq + uint64(len(writes)), Op: opTx, Tx: txid, Writes: writes}
+		if logErr = db.wal.append(record); logErr != nil {
+			log.Printf("Could not log transaction %d in table %s: %v", txid, db.Table, logErr)
+		}
+	}
+	var applyErr error
+	for i, write := range writes {
+		if err := db.applyWrite(first+uint64(i), write); err != nil {
+			applyErr = err
+		}
+	}
+	db.lastTx = txid
+	if err := errors.Join(logErr, applyErr); err != nil {
+		return err
+	}
+	return db.maybeCompact()
+}
+
+func (db *MemDb[T]) tableName() string {
+	return db.Table
+}
+
+func (db *MemDb[T]) persistent() bool {
+	return db.wal != nil
+}
+
+// lookup returns a copy of the item with the given id, even if it is in the
+// trash, unless it has expired
+func (db *MemDb[T]) lookup(id string) (T, bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	item, exists := db.Data[id]
+	if !exists || db.expired(id, time.Now()) {
+		var zero T
+		return zero, false, nil
+	}
+	clone, _, err := cloneItem(item)
+	return clone, true, err
+}
+
+// recoverTx applies a committed transaction the table has not logged yet
+func (db *MemDb[T]) recoverTx(txid uint64, writes []txWrite) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if txid <= db.lastTx {
+		return nil
+	}
+	for i := range writes {
+		writes[i].Table = ""
+	}
+	log.Printf("Recovering transaction %d in table %s", txid, db.Table)
+	return db.applyTx(txid, writes)
+}
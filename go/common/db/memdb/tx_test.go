@@ -0,0 +1,226 @@
+package memdb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type txFixture struct {
+	store *Store
+	users *MemDb[*models.User]
+	todos *MemDb[*models.Todo]
+}
+
+func openTxFixture(t *testing.T, rootPath string) *txFixture {
+	t.Helper()
+	store, err := OpenStore(rootPath, true)
+	require.NoError(t, err)
+	users, err := Initialize[*models.User]("users", rootPath, true, WithStore(store), WithUniqueIndex("username"))
+	require.NoError(t, err)
+	todos, err := Initialize[*models.Todo]("todos", rootPath, true, WithStore(store), WithIndex("user_id"))
+	require.NoError(t, err)
+	f := &txFixture{store: store, users: users, todos: todos}
+	t.Cleanup(f.close)
+	return f
+}
+
+func (f *txFixture) close() {
+	f.users.Close()
+	f.todos.Close()
+	f.store.Close()
+}
+
+func (f *txFixture) begin(t *testing.T) (*Tx, *TxTable[*models.User], *TxTable[*models.Todo]) {
+	t.Helper()
+	tx := f.store.Begin()
+	users, err := Within(tx, f.users)
+	require.NoError(t, err)
+	todos, err := Within(tx, f.todos)
+	require.NoError(t, err)
+	return tx, users, todos
+}
+
+func TestTx_DeleteUserWithTodos(t *testing.T) {
+	f := openTxFixture(t, t.TempDir())
+	require.NoError(t, f.users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t1", Text: "one", UserId: "u1"}))
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t2", Text: "two", UserId: "u1"}))
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t3", Text: "other", UserId: "u2"}))
+
+	tx, users, todos := f.begin(t)
+	userTodos, err := todos.GetByFilter(map[string]any{"user_id": "u1"})
+	require.NoError(t, err)
+	for _, todo := range userTodos {
+		require.NoError(t, todos.Delete(todo.Id))
+	}
+	require.NoError(t, users.Delete("u1"))
+
+	// Nothing is visible outside the transaction before it commits
+	_, err = f.users.GetByID("u1")
+	require.NoError(t, err)
+	all, err := f.todos.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	// but the transaction sees its own writes
+	_, err = users.GetByID("u1")
+	assert.ErrorIs(t, err, errNotFound)
+	remaining, err := todos.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, remaining, 1)
+
+	require.NoError(t, tx.Commit())
+	_, err = f.users.GetByID("u1")
+	assert.ErrorIs(t, err, errNotFound)
+	left, err := f.todos.GetByFilter(map[string]any{"user_id": "u1"})
+	require.NoError(t, err)
+	assert.Empty(t, left)
+
+	assert.ErrorIs(t, tx.Commit(), ErrTxDone)
+	assert.ErrorIs(t, users.Upsert(&models.User{ID: "u3", Username: "carol"}), ErrTxDone)
+}
+
+func TestTx_UniqueViolationAbortsAllTables(t *testing.T) {
+	f := openTxFixture(t, t.TempDir())
+	require.NoError(t, f.users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+
+	tx, users, todos := f.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u2", Username: "alice"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1", Text: "welcome", UserId: "u2"}))
+	assert.ErrorIs(t, tx.Commit(), ErrUniqueViolation)
+
+	_, err := f.users.GetByID("u2")
+	assert.ErrorIs(t, err, errNotFound)
+	_, err = f.todos.GetByID("t1")
+	assert.ErrorIs(t, err, errNotFound)
+
+	// Swapping usernames within a transaction is fine
+	require.NoError(t, f.users.Upsert(&models.User{ID: "u2", Username: "bob"}))
+	tx, users, _ = f.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "bob"}))
+	require.NoError(t, users.Upsert(&models.User{ID: "u2", Username: "alice"}))
+	require.NoError(t, tx.Commit())
+	user, err := f.users.GetByField("username", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "u2", user.ID)
+}
+
+func TestTx_Rollback(t *testing.T) {
+	f := openTxFixture(t, t.TempDir())
+	tx, users, todos := f.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1", Text: "welcome", UserId: "u1"}))
+	require.NoError(t, tx.Rollback())
+
+	assert.ErrorIs(t, tx.Commit(), ErrTxDone)
+	all, err := f.users.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, all)
+	_, err = Within(tx, f.todos)
+	assert.ErrorIs(t, err, ErrTxDone)
+}
+
+func TestTx_ReadersSeeWholeTransactions(t *testing.T) {
+	f := openTxFixture(t, t.TempDir())
+	require.NoError(t, f.users.Upsert(&models.User{ID: "u0", Username: "user0"}))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 50; i++ {
+			tx, users, todos := f.begin(t)
+			id := "u" + strings.Repeat("x", i)
+			require.NoError(t, users.Upsert(&models.User{ID: id, Username: id}))
+			require.NoError(t, todos.Upsert(&models.Todo{Id: "a" + id, UserId: id}))
+			require.NoError(t, todos.Upsert(&models.Todo{Id: "b" + id, UserId: id}))
+			require.NoError(t, tx.Commit())
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		todos, err := f.todos.GetAll()
+		require.NoError(t, err)
+		assert.Zero(t, len(todos)%2, "saw half a transaction")
+	}
+	wg.Wait()
+}
+
+func TestTx_SurvivesRestart(t *testing.T) {
+	rootPath := t.TempDir()
+	f := openTxFixture(t, rootPath)
+	tx, users, todos := f.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1", Text: "welcome", UserId: "u1"}))
+	require.NoError(t, tx.Commit())
+	require.NoError(t, f.todos.Compact())
+	f.close()
+
+	reopened := openTxFixture(t, rootPath)
+	_, err := reopened.users.GetByID("u1")
+	require.NoError(t, err)
+	todo, err := reopened.todos.GetByID("t1")
+	require.NoError(t, err)
+	assert.Equal(t, "welcome", todo.Text)
+}
+
+func TestTx_RecoversWritesMissingFromTableLog(t *testing.T) {
+	rootPath := t.TempDir()
+	f := openTxFixture(t, rootPath)
+	require.NoError(t, f.todos.Upsert(&models.Todo{Id: "t0", Text: "before"}))
+	todoLog := filepath.Join(rootPath, "todos"+logFileExtension)
+	before, err := os.Stat(todoLog)
+	require.NoError(t, err)
+	tx, users, todos := f.begin(t)
+	require.NoError(t, users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1", Text: "welcome", UserId: "u1"}))
+	require.NoError(t, tx.Commit())
+	f.close()
+
+	// Simulate a crash after the commit record was written but before the
+	// todos table logged the transaction
+	require.NoError(t, os.Truncate(todoLog, before.Size()))
+
+	reopened := openTxFixture(t, rootPath)
+	todo, err := reopened.todos.GetByID("t1")
+	require.NoError(t, err)
+	assert.Equal(t, "welcome", todo.Text)
+	byUser, err := reopened.todos.GetByFilter(map[string]any{"user_id": "u1"})
+	require.NoError(t, err)
+	assert.Len(t, byUser, 1)
+	reopened.close()
+
+	// Recovery is not applied twice
+	again := openTxFixture(t, rootPath)
+	all, err := again.todos.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+}
+
+func TestTx_ConditionalWritesCheckedAtCommit(t *testing.T) {
+	f := openTxFixture(t, t.TempDir())
+	require.NoError(t, f.users.Upsert(&models.User{ID: "u1", Username: "alice"}))
+
+	tx, users, todos := f.begin(t)
+	require.NoError(t, users.UpsertIfVersion(&models.User{ID: "u1", Username: "alice2"}, 1))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "t1", UserId: "u1"}))
+	// Someone else updates the user before the transaction commits
+	require.NoError(t, f.users.Upsert(&models.User{ID: "u1", Username: "alice3"}))
+	assert.ErrorIs(t, tx.Commit(), ErrVersionConflict)
+	_, err := f.todos.GetByID("t1")
+	assert.ErrorIs(t, err, errNotFound)
+
+	tx, users, _ = f.begin(t)
+	require.NoError(t, users.UpsertIfVersion(&models.User{ID: "u1", Username: "alice4"}, 2))
+	require.NoError(t, tx.Commit())
+	user, err := f.users.GetByID("u1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice4", user.Username)
+	assert.Equal(t, int64(3), user.Version)
+}
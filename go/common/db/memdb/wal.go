@@ -0,0 +1,619 @@
+package memdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// A table is persisted as an append-only log of records. The log starts with
+// a header
+//
+//	"MEMDB" <format version, 1 byte> <codec name length, 1 byte> <codec name>
+//
+// followed by the records, each framed as
+//
+//	<crc32 of payload, 4 bytes> <payload length, uvarint> <payload>
+//
+// The payload holds the operation, sequence number, transaction id, item id
+// and write time of the record followed by its data, items being encoded with
+// the codec named in the header. Version 1 records have no write time.
+//
+// Records are replayed in order on startup. A record that is cut short or
+// whose checksum does not match can only come from a write that was
+// interrupted (e.g. the process was killed), so replay stops there and the
+// log is truncated back to the last good record.
+//
+// Logs written before the header was introduced hold one JSON record per
+// line, preceded by its checksum in hex. They are still read, and like logs
+// of an older format version they are rewritten in the current format when
+// they are opened.
+
+type logOp string
+
+const (
+	opUpsert logOp = "upsert"
+	opDelete logOp = "delete"
+	// opTx applies the writes of a committed transaction to a table at once
+	opTx logOp = "tx"
+	// opCommit records a committed transaction in the transaction log
+	opCommit logOp = "commit"
+	// opCheckpoint starts a compacted log. It carries the sequence number of
+	// the last change and the id of the last transaction; the records after
+	// it hold a snapshot of the table and have no sequence number.
+	opCheckpoint logOp = "checkpoint"
+)
+
+// opCodes are the encodings of the operations in binary records
+var opCodes = map[logOp]byte{opUpsert: 1, opDelete: 2, opTx: 3, opCommit: 4, opCheckpoint: 5}
+
+const logFileExtension = ".log"
+
+const (
+	logMagic = "MEMDB"
+	// logFormatVersion is the version of the record format written by this
+	// code. Logs with a newer version are refused.
+	logFormatVersion = 2
+	// maxRecordSize bounds the length read from a record frame, so that a
+	// corrupted length is not taken for a huge record
+	maxRecordSize = 1 << 30
+)
+
+type logRecord struct {
+	Seq  uint64
+	Op   logOp
+	ID   string
+	Data []byte
+	Tx   uint64
+	// Time is when an upsert was written in unix milliseconds, 0 if unknown
+	Time int64
+	// Writes are the writes of an opTx or opCommit record
+	Writes []txWrite
+}
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorruptRecord = errors.New("corrupt log record")
+
+// encodeRecord frames a record in the binary format
+func encodeRecord(record *logRecord) ([]byte, error) {
+	code, ok := opCodes[record.Op]
+	if !ok {
+		return nil, fmt.Errorf("unknown log operation %q", record.Op)
+	}
+	payload := []byte{code}
+	payload = binary.AppendUvarint(payload, record.Seq)
+	payload = binary.AppendUvarint(payload, record.Tx)
+	payload = appendBytes(payload, []byte(record.ID))
+	payload = binary.AppendUvarint(payload, uint64(max(record.Time, 0)))
+	if record.Op == opTx || record.Op == opCommit {
+		payload = binary.AppendUvarint(payload, uint64(len(record.Writes)))
+		for _, write := range record.Writes {
+			payload = append(payload, opCodes[write.Op])
+			payload = appendBytes(payload, []byte(write.Table))
+			payload = appendBytes(payload, []byte(write.ID))
+			payload = binary.AppendUvarint(payload, uint64(max(write.Time, 0)))
+			payload = appendBytes(payload, write.Data)
+		}
+	} else {
+		payload = append(payload, record.Data...)
+	}
+
+	frame := make([]byte, 4, 4+binary.MaxVarintLen64+len(payload))
+	binary.LittleEndian.PutUint32(frame, crc32.Checksum(payload, crcTable))
+	frame = binary.AppendUvarint(frame, uint64(len(payload)))
+	return append(frame, payload...), nil
+}
+
+func appendBytes(buf []byte, data []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// decodePayload decodes the payload of a binary record of the given format
+// version
+func decodePayload(payload []byte, version byte) (*logRecord, error) {
+	reader := &payloadReader{data: payload}
+	record := &logRecord{
+		Op:  reader.op(),
+		Seq: reader.uvarint(),
+		Tx:  reader.uvarint(),
+		ID:  string(reader.bytes()),
+	}
+	if version >= 2 {
+		record.Time = int64(reader.uvarint())
+	}
+	if record.Op == opTx || record.Op == opCommit {
+		count := reader.uvarint()
+		for i := uint64(0); i < count && reader.err == nil; i++ {
+			write := txWrite{
+				Op:    reader.op(),
+				Table: string(reader.bytes()),
+				ID:    string(reader.bytes()),
+			}
+			if version >= 2 {
+				write.Time = int64(reader.uvarint())
+			}
+			write.Data = reader.bytes()
+			record.Writes = append(record.Writes, write)
+		}
+	} else if reader.err == nil {
+		record.Data = reader.data
+	}
+	if reader.err != nil {
+		return nil, reader.err
+	}
+	return record, nil
+}
+
+// payloadReader reads the fields of a binary record, remembering the first
+// error
+type payloadReader struct {
+	data []byte
+	err  error
+}
+
+func (r *payloadReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errCorruptRecord
+		return 0
+	}
+	r.data = r.data[n:]
+	return value
+}
+
+func (r *payloadReader) bytes() []byte {
+	length := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if length > uint64(len(r.data)) {
+		r.err = errCorruptRecord
+		return nil
+	}
+	value := r.data[:length:length]
+	r.data = r.data[length:]
+	return value
+}
+
+func (r *payloadReader) op() logOp {
+	if r.err != nil {
+		return ""
+	}
+	if len(r.data) == 0 {
+		r.err = errCorruptRecord
+		return ""
+	}
+	code := r.data[0]
+	r.data = r.data[1:]
+	for op, opCode := range opCodes {
+		if opCode == code {
+			return op
+		}
+	}
+	r.err = errCorruptRecord
+	return ""
+}
+
+// textRecord is a record of a log in the format without a header
+type textRecord struct {
+	Seq  uint64          `json:"seq"`
+	Op   logOp           `json:"op"`
+	ID   string          `json:"id"`
+	Data json.RawMessage `json:"data,omitempty"`
+	Tx   uint64          `json:"tx,omitempty"`
+}
+
+// textWrite is a write of a transaction in a log without a header
+type textWrite struct {
+	Table string          `json:"table,omitempty"`
+	Op    logOp           `json:"op"`
+	ID    string          `json:"id"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// decodeTextRecord decodes a line of a log without a header
+func decodeTextRecord(line []byte) (*logRecord, error) {
+	if len(line) < 10 || line[8] != ' ' {
+		return nil, errCorruptRecord
+	}
+	var sum [4]byte
+	if _, err := hex.Decode(sum[:], line[:8]); err != nil {
+		return nil, errCorruptRecord
+	}
+	payload := line[9:]
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(sum[:]) {
+		return nil, errCorruptRecord
+	}
+	text := &textRecord{}
+	if err := json.Unmarshal(payload, text); err != nil {
+		return nil, errCorruptRecord
+	}
+	record := &logRecord{Seq: text.Seq, Op: text.Op, ID: text.ID, Tx: text.Tx}
+	if text.Op == opTx || text.Op == opCommit {
+		writes := []textWrite{}
+		if err := json.Unmarshal(text.Data, &writes); err != nil {
+			return nil, errCorruptRecord
+		}
+		for _, write := range writes {
+			record.Writes = append(record.Writes, txWrite{Table: write.Table, Op: write.Op, ID: write.ID, Data: write.Data})
+		}
+	} else {
+		record.Data = text.Data
+	}
+	return record, nil
+}
+
+// logFile is the file a log is kept in
+type logFile interface {
+	io.ReadWriteSeeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+	Stat() (os.FileInfo, error)
+}
+
+// writeAheadLog is the open, append-only log file of a single table
+type writeAheadLog struct {
+	path    string
+	file    logFile
+	seq     uint64 // sequence number of the last record written
+	records int    // number of records currently in the file
+	// codec is the codec the items in the log are encoded with
+	codec Codec
+	// version is the format version of the log, 0 for a log without a
+	// header. Only logs in the current format can be appended to.
+	version byte
+	// start is the offset of the first record
+	start int64
+	// broken is set once a failed append could not be rolled back. The log
+	// then takes no more appends: recovery would drop them along with the
+	// part of a record in front of them.
+	broken error
+}
+
+// openLog opens the log at path. A missing or empty file becomes a new log
+// whose items are encoded with codec; an existing log keeps the codec it was
+// written with. The log has to be recovered before it is appended to.
+func openLog(path string, codec Codec) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		log.Printf("Could not open log file %s: %v", path, err)
+		return nil, err
+	}
+	wal := &writeAheadLog{path: path, file: file, codec: codec}
+	if err := wal.readHeader(); err != nil {
+		log.Printf("Could not read header of log file %s: %v", path, err)
+		file.Close()
+		return nil, err
+	}
+	return wal, nil
+}
+
+// readHeader reads the header of the log, writing one if the log is empty
+func (wal *writeAheadLog) readHeader() error {
+	reader := bufio.NewReader(wal.file)
+	magic, err := reader.Peek(len(logMagic))
+	if len(magic) == 0 && errors.Is(err, io.EOF) {
+		header, err := encodeHeader(wal.codec)
+		if err != nil {
+			return err
+		}
+		if _, err := wal.file.Write(header); err != nil {
+			return err
+		}
+		wal.start = int64(len(header))
+		wal.version = logFormatVersion
+		return wal.file.Sync()
+	}
+	return wal.parseHeader(reader)
+}
+
+// parseHeader reads the header of a log that is not empty. A log without a
+// header is in the text format.
+func (wal *writeAheadLog) parseHeader(reader *bufio.Reader) error {
+	magic, _ := reader.Peek(len(logMagic))
+	if string(magic) != logMagic {
+		wal.codec = JSONCodec
+		return nil
+	}
+
+	header := make([]byte, len(logMagic)+2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("%w: header cut short", errCorruptRecord)
+	}
+	wal.version = header[len(logMagic)]
+	if wal.version > logFormatVersion {
+		return fmt.Errorf("log format version %d is newer than the supported version %d", wal.version, logFormatVersion)
+	}
+	name := make([]byte, header[len(header)-1])
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return fmt.Errorf("%w: header cut short", errCorruptRecord)
+	}
+	codec, err := LookupCodec(string(name))
+	if err != nil {
+		return err
+	}
+	wal.codec = codec
+	wal.start = int64(len(header) + len(name))
+	return nil
+}
+
+func encodeHeader(codec Codec) ([]byte, error) {
+	name := codec.Name()
+	if len(name) > 255 {
+		return nil, fmt.Errorf("codec name %q is too long", name)
+	}
+	header := append([]byte(logMagic), logFormatVersion, byte(len(name)))
+	return append(header, name...), nil
+}
+
+// recover replays every intact record through apply and drops whatever is
+// left after the last one
+func (wal *writeAheadLog) recover(apply func(*logRecord) error) error {
+	if _, err := wal.file.Seek(wal.start, io.SeekStart); err != nil {
+		return err
+	}
+	goodOffset, err := wal.replay(apply)
+	if err != nil {
+		return err
+	}
+
+	info, err := wal.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != goodOffset {
+		log.Printf("Truncating torn write at end of %s (%d bytes)", wal.path, info.Size()-goodOffset)
+		if err := wal.file.Truncate(goodOffset); err != nil {
+			return err
+		}
+		if err := wal.file.Sync(); err != nil {
+			return err
+		}
+	}
+	_, err = wal.file.Seek(goodOffset, io.SeekStart)
+	return err
+}
+
+// replay feeds every intact record to apply and returns the offset just past
+// the last one
+func (wal *writeAheadLog) replay(apply func(*logRecord) error) (int64, error) {
+	reader := bufio.NewReader(wal.file)
+	offset := wal.start
+	for {
+		record, size, err := wal.next(reader)
+		if errors.Is(err, io.EOF) {
+			// Either a clean end of file or a partial last record
+			return offset, nil
+		}
+		if err != nil {
+			log.Printf("Stopping replay of %s at offset %d: %v", wal.path, offset, err)
+			return offset, nil
+		}
+		if err := apply(record); err != nil {
+			return offset, err
+		}
+		offset += size
+		wal.records++
+		if record.Seq > wal.seq {
+			wal.seq = record.Seq
+		}
+	}
+}
+
+// readLog feeds every intact record of the log held by reader to apply
+// without modifying the log, and returns the codec of the log. It reports
+// whether the log ends right after the last intact record; a log that is
+// being written to may end with part of a record.
+func readLog(reader io.Reader, apply func(*logRecord) error) (Codec, bool, error) {
+	buffered := bufio.NewReader(reader)
+	wal := &writeAheadLog{codec: JSONCodec}
+	if _, err := buffered.Peek(1); errors.Is(err, io.EOF) {
+		return wal.codec, true, nil
+	}
+	if err := wal.parseHeader(buffered); err != nil {
+		return nil, false, err
+	}
+	for {
+		if _, err := buffered.Peek(1); errors.Is(err, io.EOF) {
+			return wal.codec, true, nil
+		}
+		record, _, err := wal.next(buffered)
+		if err != nil {
+			return wal.codec, false, nil
+		}
+		if err := apply(record); err != nil {
+			return wal.codec, false, err
+		}
+	}
+}
+
+// next reads the next record and returns it along with its size in the file.
+// It returns io.EOF at the end of the log or if the last record is cut short.
+func (wal *writeAheadLog) next(reader *bufio.Reader) (*logRecord, int64, error) {
+	if wal.version == 0 {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, 0, io.EOF
+		}
+		record, err := decodeTextRecord(bytes.TrimSuffix(line, []byte{'\n'}))
+		return record, int64(len(line)), err
+	}
+
+	var sum [4]byte
+	if _, err := io.ReadFull(reader, sum[:]); err != nil {
+		return nil, 0, io.EOF
+	}
+	counter := &countingReader{reader: reader}
+	length, err := binary.ReadUvarint(counter)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, 0, io.EOF
+	}
+	if err != nil || length > maxRecordSize {
+		return nil, 0, errCorruptRecord
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, 0, io.EOF
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(sum[:]) {
+		return nil, 0, errCorruptRecord
+	}
+	record, err := decodePayload(payload, wal.version)
+	return record, int64(len(sum)) + counter.n + int64(length), err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	reader io.ByteReader
+	n      int64
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
+
+// append durably writes a record to the end of the log. A record without a
+// sequence number is assigned the next one.
+func (wal *writeAheadLog) append(record *logRecord) error {
+	if wal.outdated() {
+		return fmt.Errorf("log %s has to be rewritten before it can be appended to", wal.path)
+	}
+	if wal.broken != nil {
+		return wal.broken
+	}
+	if record.Seq == 0 {
+		record.Seq = wal.seq + 1
+	}
+	frame, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+	offset, err := wal.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := wal.file.Write(frame); err != nil {
+		log.Printf("Error writing to log %s: %v", wal.path, err)
+		wal.rollback(offset, err)
+		return err
+	}
+	if err := wal.file.Sync(); err != nil {
+		log.Printf("Error syncing log %s: %v", wal.path, err)
+		wal.rollback(offset, err)
+		return err
+	}
+	if record.Seq > wal.seq {
+		wal.seq = record.Seq
+	}
+	wal.records++
+	return nil
+}
+
+// rollback removes what a failed append left of its record by truncating
+// the log back to offset, where the record started, so the next record does
+// not follow a torn one. If that fails too, the log is marked broken.
+func (wal *writeAheadLog) rollback(offset int64, cause error) {
+	err := wal.file.Truncate(offset)
+	if err == nil {
+		_, err = wal.file.Seek(offset, io.SeekStart)
+	}
+	if err == nil {
+		err = wal.file.Sync()
+	}
+	if err != nil {
+		log.Printf("Could not roll back failed append to log %s: %v", wal.path, err)
+		wal.broken = fmt.Errorf("log %s takes no more writes after a failed append: %w", wal.path, cause)
+	}
+}
+
+// rewrite atomically replaces the log with the given records, written in the
+// current format with the items encoded with wal.codec. The new log is
+// written and synced to a temporary file first and then renamed over the old
+// one, so a crash leaves either the old or the new log intact.
+func (wal *writeAheadLog) rewrite(records []*logRecord) error {
+	header, err := encodeHeader(wal.codec)
+	if err != nil {
+		return err
+	}
+	tmpPath := wal.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	fail := func(err error) error {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	if _, err := writer.Write(header); err != nil {
+		return fail(err)
+	}
+	for _, record := range records {
+		frame, err := encodeRecord(record)
+		if err != nil {
+			return fail(err)
+		}
+		if _, err := writer.Write(frame); err != nil {
+			return fail(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmpPath, wal.path); err != nil {
+		return fail(err)
+	}
+	syncDir(filepath.Dir(wal.path))
+
+	// The renamed file is the new log, keep appending to it
+	wal.file.Close()
+	wal.file = tmp
+	wal.records = len(records)
+	wal.version = logFormatVersion
+	wal.start = int64(len(header))
+	wal.broken = nil
+	return nil
+}
+
+// outdated reports whether the log is in an older format and has to be
+// rewritten before it is appended to
+func (wal *writeAheadLog) outdated() bool {
+	return wal.version < logFormatVersion
+}
+
+func (wal *writeAheadLog) close() error {
+	return wal.file.Close()
+}
+
+// syncDir flushes a directory entry so a rename survives a crash
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
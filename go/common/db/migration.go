@@ -0,0 +1,187 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// Migrations bring the items stored in a table up to date when their model
+// changes, e.g. to backfill a new field. Each table has a schema version,
+// kept in a table of its own, that is the version of the last migration
+// applied to it. A table without one is at version 0.
+//
+// Migrations are run when a service starts, before it serves requests. All
+// pending migrations are applied to an item at once, in order, and the item
+// is written back if any of them changed it. The schema version is recorded
+// once every item has been migrated, so if the service stops halfway the
+// migrations run again on the next start. They must therefore be idempotent:
+// a migration given an item it has already migrated must leave it alone.
+
+// SchemaVersionTable is the table schema versions are kept in
+const SchemaVersionTable = "schema_versions"
+
+// migrationBatchSize is how many items are read at a time while migrating
+const migrationBatchSize = 500
+
+// ErrSchemaTooNew is returned when a table has been migrated by a newer
+// version of the code than the one running
+var ErrSchemaTooNew = errors.New("schema version is newer than this code supports")
+
+// Migration transforms the items of a table from the previous schema version
+// to Version
+type Migration[T common.Serializable] struct {
+	// Version numbers of the migrations of a table start at 1 and increase
+	Version     int
+	Description string
+	// Migrate updates item in place and reports whether it changed it
+	Migrate func(item T) (bool, error)
+}
+
+// SchemaVersion is the schema version of a table
+type SchemaVersion struct {
+	common.Model
+	Table   string `json:"id"`
+	Version int    `json:"schema_version"`
+	// MigratedAt is when the version was recorded in unix milliseconds
+	MigratedAt int64 `json:"migrated_at"`
+}
+
+// Migrator applies the pending migrations of a table
+type Migrator[T common.Serializable] struct {
+	Table      string
+	Items      DbDriver[T]
+	Versions   DbDriver[*SchemaVersion]
+	Migrations []Migration[T]
+	// DryRun reports what the migrations would change without writing
+	// anything
+	DryRun bool
+}
+
+// MigrationReport is the outcome of running the migrations of a table
+type MigrationReport struct {
+	Table  string
+	From   int
+	To     int
+	DryRun bool
+	// Scanned is the number of items read and Changed the number of items
+	// changed by each migration, by version
+	Scanned int
+	Changed map[int]int
+}
+
+func (report *MigrationReport) String() string {
+	if report.From == report.To {
+		return fmt.Sprintf("table %s is at schema version %d", report.Table, report.To)
+	}
+	changed := 0
+	for _, count := range report.Changed {
+		changed += count
+	}
+	verb := "migrated"
+	if report.DryRun {
+		verb = "would migrate"
+	}
+	return fmt.Sprintf("%s table %s from schema version %d to %d, %d of %d items changed",
+		verb, report.Table, report.From, report.To, changed, report.Scanned)
+}
+
+// Run applies the migrations the table has not had yet. It fails with
+// ErrSchemaTooNew if the table is at a version none of the migrations have.
+func (m *Migrator[T]) Run() (*MigrationReport, error) {
+	latest := 0
+	for _, migration := range m.Migrations {
+		if migration.Version <= latest {
+			return nil, fmt.Errorf("migrations of table %s are not in increasing version order at version %d", m.Table, migration.Version)
+		}
+		latest = migration.Version
+	}
+	current, err := m.schemaVersion()
+	if err != nil {
+		log.Printf("Could not read schema version of table %s: %v", m.Table, err)
+		return nil, err
+	}
+	if current > latest {
+		return nil, fmt.Errorf("%w: table %s is at version %d, latest known version is %d", ErrSchemaTooNew, m.Table, current, latest)
+	}
+
+	report := &MigrationReport{Table: m.Table, From: current, To: latest, DryRun: m.DryRun, Changed: map[int]int{}}
+	if current == latest {
+		return report, nil
+	}
+	pending := []Migration[T]{}
+	for _, migration := range m.Migrations {
+		if migration.Version > current {
+			pending = append(pending, migration)
+		}
+	}
+
+	query := Query{Limit: migrationBatchSize, IncludeDeleted: true}
+	for {
+		page, err := m.Items.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			if err := m.migrate(item, pending, report); err != nil {
+				return nil, err
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		query.After = page.NextCursor
+	}
+
+	if !m.DryRun {
+		version := &SchemaVersion{Table: m.Table, Version: latest, MigratedAt: time.Now().UnixMilli()}
+		if err := m.Versions.Upsert(version); err != nil {
+			log.Printf("Could not record schema version of table %s: %v", m.Table, err)
+			return nil, err
+		}
+	}
+	log.Printf("Schema migration: %s", report)
+	return report, nil
+}
+
+// migrate applies the pending migrations to item and writes it back if any
+// of them changed it
+func (m *Migrator[T]) migrate(item T, pending []Migration[T], report *MigrationReport) error {
+	report.Scanned++
+	version := VersionOf(item)
+	changed := false
+	for _, migration := range pending {
+		itemChanged, err := migration.Migrate(item)
+		if err != nil {
+			id, _ := common.GetID(item)
+			return fmt.Errorf("migration %d of table %s failed on %s: %w", migration.Version, m.Table, id, err)
+		}
+		if itemChanged {
+			report.Changed[migration.Version]++
+			changed = true
+		}
+	}
+	if !changed || m.DryRun {
+		return nil
+	}
+	// Do not overwrite a write made while migrating
+	if err := m.Items.UpsertIfVersion(item, version); err != nil {
+		log.Printf("Could not write migrated item to table %s: %v", m.Table, err)
+		return err
+	}
+	return nil
+}
+
+func (m *Migrator[T]) schemaVersion() (int, error) {
+	version, err := m.Versions.GetByID(m.Table)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return version.Version, nil
+}
@@ -0,0 +1,531 @@
+package db
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// Operator compares a field of an item with a value
+type Operator string
+
+const (
+	Eq       Operator = "eq"
+	Ne       Operator = "ne"
+	Lt       Operator = "lt"
+	Lte      Operator = "lte"
+	Gt       Operator = "gt"
+	Gte      Operator = "gte"
+	In       Operator = "in"       // value is a slice, matches any element
+	Prefix   Operator = "prefix"   // value is a string the field starts with
+	Contains Operator = "contains" // value is a string contained in the field
+)
+
+// ErrInvalidQuery is returned for queries that cannot be evaluated
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Condition is either a comparison of one field with a value or a
+// combination of other conditions with And or Or. A nil Condition matches
+// every item.
+type Condition struct {
+	Field string
+	Op    Operator
+	Value any
+
+	And []*Condition
+	Or  []*Condition
+}
+
+// Where returns a condition comparing field with value
+func Where(field string, op Operator, value any) *Condition {
+	return &Condition{Field: field, Op: op, Value: value}
+}
+
+// And returns a condition matching items that match all conditions, nil if
+// there are none
+func And(conditions ...*Condition) *Condition {
+	if len(conditions) == 0 {
+		return nil
+	}
+	return &Condition{And: conditions}
+}
+
+// Or returns a condition matching items that match any of the conditions
+func Or(conditions ...*Condition) *Condition {
+	return &Condition{Or: conditions}
+}
+
+// FromFilters turns a GetByFilter style map into an And of equalities
+func FromFilters(filters map[string]any) *Condition {
+	if len(filters) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(filters))
+	for field := range filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	conditions := make([]*Condition, 0, len(fields))
+	for _, field := range fields {
+		conditions = append(conditions, Where(field, Eq, filters[field]))
+	}
+	return And(conditions...)
+}
+
+// Order sorts results by a field
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+// Query selects, sorts and pages items of a table. Items are always sorted
+// by id after the fields in OrderBy, so the order is total and stable.
+//
+// Results can be paged with Limit and Offset, or with Limit and After: After
+// is the NextCursor of the previous page and continues right after its last
+// item, even if items were written in between.
+type Query struct {
+	Where   *Condition
+	OrderBy []Order
+	Limit   int // 0 means no limit
+	Offset  int
+	After   string
+	// IncludeDeleted also returns items that are in the trash
+	IncludeDeleted bool
+}
+
+// Page is one page of query results
+type Page[T common.Serializable] struct {
+	Items []T
+	// NextCursor is set when there are more results after this page
+	NextCursor string
+}
+
+// Matches reports whether item satisfies the condition
+func (c *Condition) Matches(item common.Serializable) (bool, error) {
+	if c == nil {
+		return true, nil
+	}
+	if len(c.And) > 0 || len(c.Or) > 0 {
+		for _, sub := range c.And {
+			matches, err := sub.Matches(item)
+			if err != nil || !matches {
+				return false, err
+			}
+		}
+		if len(c.Or) == 0 {
+			return true, nil
+		}
+		for _, sub := range c.Or {
+			matches, err := sub.Matches(item)
+			if err != nil || matches {
+				return matches, err
+			}
+		}
+		return false, nil
+	}
+
+	fieldValue, err := common.GetField(item, c.Field)
+	if err != nil {
+		return false, err
+	}
+	switch c.Op {
+	case Eq, "":
+		return Compare(fieldValue, c.Value) == 0, nil
+	case Ne:
+		return Compare(fieldValue, c.Value) != 0, nil
+	case Lt:
+		return Compare(fieldValue, c.Value) < 0, nil
+	case Lte:
+		return Compare(fieldValue, c.Value) <= 0, nil
+	case Gt:
+		return Compare(fieldValue, c.Value) > 0, nil
+	case Gte:
+		return Compare(fieldValue, c.Value) >= 0, nil
+	case In:
+		values, err := c.Values()
+		if err != nil {
+			return false, err
+		}
+		for _, value := range values {
+			if Compare(fieldValue, value) == 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case Prefix, Contains:
+		text, ok := c.Value.(string)
+		if !ok {
+			return false, fmt.Errorf("%w: %s needs a string value", ErrInvalidQuery, c.Op)
+		}
+		fieldText := fmt.Sprint(fieldValue)
+		if c.Op == Prefix {
+			return strings.HasPrefix(fieldText, text), nil
+		}
+		return strings.Contains(fieldText, text), nil
+	default:
+		return false, fmt.Errorf("%w: unknown operator %q", ErrInvalidQuery, c.Op)
+	}
+}
+
+// Fields returns the fields the condition reads
+func (c *Condition) Fields() []string {
+	if c == nil {
+		return nil
+	}
+	if len(c.And) > 0 || len(c.Or) > 0 {
+		fields := make([]string, 0)
+		for _, sub := range c.And {
+			fields = append(fields, sub.Fields()...)
+		}
+		for _, sub := range c.Or {
+			fields = append(fields, sub.Fields()...)
+		}
+		return fields
+	}
+	return []string{c.Field}
+}
+
+// Equalities collects the equality conditions that every item matching the
+// condition has to satisfy, keyed by field. Drivers answer them from an index.
+func (c *Condition) Equalities() map[string]any {
+	equalities := map[string]any{}
+	if c == nil || len(c.Or) > 0 {
+		return equalities
+	}
+	conditions := c.And
+	if len(conditions) == 0 {
+		conditions = []*Condition{c}
+	}
+	for _, condition := range conditions {
+		if condition == nil || len(condition.And) > 0 || len(condition.Or) > 0 {
+			continue
+		}
+		if condition.Op == Eq || condition.Op == "" {
+			equalities[condition.Field] = condition.Value
+		}
+	}
+	return equalities
+}
+
+// ValidateQuery fails with common.ErrUnknownField if the query reads a field
+// that items of type T do not have
+func ValidateQuery[T common.Serializable](query Query) error {
+	fields := query.Where.Fields()
+	for _, order := range query.OrderBy {
+		fields = append(fields, order.Field)
+	}
+	return common.ValidateFields[T](fields...)
+}
+
+// ValidateFilters fails with common.ErrUnknownField if a GetByFilter style
+// map filters on a field that items of type T do not have
+func ValidateFilters[T common.Serializable](filters map[string]any) error {
+	fields := make([]string, 0, len(filters))
+	for field := range filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return common.ValidateFields[T](fields...)
+}
+
+// Values returns the value of an In condition as a slice
+func (c *Condition) Values() ([]any, error) {
+	value := reflect.ValueOf(c.Value)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w: %s needs a slice value", ErrInvalidQuery, c.Op)
+	}
+	values := make([]any, value.Len())
+	for i := range values {
+		values[i] = value.Index(i).Interface()
+	}
+	return values, nil
+}
+
+// Compare orders two field values. Values of the same kind compare
+// naturally, so e.g. a models.Role compares equal to the same plain string
+// and all numbers compare by value. Values of different kinds are ordered
+// nil < bool < number < string < anything else.
+func Compare(a, b any) int {
+	rankA, normA := normalize(a)
+	rankB, normB := normalize(b)
+	if rankA != rankB {
+		return rankA - rankB
+	}
+	switch x := normA.(type) {
+	case bool:
+		y := normB.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		default:
+			return 1
+		}
+	case float64:
+		y := normB.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	case string:
+		return strings.Compare(x, normB.(string))
+	default:
+		return strings.Compare(fmt.Sprint(normA), fmt.Sprint(normB))
+	}
+}
+
+// Normalize maps a field value to the plain value Compare orders it by:
+// a bool, float64 or string for values of those kinds, the value itself
+// otherwise
+func Normalize(value any) any {
+	_, normalized := normalize(value)
+	return normalized
+}
+
+func normalize(value any) (int, any) {
+	if value == nil {
+		return 0, nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Bool:
+		return 1, v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return 2, float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return 2, float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return 2, v.Float()
+	case reflect.String:
+		return 3, v.String()
+	default:
+		return 4, value
+	}
+}
+
+// EncodeCursor returns the cursor pointing right after item in a result
+// sorted by orders
+func EncodeCursor(item common.Serializable, orders []Order) (string, error) {
+	position := make([]any, 0, len(orders)+1)
+	for _, order := range orders {
+		value, err := common.GetField(item, order.Field)
+		if err != nil {
+			return "", err
+		}
+		position = append(position, value)
+	}
+	id, err := common.GetID(item)
+	if err != nil {
+		return "", err
+	}
+	position = append(position, id)
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodeCursor returns the sort key values held by a cursor, followed by the
+// id of the item it points after
+func DecodeCursor(cursor string, orders []Order) ([]any, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	position := []any{}
+	if err := json.Unmarshal(data, &position); err != nil || len(position) != len(orders)+1 {
+		return nil, "", fmt.Errorf("%w: cursor does not match the query order", ErrInvalidQuery)
+	}
+	id, ok := position[len(orders)].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return position[:len(orders)], id, nil
+}
+
+// RunQuery evaluates a query over items in memory. Drivers that cannot push
+// the query down to their storage can use it for their Query method.
+func RunQuery[T common.Serializable](items []T, query Query) (*Page[T], error) {
+	collector, err := NewCollector[T](query)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if err := collector.Add(item); err != nil {
+			return nil, err
+		}
+	}
+	return collector.Page()
+}
+
+// Collector evaluates a query over items fed to it one at a time, for drivers
+// that scan their storage to sort. With a Limit it only keeps the
+// Offset+Limit items that come first in the query order, and one more to
+// tell whether there is a next page, so a page costs memory in proportion to
+// its size rather than to the number of matching items. Without a Limit
+// every matching item is kept.
+type Collector[T common.Serializable] struct {
+	query Query
+	// afterKeys and afterID are the position of the After cursor
+	afterKeys []any
+	afterID   string
+	// bound is how many items are kept, 0 for all of them
+	bound int
+	rows  []keyedItem[T]
+}
+
+// keyedItem is an item with its sort key and id
+type keyedItem[T common.Serializable] struct {
+	item T
+	id   string
+	keys []any
+}
+
+// NewCollector returns a collector for query, which it validates
+func NewCollector[T common.Serializable](query Query) (*Collector[T], error) {
+	if err := ValidateQuery[T](query); err != nil {
+		return nil, err
+	}
+	collector := &Collector[T]{query: query, rows: make([]keyedItem[T], 0)}
+	if query.After != "" {
+		keys, id, err := DecodeCursor(query.After, query.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		collector.afterKeys, collector.afterID = keys, id
+	}
+	if query.Limit > 0 {
+		collector.bound = max(query.Offset, 0) + query.Limit + 1
+	}
+	return collector, nil
+}
+
+// Add feeds an item to the collector, which keeps it if it matches the query
+// and comes early enough in its order
+func (c *Collector[T]) Add(item T) error {
+	if !c.query.IncludeDeleted && IsDeleted(item) {
+		return nil
+	}
+	matches, err := c.query.Where.Matches(item)
+	if err != nil || !matches {
+		return err
+	}
+	id, err := common.GetID(item)
+	if err != nil {
+		return err
+	}
+	keys := make([]any, len(c.query.OrderBy))
+	for i, order := range c.query.OrderBy {
+		if keys[i], err = common.GetField(item, order.Field); err != nil {
+			return err
+		}
+	}
+	row := keyedItem[T]{item: item, id: id, keys: keys}
+	if c.query.After != "" && c.compare(row, c.afterKeys, c.afterID) <= 0 {
+		return nil
+	}
+
+	if c.bound == 0 {
+		c.rows = append(c.rows, row)
+		return nil
+	}
+	// The kept rows form a heap with the row that comes last on top
+	if len(c.rows) < c.bound {
+		heap.Push((*rowHeap[T])(c), row)
+		return nil
+	}
+	if c.compare(row, c.rows[0].keys, c.rows[0].id) < 0 {
+		c.rows[0] = row
+		heap.Fix((*rowHeap[T])(c), 0)
+	}
+	return nil
+}
+
+// Page returns the page of the items added so far
+func (c *Collector[T]) Page() (*Page[T], error) {
+	sort.Slice(c.rows, func(i, j int) bool {
+		return c.compare(c.rows[i], c.rows[j].keys, c.rows[j].id) < 0
+	})
+	start := min(max(c.query.Offset, 0), len(c.rows))
+	end := len(c.rows)
+	if c.query.Limit > 0 && start+c.query.Limit < end {
+		end = start + c.query.Limit
+	}
+
+	page := &Page[T]{Items: make([]T, 0, end-start)}
+	for _, row := range c.rows[start:end] {
+		page.Items = append(page.Items, row.item)
+	}
+	if end < len(c.rows) && end > start {
+		cursor, err := EncodeCursor(c.rows[end-1].item, c.query.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor
+	}
+	return page, nil
+}
+
+// compare orders a row against a sort key and id
+func (c *Collector[T]) compare(row keyedItem[T], keys []any, id string) int {
+	for i, order := range c.query.OrderBy {
+		if cmp := Compare(row.keys[i], keys[i]); cmp != 0 {
+			if order.Desc {
+				return -cmp
+			}
+			return cmp
+		}
+	}
+	return strings.Compare(row.id, id)
+}
+
+// rowHeap is the heap.Interface of the rows of a collector
+type rowHeap[T common.Serializable] Collector[T]
+
+func (h *rowHeap[T]) Len() int { return len(h.rows) }
+func (h *rowHeap[T]) Less(i, j int) bool {
+	return (*Collector[T])(h).compare(h.rows[i], h.rows[j].keys, h.rows[j].id) > 0
+}
+func (h *rowHeap[T]) Swap(i, j int) { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+func (h *rowHeap[T]) Push(x any)    { h.rows = append(h.rows, x.(keyedItem[T])) }
+func (h *rowHeap[T]) Pop() any {
+	last := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return last
+}
+
+// PageRequest holds the sorting and paging parameters a service takes from
+// its clients
+type PageRequest struct {
+	OrderBy        string
+	Descending     bool
+	PageSize       int
+	PageToken      string
+	IncludeDeleted bool
+}
+
+// Query returns a query for one page of the items matching where
+func (p PageRequest) Query(where *Condition) Query {
+	query := Query{Where: where, Limit: p.PageSize, After: p.PageToken, IncludeDeleted: p.IncludeDeleted}
+	switch {
+	case p.OrderBy != "":
+		query.OrderBy = []Order{{Field: p.OrderBy, Desc: p.Descending}}
+	case p.Descending:
+		query.OrderBy = []Order{{Field: "id", Desc: true}}
+	}
+	return query
+}
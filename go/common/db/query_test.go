@@ -0,0 +1,172 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleTodos() []*models.Todo {
+	return []*models.Todo{
+		{Id: "t1", Text: "buy milk", UserId: "user1"},
+		{Id: "t2", Text: "buy bread", Done: true, UserId: "user1"},
+		{Id: "t3", Text: "walk dog", UserId: "user2"},
+		{Id: "t4", Text: "call mom", Done: true, UserId: "user2"},
+		{Id: "t5", Text: "write report", UserId: "user3"},
+	}
+}
+
+func ids(todos []*models.Todo) []string {
+	result := make([]string, len(todos))
+	for i, todo := range todos {
+		result[i] = todo.Id
+	}
+	return result
+}
+
+func TestRunQuery_Operators(t *testing.T) {
+	tests := []struct {
+		name  string
+		where *Condition
+		want  []string
+	}{
+		{"no condition", nil, []string{"t1", "t2", "t3", "t4", "t5"}},
+		{"eq", Where("user_id", Eq, "user1"), []string{"t1", "t2"}},
+		{"ne", Where("user_id", Ne, "user1"), []string{"t3", "t4", "t5"}},
+		{"lt", Where("text", Lt, "c"), []string{"t1", "t2"}},
+		{"gte", Where("text", Gte, "w"), []string{"t3", "t5"}},
+		{"in", Where("user_id", In, []string{"user2", "user3"}), []string{"t3", "t4", "t5"}},
+		{"prefix", Where("text", Prefix, "buy"), []string{"t1", "t2"}},
+		{"contains", Where("text", Contains, "o"), []string{"t3", "t4", "t5"}},
+		{"bool", Where("done", Eq, false), []string{"t1", "t3", "t5"}},
+		{"and", And(Where("user_id", Eq, "user1"), Where("done", Eq, true)), []string{"t2"}},
+		{"or", Or(Where("user_id", Eq, "user3"), Where("text", Prefix, "call")), []string{"t4", "t5"}},
+		{"nested", And(Where("done", Eq, false), Or(Where("user_id", Eq, "user1"), Where("user_id", Eq, "user2"))), []string{"t1", "t3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := RunQuery(sampleTodos(), Query{Where: tt.where})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, ids(page.Items))
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+}
+
+func TestRunQuery_Errors(t *testing.T) {
+	_, err := RunQuery(sampleTodos(), Query{Where: Where("UserId", Eq, "user1")})
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+	// Unknown fields are reported even when there is nothing to match
+	_, err = RunQuery([]*models.Todo{}, Query{OrderBy: []Order{{Field: "UserId"}}})
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+	_, err = RunQuery(sampleTodos(), Query{Where: Where("user_id", "like", "user1")})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = RunQuery(sampleTodos(), Query{Where: Where("user_id", In, "user1")})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+	_, err = RunQuery(sampleTodos(), Query{OrderBy: []Order{{Field: "text"}}, After: "not a cursor"})
+	assert.ErrorIs(t, err, ErrInvalidQuery)
+}
+
+func TestRunQuery_OrderAndOffset(t *testing.T) {
+	page, err := RunQuery(sampleTodos(), Query{OrderBy: []Order{{Field: "done", Desc: true}, {Field: "text"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t2", "t4", "t1", "t3", "t5"}, ids(page.Items))
+
+	page, err = RunQuery(sampleTodos(), Query{OrderBy: []Order{{Field: "text"}}, Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t1", "t4"}, ids(page.Items))
+	assert.NotEmpty(t, page.NextCursor)
+
+	page, err = RunQuery(sampleTodos(), Query{Offset: 10})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+}
+
+func TestRunQuery_CursorPagination(t *testing.T) {
+	todos := sampleTodos()
+	query := Query{OrderBy: []Order{{Field: "user_id", Desc: true}}, Limit: 2}
+
+	seen := []string{}
+	for pages := 0; pages < 10; pages++ {
+		page, err := RunQuery(todos, query)
+		require.NoError(t, err)
+		seen = append(seen, ids(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		query.After = page.NextCursor
+	}
+	assert.Equal(t, []string{"t5", "t3", "t4", "t1", "t2"}, seen)
+}
+
+func TestCollector_KeepsOnlyThePage(t *testing.T) {
+	todos := make([]*models.Todo, 0, 100)
+	for i := 99; i >= 0; i-- {
+		todos = append(todos, &models.Todo{Id: fmt.Sprintf("t%02d", i), Text: fmt.Sprintf("todo %02d", i%10), Done: i%2 == 0})
+	}
+	query := Query{Where: Where("done", Eq, false), OrderBy: []Order{{Field: "text", Desc: true}}, Offset: 3, Limit: 4}
+	collector, err := NewCollector[*models.Todo](query)
+	require.NoError(t, err)
+	for _, todo := range todos {
+		require.NoError(t, collector.Add(todo))
+		assert.LessOrEqual(t, len(collector.rows), 3+4+1)
+	}
+	page, err := collector.Page()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t39", "t49", "t59", "t69"}, ids(page.Items))
+
+	// The page is the same as the one of the whole result
+	query.Limit, query.Offset = 0, 0
+	all, err := RunQuery(todos, query)
+	require.NoError(t, err)
+	assert.Equal(t, ids(all.Items[3:7]), ids(page.Items))
+
+	query.Limit, query.After = 4, page.NextCursor
+	next, err := RunQuery(todos, query)
+	require.NoError(t, err)
+	assert.Equal(t, ids(all.Items[7:11]), ids(next.Items))
+}
+
+func TestRunQuery_CursorSurvivesWrites(t *testing.T) {
+	todos := sampleTodos()
+	query := Query{OrderBy: []Order{{Field: "text"}}, Limit: 2}
+	page, err := RunQuery(todos, query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t2", "t1"}, ids(page.Items))
+
+	// An item inserted before the cursor position must not shift the next page
+	todos = append(todos, &models.Todo{Id: "t0", Text: "answer email"})
+	query.After = page.NextCursor
+	page, err = RunQuery(todos, query)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t4", "t3"}, ids(page.Items))
+}
+
+func TestCompare(t *testing.T) {
+	assert.Equal(t, 0, Compare(models.Admin, "admin"))
+	assert.Equal(t, 0, Compare(3, 3.0))
+	assert.Less(t, Compare(false, true), 0)
+	assert.Less(t, Compare(int64(2), uint8(10)), 0)
+	assert.Less(t, Compare(nil, ""), 0)
+	assert.Greater(t, Compare("b", "a"), 0)
+	for _, value := range []any{true, 1, "x", nil} {
+		assert.Equal(t, 0, Compare(value, value), fmt.Sprint(value))
+	}
+}
+
+func TestRunQuery_SkipsDeleted(t *testing.T) {
+	todos := sampleTodos()
+	todos[1].DeletedAt = 1
+
+	page, err := RunQuery(todos, Query{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"t1", "t3", "t4", "t5"}, ids(page.Items))
+
+	page, err = RunQuery(todos, Query{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Len(t, page.Items, 5)
+}
@@ -0,0 +1,81 @@
+package sharddb
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// rebalanceBatchSize is how many items are read from a shard at a time while
+// rebalancing
+const rebalanceBatchSize = 500
+
+// RebalanceReport is the outcome of copying a table to another set of shards
+type RebalanceReport struct {
+	From int
+	To   int
+	// Items is the number of items copied and PerShard how many of them
+	// went to each new shard
+	Items    int
+	PerShard []int
+}
+
+func (report *RebalanceReport) String() string {
+	return fmt.Sprintf("copied %d items from %d to %d shards, %v per shard", report.Items, report.From, report.To, report.PerShard)
+}
+
+// Rebalance copies every item of from, items in the trash included, into the
+// shards of to, which have to be empty. Both tables must not be written to
+// while it runs. The copies are new writes to their shard, so their version
+// starts again at 1 and their update time, and the time a TTL counts from,
+// is the time of the copy.
+func Rebalance[T common.Serializable](from *ShardedDb[T], to *ShardedDb[T]) (*RebalanceReport, error) {
+	for shard, driver := range to.shards {
+		page, err := driver.Query(db.Query{Limit: 1, IncludeDeleted: true})
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Items) > 0 {
+			return nil, fmt.Errorf("shard %d to rebalance into is not empty", shard)
+		}
+	}
+
+	report := &RebalanceReport{From: len(from.shards), To: len(to.shards), PerShard: make([]int, len(to.shards))}
+	for shard, driver := range from.shards {
+		query := db.Query{Limit: rebalanceBatchSize, IncludeDeleted: true}
+		for {
+			page, err := driver.Query(query)
+			if err != nil {
+				log.Printf("Could not read shard %d: %v", shard, err)
+				return nil, err
+			}
+			for _, item := range page.Items {
+				target, err := to.shardOf(item)
+				if err != nil {
+					return nil, err
+				}
+				// An item found twice would otherwise be overwritten
+				// silently
+				if err := to.shards[target].UpsertIfVersion(item, 0); err != nil {
+					if errors.Is(err, db.ErrVersionConflict) {
+						id, _ := common.GetID(item)
+						err = fmt.Errorf("%s is stored in more than one shard: %w", id, err)
+					}
+					log.Printf("Could not copy item from shard %d: %v", shard, err)
+					return nil, err
+				}
+				report.Items++
+				report.PerShard[target]++
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			query.After = page.NextCursor
+		}
+	}
+	log.Printf("Rebalance: %s", report)
+	return report, nil
+}
@@ -0,0 +1,436 @@
+package sharddb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+)
+
+// ErrShardKeyChanged is returned when an upsert would change the shard key of
+// an item that is stored already. Items keep their shard key for life; moving
+// one means deleting it and creating it again.
+var ErrShardKeyChanged = errors.New("shard key of a stored item cannot change")
+
+// Driver that spreads a table over several drivers, its shards, by the hash
+// of a shard key field. Each item lives in the shard its shard key hashes to.
+//
+// Operations that name a shard key value go to that shard alone: upserts,
+// GetByField on the shard key, and GetByFilter or Query with an equality on
+// it. With "id" as the shard key every lookup by id does too. Everything else
+// is asked of all shards at once and the answers are merged.
+//
+// Items may not move between shards, so upserts with another shard key than
+// "id" look the item up in the other shards first and fail with
+// ErrShardKeyChanged if one of them has it. Items in the trash of another
+// shard are not found by that check.
+type ShardedDb[T common.Serializable] struct {
+	ShardKey string
+
+	shards []db.DbDriver[T]
+}
+
+// New spreads a table over shards by shardKey. The same shards have to be
+// given in the same order every time, or items will be looked for in the
+// wrong shard; use Rebalance to change their number.
+func New[T common.Serializable](shardKey string, shards ...db.DbDriver[T]) (*ShardedDb[T], error) {
+	if len(shards) == 0 {
+		return nil, errors.New("a sharded table needs at least one shard")
+	}
+	if err := common.ValidateFields[T](shardKey); err != nil {
+		log.Printf("Could not shard by %s: %v", shardKey, err)
+		return nil, err
+	}
+	return &ShardedDb[T]{ShardKey: shardKey, shards: shards}, nil
+}
+
+// ShardDir returns the directory that shard of a table spread over shards
+// keeps its files in. The shard count is part of the name so that a
+// rebalanced copy can be written next to the shards it replaces.
+func ShardDir(rootPath string, shard int, shards int) string {
+	return filepath.Join(rootPath, fmt.Sprintf("shard-%d-of-%d", shard, shards))
+}
+
+// OpenMemDb spreads a MemDb table over shards MemDb tables, each stored under
+// its ShardDir of rootPath. The options are passed to every shard.
+func OpenMemDb[T common.Serializable](table string, rootPath string, shards int, shardKey string, saveToDisk bool, opts ...memdb.Option) (*ShardedDb[T], error) {
+	if shards < 1 {
+		return nil, fmt.Errorf("invalid shard count %d", shards)
+	}
+	drivers := make([]db.DbDriver[T], 0, shards)
+	closeAll := func() {
+		for _, driver := range drivers {
+			driver.(*memdb.MemDb[T]).Close()
+		}
+	}
+	for shard := range shards {
+		dir := ShardDir(rootPath, shard, shards)
+		if saveToDisk {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				closeAll()
+				return nil, err
+			}
+		}
+		driver, err := memdb.Initialize[T](table, dir, saveToDisk, opts...)
+		if err != nil {
+			log.Printf("Could not open shard %d of table %s: %v", shard, table, err)
+			closeAll()
+			return nil, err
+		}
+		drivers = append(drivers, driver)
+	}
+	sharded, err := New(shardKey, drivers...)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+	return sharded, nil
+}
+
+// ShardOf returns which of shards a shard key value belongs to. Values that
+// compare equal with db.Compare, e.g. a models.Role and the same plain
+// string, belong to the same shard.
+func ShardOf(value any, shards int) (int, error) {
+	key, err := json.Marshal(db.Normalize(value))
+	if err != nil {
+		return 0, err
+	}
+	hash := fnv.New32a()
+	hash.Write(key)
+	return int(hash.Sum32() % uint32(shards)), nil
+}
+
+// Shards returns the drivers the table is spread over
+func (sdb *ShardedDb[T]) Shards() []db.DbDriver[T] {
+	return sdb.shards
+}
+
+// shardOf returns the shard item belongs to
+func (sdb *ShardedDb[T]) shardOf(item T) (int, error) {
+	value, err := common.GetField(item, sdb.ShardKey)
+	if err != nil {
+		return 0, err
+	}
+	return ShardOf(value, len(sdb.shards))
+}
+
+// routeByID returns the shard the item with the given id is in, or -1 if
+// the shard key is not the id
+func (sdb *ShardedDb[T]) routeByID(id string) (int, error) {
+	if sdb.ShardKey != "id" {
+		return -1, nil
+	}
+	return ShardOf(id, len(sdb.shards))
+}
+
+// routeByFilter returns the shard holding every item with the values of
+// equalities, or -1 if they do not fix the shard key
+func (sdb *ShardedDb[T]) routeByFilter(equalities map[string]any) (int, error) {
+	value, ok := equalities[sdb.ShardKey]
+	if !ok {
+		return -1, nil
+	}
+	return ShardOf(value, len(sdb.shards))
+}
+
+// scatter calls fn for every shard at once and returns what each call
+// returned, by shard
+func (sdb *ShardedDb[T]) scatter(fn func(shard int, driver db.DbDriver[T]) error) []error {
+	errs := make([]error, len(sdb.shards))
+	var wg sync.WaitGroup
+	for shard, driver := range sdb.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[shard] = fn(shard, driver)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+func (sdb *ShardedDb[T]) Upsert(item T) error {
+	return sdb.upsert(item, false, 0)
+}
+
+// UpsertIfVersion implements the DbDriver interface
+func (sdb *ShardedDb[T]) UpsertIfVersion(item T, version int64) error {
+	return sdb.upsert(item, true, version)
+}
+
+func (sdb *ShardedDb[T]) upsert(item T, conditional bool, version int64) error {
+	id, err := common.GetID(item)
+	if err != nil {
+		return err
+	}
+	shard, err := sdb.shardOf(item)
+	if err != nil {
+		return err
+	}
+	if sdb.ShardKey != "id" {
+		if err := sdb.checkNotElsewhere(id, shard); err != nil {
+			log.Printf("Upsert of %s rejected: %v", id, err)
+			return err
+		}
+	}
+	if conditional {
+		return sdb.shards[shard].UpsertIfVersion(item, version)
+	}
+	return sdb.shards[shard].Upsert(item)
+}
+
+// checkNotElsewhere returns ErrShardKeyChanged if a shard other than shard
+// has the item with the given id
+func (sdb *ShardedDb[T]) checkNotElsewhere(id string, shard int) error {
+	errs := sdb.scatter(func(other int, driver db.DbDriver[T]) error {
+		if other == shard {
+			return db.ErrNotFound
+		}
+		_, err := driver.GetByID(id)
+		return err
+	})
+	for other, err := range errs {
+		switch {
+		case err == nil:
+			return fmt.Errorf("%w: %s is stored in shard %d, not %d", ErrShardKeyChanged, id, other, shard)
+		case !errors.Is(err, db.ErrNotFound):
+			return err
+		}
+	}
+	return nil
+}
+
+// GetByID implements the DbDriver interface
+func (sdb *ShardedDb[T]) GetByID(id string) (T, error) {
+	var zero T
+	shard, err := sdb.routeByID(id)
+	if err != nil {
+		return zero, err
+	}
+	if shard >= 0 {
+		return sdb.shards[shard].GetByID(id)
+	}
+	return sdb.findOne(func(driver db.DbDriver[T]) (T, error) {
+		return driver.GetByID(id)
+	})
+}
+
+// findOne asks every shard for an item and returns the one found in the
+// first shard that has one
+func (sdb *ShardedDb[T]) findOne(get func(driver db.DbDriver[T]) (T, error)) (T, error) {
+	found := make([]T, len(sdb.shards))
+	errs := sdb.scatter(func(shard int, driver db.DbDriver[T]) error {
+		item, err := get(driver)
+		found[shard] = item
+		return err
+	})
+	var zero T
+	for shard, err := range errs {
+		if err == nil {
+			return found[shard], nil
+		}
+		if !errors.Is(err, db.ErrNotFound) {
+			return zero, err
+		}
+	}
+	return zero, db.ErrNotFound
+}
+
+func (sdb *ShardedDb[T]) GetAll() ([]T, error) {
+	return sdb.gather(func(driver db.DbDriver[T]) ([]T, error) {
+		return driver.GetAll()
+	})
+}
+
+// gather asks every shard for items and returns them all, those of the first
+// shard first
+func (sdb *ShardedDb[T]) gather(get func(driver db.DbDriver[T]) ([]T, error)) ([]T, error) {
+	results := make([][]T, len(sdb.shards))
+	errs := sdb.scatter(func(shard int, driver db.DbDriver[T]) error {
+		items, err := get(driver)
+		results[shard] = items
+		return err
+	})
+	result := make([]T, 0)
+	for shard, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, results[shard]...)
+	}
+	return result, nil
+}
+
+// Delete implements the DbDriver interface
+func (sdb *ShardedDb[T]) Delete(id string) error {
+	return sdb.byID(id, func(driver db.DbDriver[T]) error {
+		return driver.Delete(id)
+	})
+}
+
+// Restore implements the DbDriver interface
+func (sdb *ShardedDb[T]) Restore(id string) error {
+	return sdb.byID(id, func(driver db.DbDriver[T]) error {
+		return driver.Restore(id)
+	})
+}
+
+// Purge implements the DbDriver interface
+func (sdb *ShardedDb[T]) Purge(id string) error {
+	return sdb.byID(id, func(driver db.DbDriver[T]) error {
+		return driver.Purge(id)
+	})
+}
+
+// byID runs a write to the item with the given id on the shard that has it.
+// If the shard key is not the id the write is run on every shard, and fails
+// with db.ErrNotFound only if it does on all of them.
+func (sdb *ShardedDb[T]) byID(id string, write func(driver db.DbDriver[T]) error) error {
+	shard, err := sdb.routeByID(id)
+	if err != nil {
+		return err
+	}
+	if shard >= 0 {
+		return write(sdb.shards[shard])
+	}
+	errs := sdb.scatter(func(_ int, driver db.DbDriver[T]) error {
+		return write(driver)
+	})
+	notFound := 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, db.ErrNotFound):
+			notFound++
+		case err != nil:
+			return err
+		}
+	}
+	if notFound == len(errs) {
+		return db.ErrNotFound
+	}
+	return nil
+}
+
+func (sdb *ShardedDb[T]) GetByField(field string, value any) (T, error) {
+	var zero T
+	if err := common.ValidateFields[T](field); err != nil {
+		return zero, err
+	}
+	shard, err := sdb.routeByFilter(map[string]any{field: value})
+	if err != nil {
+		return zero, err
+	}
+	if shard >= 0 {
+		return sdb.shards[shard].GetByField(field, value)
+	}
+	return sdb.findOne(func(driver db.DbDriver[T]) (T, error) {
+		return driver.GetByField(field, value)
+	})
+}
+
+func (sdb *ShardedDb[T]) GetByFilter(filters map[string]any) ([]T, error) {
+	if err := db.ValidateFilters[T](filters); err != nil {
+		return nil, err
+	}
+	shard, err := sdb.routeByFilter(filters)
+	if err != nil {
+		return nil, err
+	}
+	if shard >= 0 {
+		return sdb.shards[shard].GetByFilter(filters)
+	}
+	return sdb.gather(func(driver db.DbDriver[T]) ([]T, error) {
+		return driver.GetByFilter(filters)
+	})
+}
+
+// Query implements the DbDriver interface. A query that does not fix the
+// shard key asks every shard for the first Offset+Limit+1 items after the
+// cursor, which include the first Offset+Limit+1 of the whole table, and
+// evaluates it again over the results.
+func (sdb *ShardedDb[T]) Query(query db.Query) (*db.Page[T], error) {
+	if err := db.ValidateQuery[T](query); err != nil {
+		return nil, err
+	}
+	shard, err := sdb.routeByFilter(query.Where.Equalities())
+	if err != nil {
+		return nil, err
+	}
+	if shard >= 0 {
+		return sdb.shards[shard].Query(query)
+	}
+
+	shardQuery := query
+	shardQuery.Offset = 0
+	if query.Limit > 0 {
+		shardQuery.Limit = query.Offset + query.Limit + 1
+	}
+	items, err := sdb.gather(func(driver db.DbDriver[T]) ([]T, error) {
+		page, err := driver.Query(shardQuery)
+		if err != nil {
+			return nil, err
+		}
+		return page.Items, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return db.RunQuery(items, query)
+}
+
+// PurgeDeleted implements the db.Purger interface for shards that implement
+// it
+func (sdb *ShardedDb[T]) PurgeDeleted(before time.Time) (int, error) {
+	return sdb.sum(func(driver db.DbDriver[T]) (int, error) {
+		purger, ok := driver.(db.Purger)
+		if !ok {
+			return 0, nil
+		}
+		return purger.PurgeDeleted(before)
+	})
+}
+
+// ExpireDue implements the db.Expirer interface for shards that implement it
+func (sdb *ShardedDb[T]) ExpireDue(now time.Time) (int, error) {
+	return sdb.sum(func(driver db.DbDriver[T]) (int, error) {
+		expirer, ok := driver.(db.Expirer)
+		if !ok {
+			return 0, nil
+		}
+		return expirer.ExpireDue(now)
+	})
+}
+
+// sum runs count on every shard and adds up the results
+func (sdb *ShardedDb[T]) sum(count func(driver db.DbDriver[T]) (int, error)) (int, error) {
+	var mu sync.Mutex
+	total := 0
+	errs := sdb.scatter(func(_ int, driver db.DbDriver[T]) error {
+		n, err := count(driver)
+		mu.Lock()
+		total += n
+		mu.Unlock()
+		return err
+	})
+	return total, errors.Join(errs...)
+}
+
+// Close closes the shards that can be closed
+func (sdb *ShardedDb[T]) Close() error {
+	errs := make([]error, 0)
+	for _, driver := range sdb.shards {
+		if closer, ok := driver.(interface{ Close() error }); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
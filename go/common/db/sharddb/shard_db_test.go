@@ -0,0 +1,203 @@
+package sharddb
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openTodos(t *testing.T, rootPath string, shards int) *ShardedDb[*models.Todo] {
+	t.Helper()
+	todos, err := OpenMemDb[*models.Todo]("todos", rootPath, shards, "user_id", true, memdb.WithIndex("user_id"))
+	require.NoError(t, err)
+	t.Cleanup(func() { todos.Close() })
+	return todos
+}
+
+// shardSizes returns how many todos each shard holds
+func shardSizes(t *testing.T, todos *ShardedDb[*models.Todo]) []int {
+	t.Helper()
+	sizes := make([]int, len(todos.Shards()))
+	for shard, driver := range todos.Shards() {
+		all, err := driver.GetAll()
+		require.NoError(t, err)
+		sizes[shard] = len(all)
+	}
+	return sizes
+}
+
+func TestShardedDb_RoutesByShardKey(t *testing.T) {
+	rootPath := t.TempDir()
+	todos := openTodos(t, rootPath, 4)
+	for i := range 40 {
+		require.NoError(t, todos.Upsert(&models.Todo{Id: fmt.Sprintf("todo%02d", i), Text: fmt.Sprintf("item %d", i), UserId: fmt.Sprintf("user%d", i%8)}))
+	}
+
+	// Every todo of a user is in the shard the user id hashes to
+	for user := range 8 {
+		userId := fmt.Sprintf("user%d", user)
+		shard, err := ShardOf(userId, 4)
+		require.NoError(t, err)
+		userTodos, err := todos.Shards()[shard].GetByFilter(map[string]any{"user_id": userId})
+		require.NoError(t, err)
+		assert.Len(t, userTodos, 5, userId)
+		routed, err := todos.GetByFilter(map[string]any{"user_id": userId})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, todoIds(userTodos), todoIds(routed))
+	}
+	sizes := shardSizes(t, todos)
+	assert.Equal(t, 40, sizes[0]+sizes[1]+sizes[2]+sizes[3])
+
+	todo, err := todos.GetByID("todo13")
+	require.NoError(t, err)
+	assert.Equal(t, "user5", todo.UserId)
+	todo, err = todos.GetByField("text", "item 13")
+	require.NoError(t, err)
+	assert.Equal(t, "todo13", todo.Id)
+	_, err = todos.GetByID("missing")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	all, err := todos.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 40)
+	_, err = todos.GetByFilter(map[string]any{"UserId": "user1"})
+	assert.ErrorIs(t, err, common.ErrUnknownField)
+
+	// The shards are on disk and come back in the same place
+	require.NoError(t, todos.Close())
+	reopened := openTodos(t, rootPath, 4)
+	assert.Equal(t, sizes, shardSizes(t, reopened))
+}
+
+func TestShardedDb_ShardKeyCannotChange(t *testing.T) {
+	todos := openTodos(t, t.TempDir(), 4)
+	todo := &models.Todo{Id: "todo1", Text: "first", UserId: "user0"}
+	require.NoError(t, todos.Upsert(todo))
+	assert.Equal(t, int64(1), todo.Version)
+
+	// Find a user that lives in another shard
+	home, err := ShardOf("user0", 4)
+	require.NoError(t, err)
+	other := ""
+	for i := 1; other == ""; i++ {
+		if shard, _ := ShardOf(fmt.Sprintf("user%d", i), 4); shard != home {
+			other = fmt.Sprintf("user%d", i)
+		}
+	}
+	err = todos.Upsert(&models.Todo{Id: "todo1", Text: "moved", UserId: other})
+	assert.ErrorIs(t, err, ErrShardKeyChanged)
+
+	require.NoError(t, todos.UpsertIfVersion(&models.Todo{Id: "todo1", Text: "edited", UserId: "user0"}, 1))
+	assert.ErrorIs(t, todos.UpsertIfVersion(&models.Todo{Id: "todo1", UserId: "user0"}, 1), db.ErrVersionConflict)
+}
+
+func TestShardedDb_QueryMatchesInMemoryEvaluation(t *testing.T) {
+	todos := openTodos(t, t.TempDir(), 3)
+	all := make([]*models.Todo, 0)
+	for i := range 30 {
+		todo := &models.Todo{Id: fmt.Sprintf("t%02d", i), Text: fmt.Sprintf("item %d", i%7), Done: i%3 == 0, UserId: fmt.Sprintf("user%d", i%5)}
+		require.NoError(t, todos.Upsert(todo))
+		all = append(all, todo)
+	}
+	require.NoError(t, todos.Delete("t04"))
+	all[4].SetDeletedAt(time.Now())
+
+	queries := []db.Query{
+		{},
+		{Limit: 7},
+		{Where: db.Where("user_id", db.Eq, "user1"), Limit: 2},
+		{Where: db.Where("done", db.Eq, true), OrderBy: []db.Order{{Field: "text", Desc: true}}, Limit: 4, Offset: 3},
+		{Where: db.Where("text", db.Prefix, "item 1"), IncludeDeleted: true},
+		{OrderBy: []db.Order{{Field: "done"}, {Field: "user_id", Desc: true}}, Limit: 5},
+	}
+	for i, query := range queries {
+		// Follow the cursors to the end
+		for page := 0; ; page++ {
+			want, err := db.RunQuery(all, query)
+			require.NoError(t, err)
+			got, err := todos.Query(query)
+			require.NoError(t, err, "query %d", i)
+			assert.Equal(t, todoIds(want.Items), todoIds(got.Items), "query %d page %d", i, page)
+			assert.Equal(t, want.NextCursor, got.NextCursor, "query %d page %d", i, page)
+			if got.NextCursor == "" {
+				break
+			}
+			query.After = got.NextCursor
+		}
+	}
+}
+
+func TestShardedDb_SoftDelete(t *testing.T) {
+	todos := openTodos(t, t.TempDir(), 3)
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, todos.Upsert(&models.Todo{Id: "todo2", Text: "second", UserId: "user2"}))
+
+	require.NoError(t, todos.Delete("todo1"))
+	_, err := todos.GetByID("todo1")
+	assert.ErrorIs(t, err, db.ErrNotFound)
+	require.NoError(t, todos.Restore("todo1"))
+	assert.ErrorIs(t, todos.Restore("todo1"), db.ErrNotFound)
+	assert.ErrorIs(t, todos.Restore("missing"), db.ErrNotFound)
+
+	require.NoError(t, todos.Delete("todo1"))
+	require.NoError(t, todos.Delete("todo2"))
+	purged, err := todos.PurgeDeleted(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	page, err := todos.Query(db.Query{IncludeDeleted: true})
+	require.NoError(t, err)
+	assert.Empty(t, page.Items)
+}
+
+func TestRebalance(t *testing.T) {
+	rootPath := t.TempDir()
+	from := openTodos(t, rootPath, 2)
+	for i := range 1100 {
+		require.NoError(t, from.Upsert(&models.Todo{Id: fmt.Sprintf("todo%04d", i), Text: "item", UserId: fmt.Sprintf("user%d", i%50)}))
+	}
+	require.NoError(t, from.Delete("todo0007"))
+
+	to := openTodos(t, rootPath, 5)
+	report, err := Rebalance(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, 1100, report.Items)
+	assert.Equal(t, 5, report.To)
+
+	// Every user's todos are together in the shard the new count puts them in
+	for user := range 50 {
+		userId := fmt.Sprintf("user%d", user)
+		shard, err := ShardOf(userId, 5)
+		require.NoError(t, err)
+		userTodos, err := to.Shards()[shard].GetByFilter(map[string]any{"user_id": userId})
+		require.NoError(t, err)
+		expected := 22
+		if userId == "user7" {
+			expected--
+		}
+		assert.Len(t, userTodos, expected, userId)
+	}
+	require.NoError(t, to.Restore("todo0007"))
+	_, err = to.GetByID("todo0007")
+	assert.NoError(t, err)
+
+	// The old shards are left alone
+	_, err = os.Stat(ShardDir(rootPath, 1, 2))
+	assert.NoError(t, err)
+	_, err = Rebalance(from, to)
+	assert.ErrorContains(t, err, "not empty")
+}
+
+func todoIds(todos []*models.Todo) []string {
+	result := make([]string, len(todos))
+	for i, todo := range todos {
+		result[i] = todo.Id
+	}
+	return result
+}
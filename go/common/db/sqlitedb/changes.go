@@ -0,0 +1,73 @@
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// Changes are recorded by triggers in the <table>_changes table, which keeps
+// the most recent db.DefaultChangeHistory of them. Sequence numbers come from
+// its AUTOINCREMENT key, so they are never reused.
+
+// pollInterval is how often watchers look for changes made by other
+// connections to the database file. Writes through the same SqliteDb wake
+// them up right away.
+const pollInterval = 250 * time.Millisecond
+
+// maxFetchedChanges caps the number of changes read for a watcher at once
+const maxFetchedChanges = 256
+
+// LatestSeq implements the db.Watchable interface
+func (sdb *SqliteDb[T]) LatestSeq() (uint64, error) {
+	var seq uint64
+	err := sdb.conn.QueryRow(fmt.Sprintf("SELECT IFNULL(MAX(seq), 0) FROM %s_changes", sdb.Table)).Scan(&seq)
+	return seq, err
+}
+
+// Watch implements the db.Watchable interface
+func (sdb *SqliteDb[T]) Watch(ctx context.Context, after uint64) (*db.Subscription[T], error) {
+	return db.Subscribe(ctx, after, sdb.changesAfter, &sdb.changed, pollInterval)
+}
+
+// changesAfter returns the next changes after seq
+func (sdb *SqliteDb[T]) changesAfter(after uint64) ([]db.ChangeEvent[T], error) {
+	rows, err := sdb.conn.Query(fmt.Sprintf("SELECT seq, op, id, before, after FROM %s_changes WHERE seq > ? ORDER BY seq LIMIT ?", sdb.Table),
+		after, maxFetchedChanges)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []db.ChangeEvent[T]{}
+	for rows.Next() {
+		var event db.ChangeEvent[T]
+		var beforeData, afterData sql.NullString
+		if err := rows.Scan(&event.Seq, &event.Op, &event.ID, &beforeData, &afterData); err != nil {
+			return nil, err
+		}
+		if beforeData.Valid {
+			if err := json.Unmarshal([]byte(beforeData.String), &event.Before); err != nil {
+				return nil, err
+			}
+		}
+		if afterData.Valid {
+			if err := json.Unmarshal([]byte(afterData.String), &event.After); err != nil {
+				return nil, err
+			}
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(events) > 0 && events[0].Seq > after+1 {
+		// Everything up to events[0] was pruned
+		return nil, db.ErrChangesExpired
+	}
+	return events, nil
+}
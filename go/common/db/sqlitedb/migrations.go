@@ -0,0 +1,121 @@
+package sqlitedb
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// migration is one step in the evolution of a table's schema. Migrations are
+// applied in order and each one exactly once per table; the versions applied
+// so far are recorded in the schema_migrations table.
+type migration struct {
+	version     int
+	description string
+	statements  func(table string) []string
+}
+
+// Never edit or reorder migrations that have shipped, only append new ones.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create document table",
+		statements: func(table string) []string {
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+					id   TEXT PRIMARY KEY,
+					data TEXT NOT NULL CHECK (json_valid(data))
+				)`, table),
+			}
+		},
+	},
+	{
+		version:     2,
+		description: "record changes for watchers",
+		statements: func(table string) []string {
+			changes := table + "_changes"
+			return []string{
+				fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+					seq    INTEGER PRIMARY KEY AUTOINCREMENT,
+					op     TEXT NOT NULL,
+					id     TEXT NOT NULL,
+					before TEXT,
+					after  TEXT
+				)`, changes),
+				fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_insert AFTER INSERT ON %s BEGIN
+					INSERT INTO %s (op, id, after) VALUES ('insert', NEW.id, NEW.data);
+				END`, changes, table, changes),
+				fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_update AFTER UPDATE ON %s BEGIN
+					INSERT INTO %s (op, id, before, after) VALUES ('update', NEW.id, OLD.data, NEW.data);
+				END`, changes, table, changes),
+				fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_delete AFTER DELETE ON %s BEGIN
+					INSERT INTO %s (op, id, before) VALUES ('delete', OLD.id, OLD.data);
+				END`, changes, table, changes),
+				// Only keep the most recent changes
+				fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %s_prune AFTER INSERT ON %s BEGIN
+					DELETE FROM %s WHERE seq <= NEW.seq - %d;
+				END`, changes, changes, changes, db.DefaultChangeHistory),
+			}
+		},
+	},
+}
+
+// migrate brings the schema of table up to the latest migration
+func migrate(conn *sql.DB, table string) error {
+	_, err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		table_name TEXT NOT NULL,
+		version    INTEGER NOT NULL,
+		applied_at TEXT NOT NULL DEFAULT (datetime('now')),
+		PRIMARY KEY (table_name, version)
+	)`)
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(conn, table)
+	if err != nil {
+		return err
+	}
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("table %s is at schema version %d, newer than the latest known version %d", table, current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := apply(conn, table, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+		log.Printf("Applied migration %d (%s) to table %s", m.version, m.description, table)
+	}
+	return nil
+}
+
+// schemaVersion returns the latest migration applied to table, 0 if none
+func schemaVersion(conn *sql.DB, table string) (int, error) {
+	var version int
+	err := conn.QueryRow(`SELECT IFNULL(MAX(version), 0) FROM schema_migrations WHERE table_name = ?`, table).Scan(&version)
+	return version, err
+}
+
+func apply(conn *sql.DB, table string, m migration) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range m.statements(table) {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (table_name, version) VALUES (?, ?)`, table, m.version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
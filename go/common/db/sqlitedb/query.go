@@ -0,0 +1,194 @@
+package sqlitedb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+)
+
+// Query implements the DbDriver interface by translating the query to SQL
+func (sdb *SqliteDb[T]) Query(query db.Query) (*db.Page[T], error) {
+	where, args, err := sdb.buildCondition(query.Where)
+	if err != nil {
+		return nil, err
+	}
+	conditions := []string{}
+	if where != "" {
+		conditions = append(conditions, where)
+	}
+	if !query.IncludeDeleted {
+		live, err := sdb.liveCondition()
+		if err != nil {
+			return nil, err
+		}
+		if live != "" {
+			conditions = append(conditions, live)
+		}
+	}
+
+	orderExprs := make([]string, 0, len(query.OrderBy))
+	orderTerms := make([]string, 0, len(query.OrderBy)+1)
+	for _, order := range query.OrderBy {
+		expr, err := sdb.fieldExpr(order.Field)
+		if err != nil {
+			return nil, err
+		}
+		orderExprs = append(orderExprs, expr)
+		direction := "ASC"
+		if order.Desc {
+			direction = "DESC"
+		}
+		orderTerms = append(orderTerms, expr+" "+direction)
+	}
+	orderTerms = append(orderTerms, "id ASC")
+
+	if query.After != "" {
+		keys, id, err := db.DecodeCursor(query.After, query.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		after, afterArgs := keysetCondition(orderExprs, query.OrderBy, keys, id)
+		conditions = append(conditions, after)
+		args = append(args, afterArgs...)
+	}
+
+	statement := fmt.Sprintf("SELECT data FROM %s", sdb.Table)
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += " ORDER BY " + strings.Join(orderTerms, ", ")
+	if query.Limit > 0 {
+		// Fetch one extra row to learn whether there is a next page
+		statement += " LIMIT ?"
+		args = append(args, query.Limit+1)
+	} else {
+		statement += " LIMIT -1"
+	}
+	if query.Offset > 0 {
+		statement += " OFFSET ?"
+		args = append(args, query.Offset)
+	}
+
+	items, err := sdb.query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	page := &db.Page[T]{Items: items}
+	if query.Limit > 0 && len(items) > query.Limit {
+		page.Items = items[:query.Limit]
+		cursor, err := db.EncodeCursor(page.Items[query.Limit-1], query.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor
+	}
+	return page, nil
+}
+
+// buildCondition translates a condition to a SQL boolean expression
+func (sdb *SqliteDb[T]) buildCondition(condition *db.Condition) (string, []any, error) {
+	if condition == nil {
+		return "", nil, nil
+	}
+	if len(condition.And) > 0 || len(condition.Or) > 0 {
+		clauses := []string{}
+		args := []any{}
+		for _, sub := range condition.And {
+			clause, subArgs, err := sdb.buildCondition(sub)
+			if err != nil {
+				return "", nil, err
+			}
+			if clause != "" {
+				clauses = append(clauses, clause)
+				args = append(args, subArgs...)
+			}
+		}
+		if len(condition.Or) > 0 {
+			alternatives := []string{}
+			for _, sub := range condition.Or {
+				clause, subArgs, err := sdb.buildCondition(sub)
+				if err != nil {
+					return "", nil, err
+				}
+				if clause == "" {
+					clause = "1"
+				}
+				alternatives = append(alternatives, clause)
+				args = append(args, subArgs...)
+			}
+			clauses = append(clauses, "("+strings.Join(alternatives, " OR ")+")")
+		}
+		if len(clauses) == 0 {
+			return "", nil, nil
+		}
+		return "(" + strings.Join(clauses, " AND ") + ")", args, nil
+	}
+
+	expr, err := sdb.fieldExpr(condition.Field)
+	if err != nil {
+		return "", nil, err
+	}
+	switch condition.Op {
+	case db.Eq, "":
+		return expr + " = ?", []any{condition.Value}, nil
+	case db.Ne:
+		return expr + " != ?", []any{condition.Value}, nil
+	case db.Lt:
+		return expr + " < ?", []any{condition.Value}, nil
+	case db.Lte:
+		return expr + " <= ?", []any{condition.Value}, nil
+	case db.Gt:
+		return expr + " > ?", []any{condition.Value}, nil
+	case db.Gte:
+		return expr + " >= ?", []any{condition.Value}, nil
+	case db.In:
+		values, err := condition.Values()
+		if err != nil {
+			return "", nil, err
+		}
+		if len(values) == 0 {
+			return "0", nil, nil
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		return expr + " IN (" + placeholders + ")", values, nil
+	case db.Prefix, db.Contains:
+		text, ok := condition.Value.(string)
+		if !ok {
+			return "", nil, fmt.Errorf("%w: %s needs a string value", db.ErrInvalidQuery, condition.Op)
+		}
+		if condition.Op == db.Prefix {
+			// substr keeps the comparison case sensitive, unlike LIKE
+			return "substr(" + expr + ", 1, length(?)) = ?", []any{text, text}, nil
+		}
+		return "instr(" + expr + ", ?) > 0", []any{text}, nil
+	default:
+		return "", nil, fmt.Errorf("%w: unknown operator %q", db.ErrInvalidQuery, condition.Op)
+	}
+}
+
+// keysetCondition matches the rows sorted after the position (keys, id)
+func keysetCondition(exprs []string, orders []db.Order, keys []any, id string) (string, []any) {
+	alternatives := []string{}
+	args := []any{}
+	for i := 0; i <= len(orders); i++ {
+		terms := []string{}
+		for j := 0; j < i; j++ {
+			terms = append(terms, exprs[j]+" = ?")
+			args = append(args, keys[j])
+		}
+		if i == len(orders) {
+			terms = append(terms, "id > ?")
+			args = append(args, id)
+		} else {
+			comparison := " > ?"
+			if orders[i].Desc {
+				comparison = " < ?"
+			}
+			terms = append(terms, exprs[i]+comparison)
+			args = append(args, keys[i])
+		}
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
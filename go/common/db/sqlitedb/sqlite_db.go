@@ -0,0 +1,495 @@
+package sqlitedb
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// FileName is the name of the database file created under the root path.
+// Every table of a service lives in the same file.
+const FileName = "data.sqlite"
+
+// Driver for data held in an embedded SQLite database. Each item is stored as
+// a JSON document in a table with one row per id; fields are addressed by
+// their JSON key, which is expected to match the name used with GetField.
+type SqliteDb[T common.Serializable] struct {
+	Table    string
+	FilePath string
+
+	conn    *sql.DB
+	zero    T
+	indexes []indexSpec
+	changed db.Broadcast
+}
+
+// Option configures a SqliteDb table at Initialize
+type Option func(*options)
+
+type options struct {
+	indexes []indexSpec
+}
+
+type indexSpec struct {
+	field  string
+	unique bool
+}
+
+// WithIndex declares a secondary index on field
+func WithIndex(field string) Option {
+	return func(o *options) {
+		o.indexes = append(o.indexes, indexSpec{field: field})
+	}
+}
+
+// WithUniqueIndex declares a secondary index on field that rejects two items
+// with the same value
+func WithUniqueIndex(field string) Option {
+	return func(o *options) {
+		o.indexes = append(o.indexes, indexSpec{field: field, unique: true})
+	}
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func Initialize[T common.Serializable](table string, rootPath string, opts ...Option) (*SqliteDb[T], error) {
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+	config := &options{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if err := common.ValidateFields[T]("id"); err != nil {
+		return nil, err
+	}
+
+	filePath := filepath.Join(rootPath, FileName)
+	conn, err := sql.Open("sqlite", "file:"+filePath+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		log.Printf("Could not open sqlite database %s: %v", filePath, err)
+		return nil, err
+	}
+
+	sdb := &SqliteDb[T]{
+		Table:    table,
+		FilePath: filePath,
+		conn:     conn,
+		zero:     newItem[T](),
+		indexes:  config.indexes,
+	}
+	if err := migrate(conn, table); err != nil {
+		log.Printf("Could not migrate table %s: %v", table, err)
+		conn.Close()
+		return nil, err
+	}
+	if err := sdb.ensureIndexes(); err != nil {
+		log.Printf("Could not create indexes for table %s: %v", table, err)
+		conn.Close()
+		return nil, err
+	}
+	return sdb, nil
+}
+
+// newItem returns an empty item whose GetField can be called to learn which
+// fields exist and what type they hold
+func newItem[T common.Serializable]() T {
+	var zero T
+	itemType := reflect.TypeOf(&zero).Elem()
+	if itemType.Kind() == reflect.Pointer {
+		return reflect.New(itemType.Elem()).Interface().(T)
+	}
+	return zero
+}
+
+// fieldExpr returns the SQL expression for a field of the stored document.
+// Fields left out of the JSON because of omitempty read as their zero value,
+// so filters on e.g. done = false match the way they do in memory. Indexes
+// are created on the same expression so that lookups can use them.
+func (sdb *SqliteDb[T]) fieldExpr(field string) (string, error) {
+	if !identifierPattern.MatchString(field) {
+		return "", fmt.Errorf("field %s not found", field)
+	}
+	zeroValue, err := common.GetField(sdb.zero, field)
+	if err != nil {
+		return "", err
+	}
+	fallback := "NULL"
+	switch reflect.ValueOf(zeroValue).Kind() {
+	case reflect.String:
+		fallback = "''"
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		fallback = "0"
+	}
+	return fmt.Sprintf("IFNULL(json_extract(data, '$.%s'), %s)", field, fallback), nil
+}
+
+func (sdb *SqliteDb[T]) ensureIndexes() error {
+	for _, spec := range sdb.indexes {
+		expr, err := sdb.fieldExpr(spec.field)
+		if err != nil {
+			return err
+		}
+		unique := ""
+		if spec.unique {
+			unique = "UNIQUE "
+		}
+		statement := fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s_%s_idx ON %s (%s)", unique, sdb.Table, spec.field, sdb.Table, expr)
+		if _, err := sdb.conn.Exec(statement); err != nil {
+			return translateError(err)
+		}
+	}
+	return nil
+}
+
+// Close closes the underlying database connection
+func (sdb *SqliteDb[T]) Close() error {
+	return sdb.conn.Close()
+}
+
+func (sdb *SqliteDb[T]) Upsert(item T) error {
+	if _, versioned := any(item).(db.Versioned); !versioned {
+		id, err := common.GetID(item)
+		if err != nil {
+			return err
+		}
+		data, err := common.ToJson(item)
+		if err != nil {
+			return err
+		}
+		statement := fmt.Sprintf("INSERT INTO %s (id, data) VALUES (?, ?) ON CONFLICT(id) DO UPDATE SET data = excluded.data", sdb.Table)
+		if _, err := sdb.conn.Exec(statement, id, data); err != nil {
+			log.Printf("Upsert into %s failed: %v", sdb.Table, err)
+			return translateError(err)
+		}
+		sdb.changed.Notify()
+		return nil
+	}
+
+	// Write on top of whatever version is stored, retrying if another
+	// writer gets in between
+	for {
+		id, err := common.GetID(item)
+		if err != nil {
+			return err
+		}
+		current, err := sdb.storedVersion(id)
+		if err != nil {
+			return err
+		}
+		err = sdb.UpsertIfVersion(item, current)
+		if !errors.Is(err, db.ErrVersionConflict) {
+			return err
+		}
+	}
+}
+
+// UpsertIfVersion implements the DbDriver interface
+func (sdb *SqliteDb[T]) UpsertIfVersion(item T, version int64) error {
+	id, err := common.GetID(item)
+	if err != nil {
+		return err
+	}
+	if _, versioned := any(item).(db.Versioned); !versioned {
+		if version != 0 {
+			return db.CheckVersion(id, version, 0)
+		}
+		return sdb.Upsert(item)
+	}
+
+	// Stamp a copy so the caller's item only changes if the write succeeds
+	var stored T
+	data, err := common.ToJson(item)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return err
+	}
+	now := time.Now()
+	db.Stamp(stored, version, now)
+	if data, err = common.ToJson(stored); err != nil {
+		return err
+	}
+
+	versionExpr, err := sdb.fieldExpr("version")
+	if err != nil {
+		return err
+	}
+	var result sql.Result
+	if version == 0 {
+		statement := fmt.Sprintf("INSERT INTO %s (id, data) VALUES (?, ?) ON CONFLICT(id) DO UPDATE SET data = excluded.data WHERE %s = 0", sdb.Table, versionExpr)
+		result, err = sdb.conn.Exec(statement, id, data)
+	} else {
+		statement := fmt.Sprintf("UPDATE %s SET data = ? WHERE id = ? AND %s = ?", sdb.Table, versionExpr)
+		result, err = sdb.conn.Exec(statement, data, id, version)
+	}
+	if err != nil {
+		log.Printf("Upsert into %s failed: %v", sdb.Table, err)
+		return translateError(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		current, err := sdb.storedVersion(id)
+		if err != nil {
+			return err
+		}
+		return db.CheckVersion(id, version, current)
+	}
+	db.Stamp(item, version, now)
+	sdb.changed.Notify()
+	return nil
+}
+
+// storedVersion returns the version of the stored item with the given id, 0
+// if there is none
+func (sdb *SqliteDb[T]) storedVersion(id string) (int64, error) {
+	versionExpr, err := sdb.fieldExpr("version")
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	err = sdb.conn.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", versionExpr, sdb.Table), id).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return version, err
+}
+
+// liveCondition returns the SQL condition that leaves out items in the
+// trash, or "" if items of type T are deleted permanently
+func (sdb *SqliteDb[T]) liveCondition() (string, error) {
+	if !db.IsSoftDeletable[T]() {
+		return "", nil
+	}
+	expr, err := sdb.fieldExpr("deleted_at")
+	if err != nil {
+		return "", err
+	}
+	return expr + " = 0", nil
+}
+
+// selectLive returns a SELECT of the items that are not in the trash and
+// match conditions
+func (sdb *SqliteDb[T]) selectLive(conditions ...string) (string, error) {
+	live, err := sdb.liveCondition()
+	if err != nil {
+		return "", err
+	}
+	if live != "" {
+		conditions = append(conditions, live)
+	}
+	statement := fmt.Sprintf("SELECT data FROM %s", sdb.Table)
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return statement, nil
+}
+
+func (sdb *SqliteDb[T]) GetAll() ([]T, error) {
+	statement, err := sdb.selectLive()
+	if err != nil {
+		return nil, err
+	}
+	return sdb.query(statement)
+}
+
+// GetByID implements the DbDriver interface
+func (sdb *SqliteDb[T]) GetByID(id string) (T, error) {
+	statement, err := sdb.selectLive("id = ?")
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return sdb.queryOne(statement, id)
+}
+
+// Delete implements the DbDriver interface. Soft deletable items are moved
+// to the trash, other items are purged.
+func (sdb *SqliteDb[T]) Delete(id string) error {
+	if !db.IsSoftDeletable[T]() {
+		return sdb.Purge(id)
+	}
+	err := sdb.setDeletedAt(id, time.Now())
+	if errors.Is(err, db.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Restore implements the DbDriver interface
+func (sdb *SqliteDb[T]) Restore(id string) error {
+	return sdb.setDeletedAt(id, time.Time{})
+}
+
+// setDeletedAt moves the item with the given id to the trash, or out of it
+// for the zero time. It returns db.ErrNotFound if there is no such item or it
+// already is where it should go.
+func (sdb *SqliteDb[T]) setDeletedAt(id string, deletedAt time.Time) error {
+	for {
+		item, err := sdb.queryOne(fmt.Sprintf("SELECT data FROM %s WHERE id = ?", sdb.Table), id)
+		if err != nil {
+			return err
+		}
+		if db.IsDeleted(item) == !deletedAt.IsZero() {
+			return db.ErrNotFound
+		}
+		deletable, ok := any(item).(db.SoftDeletable)
+		if !ok {
+			return db.ErrNotFound
+		}
+		deletable.SetDeletedAt(deletedAt)
+		// Write over the version that was read so a concurrent write is
+		// not lost
+		err = sdb.UpsertIfVersion(item, db.VersionOf(item))
+		if !errors.Is(err, db.ErrVersionConflict) {
+			return err
+		}
+	}
+}
+
+// Purge implements the DbDriver interface
+func (sdb *SqliteDb[T]) Purge(id string) error {
+	if _, err := sdb.conn.Exec(fmt.Sprintf("DELETE FROM %s WHERE id = ?", sdb.Table), id); err != nil {
+		log.Printf("Delete from %s failed: %v", sdb.Table, err)
+		return err
+	}
+	sdb.changed.Notify()
+	return nil
+}
+
+// PurgeDeleted implements the db.Purger interface
+func (sdb *SqliteDb[T]) PurgeDeleted(before time.Time) (int, error) {
+	if !db.IsSoftDeletable[T]() {
+		return 0, nil
+	}
+	expr, err := sdb.fieldExpr("deleted_at")
+	if err != nil {
+		return 0, err
+	}
+	statement := fmt.Sprintf("DELETE FROM %s WHERE %s > 0 AND %s < ?", sdb.Table, expr, expr)
+	result, err := sdb.conn.Exec(statement, before.UnixMilli())
+	if err != nil {
+		log.Printf("Purge of %s failed: %v", sdb.Table, err)
+		return 0, err
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if purged > 0 {
+		sdb.changed.Notify()
+	}
+	return int(purged), nil
+}
+
+func (sdb *SqliteDb[T]) GetByField(field string, value any) (T, error) {
+	var zero T
+	expr, err := sdb.fieldExpr(field)
+	if err != nil {
+		return zero, err
+	}
+	statement, err := sdb.selectLive(expr + " = ?")
+	if err != nil {
+		return zero, err
+	}
+	return sdb.queryOne(statement+" LIMIT 1", value)
+}
+
+func (sdb *SqliteDb[T]) GetByFilter(filters map[string]any) ([]T, error) {
+	// Sort the fields so the same filter always produces the same statement
+	fields := make([]string, 0, len(filters))
+	for field := range filters {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	conditions := make([]string, 0, len(fields))
+	args := make([]any, 0, len(fields))
+	for _, field := range fields {
+		expr, err := sdb.fieldExpr(field)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, expr+" = ?")
+		args = append(args, filters[field])
+	}
+
+	statement, err := sdb.selectLive(conditions...)
+	if err != nil {
+		return nil, err
+	}
+	return sdb.query(statement, args...)
+}
+
+func (sdb *SqliteDb[T]) query(statement string, args ...any) ([]T, error) {
+	rows, err := sdb.conn.Query(statement, args...)
+	if err != nil {
+		log.Printf("Query on %s failed: %v", sdb.Table, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]T, 0)
+	for rows.Next() {
+		item, err := scanItem[T](rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, rows.Err()
+}
+
+func (sdb *SqliteDb[T]) queryOne(statement string, args ...any) (T, error) {
+	item, err := scanItem[T](sdb.conn.QueryRow(statement, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return item, db.ErrNotFound
+	}
+	return item, err
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanItem[T common.Serializable](row scanner) (T, error) {
+	var item T
+	var data string
+	if err := row.Scan(&data); err != nil {
+		return item, err
+	}
+	if err := json.Unmarshal([]byte(data), &item); err != nil {
+		log.Printf("Error unmarshalling stored item: %v", err)
+		return item, err
+	}
+	return item, nil
+}
+
+// translateError maps SQLite constraint errors to the errors shared by all
+// drivers
+func translateError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return fmt.Errorf("%w: %v", db.ErrUniqueViolation, err)
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// SoftDeletable is implemented by items that go to the trash when deleted.
+// Deleting such an item only sets its deletion time; it is left out of reads
+// from then on but can be restored until it is purged. Drivers read the
+// deletion time of stored items through GetField("deleted_at"), which holds
+// it in unix milliseconds, 0 while the item is not deleted.
+type SoftDeletable interface {
+	common.Serializable
+	// GetDeletedAt returns the zero time if the item is not deleted
+	GetDeletedAt() time.Time
+	// SetDeletedAt with the zero time restores the item
+	SetDeletedAt(deletedAt time.Time)
+}
+
+// IsSoftDeletable reports whether items of type T go to the trash when
+// deleted
+func IsSoftDeletable[T common.Serializable]() bool {
+	var item T
+	_, ok := any(item).(SoftDeletable)
+	return ok
+}
+
+// IsDeleted reports whether item is in the trash
+func IsDeleted(item common.Serializable) bool {
+	deletable, ok := item.(SoftDeletable)
+	return ok && !deletable.GetDeletedAt().IsZero()
+}
+
+// DeletedBefore reports whether item went to the trash before t
+func DeletedBefore(item common.Serializable, t time.Time) bool {
+	deletable, ok := item.(SoftDeletable)
+	return ok && !deletable.GetDeletedAt().IsZero() && deletable.GetDeletedAt().Before(t)
+}
+
+// Purger is implemented by drivers that can empty their trash
+type Purger interface {
+	// PurgeDeleted permanently removes the items deleted before t and
+	// returns how many there were
+	PurgeDeleted(before time.Time) (int, error)
+}
+
+// RunPurger purges the items that have been in the trash for longer than
+// retention every interval until ctx is done
+func RunPurger(ctx context.Context, purger Purger, retention time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := purger.PurgeDeleted(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("Purging deleted items failed: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted items", purged)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
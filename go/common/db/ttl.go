@@ -0,0 +1,62 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// Expirable is implemented by items that expire at a time of their own, such
+// as sessions or reset codes. The zero time means the item does not expire.
+type Expirable interface {
+	common.Serializable
+	GetExpiresAt() time.Time
+}
+
+// ExpiresAt returns when an item written at writtenAt expires in a table
+// whose items live for ttl, 0 meaning forever. An Expirable item expires at
+// its own time if that comes first. It returns the zero time if the item
+// never expires.
+func ExpiresAt(item common.Serializable, writtenAt time.Time, ttl time.Duration) time.Time {
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = writtenAt.Add(ttl)
+	}
+	if expirable, ok := item.(Expirable); ok {
+		own := expirable.GetExpiresAt()
+		if !own.IsZero() && (expiresAt.IsZero() || own.Before(expiresAt)) {
+			expiresAt = own
+		}
+	}
+	return expiresAt
+}
+
+// Expirer is implemented by drivers that remove expired items. Expired items
+// are left out of reads right away; ExpireDue deletes them for good, which
+// watchers see as a delete.
+type Expirer interface {
+	// ExpireDue removes the items that have expired by now and returns how
+	// many there were
+	ExpireDue(now time.Time) (int, error)
+}
+
+// RunExpirer removes expired items every interval until ctx is done
+func RunExpirer(ctx context.Context, expirer Expirer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		expired, err := expirer.ExpireDue(time.Now())
+		if err != nil {
+			log.Printf("Removing expired items failed: %v", err)
+		} else if expired > 0 {
+			log.Printf("Removed %d expired items", expired)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// Versioned is implemented by items whose version and update time are
+// managed by the driver. Every successful write of an item stores it with
+// the next version, starting at 1, and the current time. The version is read
+// through GetField("version") by drivers that query stored documents.
+type Versioned interface {
+	common.Serializable
+	GetVersion() int64
+	SetVersion(version int64)
+	SetUpdatedAt(updatedAt time.Time)
+}
+
+// ErrVersionConflict matches every VersionConflictError with errors.Is
+var ErrVersionConflict = errors.New("version conflict")
+
+// VersionConflictError is returned by UpsertIfVersion when the stored item is
+// not at the expected version, i.e. someone else wrote it in the meantime
+type VersionConflictError struct {
+	ID       string
+	Expected int64
+	// Actual is the stored version, 0 if the item does not exist
+	Actual int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("version conflict on %s: expected version %d, stored version is %d", e.ID, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
+
+// VersionOf returns the version of item, 0 for items that are not Versioned
+func VersionOf(item common.Serializable) int64 {
+	if versioned, ok := item.(Versioned); ok {
+		return versioned.GetVersion()
+	}
+	return 0
+}
+
+// Stamp sets the version and update time of a Versioned item that is about to
+// replace the stored version current, 0 if there is none. Other items are
+// left alone.
+func Stamp(item common.Serializable, current int64, now time.Time) {
+	if versioned, ok := item.(Versioned); ok {
+		versioned.SetVersion(current + 1)
+		versioned.SetUpdatedAt(now)
+	}
+}
+
+// CheckVersion returns a VersionConflictError unless the stored version of
+// id is the expected one
+func CheckVersion(id string, expected int64, actual int64) error {
+	if expected != actual {
+		return &VersionConflictError{ID: id, Expected: expected, Actual: actual}
+	}
+	return nil
+}
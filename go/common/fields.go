@@ -0,0 +1,166 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownField is returned when a field name does not match any field of
+// an item
+var ErrUnknownField = errors.New("unknown field")
+
+// Fields are named by their json tag, the same keys ToJson and ToMap use, so a
+// field reads the same whether it comes from GetField or from a stored
+// document. Fields without a tag go by their Go name and fields tagged "-"
+// cannot be read.
+
+// fieldIndexes caches the field lookup table of each struct type
+var fieldIndexes sync.Map // reflect.Type -> map[string][]int
+
+// GetField returns the value of the field named field of a struct or pointer
+// to a struct.
+func GetField(object any, field string) (any, error) {
+	value := reflect.ValueOf(object)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil, fmt.Errorf("cannot get field %s of nil %s", field, value.Type())
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot get field %s of %s, not a struct", field, value.Type())
+	}
+	index, ok := fieldsOf(value.Type())[field]
+	if !ok {
+		return nil, unknownField(value.Type(), field)
+	}
+	fieldValue, err := value.FieldByIndexErr(index)
+	if err != nil {
+		// A nil embedded pointer, the field reads as its zero value
+		return reflect.Zero(value.Type().FieldByIndex(index).Type).Interface(), nil
+	}
+	return fieldValue.Interface(), nil
+}
+
+// GetID returns the "id" field of a struct, which must be a string. The db
+// drivers store items by it.
+func GetID(object any) (string, error) {
+	value, err := GetField(object, "id")
+	if err != nil {
+		return "", err
+	}
+	id, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("id of %T is a %T, not a string", object, value)
+	}
+	return id, nil
+}
+
+// FieldNames returns the names GetField accepts for items of type T, in the
+// order the fields are declared
+func FieldNames[T any]() []string {
+	itemType := structType[T]()
+	if itemType == nil {
+		return nil
+	}
+	return namesOf(itemType)
+}
+
+// ValidateFields fails with ErrUnknownField if any of fields is not a field
+// of items of type T. Drivers check the fields of filters, queries and
+// indexes with it so that a misspelled field is reported instead of matching
+// nothing.
+func ValidateFields[T any](fields ...string) error {
+	itemType := structType[T]()
+	if itemType == nil {
+		// Nothing to check against, GetField reports unknown fields
+		return nil
+	}
+	known := fieldsOf(itemType)
+	for _, field := range fields {
+		if _, ok := known[field]; !ok {
+			return unknownField(itemType, field)
+		}
+	}
+	return nil
+}
+
+// structType returns the struct type T is or points to, nil if it is neither
+func structType[T any]() reflect.Type {
+	itemType := reflect.TypeOf((*T)(nil)).Elem()
+	for itemType.Kind() == reflect.Pointer {
+		itemType = itemType.Elem()
+	}
+	if itemType.Kind() != reflect.Struct {
+		return nil
+	}
+	return itemType
+}
+
+func unknownField(itemType reflect.Type, field string) error {
+	return fmt.Errorf("%w %q for %s, known fields are %s", ErrUnknownField, field, itemType, strings.Join(namesOf(itemType), ", "))
+}
+
+func namesOf(itemType reflect.Type) []string {
+	names := make([]string, 0)
+	for _, field := range reflect.VisibleFields(itemType) {
+		if name, ok := fieldName(field); ok && slices.Equal(fieldsOf(itemType)[name], field.Index) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// fieldsOf returns the index of every readable field of a struct type by
+// name. Like encoding/json, a field of an embedded struct is hidden by a
+// field of the same name closer to the top.
+func fieldsOf(itemType reflect.Type) map[string][]int {
+	if cached, ok := fieldIndexes.Load(itemType); ok {
+		return cached.(map[string][]int)
+	}
+	fields := map[string][]int{}
+	for _, field := range reflect.VisibleFields(itemType) {
+		name, ok := fieldName(field)
+		if !ok {
+			continue
+		}
+		if existing, taken := fields[name]; taken && len(existing) <= len(field.Index) {
+			continue
+		}
+		fields[name] = field.Index
+	}
+	fieldIndexes.Store(itemType, fields)
+	return fields
+}
+
+// fieldName returns the name a struct field is read by, false if it cannot
+// be read
+func fieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		// Embedded structs without a name are flattened into their parent
+		if field.Anonymous && indirect(field.Type).Kind() == reflect.Struct {
+			return "", false
+		}
+		name = field.Name
+	}
+	return name, true
+}
+
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type audit struct {
+	CreatedBy string `json:"created_by"`
+	Note      string `json:"note"`
+}
+
+type note struct {
+	*audit
+	ID     string `json:"id"`
+	Note   string `json:"note,omitempty"`
+	Pinned bool
+	Secret string `json:"-"`
+	hidden string
+}
+
+func TestGetField(t *testing.T) {
+	item := &note{audit: &audit{CreatedBy: "user1", Note: "shadowed"}, ID: "n1", Note: "hello", Pinned: true, hidden: "x"}
+
+	value, err := GetField(item, "note")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", value)
+	value, err = GetField(item, "created_by")
+	require.NoError(t, err)
+	assert.Equal(t, "user1", value)
+	value, err = GetField(*item, "Pinned")
+	require.NoError(t, err)
+	assert.Equal(t, true, value)
+
+	for _, field := range []string{"Secret", "hidden", "Note", "audit"} {
+		_, err = GetField(item, field)
+		assert.ErrorIs(t, err, ErrUnknownField, field)
+	}
+
+	// Fields of a nil embedded struct read as zero values
+	value, err = GetField(&note{ID: "n2"}, "created_by")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	id, err := GetID(item)
+	require.NoError(t, err)
+	assert.Equal(t, "n1", id)
+	_, err = GetField((*note)(nil), "id")
+	assert.Error(t, err)
+}
+
+func TestValidateFields(t *testing.T) {
+	assert.Equal(t, []string{"created_by", "id", "note", "Pinned"}, FieldNames[*note]())
+	assert.NoError(t, ValidateFields[*note]("id", "created_by", "Pinned"))
+
+	err := ValidateFields[*note]("id", "UserId")
+	assert.ErrorIs(t, err, ErrUnknownField)
+	assert.Contains(t, err.Error(), `"UserId"`)
+	assert.Contains(t, err.Error(), "known fields are created_by, id, note, Pinned")
+}
@@ -9,6 +9,7 @@ package todopb
 import (
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
 	reflect "reflect"
 	sync "sync"
 	unsafe "unsafe"
@@ -27,7 +28,14 @@ type Todo struct {
 	Text  string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
 	Done  bool                   `protobuf:"varint,3,opt,name=done,proto3" json:"done,omitempty"`
 	// ID of the user who owns this todo
-	UserId        string `protobuf:"bytes,4,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	UserId string `protobuf:"bytes,4,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Set by the service on every write, starting at 1
+	Version int64 `protobuf:"varint,5,opt,name=version,proto3" json:"version,omitempty"`
+	// Time of the last write in unix milliseconds
+	UpdatedAt int64 `protobuf:"varint,6,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	// Time the todo was moved to the trash in unix milliseconds, 0 if it is
+	// not deleted
+	DeletedAt     int64 `protobuf:"varint,7,opt,name=deleted_at,json=deletedAt,proto3" json:"deleted_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -90,9 +98,32 @@ func (x *Todo) GetUserId() string {
 	return ""
 }
 
+func (x *Todo) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Todo) GetUpdatedAt() int64 {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return 0
+}
+
+func (x *Todo) GetDeletedAt() int64 {
+	if x != nil {
+		return x.DeletedAt
+	}
+	return 0
+}
+
 type CreateTodoRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Todo          *Todo                  `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The id of the todo is chosen by the service; only text, done and
+	// user_id are used
+	Todo          *Todo `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -135,8 +166,10 @@ func (x *CreateTodoRequest) GetTodo() *Todo {
 }
 
 type CreateTodoResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Response      string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Response string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// The todo as stored, with its new version
+	Todo          *Todo `protobuf:"bytes,2,opt,name=todo,proto3" json:"todo,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -178,12 +211,28 @@ func (x *CreateTodoResponse) GetResponse() string {
 	return ""
 }
 
+func (x *CreateTodoResponse) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
 type GetTodosRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
-	// Optional: filter todos by user ID
-	UserId        string `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	// The user whose todos are returned, required
+	UserId string `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Maximum number of todos to return, 0 returns all of them
+	PageSize int32 `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page, empty for the first page
+	PageToken string `protobuf:"bytes,3,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// Field to sort by (e.g. "text", "done"), todos are sorted by ID otherwise
+	OrderBy    string `protobuf:"bytes,4,opt,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"`
+	Descending bool   `protobuf:"varint,5,opt,name=descending,proto3" json:"descending,omitempty"`
+	// Also return todos that are in the trash
+	IncludeDeleted bool `protobuf:"varint,6,opt,name=include_deleted,json=includeDeleted,proto3" json:"include_deleted,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
 }
 
 func (x *GetTodosRequest) Reset() {
@@ -223,16 +272,159 @@ func (x *GetTodosRequest) GetUserId() string {
 	return ""
 }
 
+func (x *GetTodosRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *GetTodosRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *GetTodosRequest) GetOrderBy() string {
+	if x != nil {
+		return x.OrderBy
+	}
+	return ""
+}
+
+func (x *GetTodosRequest) GetDescending() bool {
+	if x != nil {
+		return x.Descending
+	}
+	return false
+}
+
+func (x *GetTodosRequest) GetIncludeDeleted() bool {
+	if x != nil {
+		return x.IncludeDeleted
+	}
+	return false
+}
+
+type RestoreTodoRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Owner of the todo; todos of other users are not found
+	UserId        string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreTodoRequest) Reset() {
+	*x = RestoreTodoRequest{}
+	mi := &file_todo_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreTodoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreTodoRequest) ProtoMessage() {}
+
+func (x *RestoreTodoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreTodoRequest.ProtoReflect.Descriptor instead.
+func (*RestoreTodoRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RestoreTodoRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RestoreTodoRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type RestoreTodoResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Response string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// The restored todo, with its new version
+	Todo          *Todo `protobuf:"bytes,2,opt,name=todo,proto3" json:"todo,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RestoreTodoResponse) Reset() {
+	*x = RestoreTodoResponse{}
+	mi := &file_todo_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RestoreTodoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RestoreTodoResponse) ProtoMessage() {}
+
+func (x *RestoreTodoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RestoreTodoResponse.ProtoReflect.Descriptor instead.
+func (*RestoreTodoResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RestoreTodoResponse) GetResponse() string {
+	if x != nil {
+		return x.Response
+	}
+	return ""
+}
+
+func (x *RestoreTodoResponse) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
 type GetTodosResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Todos         []*Todo                `protobuf:"bytes,1,rep,name=todos,proto3" json:"todos,omitempty"` // List of todos;
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Todos []*Todo                `protobuf:"bytes,1,rep,name=todos,proto3" json:"todos,omitempty"` // List of todos;
+	// Set when there are more todos, pass it as page_token to get them
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetTodosResponse) Reset() {
 	*x = GetTodosResponse{}
-	mi := &file_todo_proto_msgTypes[4]
+	mi := &file_todo_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -244,7 +436,7 @@ func (x *GetTodosResponse) String() string {
 func (*GetTodosResponse) ProtoMessage() {}
 
 func (x *GetTodosResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_todo_proto_msgTypes[4]
+	mi := &file_todo_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -257,7 +449,7 @@ func (x *GetTodosResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetTodosResponse.ProtoReflect.Descriptor instead.
 func (*GetTodosResponse) Descriptor() ([]byte, []int) {
-	return file_todo_proto_rawDescGZIP(), []int{4}
+	return file_todo_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *GetTodosResponse) GetTodos() []*Todo {
@@ -267,29 +459,795 @@ func (x *GetTodosResponse) GetTodos() []*Todo {
 	return nil
 }
 
-var File_todo_proto protoreflect.FileDescriptor
+func (x *GetTodosResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
 
-const file_todo_proto_rawDesc = "" +
-	"\n" +
-	"\n" +
-	"todo.proto\x12\x06todopb\"W\n" +
-	"\x04Todo\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
-	"\x04text\x18\x02 \x01(\tR\x04text\x12\x12\n" +
-	"\x04done\x18\x03 \x01(\bR\x04done\x12\x17\n" +
-	"\auser_id\x18\x04 \x01(\tR\x06userId\"5\n" +
-	"\x11CreateTodoRequest\x12 \n" +
-	"\x04todo\x18\x01 \x01(\v2\f.todopb.TodoR\x04todo\"0\n" +
-	"\x12CreateTodoResponse\x12\x1a\n" +
-	"\bresponse\x18\x01 \x01(\tR\bresponse\"*\n" +
-	"\x0fGetTodosRequest\x12\x17\n" +
-	"\auser_id\x18\x01 \x01(\tR\x06userId\"6\n" +
-	"\x10GetTodosResponse\x12\"\n" +
-	"\x05todos\x18\x01 \x03(\v2\f.todopb.TodoR\x05todos2\x91\x01\n" +
-	"\vTodoService\x12C\n" +
+type SearchTodosRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only the todos of this user are searched
+	UserId string `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// Words to look for in the todo text. Todos matching any of them are
+	// returned, best match first.
+	Query string `protobuf:"bytes,2,opt,name=query,proto3" json:"query,omitempty"`
+	// Maximum number of results, 0 returns 20. At most 100 are returned.
+	Limit         int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchTodosRequest) Reset() {
+	*x = SearchTodosRequest{}
+	mi := &file_todo_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchTodosRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchTodosRequest) ProtoMessage() {}
+
+func (x *SearchTodosRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchTodosRequest.ProtoReflect.Descriptor instead.
+func (*SearchTodosRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SearchTodosRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SearchTodosRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchTodosRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type TodoSearchResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Todo  *Todo                  `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
+	// Relevance of the todo to the query, higher is better
+	Score float64 `protobuf:"fixed64,2,opt,name=score,proto3" json:"score,omitempty"`
+	// The todo text, HTML escaped, with the matching words wrapped in
+	// <mark></mark>
+	Highlight     string `protobuf:"bytes,3,opt,name=highlight,proto3" json:"highlight,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TodoSearchResult) Reset() {
+	*x = TodoSearchResult{}
+	mi := &file_todo_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TodoSearchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TodoSearchResult) ProtoMessage() {}
+
+func (x *TodoSearchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TodoSearchResult.ProtoReflect.Descriptor instead.
+func (*TodoSearchResult) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TodoSearchResult) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
+func (x *TodoSearchResult) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *TodoSearchResult) GetHighlight() string {
+	if x != nil {
+		return x.Highlight
+	}
+	return ""
+}
+
+type SearchTodosResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*TodoSearchResult    `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchTodosResponse) Reset() {
+	*x = SearchTodosResponse{}
+	mi := &file_todo_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchTodosResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchTodosResponse) ProtoMessage() {}
+
+func (x *SearchTodosResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchTodosResponse.ProtoReflect.Descriptor instead.
+func (*SearchTodosResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SearchTodosResponse) GetResults() []*TodoSearchResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type GetTodoRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// The user asking for the todo, who has to own it
+	UserId        string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTodoRequest) Reset() {
+	*x = GetTodoRequest{}
+	mi := &file_todo_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTodoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTodoRequest) ProtoMessage() {}
+
+func (x *GetTodoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTodoRequest.ProtoReflect.Descriptor instead.
+func (*GetTodoRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetTodoRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetTodoRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type GetTodoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Todo          *Todo                  `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetTodoResponse) Reset() {
+	*x = GetTodoResponse{}
+	mi := &file_todo_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetTodoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetTodoResponse) ProtoMessage() {}
+
+func (x *GetTodoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetTodoResponse.ProtoReflect.Descriptor instead.
+func (*GetTodoResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GetTodoResponse) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
+type UpdateTodoRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The todo to update, found by its id, with the new values of the fields
+	// in update_mask
+	Todo *Todo `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
+	// Fields to update: "text" and "done". An empty mask updates both.
+	UpdateMask *fieldmaskpb.FieldMask `protobuf:"bytes,2,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
+	// The user making the update, who has to own the todo
+	UserId string `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	// When set the update fails with ABORTED unless the stored todo is at
+	// this version
+	ExpectedVersion *int64 `protobuf:"varint,4,opt,name=expected_version,json=expectedVersion,proto3,oneof" json:"expected_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *UpdateTodoRequest) Reset() {
+	*x = UpdateTodoRequest{}
+	mi := &file_todo_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateTodoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateTodoRequest) ProtoMessage() {}
+
+func (x *UpdateTodoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateTodoRequest.ProtoReflect.Descriptor instead.
+func (*UpdateTodoRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UpdateTodoRequest) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
+func (x *UpdateTodoRequest) GetUpdateMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.UpdateMask
+	}
+	return nil
+}
+
+func (x *UpdateTodoRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *UpdateTodoRequest) GetExpectedVersion() int64 {
+	if x != nil && x.ExpectedVersion != nil {
+		return *x.ExpectedVersion
+	}
+	return 0
+}
+
+type UpdateTodoResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The updated todo, with its new version
+	Todo          *Todo `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateTodoResponse) Reset() {
+	*x = UpdateTodoResponse{}
+	mi := &file_todo_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateTodoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateTodoResponse) ProtoMessage() {}
+
+func (x *UpdateTodoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateTodoResponse.ProtoReflect.Descriptor instead.
+func (*UpdateTodoResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *UpdateTodoResponse) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
+type ToggleDoneRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// The user toggling the todo, who has to own it
+	UserId        string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToggleDoneRequest) Reset() {
+	*x = ToggleDoneRequest{}
+	mi := &file_todo_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToggleDoneRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToggleDoneRequest) ProtoMessage() {}
+
+func (x *ToggleDoneRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToggleDoneRequest.ProtoReflect.Descriptor instead.
+func (*ToggleDoneRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ToggleDoneRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ToggleDoneRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type ToggleDoneResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The updated todo, with its new version
+	Todo          *Todo `protobuf:"bytes,1,opt,name=todo,proto3" json:"todo,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToggleDoneResponse) Reset() {
+	*x = ToggleDoneResponse{}
+	mi := &file_todo_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToggleDoneResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToggleDoneResponse) ProtoMessage() {}
+
+func (x *ToggleDoneResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToggleDoneResponse.ProtoReflect.Descriptor instead.
+func (*ToggleDoneResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ToggleDoneResponse) GetTodo() *Todo {
+	if x != nil {
+		return x.Todo
+	}
+	return nil
+}
+
+type DeleteTodoRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// The user deleting the todo, who has to own it
+	UserId        string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTodoRequest) Reset() {
+	*x = DeleteTodoRequest{}
+	mi := &file_todo_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTodoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTodoRequest) ProtoMessage() {}
+
+func (x *DeleteTodoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTodoRequest.ProtoReflect.Descriptor instead.
+func (*DeleteTodoRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *DeleteTodoRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteTodoRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type DeleteTodoResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Response      string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTodoResponse) Reset() {
+	*x = DeleteTodoResponse{}
+	mi := &file_todo_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTodoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTodoResponse) ProtoMessage() {}
+
+func (x *DeleteTodoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTodoResponse.ProtoReflect.Descriptor instead.
+func (*DeleteTodoResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *DeleteTodoResponse) GetResponse() string {
+	if x != nil {
+		return x.Response
+	}
+	return ""
+}
+
+type DeleteTodosRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Ids   []string               `protobuf:"bytes,1,rep,name=ids,proto3" json:"ids,omitempty"`
+	// The user deleting the todos, who has to own all of them
+	UserId        string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTodosRequest) Reset() {
+	*x = DeleteTodosRequest{}
+	mi := &file_todo_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTodosRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTodosRequest) ProtoMessage() {}
+
+func (x *DeleteTodosRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTodosRequest.ProtoReflect.Descriptor instead.
+func (*DeleteTodosRequest) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *DeleteTodosRequest) GetIds() []string {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+func (x *DeleteTodosRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type DeleteTodosResponse struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Response string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// Number of todos moved to the trash
+	Deleted       int32 `protobuf:"varint,2,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteTodosResponse) Reset() {
+	*x = DeleteTodosResponse{}
+	mi := &file_todo_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteTodosResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTodosResponse) ProtoMessage() {}
+
+func (x *DeleteTodosResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_todo_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTodosResponse.ProtoReflect.Descriptor instead.
+func (*DeleteTodosResponse) Descriptor() ([]byte, []int) {
+	return file_todo_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *DeleteTodosResponse) GetResponse() string {
+	if x != nil {
+		return x.Response
+	}
+	return ""
+}
+
+func (x *DeleteTodosResponse) GetDeleted() int32 {
+	if x != nil {
+		return x.Deleted
+	}
+	return 0
+}
+
+var File_todo_proto protoreflect.FileDescriptor
+
+const file_todo_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"todo.proto\x12\x06todopb\x1a google/protobuf/field_mask.proto\"\xaf\x01\n" +
+	"\x04Todo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12\x12\n" +
+	"\x04done\x18\x03 \x01(\bR\x04done\x12\x17\n" +
+	"\auser_id\x18\x04 \x01(\tR\x06userId\x12\x18\n" +
+	"\aversion\x18\x05 \x01(\x03R\aversion\x12\x1d\n" +
+	"\n" +
+	"updated_at\x18\x06 \x01(\x03R\tupdatedAt\x12\x1d\n" +
+	"\n" +
+	"deleted_at\x18\a \x01(\x03R\tdeletedAt\"M\n" +
+	"\x11CreateTodoRequest\x12 \n" +
+	"\x04todo\x18\x01 \x01(\v2\f.todopb.TodoR\x04todoJ\x04\b\x02\x10\x03R\x10expected_version\"R\n" +
+	"\x12CreateTodoResponse\x12\x1a\n" +
+	"\bresponse\x18\x01 \x01(\tR\bresponse\x12 \n" +
+	"\x04todo\x18\x02 \x01(\v2\f.todopb.TodoR\x04todo\"\xca\x01\n" +
+	"\x0fGetTodosRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1b\n" +
+	"\tpage_size\x18\x02 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tR\tpageToken\x12\x19\n" +
+	"\border_by\x18\x04 \x01(\tR\aorderBy\x12\x1e\n" +
+	"\n" +
+	"descending\x18\x05 \x01(\bR\n" +
+	"descending\x12'\n" +
+	"\x0finclude_deleted\x18\x06 \x01(\bR\x0eincludeDeleted\"=\n" +
+	"\x12RestoreTodoRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"S\n" +
+	"\x13RestoreTodoResponse\x12\x1a\n" +
+	"\bresponse\x18\x01 \x01(\tR\bresponse\x12 \n" +
+	"\x04todo\x18\x02 \x01(\v2\f.todopb.TodoR\x04todo\"^\n" +
+	"\x10GetTodosResponse\x12\"\n" +
+	"\x05todos\x18\x01 \x03(\v2\f.todopb.TodoR\x05todos\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"Y\n" +
+	"\x12SearchTodosRequest\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x14\n" +
+	"\x05query\x18\x02 \x01(\tR\x05query\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\"h\n" +
+	"\x10TodoSearchResult\x12 \n" +
+	"\x04todo\x18\x01 \x01(\v2\f.todopb.TodoR\x04todo\x12\x14\n" +
+	"\x05score\x18\x02 \x01(\x01R\x05score\x12\x1c\n" +
+	"\thighlight\x18\x03 \x01(\tR\thighlight\"I\n" +
+	"\x13SearchTodosResponse\x122\n" +
+	"\aresults\x18\x01 \x03(\v2\x18.todopb.TodoSearchResultR\aresults\"9\n" +
+	"\x0eGetTodoRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"3\n" +
+	"\x0fGetTodoResponse\x12 \n" +
+	"\x04todo\x18\x01 \x01(\v2\f.todopb.TodoR\x04todo\"\xd0\x01\n" +
+	"\x11UpdateTodoRequest\x12 \n" +
+	"\x04todo\x18\x01 \x01(\v2\f.todopb.TodoR\x04todo\x12;\n" +
+	"\vupdate_mask\x18\x02 \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
+	"updateMask\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12.\n" +
+	"\x10expected_version\x18\x04 \x01(\x03H\x00R\x0fexpectedVersion\x88\x01\x01B\x13\n" +
+	"\x11_expected_version\"6\n" +
+	"\x12UpdateTodoResponse\x12 \n" +
+	"\x04todo\x18\x01 \x01(\v2\f.todopb.TodoR\x04todo\"<\n" +
+	"\x11ToggleDoneRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"6\n" +
+	"\x12ToggleDoneResponse\x12 \n" +
+	"\x04todo\x18\x01 \x01(\v2\f.todopb.TodoR\x04todo\"<\n" +
+	"\x11DeleteTodoRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"0\n" +
+	"\x12DeleteTodoResponse\x12\x1a\n" +
+	"\bresponse\x18\x01 \x01(\tR\bresponse\"?\n" +
+	"\x12DeleteTodosRequest\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\tR\x03ids\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\"K\n" +
+	"\x13DeleteTodosResponse\x12\x1a\n" +
+	"\bresponse\x18\x01 \x01(\tR\bresponse\x12\x18\n" +
+	"\adeleted\x18\x02 \x01(\x05R\adeleted2\xf4\x04\n" +
+	"\vTodoService\x12C\n" +
+	"\n" +
+	"CreateTodo\x12\x19.todopb.CreateTodoRequest\x1a\x1a.todopb.CreateTodoResponse\x12:\n" +
+	"\aGetTodo\x12\x16.todopb.GetTodoRequest\x1a\x17.todopb.GetTodoResponse\x12C\n" +
+	"\n" +
+	"UpdateTodo\x12\x19.todopb.UpdateTodoRequest\x1a\x1a.todopb.UpdateTodoResponse\x12C\n" +
+	"\n" +
+	"ToggleDone\x12\x19.todopb.ToggleDoneRequest\x1a\x1a.todopb.ToggleDoneResponse\x12C\n" +
 	"\n" +
-	"CreateTodo\x12\x19.todopb.CreateTodoRequest\x1a\x1a.todopb.CreateTodoResponse\x12=\n" +
-	"\bGetTodos\x12\x17.todopb.GetTodosRequest\x1a\x18.todopb.GetTodosResponseB\tZ\a/todopbb\x06proto3"
+	"DeleteTodo\x12\x19.todopb.DeleteTodoRequest\x1a\x1a.todopb.DeleteTodoResponse\x12F\n" +
+	"\vDeleteTodos\x12\x1a.todopb.DeleteTodosRequest\x1a\x1b.todopb.DeleteTodosResponse\x12=\n" +
+	"\bGetTodos\x12\x17.todopb.GetTodosRequest\x1a\x18.todopb.GetTodosResponse\x12F\n" +
+	"\vRestoreTodo\x12\x1a.todopb.RestoreTodoRequest\x1a\x1b.todopb.RestoreTodoResponse\x12F\n" +
+	"\vSearchTodos\x12\x1a.todopb.SearchTodosRequest\x1a\x1b.todopb.SearchTodosResponseB\tZ\a/todopbb\x06proto3"
 
 var (
 	file_todo_proto_rawDescOnce sync.Once
@@ -303,26 +1261,65 @@ func file_todo_proto_rawDescGZIP() []byte {
 	return file_todo_proto_rawDescData
 }
 
-var file_todo_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_todo_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
 var file_todo_proto_goTypes = []any{
-	(*Todo)(nil),               // 0: todopb.Todo
-	(*CreateTodoRequest)(nil),  // 1: todopb.CreateTodoRequest
-	(*CreateTodoResponse)(nil), // 2: todopb.CreateTodoResponse
-	(*GetTodosRequest)(nil),    // 3: todopb.GetTodosRequest
-	(*GetTodosResponse)(nil),   // 4: todopb.GetTodosResponse
+	(*Todo)(nil),                  // 0: todopb.Todo
+	(*CreateTodoRequest)(nil),     // 1: todopb.CreateTodoRequest
+	(*CreateTodoResponse)(nil),    // 2: todopb.CreateTodoResponse
+	(*GetTodosRequest)(nil),       // 3: todopb.GetTodosRequest
+	(*RestoreTodoRequest)(nil),    // 4: todopb.RestoreTodoRequest
+	(*RestoreTodoResponse)(nil),   // 5: todopb.RestoreTodoResponse
+	(*GetTodosResponse)(nil),      // 6: todopb.GetTodosResponse
+	(*SearchTodosRequest)(nil),    // 7: todopb.SearchTodosRequest
+	(*TodoSearchResult)(nil),      // 8: todopb.TodoSearchResult
+	(*SearchTodosResponse)(nil),   // 9: todopb.SearchTodosResponse
+	(*GetTodoRequest)(nil),        // 10: todopb.GetTodoRequest
+	(*GetTodoResponse)(nil),       // 11: todopb.GetTodoResponse
+	(*UpdateTodoRequest)(nil),     // 12: todopb.UpdateTodoRequest
+	(*UpdateTodoResponse)(nil),    // 13: todopb.UpdateTodoResponse
+	(*ToggleDoneRequest)(nil),     // 14: todopb.ToggleDoneRequest
+	(*ToggleDoneResponse)(nil),    // 15: todopb.ToggleDoneResponse
+	(*DeleteTodoRequest)(nil),     // 16: todopb.DeleteTodoRequest
+	(*DeleteTodoResponse)(nil),    // 17: todopb.DeleteTodoResponse
+	(*DeleteTodosRequest)(nil),    // 18: todopb.DeleteTodosRequest
+	(*DeleteTodosResponse)(nil),   // 19: todopb.DeleteTodosResponse
+	(*fieldmaskpb.FieldMask)(nil), // 20: google.protobuf.FieldMask
 }
 var file_todo_proto_depIdxs = []int32{
-	0, // 0: todopb.CreateTodoRequest.todo:type_name -> todopb.Todo
-	0, // 1: todopb.GetTodosResponse.todos:type_name -> todopb.Todo
-	1, // 2: todopb.TodoService.CreateTodo:input_type -> todopb.CreateTodoRequest
-	3, // 3: todopb.TodoService.GetTodos:input_type -> todopb.GetTodosRequest
-	2, // 4: todopb.TodoService.CreateTodo:output_type -> todopb.CreateTodoResponse
-	4, // 5: todopb.TodoService.GetTodos:output_type -> todopb.GetTodosResponse
-	4, // [4:6] is the sub-list for method output_type
-	2, // [2:4] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	0,  // 0: todopb.CreateTodoRequest.todo:type_name -> todopb.Todo
+	0,  // 1: todopb.CreateTodoResponse.todo:type_name -> todopb.Todo
+	0,  // 2: todopb.RestoreTodoResponse.todo:type_name -> todopb.Todo
+	0,  // 3: todopb.GetTodosResponse.todos:type_name -> todopb.Todo
+	0,  // 4: todopb.TodoSearchResult.todo:type_name -> todopb.Todo
+	8,  // 5: todopb.SearchTodosResponse.results:type_name -> todopb.TodoSearchResult
+	0,  // 6: todopb.GetTodoResponse.todo:type_name -> todopb.Todo
+	0,  // 7: todopb.UpdateTodoRequest.todo:type_name -> todopb.Todo
+	20, // 8: todopb.UpdateTodoRequest.update_mask:type_name -> google.protobuf.FieldMask
+	0,  // 9: todopb.UpdateTodoResponse.todo:type_name -> todopb.Todo
+	0,  // 10: todopb.ToggleDoneResponse.todo:type_name -> todopb.Todo
+	1,  // 11: todopb.TodoService.CreateTodo:input_type -> todopb.CreateTodoRequest
+	10, // 12: todopb.TodoService.GetTodo:input_type -> todopb.GetTodoRequest
+	12, // 13: todopb.TodoService.UpdateTodo:input_type -> todopb.UpdateTodoRequest
+	14, // 14: todopb.TodoService.ToggleDone:input_type -> todopb.ToggleDoneRequest
+	16, // 15: todopb.TodoService.DeleteTodo:input_type -> todopb.DeleteTodoRequest
+	18, // 16: todopb.TodoService.DeleteTodos:input_type -> todopb.DeleteTodosRequest
+	3,  // 17: todopb.TodoService.GetTodos:input_type -> todopb.GetTodosRequest
+	4,  // 18: todopb.TodoService.RestoreTodo:input_type -> todopb.RestoreTodoRequest
+	7,  // 19: todopb.TodoService.SearchTodos:input_type -> todopb.SearchTodosRequest
+	2,  // 20: todopb.TodoService.CreateTodo:output_type -> todopb.CreateTodoResponse
+	11, // 21: todopb.TodoService.GetTodo:output_type -> todopb.GetTodoResponse
+	13, // 22: todopb.TodoService.UpdateTodo:output_type -> todopb.UpdateTodoResponse
+	15, // 23: todopb.TodoService.ToggleDone:output_type -> todopb.ToggleDoneResponse
+	17, // 24: todopb.TodoService.DeleteTodo:output_type -> todopb.DeleteTodoResponse
+	19, // 25: todopb.TodoService.DeleteTodos:output_type -> todopb.DeleteTodosResponse
+	6,  // 26: todopb.TodoService.GetTodos:output_type -> todopb.GetTodosResponse
+	5,  // 27: todopb.TodoService.RestoreTodo:output_type -> todopb.RestoreTodoResponse
+	9,  // 28: todopb.TodoService.SearchTodos:output_type -> todopb.SearchTodosResponse
+	20, // [20:29] is the sub-list for method output_type
+	11, // [11:20] is the sub-list for method input_type
+	11, // [11:11] is the sub-list for extension type_name
+	11, // [11:11] is the sub-list for extension extendee
+	0,  // [0:11] is the sub-list for field type_name
 }
 
 func init() { file_todo_proto_init() }
@@ -330,13 +1327,14 @@ func file_todo_proto_init() {
 	if File_todo_proto != nil {
 		return
 	}
+	file_todo_proto_msgTypes[12].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_todo_proto_rawDesc), len(file_todo_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   20,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
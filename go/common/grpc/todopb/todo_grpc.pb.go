@@ -19,8 +19,15 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	TodoService_CreateTodo_FullMethodName = "/todopb.TodoService/CreateTodo"
-	TodoService_GetTodos_FullMethodName   = "/todopb.TodoService/GetTodos"
+	TodoService_CreateTodo_FullMethodName  = "/todopb.TodoService/CreateTodo"
+	TodoService_GetTodo_FullMethodName     = "/todopb.TodoService/GetTodo"
+	TodoService_UpdateTodo_FullMethodName  = "/todopb.TodoService/UpdateTodo"
+	TodoService_ToggleDone_FullMethodName  = "/todopb.TodoService/ToggleDone"
+	TodoService_DeleteTodo_FullMethodName  = "/todopb.TodoService/DeleteTodo"
+	TodoService_DeleteTodos_FullMethodName = "/todopb.TodoService/DeleteTodos"
+	TodoService_GetTodos_FullMethodName    = "/todopb.TodoService/GetTodos"
+	TodoService_RestoreTodo_FullMethodName = "/todopb.TodoService/RestoreTodo"
+	TodoService_SearchTodos_FullMethodName = "/todopb.TodoService/SearchTodos"
 )
 
 // TodoServiceClient is the client API for TodoService service.
@@ -29,10 +36,29 @@ const (
 //
 // TodoService defines the todo management operations.
 type TodoServiceClient interface {
-	// Creates a new todo item.
+	// Creates a new todo item with a new id.
 	CreateTodo(ctx context.Context, in *CreateTodoRequest, opts ...grpc.CallOption) (*CreateTodoResponse, error)
+	// Retrieves one todo. Fails with NOT_FOUND if there is no such todo and
+	// PERMISSION_DENIED if it belongs to another user, like the other calls
+	// on single todos.
+	GetTodo(ctx context.Context, in *GetTodoRequest, opts ...grpc.CallOption) (*GetTodoResponse, error)
+	// Updates the fields of a todo named in the update mask.
+	UpdateTodo(ctx context.Context, in *UpdateTodoRequest, opts ...grpc.CallOption) (*UpdateTodoResponse, error)
+	// Marks a todo done if it is not, and not done if it is.
+	ToggleDone(ctx context.Context, in *ToggleDoneRequest, opts ...grpc.CallOption) (*ToggleDoneResponse, error)
+	// Moves a todo to the trash, from where RestoreTodo takes it back.
+	DeleteTodo(ctx context.Context, in *DeleteTodoRequest, opts ...grpc.CallOption) (*DeleteTodoResponse, error)
+	// Moves several todos to the trash. Nothing is deleted if one of them
+	// does not exist or belongs to another user.
+	DeleteTodos(ctx context.Context, in *DeleteTodosRequest, opts ...grpc.CallOption) (*DeleteTodosResponse, error)
 	// Retrieves todo items, optionally filtered by user ID.
 	GetTodos(ctx context.Context, in *GetTodosRequest, opts ...grpc.CallOption) (*GetTodosResponse, error)
+	// Takes a todo back out of the trash. Fails with NOT_FOUND if the todo is
+	// not in the trash, which includes todos that have been purged.
+	RestoreTodo(ctx context.Context, in *RestoreTodoRequest, opts ...grpc.CallOption) (*RestoreTodoResponse, error)
+	// Searches the text of a user's todos. Todos in the trash are not
+	// searched.
+	SearchTodos(ctx context.Context, in *SearchTodosRequest, opts ...grpc.CallOption) (*SearchTodosResponse, error)
 }
 
 type todoServiceClient struct {
@@ -53,6 +79,56 @@ func (c *todoServiceClient) CreateTodo(ctx context.Context, in *CreateTodoReques
 	return out, nil
 }
 
+func (c *todoServiceClient) GetTodo(ctx context.Context, in *GetTodoRequest, opts ...grpc.CallOption) (*GetTodoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetTodoResponse)
+	err := c.cc.Invoke(ctx, TodoService_GetTodo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) UpdateTodo(ctx context.Context, in *UpdateTodoRequest, opts ...grpc.CallOption) (*UpdateTodoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateTodoResponse)
+	err := c.cc.Invoke(ctx, TodoService_UpdateTodo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) ToggleDone(ctx context.Context, in *ToggleDoneRequest, opts ...grpc.CallOption) (*ToggleDoneResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ToggleDoneResponse)
+	err := c.cc.Invoke(ctx, TodoService_ToggleDone_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) DeleteTodo(ctx context.Context, in *DeleteTodoRequest, opts ...grpc.CallOption) (*DeleteTodoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteTodoResponse)
+	err := c.cc.Invoke(ctx, TodoService_DeleteTodo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) DeleteTodos(ctx context.Context, in *DeleteTodosRequest, opts ...grpc.CallOption) (*DeleteTodosResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteTodosResponse)
+	err := c.cc.Invoke(ctx, TodoService_DeleteTodos_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *todoServiceClient) GetTodos(ctx context.Context, in *GetTodosRequest, opts ...grpc.CallOption) (*GetTodosResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(GetTodosResponse)
@@ -63,16 +139,55 @@ func (c *todoServiceClient) GetTodos(ctx context.Context, in *GetTodosRequest, o
 	return out, nil
 }
 
+func (c *todoServiceClient) RestoreTodo(ctx context.Context, in *RestoreTodoRequest, opts ...grpc.CallOption) (*RestoreTodoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RestoreTodoResponse)
+	err := c.cc.Invoke(ctx, TodoService_RestoreTodo_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *todoServiceClient) SearchTodos(ctx context.Context, in *SearchTodosRequest, opts ...grpc.CallOption) (*SearchTodosResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchTodosResponse)
+	err := c.cc.Invoke(ctx, TodoService_SearchTodos_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TodoServiceServer is the server API for TodoService service.
 // All implementations must embed UnimplementedTodoServiceServer
 // for forward compatibility.
 //
 // TodoService defines the todo management operations.
 type TodoServiceServer interface {
-	// Creates a new todo item.
+	// Creates a new todo item with a new id.
 	CreateTodo(context.Context, *CreateTodoRequest) (*CreateTodoResponse, error)
+	// Retrieves one todo. Fails with NOT_FOUND if there is no such todo and
+	// PERMISSION_DENIED if it belongs to another user, like the other calls
+	// on single todos.
+	GetTodo(context.Context, *GetTodoRequest) (*GetTodoResponse, error)
+	// Updates the fields of a todo named in the update mask.
+	UpdateTodo(context.Context, *UpdateTodoRequest) (*UpdateTodoResponse, error)
+	// Marks a todo done if it is not, and not done if it is.
+	ToggleDone(context.Context, *ToggleDoneRequest) (*ToggleDoneResponse, error)
+	// Moves a todo to the trash, from where RestoreTodo takes it back.
+	DeleteTodo(context.Context, *DeleteTodoRequest) (*DeleteTodoResponse, error)
+	// Moves several todos to the trash. Nothing is deleted if one of them
+	// does not exist or belongs to another user.
+	DeleteTodos(context.Context, *DeleteTodosRequest) (*DeleteTodosResponse, error)
 	// Retrieves todo items, optionally filtered by user ID.
 	GetTodos(context.Context, *GetTodosRequest) (*GetTodosResponse, error)
+	// Takes a todo back out of the trash. Fails with NOT_FOUND if the todo is
+	// not in the trash, which includes todos that have been purged.
+	RestoreTodo(context.Context, *RestoreTodoRequest) (*RestoreTodoResponse, error)
+	// Searches the text of a user's todos. Todos in the trash are not
+	// searched.
+	SearchTodos(context.Context, *SearchTodosRequest) (*SearchTodosResponse, error)
 	mustEmbedUnimplementedTodoServiceServer()
 }
 
@@ -86,9 +201,30 @@ type UnimplementedTodoServiceServer struct{}
 func (UnimplementedTodoServiceServer) CreateTodo(context.Context, *CreateTodoRequest) (*CreateTodoResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method CreateTodo not implemented")
 }
+func (UnimplementedTodoServiceServer) GetTodo(context.Context, *GetTodoRequest) (*GetTodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTodo not implemented")
+}
+func (UnimplementedTodoServiceServer) UpdateTodo(context.Context, *UpdateTodoRequest) (*UpdateTodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateTodo not implemented")
+}
+func (UnimplementedTodoServiceServer) ToggleDone(context.Context, *ToggleDoneRequest) (*ToggleDoneResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ToggleDone not implemented")
+}
+func (UnimplementedTodoServiceServer) DeleteTodo(context.Context, *DeleteTodoRequest) (*DeleteTodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTodo not implemented")
+}
+func (UnimplementedTodoServiceServer) DeleteTodos(context.Context, *DeleteTodosRequest) (*DeleteTodosResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTodos not implemented")
+}
 func (UnimplementedTodoServiceServer) GetTodos(context.Context, *GetTodosRequest) (*GetTodosResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetTodos not implemented")
 }
+func (UnimplementedTodoServiceServer) RestoreTodo(context.Context, *RestoreTodoRequest) (*RestoreTodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreTodo not implemented")
+}
+func (UnimplementedTodoServiceServer) SearchTodos(context.Context, *SearchTodosRequest) (*SearchTodosResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchTodos not implemented")
+}
 func (UnimplementedTodoServiceServer) mustEmbedUnimplementedTodoServiceServer() {}
 func (UnimplementedTodoServiceServer) testEmbeddedByValue()                     {}
 
@@ -128,6 +264,96 @@ func _TodoService_CreateTodo_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TodoService_GetTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).GetTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_GetTodo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).GetTodo(ctx, req.(*GetTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_UpdateTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).UpdateTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_UpdateTodo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).UpdateTodo(ctx, req.(*UpdateTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_ToggleDone_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ToggleDoneRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).ToggleDone(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_ToggleDone_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).ToggleDone(ctx, req.(*ToggleDoneRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_DeleteTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).DeleteTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_DeleteTodo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).DeleteTodo(ctx, req.(*DeleteTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_DeleteTodos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTodosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).DeleteTodos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_DeleteTodos_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).DeleteTodos(ctx, req.(*DeleteTodosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _TodoService_GetTodos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetTodosRequest)
 	if err := dec(in); err != nil {
@@ -146,6 +372,42 @@ func _TodoService_GetTodos_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TodoService_RestoreTodo_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreTodoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).RestoreTodo(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_RestoreTodo_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).RestoreTodo(ctx, req.(*RestoreTodoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TodoService_SearchTodos_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchTodosRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TodoServiceServer).SearchTodos(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TodoService_SearchTodos_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TodoServiceServer).SearchTodos(ctx, req.(*SearchTodosRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // TodoService_ServiceDesc is the grpc.ServiceDesc for TodoService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -157,10 +419,38 @@ var TodoService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "CreateTodo",
 			Handler:    _TodoService_CreateTodo_Handler,
 		},
+		{
+			MethodName: "GetTodo",
+			Handler:    _TodoService_GetTodo_Handler,
+		},
+		{
+			MethodName: "UpdateTodo",
+			Handler:    _TodoService_UpdateTodo_Handler,
+		},
+		{
+			MethodName: "ToggleDone",
+			Handler:    _TodoService_ToggleDone_Handler,
+		},
+		{
+			MethodName: "DeleteTodo",
+			Handler:    _TodoService_DeleteTodo_Handler,
+		},
+		{
+			MethodName: "DeleteTodos",
+			Handler:    _TodoService_DeleteTodos_Handler,
+		},
 		{
 			MethodName: "GetTodos",
 			Handler:    _TodoService_GetTodos_Handler,
 		},
+		{
+			MethodName: "RestoreTodo",
+			Handler:    _TodoService_RestoreTodo_Handler,
+		},
+		{
+			MethodName: "SearchTodos",
+			Handler:    _TodoService_SearchTodos_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "todo.proto",
@@ -28,7 +28,11 @@ type User struct {
 	Email    string                 `protobuf:"bytes,3,opt,name=email,proto3" json:"email,omitempty"`
 	Password string                 `protobuf:"bytes,4,opt,name=password,proto3" json:"password,omitempty"`
 	// User role (e.g., "admin", "user")
-	Role          string `protobuf:"bytes,5,opt,name=role,proto3" json:"role,omitempty"`
+	Role string `protobuf:"bytes,5,opt,name=role,proto3" json:"role,omitempty"`
+	// Set by the service on every write, starting at 1
+	Version int64 `protobuf:"varint,6,opt,name=version,proto3" json:"version,omitempty"`
+	// Time of the last write in unix milliseconds
+	UpdatedAt     int64 `protobuf:"varint,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -98,6 +102,20 @@ func (x *User) GetRole() string {
 	return ""
 }
 
+func (x *User) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *User) GetUpdatedAt() int64 {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return 0
+}
+
 type CreateUserRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	User          *User                  `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
@@ -143,8 +161,10 @@ func (x *CreateUserRequest) GetUser() *User {
 }
 
 type CreateUserResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Response      string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Response string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	// The created user with the id it was given, without its password
+	User          *User `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -186,6 +206,13 @@ func (x *CreateUserResponse) GetResponse() string {
 	return ""
 }
 
+func (x *CreateUserResponse) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
 type AuthenticateUserRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// Identifier can be either username or email
@@ -315,19 +342,449 @@ func (x *AuthenticateUserResponse) GetUser() *User {
 	return nil
 }
 
-type GetUsersRequest struct {
+type RefreshTokensRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	IdFilter      string                 `protobuf:"bytes,1,opt,name=id_filter,json=idFilter,proto3" json:"id_filter,omitempty"`
-	NameFilter    string                 `protobuf:"bytes,2,opt,name=name_filter,json=nameFilter,proto3" json:"name_filter,omitempty"`
-	EmailFilter   string                 `protobuf:"bytes,3,opt,name=email_filter,json=emailFilter,proto3" json:"email_filter,omitempty"`
-	RoleFilter    string                 `protobuf:"bytes,4,opt,name=role_filter,json=roleFilter,proto3" json:"role_filter,omitempty"`
+	RefreshToken  string                 `protobuf:"bytes,1,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RefreshTokensRequest) Reset() {
+	*x = RefreshTokensRequest{}
+	mi := &file_user_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefreshTokensRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefreshTokensRequest) ProtoMessage() {}
+
+func (x *RefreshTokensRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefreshTokensRequest.ProtoReflect.Descriptor instead.
+func (*RefreshTokensRequest) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *RefreshTokensRequest) GetRefreshToken() string {
+	if x != nil {
+		return x.RefreshToken
+	}
+	return ""
+}
+
+// The refresh token sent in the request cannot be used again; refresh_token
+// replaces it
+type RefreshTokensResponse struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	AccessToken      string                 `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	RefreshToken     string                 `protobuf:"bytes,2,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	ExpiresTimestamp int64                  `protobuf:"varint,3,opt,name=expires_timestamp,json=expiresTimestamp,proto3" json:"expires_timestamp,omitempty"`
+	TokenType        string                 `protobuf:"bytes,4,opt,name=token_type,json=tokenType,proto3" json:"token_type,omitempty"`
+	User             *User                  `protobuf:"bytes,5,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *RefreshTokensResponse) Reset() {
+	*x = RefreshTokensResponse{}
+	mi := &file_user_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefreshTokensResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefreshTokensResponse) ProtoMessage() {}
+
+func (x *RefreshTokensResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefreshTokensResponse.ProtoReflect.Descriptor instead.
+func (*RefreshTokensResponse) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RefreshTokensResponse) GetAccessToken() string {
+	if x != nil {
+		return x.AccessToken
+	}
+	return ""
+}
+
+func (x *RefreshTokensResponse) GetRefreshToken() string {
+	if x != nil {
+		return x.RefreshToken
+	}
+	return ""
+}
+
+func (x *RefreshTokensResponse) GetExpiresTimestamp() int64 {
+	if x != nil {
+		return x.ExpiresTimestamp
+	}
+	return 0
+}
+
+func (x *RefreshTokensResponse) GetTokenType() string {
+	if x != nil {
+		return x.TokenType
+	}
+	return ""
+}
+
+func (x *RefreshTokensResponse) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+type LogoutRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The access token of the session to log out of
+	AccessToken string `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	// Logs out of every session of the user instead
+	Everywhere    bool `protobuf:"varint,2,opt,name=everywhere,proto3" json:"everywhere,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogoutRequest) Reset() {
+	*x = LogoutRequest{}
+	mi := &file_user_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogoutRequest) ProtoMessage() {}
+
+func (x *LogoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogoutRequest.ProtoReflect.Descriptor instead.
+func (*LogoutRequest) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *LogoutRequest) GetAccessToken() string {
+	if x != nil {
+		return x.AccessToken
+	}
+	return ""
+}
+
+func (x *LogoutRequest) GetEverywhere() bool {
+	if x != nil {
+		return x.Everywhere
+	}
+	return false
+}
+
+type LogoutResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Number of sessions revoked
+	Sessions      int32 `protobuf:"varint,1,opt,name=sessions,proto3" json:"sessions,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LogoutResponse) Reset() {
+	*x = LogoutResponse{}
+	mi := &file_user_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LogoutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LogoutResponse) ProtoMessage() {}
+
+func (x *LogoutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LogoutResponse.ProtoReflect.Descriptor instead.
+func (*LogoutResponse) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *LogoutResponse) GetSessions() int32 {
+	if x != nil {
+		return x.Sessions
+	}
+	return 0
+}
+
+type IsTokenRevokedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The jti and sid claims of an access token
+	TokenId       string `protobuf:"bytes,1,opt,name=token_id,json=tokenId,proto3" json:"token_id,omitempty"`
+	SessionId     string `protobuf:"bytes,2,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IsTokenRevokedRequest) Reset() {
+	*x = IsTokenRevokedRequest{}
+	mi := &file_user_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IsTokenRevokedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IsTokenRevokedRequest) ProtoMessage() {}
+
+func (x *IsTokenRevokedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IsTokenRevokedRequest.ProtoReflect.Descriptor instead.
+func (*IsTokenRevokedRequest) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *IsTokenRevokedRequest) GetTokenId() string {
+	if x != nil {
+		return x.TokenId
+	}
+	return ""
+}
+
+func (x *IsTokenRevokedRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+type IsTokenRevokedResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Revoked       bool                   `protobuf:"varint,1,opt,name=revoked,proto3" json:"revoked,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IsTokenRevokedResponse) Reset() {
+	*x = IsTokenRevokedResponse{}
+	mi := &file_user_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IsTokenRevokedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IsTokenRevokedResponse) ProtoMessage() {}
+
+func (x *IsTokenRevokedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IsTokenRevokedResponse.ProtoReflect.Descriptor instead.
+func (*IsTokenRevokedResponse) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *IsTokenRevokedResponse) GetRevoked() bool {
+	if x != nil {
+		return x.Revoked
+	}
+	return false
+}
+
+type SetUserRoleRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// The access token of the admin making the change
+	AccessToken   string `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	UserId        string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Role          string `protobuf:"bytes,3,opt,name=role,proto3" json:"role,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetUserRoleRequest) Reset() {
+	*x = SetUserRoleRequest{}
+	mi := &file_user_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetUserRoleRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetUserRoleRequest) ProtoMessage() {}
+
+func (x *SetUserRoleRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetUserRoleRequest.ProtoReflect.Descriptor instead.
+func (*SetUserRoleRequest) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *SetUserRoleRequest) GetAccessToken() string {
+	if x != nil {
+		return x.AccessToken
+	}
+	return ""
+}
+
+func (x *SetUserRoleRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *SetUserRoleRequest) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+type SetUserRoleResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	User          *User                  `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetUserRoleResponse) Reset() {
+	*x = SetUserRoleResponse{}
+	mi := &file_user_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetUserRoleResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetUserRoleResponse) ProtoMessage() {}
+
+func (x *SetUserRoleResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetUserRoleResponse.ProtoReflect.Descriptor instead.
+func (*SetUserRoleResponse) Descriptor() ([]byte, []int) {
+	return file_user_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SetUserRoleResponse) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+type GetUsersRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	IdFilter    string                 `protobuf:"bytes,1,opt,name=id_filter,json=idFilter,proto3" json:"id_filter,omitempty"`
+	NameFilter  string                 `protobuf:"bytes,2,opt,name=name_filter,json=nameFilter,proto3" json:"name_filter,omitempty"`
+	EmailFilter string                 `protobuf:"bytes,3,opt,name=email_filter,json=emailFilter,proto3" json:"email_filter,omitempty"`
+	RoleFilter  string                 `protobuf:"bytes,4,opt,name=role_filter,json=roleFilter,proto3" json:"role_filter,omitempty"`
+	// Maximum number of users to return, 0 returns all of them
+	PageSize int32 `protobuf:"varint,5,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page, empty for the first page
+	PageToken string `protobuf:"bytes,6,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// Field to sort by (e.g. "username", "email"), users are sorted by ID otherwise
+	OrderBy       string `protobuf:"bytes,7,opt,name=order_by,json=orderBy,proto3" json:"order_by,omitempty"`
+	Descending    bool   `protobuf:"varint,8,opt,name=descending,proto3" json:"descending,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetUsersRequest) Reset() {
 	*x = GetUsersRequest{}
-	mi := &file_user_proto_msgTypes[5]
+	mi := &file_user_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -339,7 +796,7 @@ func (x *GetUsersRequest) String() string {
 func (*GetUsersRequest) ProtoMessage() {}
 
 func (x *GetUsersRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_user_proto_msgTypes[5]
+	mi := &file_user_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -352,7 +809,7 @@ func (x *GetUsersRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetUsersRequest.ProtoReflect.Descriptor instead.
 func (*GetUsersRequest) Descriptor() ([]byte, []int) {
-	return file_user_proto_rawDescGZIP(), []int{5}
+	return file_user_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *GetUsersRequest) GetIdFilter() string {
@@ -383,17 +840,47 @@ func (x *GetUsersRequest) GetRoleFilter() string {
 	return ""
 }
 
+func (x *GetUsersRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *GetUsersRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+func (x *GetUsersRequest) GetOrderBy() string {
+	if x != nil {
+		return x.OrderBy
+	}
+	return ""
+}
+
+func (x *GetUsersRequest) GetDescending() bool {
+	if x != nil {
+		return x.Descending
+	}
+	return false
+}
+
 type GetUsersResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Response      string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
-	Users         []*User                `protobuf:"bytes,2,rep,name=users,proto3" json:"users,omitempty"`
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Response string                 `protobuf:"bytes,1,opt,name=response,proto3" json:"response,omitempty"`
+	Users    []*User                `protobuf:"bytes,2,rep,name=users,proto3" json:"users,omitempty"`
+	// Set when there are more users, pass it as page_token to get them
+	NextPageToken string `protobuf:"bytes,3,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetUsersResponse) Reset() {
 	*x = GetUsersResponse{}
-	mi := &file_user_proto_msgTypes[6]
+	mi := &file_user_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -405,7 +892,7 @@ func (x *GetUsersResponse) String() string {
 func (*GetUsersResponse) ProtoMessage() {}
 
 func (x *GetUsersResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_user_proto_msgTypes[6]
+	mi := &file_user_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -418,7 +905,7 @@ func (x *GetUsersResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetUsersResponse.ProtoReflect.Descriptor instead.
 func (*GetUsersResponse) Descriptor() ([]byte, []int) {
-	return file_user_proto_rawDescGZIP(), []int{6}
+	return file_user_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *GetUsersResponse) GetResponse() string {
@@ -435,22 +922,33 @@ func (x *GetUsersResponse) GetUsers() []*User {
 	return nil
 }
 
+func (x *GetUsersResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
 var File_user_proto protoreflect.FileDescriptor
 
 const file_user_proto_rawDesc = "" +
 	"\n" +
 	"\n" +
-	"user.proto\x12\x06userpb\"x\n" +
+	"user.proto\x12\x06userpb\"\xb1\x01\n" +
 	"\x04User\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
 	"\busername\x18\x02 \x01(\tR\busername\x12\x14\n" +
 	"\x05email\x18\x03 \x01(\tR\x05email\x12\x1a\n" +
 	"\bpassword\x18\x04 \x01(\tR\bpassword\x12\x12\n" +
-	"\x04role\x18\x05 \x01(\tR\x04role\"5\n" +
+	"\x04role\x18\x05 \x01(\tR\x04role\x12\x18\n" +
+	"\aversion\x18\x06 \x01(\x03R\aversion\x12\x1d\n" +
+	"\n" +
+	"updated_at\x18\a \x01(\x03R\tupdatedAt\"5\n" +
 	"\x11CreateUserRequest\x12 \n" +
-	"\x04user\x18\x01 \x01(\v2\f.userpb.UserR\x04user\"0\n" +
+	"\x04user\x18\x01 \x01(\v2\f.userpb.UserR\x04user\"R\n" +
 	"\x12CreateUserResponse\x12\x1a\n" +
-	"\bresponse\x18\x01 \x01(\tR\bresponse\"U\n" +
+	"\bresponse\x18\x01 \x01(\tR\bresponse\x12 \n" +
+	"\x04user\x18\x02 \x01(\v2\f.userpb.UserR\x04user\"U\n" +
 	"\x17AuthenticateUserRequest\x12\x1e\n" +
 	"\n" +
 	"identifier\x18\x01 \x01(\tR\n" +
@@ -462,21 +960,61 @@ const file_user_proto_rawDesc = "" +
 	"\x11expires_timestamp\x18\x03 \x01(\x03R\x10expiresTimestamp\x12\x1d\n" +
 	"\n" +
 	"token_type\x18\x04 \x01(\tR\ttokenType\x12 \n" +
-	"\x04user\x18\x05 \x01(\v2\f.userpb.UserR\x04user\"\x93\x01\n" +
+	"\x04user\x18\x05 \x01(\v2\f.userpb.UserR\x04user\";\n" +
+	"\x14RefreshTokensRequest\x12#\n" +
+	"\rrefresh_token\x18\x01 \x01(\tR\frefreshToken\"\xcd\x01\n" +
+	"\x15RefreshTokensResponse\x12!\n" +
+	"\faccess_token\x18\x01 \x01(\tR\vaccessToken\x12#\n" +
+	"\rrefresh_token\x18\x02 \x01(\tR\frefreshToken\x12+\n" +
+	"\x11expires_timestamp\x18\x03 \x01(\x03R\x10expiresTimestamp\x12\x1d\n" +
+	"\n" +
+	"token_type\x18\x04 \x01(\tR\ttokenType\x12 \n" +
+	"\x04user\x18\x05 \x01(\v2\f.userpb.UserR\x04user\"R\n" +
+	"\rLogoutRequest\x12!\n" +
+	"\faccess_token\x18\x01 \x01(\tR\vaccessToken\x12\x1e\n" +
+	"\n" +
+	"everywhere\x18\x02 \x01(\bR\n" +
+	"everywhere\",\n" +
+	"\x0eLogoutResponse\x12\x1a\n" +
+	"\bsessions\x18\x01 \x01(\x05R\bsessions\"Q\n" +
+	"\x15IsTokenRevokedRequest\x12\x19\n" +
+	"\btoken_id\x18\x01 \x01(\tR\atokenId\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x02 \x01(\tR\tsessionId\"2\n" +
+	"\x16IsTokenRevokedResponse\x12\x18\n" +
+	"\arevoked\x18\x01 \x01(\bR\arevoked\"d\n" +
+	"\x12SetUserRoleRequest\x12!\n" +
+	"\faccess_token\x18\x01 \x01(\tR\vaccessToken\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x12\n" +
+	"\x04role\x18\x03 \x01(\tR\x04role\"7\n" +
+	"\x13SetUserRoleResponse\x12 \n" +
+	"\x04user\x18\x01 \x01(\v2\f.userpb.UserR\x04user\"\x8a\x02\n" +
 	"\x0fGetUsersRequest\x12\x1b\n" +
 	"\tid_filter\x18\x01 \x01(\tR\bidFilter\x12\x1f\n" +
 	"\vname_filter\x18\x02 \x01(\tR\n" +
 	"nameFilter\x12!\n" +
 	"\femail_filter\x18\x03 \x01(\tR\vemailFilter\x12\x1f\n" +
 	"\vrole_filter\x18\x04 \x01(\tR\n" +
-	"roleFilter\"R\n" +
+	"roleFilter\x12\x1b\n" +
+	"\tpage_size\x18\x05 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x06 \x01(\tR\tpageToken\x12\x19\n" +
+	"\border_by\x18\a \x01(\tR\aorderBy\x12\x1e\n" +
+	"\n" +
+	"descending\x18\b \x01(\bR\n" +
+	"descending\"z\n" +
 	"\x10GetUsersResponse\x12\x1a\n" +
 	"\bresponse\x18\x01 \x01(\tR\bresponse\x12\"\n" +
-	"\x05users\x18\x02 \x03(\v2\f.userpb.UserR\x05users2\xe8\x01\n" +
+	"\x05users\x18\x02 \x03(\v2\f.userpb.UserR\x05users\x12&\n" +
+	"\x0fnext_page_token\x18\x03 \x01(\tR\rnextPageToken2\x88\x04\n" +
 	"\vUserService\x12C\n" +
 	"\n" +
 	"CreateUser\x12\x19.userpb.CreateUserRequest\x1a\x1a.userpb.CreateUserResponse\x12U\n" +
-	"\x10AuthenticateUser\x12\x1f.userpb.AuthenticateUserRequest\x1a .userpb.AuthenticateUserResponse\x12=\n" +
+	"\x10AuthenticateUser\x12\x1f.userpb.AuthenticateUserRequest\x1a .userpb.AuthenticateUserResponse\x12L\n" +
+	"\rRefreshTokens\x12\x1c.userpb.RefreshTokensRequest\x1a\x1d.userpb.RefreshTokensResponse\x127\n" +
+	"\x06Logout\x12\x15.userpb.LogoutRequest\x1a\x16.userpb.LogoutResponse\x12O\n" +
+	"\x0eIsTokenRevoked\x12\x1d.userpb.IsTokenRevokedRequest\x1a\x1e.userpb.IsTokenRevokedResponse\x12F\n" +
+	"\vSetUserRole\x12\x1a.userpb.SetUserRoleRequest\x1a\x1b.userpb.SetUserRoleResponse\x12=\n" +
 	"\bGetUsers\x12\x17.userpb.GetUsersRequest\x1a\x18.userpb.GetUsersResponseB\tZ\a/userpbb\x06proto3"
 
 var (
@@ -491,31 +1029,50 @@ func file_user_proto_rawDescGZIP() []byte {
 	return file_user_proto_rawDescData
 }
 
-var file_user_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_user_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
 var file_user_proto_goTypes = []any{
 	(*User)(nil),                     // 0: userpb.User
 	(*CreateUserRequest)(nil),        // 1: userpb.CreateUserRequest
 	(*CreateUserResponse)(nil),       // 2: userpb.CreateUserResponse
 	(*AuthenticateUserRequest)(nil),  // 3: userpb.AuthenticateUserRequest
 	(*AuthenticateUserResponse)(nil), // 4: userpb.AuthenticateUserResponse
-	(*GetUsersRequest)(nil),          // 5: userpb.GetUsersRequest
-	(*GetUsersResponse)(nil),         // 6: userpb.GetUsersResponse
+	(*RefreshTokensRequest)(nil),     // 5: userpb.RefreshTokensRequest
+	(*RefreshTokensResponse)(nil),    // 6: userpb.RefreshTokensResponse
+	(*LogoutRequest)(nil),            // 7: userpb.LogoutRequest
+	(*LogoutResponse)(nil),           // 8: userpb.LogoutResponse
+	(*IsTokenRevokedRequest)(nil),    // 9: userpb.IsTokenRevokedRequest
+	(*IsTokenRevokedResponse)(nil),   // 10: userpb.IsTokenRevokedResponse
+	(*SetUserRoleRequest)(nil),       // 11: userpb.SetUserRoleRequest
+	(*SetUserRoleResponse)(nil),      // 12: userpb.SetUserRoleResponse
+	(*GetUsersRequest)(nil),          // 13: userpb.GetUsersRequest
+	(*GetUsersResponse)(nil),         // 14: userpb.GetUsersResponse
 }
 var file_user_proto_depIdxs = []int32{
-	0, // 0: userpb.CreateUserRequest.user:type_name -> userpb.User
-	0, // 1: userpb.AuthenticateUserResponse.user:type_name -> userpb.User
-	0, // 2: userpb.GetUsersResponse.users:type_name -> userpb.User
-	1, // 3: userpb.UserService.CreateUser:input_type -> userpb.CreateUserRequest
-	3, // 4: userpb.UserService.AuthenticateUser:input_type -> userpb.AuthenticateUserRequest
-	5, // 5: userpb.UserService.GetUsers:input_type -> userpb.GetUsersRequest
-	2, // 6: userpb.UserService.CreateUser:output_type -> userpb.CreateUserResponse
-	4, // 7: userpb.UserService.AuthenticateUser:output_type -> userpb.AuthenticateUserResponse
-	6, // 8: userpb.UserService.GetUsers:output_type -> userpb.GetUsersResponse
-	6, // [6:9] is the sub-list for method output_type
-	3, // [3:6] is the sub-list for method input_type
-	3, // [3:3] is the sub-list for extension type_name
-	3, // [3:3] is the sub-list for extension extendee
-	0, // [0:3] is the sub-list for field type_name
+	0,  // 0: userpb.CreateUserRequest.user:type_name -> userpb.User
+	0,  // 1: userpb.CreateUserResponse.user:type_name -> userpb.User
+	0,  // 2: userpb.AuthenticateUserResponse.user:type_name -> userpb.User
+	0,  // 3: userpb.RefreshTokensResponse.user:type_name -> userpb.User
+	0,  // 4: userpb.SetUserRoleResponse.user:type_name -> userpb.User
+	0,  // 5: userpb.GetUsersResponse.users:type_name -> userpb.User
+	1,  // 6: userpb.UserService.CreateUser:input_type -> userpb.CreateUserRequest
+	3,  // 7: userpb.UserService.AuthenticateUser:input_type -> userpb.AuthenticateUserRequest
+	5,  // 8: userpb.UserService.RefreshTokens:input_type -> userpb.RefreshTokensRequest
+	7,  // 9: userpb.UserService.Logout:input_type -> userpb.LogoutRequest
+	9,  // 10: userpb.UserService.IsTokenRevoked:input_type -> userpb.IsTokenRevokedRequest
+	11, // 11: userpb.UserService.SetUserRole:input_type -> userpb.SetUserRoleRequest
+	13, // 12: userpb.UserService.GetUsers:input_type -> userpb.GetUsersRequest
+	2,  // 13: userpb.UserService.CreateUser:output_type -> userpb.CreateUserResponse
+	4,  // 14: userpb.UserService.AuthenticateUser:output_type -> userpb.AuthenticateUserResponse
+	6,  // 15: userpb.UserService.RefreshTokens:output_type -> userpb.RefreshTokensResponse
+	8,  // 16: userpb.UserService.Logout:output_type -> userpb.LogoutResponse
+	10, // 17: userpb.UserService.IsTokenRevoked:output_type -> userpb.IsTokenRevokedResponse
+	12, // 18: userpb.UserService.SetUserRole:output_type -> userpb.SetUserRoleResponse
+	14, // 19: userpb.UserService.GetUsers:output_type -> userpb.GetUsersResponse
+	13, // [13:20] is the sub-list for method output_type
+	6,  // [6:13] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_user_proto_init() }
@@ -529,7 +1086,7 @@ func file_user_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_user_proto_rawDesc), len(file_user_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   7,
+			NumMessages:   15,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -4,10 +4,24 @@ import "github.com/Hanasou/news_feed/go/common/models"
 
 type CreateTodoResponse struct {
 	Response string
-	TodoID   string
+	// Todo is the todo as stored, with the id the service gave it
+	Todo *models.Todo
 }
 
 type GetTodosResponse struct {
-	Response string
-	Todos    []models.Todo
+	Todos []models.Todo
+	// NextPageToken is set when there are more todos
+	NextPageToken string
+}
+
+type SearchTodosResponse struct {
+	Results []TodoSearchResult
+}
+
+// TodoSearchResult is a todo matching a search. Highlight is the todo text,
+// HTML escaped, with the matching words wrapped in <mark></mark>.
+type TodoSearchResult struct {
+	Todo      models.Todo
+	Score     float64
+	Highlight string
 }
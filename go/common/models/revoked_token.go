@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// RevokedToken is an access token revoked before it expired, by its ID
+type RevokedToken struct {
+	common.Model
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	// ExpiresAt (unix milliseconds) is when the token expires, after which
+	// it no longer needs to be remembered
+	ExpiresAt int64 `json:"expires_at"`
+	// Version and UpdatedAt (unix milliseconds) are set by the db driver
+	Version   int64 `json:"version"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (token *RevokedToken) GetVersion() int64 {
+	return token.Version
+}
+
+func (token *RevokedToken) SetVersion(version int64) {
+	token.Version = version
+}
+
+func (token *RevokedToken) SetUpdatedAt(updatedAt time.Time) {
+	token.UpdatedAt = updatedAt.UnixMilli()
+}
+
+// GetExpiresAt makes the revocation expire with the token
+func (token *RevokedToken) GetExpiresAt() time.Time {
+	if token.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(token.ExpiresAt)
+}
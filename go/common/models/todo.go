@@ -1,41 +1,80 @@
 package models
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
+	"google.golang.org/protobuf/proto"
 )
 
 type Todo struct {
+	common.Model
 	Id     string `json:"id,omitempty"`
 	Text   string `json:"text,omitempty"`
 	Done   bool   `json:"done,omitempty"`
 	UserId string `json:"user_id,omitempty"`
+	// Version and UpdatedAt (unix milliseconds) are set by the db driver
+	Version   int64 `json:"version,omitempty"`
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+	// DeletedAt (unix milliseconds) is set while the todo is in the trash
+	DeletedAt int64 `json:"deleted_at,omitempty"`
 }
 
-func (todo *Todo) ToJson() (string, error) {
-	return common.ToJson(todo)
+func (todo *Todo) GetVersion() int64 {
+	return todo.Version
 }
 
-func (todo *Todo) GetID() (string, error) {
-	return todo.Id, nil
+func (todo *Todo) SetVersion(version int64) {
+	todo.Version = version
 }
 
-func (todo *Todo) ToMap() (map[string]any, error) {
-	return common.ToMap(todo)
+func (todo *Todo) SetUpdatedAt(updatedAt time.Time) {
+	todo.UpdatedAt = updatedAt.UnixMilli()
 }
 
-func (todo *Todo) GetField(field string) (any, error) {
-	switch field {
-	case "id":
-		return todo.Id, nil
-	case "text":
-		return todo.Text, nil
-	case "done":
-		return todo.Done, nil
-	case "user_id":
-		return todo.UserId, nil
-	default:
-		return nil, fmt.Errorf("field %s not found", field)
+func (todo *Todo) GetDeletedAt() time.Time {
+	if todo.DeletedAt == 0 {
+		return time.Time{}
 	}
+	return time.UnixMilli(todo.DeletedAt)
+}
+
+func (todo *Todo) SetDeletedAt(deletedAt time.Time) {
+	if deletedAt.IsZero() {
+		todo.DeletedAt = 0
+		return
+	}
+	todo.DeletedAt = deletedAt.UnixMilli()
+}
+
+// MarshalProto encodes the todo as a todopb.Todo, which is how the mem db
+// stores it with the proto codec
+func (todo *Todo) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&todopb.Todo{
+		Id:        todo.Id,
+		Text:      todo.Text,
+		Done:      todo.Done,
+		UserId:    todo.UserId,
+		Version:   todo.Version,
+		UpdatedAt: todo.UpdatedAt,
+		DeletedAt: todo.DeletedAt,
+	})
+}
+
+func (todo *Todo) UnmarshalProto(data []byte) error {
+	message := &todopb.Todo{}
+	if err := proto.Unmarshal(data, message); err != nil {
+		return err
+	}
+	*todo = Todo{
+		Id:        message.GetId(),
+		Text:      message.GetText(),
+		Done:      message.GetDone(),
+		UserId:    message.GetUserId(),
+		Version:   message.GetVersion(),
+		UpdatedAt: message.GetUpdatedAt(),
+		DeletedAt: message.GetDeletedAt(),
+	}
+	return nil
 }
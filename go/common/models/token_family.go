@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common"
+)
+
+// TokenFamily is the chain of refresh tokens issued since a user logged in.
+// Only the latest token of the family can be exchanged for new tokens; using
+// an older one again means it was stolen, and the family is revoked.
+type TokenFamily struct {
+	common.Model
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	// TokenID is the ID of the latest refresh token of the family
+	TokenID string `json:"token_id"`
+	Revoked bool   `json:"revoked"`
+	// ExpiresAt (unix milliseconds) is when the latest refresh token expires
+	ExpiresAt int64 `json:"expires_at"`
+	// Version and UpdatedAt (unix milliseconds) are set by the db driver
+	Version   int64 `json:"version"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (family *TokenFamily) GetVersion() int64 {
+	return family.Version
+}
+
+func (family *TokenFamily) SetVersion(version int64) {
+	family.Version = version
+}
+
+func (family *TokenFamily) SetUpdatedAt(updatedAt time.Time) {
+	family.UpdatedAt = updatedAt.UnixMilli()
+}
+
+// GetExpiresAt makes the family expire with its latest refresh token
+func (family *TokenFamily) GetExpiresAt() time.Time {
+	if family.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(family.ExpiresAt)
+}
@@ -1,44 +1,64 @@
 package models
 
 import (
-	"fmt"
+	"time"
 
 	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/grpc/userpb"
+	"google.golang.org/protobuf/proto"
 )
 
 type User struct {
+	common.Model
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Password string `json:"password"` // hashed
 	Role     Role   `json:"role"`     // User role (e.g., "admin
+	// Version and UpdatedAt (unix milliseconds) are set by the db driver
+	Version   int64 `json:"version"`
+	UpdatedAt int64 `json:"updated_at"`
 }
 
-func (user *User) ToJson() (string, error) {
-	return common.ToJson(user)
+func (user *User) GetVersion() int64 {
+	return user.Version
 }
 
-func (user *User) ToMap() (map[string]any, error) {
-	return common.ToMap(user)
+func (user *User) SetVersion(version int64) {
+	user.Version = version
 }
 
-func (user *User) GetID() (string, error) {
-	return user.ID, nil
+func (user *User) SetUpdatedAt(updatedAt time.Time) {
+	user.UpdatedAt = updatedAt.UnixMilli()
 }
 
-func (user *User) GetField(field string) (any, error) {
-	switch field {
-	case "id":
-		return user.ID, nil
-	case "username":
-		return user.Username, nil
-	case "email":
-		return user.Email, nil
-	case "password":
-		return user.Password, nil
-	case "role":
-		return user.Role, nil
-	default:
-		return nil, fmt.Errorf("field %s not found", field)
+// MarshalProto encodes the user as a userpb.User, which is how the mem db
+// stores it with the proto codec
+func (user *User) MarshalProto() ([]byte, error) {
+	return proto.Marshal(&userpb.User{
+		Id:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Password:  user.Password,
+		Role:      user.Role.String(),
+		Version:   user.Version,
+		UpdatedAt: user.UpdatedAt,
+	})
+}
+
+func (user *User) UnmarshalProto(data []byte) error {
+	message := &userpb.User{}
+	if err := proto.Unmarshal(data, message); err != nil {
+		return err
+	}
+	*user = User{
+		ID:        message.GetId(),
+		Username:  message.GetUsername(),
+		Email:     message.GetEmail(),
+		Password:  message.GetPassword(),
+		Role:      Role(message.GetRole()),
+		Version:   message.GetVersion(),
+		UpdatedAt: message.GetUpdatedAt(),
 	}
+	return nil
 }
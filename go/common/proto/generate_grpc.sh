@@ -7,4 +7,7 @@ export PATH=$(go env GOPATH)/bin:$PATH
 protoc --go_out=../grpc --go-grpc_out=../grpc --proto_path=. user.proto
 
 # Then generate todo.proto with gRPC service
-protoc --go_out=../grpc --go-grpc_out=../grpc --proto_path=. todo.proto
\ No newline at end of file
+protoc --go_out=../grpc --go-grpc_out=../grpc --proto_path=. todo.proto
+
+# Then generate replication.proto, shared by the services that replicate their tables
+protoc --go_out=../grpc --go-grpc_out=../grpc --proto_path=. replication.proto
\ No newline at end of file
@@ -0,0 +1,246 @@
+// Package replication keeps copies of a service's tables on other instances
+// of the service.
+//
+// One node, the leader, takes the writes. Followers stream the changes of
+// each of the leader's tables over gRPC and apply them in order, and serve
+// reads from their copy. A follower that is new, or has fallen further behind
+// than the leader keeps changes for, gets a snapshot of the table first.
+//
+// There is no automatic failover. If the leader fails, an operator promotes a
+// follower, which then takes writes, and points the other followers at it.
+// A failed leader that comes back has to rejoin as a follower. If it took
+// writes that did not reach the new leader, it should start from an empty
+// directory, since its copy may have diverged.
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/grpc/replicationpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Role is what a node does in replication
+type Role string
+
+const (
+	Leader   Role = "leader"
+	Follower Role = "follower"
+)
+
+// DefaultRetryInterval is how long a follower waits before reconnecting to
+// its leader
+const DefaultRetryInterval = time.Second
+
+// ErrNotLeader is returned for writes to a node that is not the leader
+var ErrNotLeader = errors.New("this node is a read-only follower")
+
+// Node is a service instance taking part in replication. It starts out as the
+// leader; Follow makes it a follower.
+type Node struct {
+	// RetryInterval is how long a follower waits before reconnecting to its
+	// leader, DefaultRetryInterval if it is not set
+	RetryInterval time.Duration
+
+	mu            sync.Mutex
+	tables        []Table
+	role          Role
+	leaderAddress string
+	stop          context.CancelFunc
+	stopped       sync.WaitGroup
+	onPromote     []func() error
+}
+
+func NewNode(tables ...Table) *Node {
+	return &Node{tables: tables, role: Leader}
+}
+
+// OnPromote registers fn to be called when the node is promoted to leader,
+// e.g. to start work only the leader does
+func (n *Node) OnPromote(fn func() error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.onPromote = append(n.onPromote, fn)
+}
+
+// IsLeader reports whether the node takes writes
+func (n *Node) IsLeader() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.role == Leader
+}
+
+// CheckLeader returns ErrNotLeader unless the node takes writes
+func (n *Node) CheckLeader() error {
+	if !n.IsLeader() {
+		return ErrNotLeader
+	}
+	return nil
+}
+
+// Follow makes the node a follower of the leader at leaderAddress. A node
+// already following another leader switches to the new one.
+func (n *Node) Follow(leaderAddress string) error {
+	conn, err := grpc.NewClient(leaderAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Printf("Could not connect to leader %s: %v", leaderAddress, err)
+		return err
+	}
+	client := replicationpb.NewReplicationServiceClient(conn)
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stopFollowing()
+	ctx, cancel := context.WithCancel(context.Background())
+	n.role = Follower
+	n.leaderAddress = leaderAddress
+	n.stop = cancel
+	for _, table := range n.tables {
+		n.stopped.Add(1)
+		go func() {
+			defer n.stopped.Done()
+			n.follow(ctx, client, table)
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	log.Printf("Following leader %s", leaderAddress)
+	return nil
+}
+
+// Promote makes a follower the leader. It stops following and calls the
+// OnPromote functions; the node is the leader even if one of them fails.
+func (n *Node) Promote() error {
+	n.mu.Lock()
+	if n.role == Leader {
+		n.mu.Unlock()
+		return nil
+	}
+	n.stopFollowing()
+	n.role = Leader
+	n.leaderAddress = ""
+	hooks := n.onPromote
+	n.mu.Unlock()
+
+	log.Println("Promoted to leader")
+	errs := make([]error, 0)
+	for _, hook := range hooks {
+		errs = append(errs, hook())
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops following
+func (n *Node) Close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stopFollowing()
+}
+
+// stopFollowing stops the follow loops and waits for them to end. The caller
+// must hold the lock.
+func (n *Node) stopFollowing() {
+	if n.stop == nil {
+		return
+	}
+	n.stop()
+	n.stop = nil
+	n.stopped.Wait()
+}
+
+// Status reports the role of the node and how far its tables are
+func (n *Node) Status() (*replicationpb.StatusResponse, error) {
+	n.mu.Lock()
+	status := &replicationpb.StatusResponse{Role: string(n.role), LeaderAddress: n.leaderAddress}
+	n.mu.Unlock()
+	for _, table := range n.tables {
+		seq, err := table.LatestSeq()
+		if err != nil {
+			return nil, err
+		}
+		status.Tables = append(status.Tables, &replicationpb.TableStatus{Table: table.Name(), Seq: seq})
+	}
+	return status, nil
+}
+
+// table returns the table with the given name, nil if there is none
+func (n *Node) table(name string) Table {
+	for _, table := range n.tables {
+		if table.Name() == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// follow applies the changes of table on the leader until ctx is done,
+// reconnecting whenever the stream breaks
+func (n *Node) follow(ctx context.Context, client replicationpb.ReplicationServiceClient, table Table) {
+	retryInterval := n.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = DefaultRetryInterval
+	}
+	for {
+		err := replicate(ctx, client, table)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Replication of table %s interrupted, retrying in %v: %v", table.Name(), retryInterval, err)
+		select {
+		case <-time.After(retryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// replicate streams the changes of table from the leader once
+func replicate(ctx context.Context, client replicationpb.ReplicationServiceClient, table Table) error {
+	after, err := table.LatestSeq()
+	if err != nil {
+		return err
+	}
+	stream, err := client.Replicate(ctx, &replicationpb.ReplicateRequest{Table: table.Name(), AfterSeq: after})
+	if err != nil {
+		return err
+	}
+	var snapshot [][]byte
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return errors.New("leader ended the stream")
+		}
+		if err != nil {
+			return err
+		}
+		switch event := event.Event.(type) {
+		case *replicationpb.ReplicationEvent_Change:
+			if err := table.apply(event.Change); err != nil {
+				log.Printf("Could not apply change %d to table %s: %v", event.Change.Seq, table.Name(), err)
+				return err
+			}
+		case *replicationpb.ReplicationEvent_Snapshot:
+			snapshot = append(snapshot, event.Snapshot.Items...)
+			if !event.Snapshot.Last {
+				continue
+			}
+			if err := table.reset(event.Snapshot.Seq, snapshot); err != nil {
+				log.Printf("Could not reset table %s to snapshot: %v", table.Name(), err)
+				return err
+			}
+			log.Printf("Reset table %s to a snapshot of %d items at change %d", table.Name(), len(snapshot), event.Snapshot.Seq)
+			snapshot = nil
+		default:
+			return fmt.Errorf("unknown replication event %T", event)
+		}
+	}
+}
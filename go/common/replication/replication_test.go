@@ -0,0 +1,138 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/grpc/replicationpb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type testNode struct {
+	*Node
+	todos   *memdb.MemDb[*models.Todo]
+	address string
+	server  *grpc.Server
+}
+
+// startNode serves a node with a todos table on a local port
+func startNode(t *testing.T, opts ...memdb.Option) *testNode {
+	t.Helper()
+	todos, err := memdb.Initialize[*models.Todo]("todos", t.TempDir(), true, opts...)
+	require.NoError(t, err)
+	node := NewNode(MemDbTable(todos))
+	node.RetryInterval = 50 * time.Millisecond
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	replicationpb.RegisterReplicationServiceServer(server, NewServer(node))
+	go server.Serve(lis)
+	t.Cleanup(func() {
+		server.Stop()
+		node.Close()
+		todos.Close()
+	})
+	return &testNode{Node: node, todos: todos, address: lis.Addr().String(), server: server}
+}
+
+// waitForTodo waits until node has the todo with the given id and text
+func waitForTodo(t *testing.T, node *testNode, id string, text string) {
+	t.Helper()
+	assert.Eventually(t, func() bool {
+		todo, err := node.todos.GetByID(id)
+		return err == nil && todo.Text == text
+	}, 5*time.Second, 10*time.Millisecond, "%s never became %q", id, text)
+}
+
+func TestReplication_FollowerAppliesLeaderChanges(t *testing.T) {
+	leader := startNode(t)
+	require.NoError(t, leader.todos.Upsert(&models.Todo{Id: "todo1", Text: "before following"}))
+	follower := startNode(t)
+	require.NoError(t, follower.Follow(leader.address))
+	assert.False(t, follower.IsLeader())
+	assert.ErrorIs(t, follower.CheckLeader(), ErrNotLeader)
+
+	waitForTodo(t, follower, "todo1", "before following")
+	require.NoError(t, leader.todos.Upsert(&models.Todo{Id: "todo1", Text: "edited"}))
+	require.NoError(t, leader.todos.Upsert(&models.Todo{Id: "todo2", Text: "second"}))
+	require.NoError(t, leader.todos.Delete("todo2"))
+	waitForTodo(t, follower, "todo1", "edited")
+	assert.Eventually(t, func() bool {
+		seq, _ := follower.todos.LatestSeq()
+		return seq == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	_, err := follower.todos.GetByID("todo2")
+	assert.Error(t, err)
+	todo, err := follower.todos.GetByID("todo1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), todo.Version)
+
+	status, err := follower.Status()
+	require.NoError(t, err)
+	assert.Equal(t, string(Follower), status.Role)
+	assert.Equal(t, leader.address, status.LeaderAddress)
+	assert.Equal(t, uint64(4), status.Tables[0].Seq)
+}
+
+func TestReplication_LaggingFollowerGetsSnapshot(t *testing.T) {
+	leader := startNode(t, memdb.WithChangeHistory(2))
+	for i := range 1200 {
+		require.NoError(t, leader.todos.Upsert(&models.Todo{Id: fmt.Sprintf("todo%04d", i), Text: "item"}))
+	}
+	follower := startNode(t)
+	require.NoError(t, follower.todos.Upsert(&models.Todo{Id: "stale", Text: "not on the leader"}))
+
+	require.NoError(t, follower.Follow(leader.address))
+	waitForTodo(t, follower, "todo1199", "item")
+	all, err := follower.todos.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 1200)
+
+	// Changes after the snapshot stream as usual
+	require.NoError(t, leader.todos.Upsert(&models.Todo{Id: "todo0000", Text: "edited"}))
+	waitForTodo(t, follower, "todo0000", "edited")
+}
+
+func TestReplication_PromoteFollower(t *testing.T) {
+	leader := startNode(t)
+	first := startNode(t)
+	second := startNode(t)
+	require.NoError(t, first.Follow(leader.address))
+	require.NoError(t, second.Follow(leader.address))
+	require.NoError(t, leader.todos.Upsert(&models.Todo{Id: "todo1", Text: "from the old leader"}))
+	waitForTodo(t, first, "todo1", "from the old leader")
+	waitForTodo(t, second, "todo1", "from the old leader")
+
+	// The leader fails; an operator promotes the first follower over gRPC
+	// and points the second one at it
+	leader.server.Stop()
+	promoted := false
+	first.OnPromote(func() error {
+		promoted = true
+		return nil
+	})
+	conn, err := grpc.NewClient(first.address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	response, err := replicationpb.NewReplicationServiceClient(conn).Promote(context.Background(), &replicationpb.PromoteRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, string(Leader), response.Status.Role)
+	assert.True(t, promoted)
+	assert.NoError(t, first.CheckLeader())
+	require.NoError(t, second.Follow(first.address))
+
+	require.NoError(t, first.todos.Upsert(&models.Todo{Id: "todo2", Text: "from the new leader"}))
+	waitForTodo(t, second, "todo2", "from the new leader")
+	seq, err := second.todos.LatestSeq()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), seq)
+}
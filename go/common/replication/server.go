@@ -0,0 +1,112 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/grpc/replicationpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// snapshotChunkSize is how many items are sent per snapshot message
+const snapshotChunkSize = 500
+
+// Server serves the replication service of a node. Followers can serve it
+// too, so followers can follow one another, and it has to be served for the
+// node to be promoted or pointed at a new leader.
+type Server struct {
+	replicationpb.UnimplementedReplicationServiceServer
+	node *Node
+}
+
+func NewServer(node *Node) *Server {
+	return &Server{node: node}
+}
+
+// Replicate implements the ReplicationService. A follower that is behind the
+// changes the table keeps, or ahead of the table, gets a snapshot first.
+func (s *Server) Replicate(request *replicationpb.ReplicateRequest, stream replicationpb.ReplicationService_ReplicateServer) error {
+	table := s.node.table(request.Table)
+	if table == nil {
+		return status.Errorf(codes.NotFound, "table %s is not replicated", request.Table)
+	}
+	latest, err := table.LatestSeq()
+	if err != nil {
+		return err
+	}
+
+	after := request.AfterSeq
+	if after > latest {
+		if after, err = sendSnapshot(table, stream); err != nil {
+			return err
+		}
+	}
+	for {
+		err := table.watch(stream.Context(), after, func(change *replicationpb.Change) error {
+			after = change.Seq
+			return stream.Send(&replicationpb.ReplicationEvent{Event: &replicationpb.ReplicationEvent_Change{Change: change}})
+		})
+		if !errors.Is(err, db.ErrChangesExpired) {
+			return err
+		}
+		log.Printf("Follower of table %s is behind the kept changes at %d, sending a snapshot", table.Name(), after)
+		if after, err = sendSnapshot(table, stream); err != nil {
+			return err
+		}
+	}
+}
+
+// sendSnapshot sends a snapshot of table and returns the sequence number of
+// the last change it reflects
+func sendSnapshot(table Table, stream replicationpb.ReplicationService_ReplicateServer) (uint64, error) {
+	seq, items, err := table.snapshot()
+	if err != nil {
+		return 0, err
+	}
+	for start := 0; ; start += snapshotChunkSize {
+		end := min(start+snapshotChunkSize, len(items))
+		snapshot := &replicationpb.Snapshot{Seq: seq, Items: items[start:end], Last: end == len(items)}
+		if err := stream.Send(&replicationpb.ReplicationEvent{Event: &replicationpb.ReplicationEvent_Snapshot{Snapshot: snapshot}}); err != nil {
+			return 0, err
+		}
+		if snapshot.Last {
+			return seq, nil
+		}
+	}
+}
+
+// Status implements the ReplicationService
+func (s *Server) Status(ctx context.Context, request *replicationpb.StatusRequest) (*replicationpb.StatusResponse, error) {
+	return s.node.Status()
+}
+
+// Promote implements the ReplicationService
+func (s *Server) Promote(ctx context.Context, request *replicationpb.PromoteRequest) (*replicationpb.PromoteResponse, error) {
+	if err := s.node.Promote(); err != nil {
+		log.Printf("Promotion failed: %v", err)
+		return nil, err
+	}
+	nodeStatus, err := s.node.Status()
+	if err != nil {
+		return nil, err
+	}
+	return &replicationpb.PromoteResponse{Status: nodeStatus}, nil
+}
+
+// Follow implements the ReplicationService
+func (s *Server) Follow(ctx context.Context, request *replicationpb.FollowRequest) (*replicationpb.FollowResponse, error) {
+	if request.LeaderAddress == "" {
+		return nil, status.Error(codes.InvalidArgument, "leader address is required")
+	}
+	if err := s.node.Follow(request.LeaderAddress); err != nil {
+		return nil, err
+	}
+	nodeStatus, err := s.node.Status()
+	if err != nil {
+		return nil, err
+	}
+	return &replicationpb.FollowResponse{Status: nodeStatus}, nil
+}
@@ -0,0 +1,99 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/grpc/replicationpb"
+)
+
+// Table is a table a node replicates, with its items JSON encoded on the
+// wire. MemDbTable makes one of a MemDb.
+type Table interface {
+	Name() string
+	LatestSeq() (uint64, error)
+	// snapshot returns the encoded items and the sequence number of the last
+	// change they reflect
+	snapshot() (uint64, [][]byte, error)
+	// watch passes the changes after seq to send until ctx is done or either
+	// fails
+	watch(ctx context.Context, after uint64, send func(*replicationpb.Change) error) error
+	apply(change *replicationpb.Change) error
+	reset(seq uint64, items [][]byte) error
+}
+
+type memDbTable[T common.Serializable] struct {
+	mem *memdb.MemDb[T]
+}
+
+// MemDbTable replicates mem. Tables are told apart by their name, so the
+// tables of a node must have different names.
+func MemDbTable[T common.Serializable](mem *memdb.MemDb[T]) Table {
+	return &memDbTable[T]{mem: mem}
+}
+
+func (table *memDbTable[T]) Name() string {
+	return table.mem.Table
+}
+
+func (table *memDbTable[T]) LatestSeq() (uint64, error) {
+	return table.mem.LatestSeq()
+}
+
+func (table *memDbTable[T]) snapshot() (uint64, [][]byte, error) {
+	seq, items, err := table.mem.Snapshot()
+	if err != nil {
+		return 0, nil, err
+	}
+	encoded := make([][]byte, len(items))
+	for i, item := range items {
+		if encoded[i], err = json.Marshal(item); err != nil {
+			return 0, nil, err
+		}
+	}
+	return seq, encoded, nil
+}
+
+func (table *memDbTable[T]) watch(ctx context.Context, after uint64, send func(*replicationpb.Change) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sub, err := table.mem.Watch(ctx, after)
+	if err != nil {
+		return err
+	}
+	for event := range sub.Events() {
+		change := &replicationpb.Change{Seq: event.Seq, Op: string(event.Op), Id: event.ID}
+		if event.Op != db.Delete {
+			if change.Item, err = json.Marshal(event.After); err != nil {
+				return err
+			}
+		}
+		if err := send(change); err != nil {
+			return err
+		}
+	}
+	return sub.Err()
+}
+
+func (table *memDbTable[T]) apply(change *replicationpb.Change) error {
+	event := db.ChangeEvent[T]{Seq: change.Seq, Op: db.ChangeOp(change.Op), ID: change.Id}
+	if event.Op != db.Delete {
+		if err := json.Unmarshal(change.Item, &event.After); err != nil {
+			return err
+		}
+	}
+	return table.mem.ApplyChange(event)
+}
+
+func (table *memDbTable[T]) reset(seq uint64, items [][]byte) error {
+	decoded := make([]T, len(items))
+	for i, data := range items {
+		if err := json.Unmarshal(data, &decoded[i]); err != nil {
+			return err
+		}
+	}
+	return table.mem.Reset(seq, decoded)
+}
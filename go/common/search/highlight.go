@@ -0,0 +1,31 @@
+package search
+
+import (
+	"html"
+	"strings"
+)
+
+// Highlight returns text with the words matching a term of query wrapped in
+// open and close, e.g. "<mark>" and "</mark>". The rest of the text is HTML
+// escaped so the result can be shown as HTML.
+func Highlight(text string, query string, open string, close string) string {
+	terms := map[string]bool{}
+	for _, term := range Terms(query) {
+		terms[term] = true
+	}
+
+	var result strings.Builder
+	last := 0
+	for _, token := range Tokenize(text) {
+		if !terms[token.Term] {
+			continue
+		}
+		result.WriteString(html.EscapeString(text[last:token.Start]))
+		result.WriteString(open)
+		result.WriteString(html.EscapeString(text[token.Start:token.End]))
+		result.WriteString(close)
+		last = token.End
+	}
+	result.WriteString(html.EscapeString(text[last:]))
+	return result.String()
+}
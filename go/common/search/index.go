@@ -0,0 +1,147 @@
+// Package search is an in-memory full-text index. Texts are split into
+// words, stop words are dropped and the rest are stemmed, so a search for
+// "run" finds "running". Results are ranked with BM25.
+package search
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// BM25 parameters: k1 limits how much repeating a term raises the score and
+// b how much longer texts are penalised
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Hit is a document matching a search
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+type document struct {
+	scope  string
+	length int
+	terms  map[string]int
+}
+
+// Index maps the terms of documents to the documents. Each document belongs
+// to a scope, e.g. the user owning it, and searches can be limited to one
+// scope. It is safe for concurrent use.
+type Index struct {
+	mu          sync.RWMutex
+	docs        map[string]*document
+	postings    map[string]map[string]int
+	totalLength int
+}
+
+func NewIndex() *Index {
+	return &Index{docs: map[string]*document{}, postings: map[string]map[string]int{}}
+}
+
+// Add indexes text as the document with the given id, replacing the
+// document if it is already indexed
+func (index *Index) Add(id string, scope string, text string) {
+	doc := &document{scope: scope, terms: map[string]int{}}
+	for _, token := range Tokenize(text) {
+		doc.terms[token.Term]++
+		doc.length++
+	}
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.remove(id)
+	index.docs[id] = doc
+	index.totalLength += doc.length
+	for term, count := range doc.terms {
+		if index.postings[term] == nil {
+			index.postings[term] = map[string]int{}
+		}
+		index.postings[term][id] = count
+	}
+}
+
+// Remove takes the document with the given id out of the index
+func (index *Index) Remove(id string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.remove(id)
+}
+
+func (index *Index) remove(id string) {
+	doc, ok := index.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(index.postings[term], id)
+		if len(index.postings[term]) == 0 {
+			delete(index.postings, term)
+		}
+	}
+	index.totalLength -= doc.length
+	delete(index.docs, id)
+}
+
+// Clear removes every document
+func (index *Index) Clear() {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	index.docs = map[string]*document{}
+	index.postings = map[string]map[string]int{}
+	index.totalLength = 0
+}
+
+// Len returns the number of documents in the index
+func (index *Index) Len() int {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return len(index.docs)
+}
+
+// Search returns the documents of scope that have any of the terms of
+// query, best match first and at most limit of them. An empty scope searches
+// every document and a limit of 0 returns all matches.
+func (index *Index) Search(scope string, query string, limit int) []Hit {
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	if len(index.docs) == 0 {
+		return nil
+	}
+
+	total := float64(len(index.docs))
+	averageLength := math.Max(float64(index.totalLength)/total, 1)
+	scores := map[string]float64{}
+	for _, term := range Terms(query) {
+		postings := index.postings[term]
+		matches := float64(len(postings))
+		idf := math.Log(1 + (total-matches+0.5)/(matches+0.5))
+		for id, count := range postings {
+			doc := index.docs[id]
+			if scope != "" && doc.scope != scope {
+				continue
+			}
+			frequency := float64(count)
+			norm := k1 * (1 - b + b*float64(doc.length)/averageLength)
+			scores[id] += idf * frequency * (k1 + 1) / (frequency + norm)
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
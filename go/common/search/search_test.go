@@ -0,0 +1,93 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStem(t *testing.T) {
+	for word, stem := range map[string]string{
+		"caresses":        "caress",
+		"ponies":          "poni",
+		"cats":            "cat",
+		"agreed":          "agre",
+		"running":         "run",
+		"hopping":         "hop",
+		"filing":          "file",
+		"happy":           "happi",
+		"relational":      "relat",
+		"connections":     "connect",
+		"generalizations": "gener",
+		"hopeful":         "hope",
+		"adjustment":      "adjust",
+		"controll":        "control",
+		"go":              "go",
+		"café":            "café",
+		"2024":            "2024",
+	} {
+		assert.Equal(t, stem, Stem(word), word)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens := Tokenize("Buy the Milk, then call Zoë's café!")
+	require.Len(t, tokens, 6)
+	assert.Equal(t, Token{Term: "bui", Start: 0, End: 3}, tokens[0])
+	assert.Equal(t, Token{Term: "milk", Start: 8, End: 12}, tokens[1])
+	assert.Equal(t, "call", tokens[2].Term)
+	assert.Equal(t, "zoë", tokens[3].Term)
+	assert.Equal(t, "Zoë", "Buy the Milk, then call Zoë's café!"[tokens[3].Start:tokens[3].End])
+	assert.Equal(t, "s", tokens[4].Term)
+	assert.Equal(t, "café", tokens[5].Term)
+
+	assert.Equal(t, []string{"run", "errand"}, Terms("Running errands, run!"))
+	assert.Empty(t, Terms("the and of"))
+}
+
+func TestIndex_Search(t *testing.T) {
+	index := NewIndex()
+	index.Add("todo1", "user1", "Go running in the park")
+	index.Add("todo2", "user1", "Run errands: groceries, post office, run to the bank")
+	index.Add("todo3", "user1", "Call the bank")
+	index.Add("todo4", "user2", "Run a marathon")
+	assert.Equal(t, 4, index.Len())
+
+	hits := index.Search("user1", "runs", 0)
+	require.Len(t, hits, 2)
+	// Mentioning the term twice ranks higher despite the longer text
+	assert.Equal(t, "todo2", hits[0].ID)
+	assert.Equal(t, "todo1", hits[1].ID)
+	assert.Greater(t, hits[0].Score, hits[1].Score)
+
+	hits = index.Search("", "run", 0)
+	assert.Len(t, hits, 3)
+	assert.Len(t, index.Search("", "run", 1), 1)
+
+	// Documents with more of the terms rank higher
+	hits = index.Search("user1", "run bank", 0)
+	require.Len(t, hits, 3)
+	assert.Equal(t, "todo2", hits[0].ID)
+
+	index.Add("todo2", "user1", "Walk the dog")
+	hits = index.Search("user1", "run", 0)
+	require.Len(t, hits, 1)
+	assert.Equal(t, "todo1", hits[0].ID)
+
+	index.Remove("todo1")
+	assert.Empty(t, index.Search("user1", "run", 0))
+	assert.Empty(t, index.Search("user1", "", 0))
+	assert.Equal(t, 3, index.Len())
+
+	index.Clear()
+	assert.Zero(t, index.Len())
+	assert.Empty(t, index.Search("", "dog", 0))
+}
+
+func TestHighlight(t *testing.T) {
+	assert.Equal(t,
+		"<mark>Running</mark> &amp; <mark>runs</mark> &lt;b&gt;",
+		Highlight("Running & runs <b>", "run", "<mark>", "</mark>"))
+	assert.Equal(t, "nothing to see", Highlight("nothing to see", "run", "[", "]"))
+}
@@ -0,0 +1,299 @@
+package search
+
+// Stem reduces an English word to its stem with the Porter stemming
+// algorithm, so "connected", "connecting" and "connections" all become
+// "connect". Stems are not always words ("ponies" becomes "poni"); they are
+// only compared with other stems. The word has to be in lower case; words
+// with anything but the letters a to z are returned as they are.
+func Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	for i := 0; i < len(word); i++ {
+		if word[i] < 'a' || word[i] > 'z' {
+			return word
+		}
+	}
+	s := &stemmer{b: []byte(word), k: len(word) - 1}
+	s.step1ab()
+	if s.k > 0 {
+		s.step1c()
+		s.step2()
+		s.step3()
+		s.step4()
+		s.step5()
+	}
+	return string(s.b[:s.k+1])
+}
+
+// stemmer holds a word being stemmed in b[0..k]. j marks the end of the stem
+// once a suffix has been matched by ends.
+type stemmer struct {
+	b []byte
+	k int
+	j int
+}
+
+// cons reports whether b[i] is a consonant
+func (s *stemmer) cons(i int) bool {
+	switch s.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !s.cons(i-1)
+	default:
+		return true
+	}
+}
+
+// m measures the number of consonant sequences in b[0..j]. With c a
+// consonant sequence and v a vowel sequence, every word is [c](vc){m}[v].
+func (s *stemmer) m() int {
+	n := 0
+	i := 0
+	for {
+		if i > s.j {
+			return n
+		}
+		if !s.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > s.j {
+				return n
+			}
+			if s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > s.j {
+				return n
+			}
+			if !s.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// vowelInStem reports whether b[0..j] contains a vowel
+func (s *stemmer) vowelInStem() bool {
+	for i := 0; i <= s.j; i++ {
+		if !s.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doubleC reports whether b[j-1..j] is a double consonant
+func (s *stemmer) doubleC(j int) bool {
+	return j >= 1 && s.b[j] == s.b[j-1] && s.cons(j)
+}
+
+// cvc reports whether b[i-2..i] is consonant, vowel, consonant and the last
+// consonant is not w, x or y. It restores an e in words like "hop(e)".
+func (s *stemmer) cvc(i int) bool {
+	if i < 2 || !s.cons(i) || s.cons(i-1) || !s.cons(i-2) {
+		return false
+	}
+	switch s.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether b[0..k] ends with suffix and sets j to the end of the
+// rest if so
+func (s *stemmer) ends(suffix string) bool {
+	length := len(suffix)
+	if length > s.k+1 || string(s.b[s.k-length+1:s.k+1]) != suffix {
+		return false
+	}
+	s.j = s.k - length
+	return true
+}
+
+// setTo replaces b[j+1..k] with suffix
+func (s *stemmer) setTo(suffix string) {
+	s.b = append(s.b[:s.j+1], suffix...)
+	s.k = s.j + len(suffix)
+}
+
+// replace replaces the matched suffix with suffix if the stem before it has
+// a measure above 0
+func (s *stemmer) replace(suffix string) {
+	if s.m() > 0 {
+		s.setTo(suffix)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing
+func (s *stemmer) step1ab() {
+	if s.b[s.k] == 's' {
+		switch {
+		case s.ends("sses"):
+			s.k -= 2
+		case s.ends("ies"):
+			s.setTo("i")
+		case s.b[s.k-1] != 's':
+			s.k--
+		}
+	}
+	if s.ends("eed") {
+		if s.m() > 0 {
+			s.k--
+		}
+	} else if (s.ends("ed") || s.ends("ing")) && s.vowelInStem() {
+		s.k = s.j
+		switch {
+		case s.ends("at"):
+			s.setTo("ate")
+		case s.ends("bl"):
+			s.setTo("ble")
+		case s.ends("iz"):
+			s.setTo("ize")
+		case s.doubleC(s.k):
+			switch s.b[s.k] {
+			case 'l', 's', 'z':
+			default:
+				s.k--
+			}
+		default:
+			s.j = s.k
+			if s.m() == 1 && s.cvc(s.k) {
+				s.setTo("e")
+			}
+		}
+	}
+}
+
+// step1c turns a final y into i when there is another vowel in the stem
+func (s *stemmer) step1c() {
+	if s.ends("y") && s.vowelInStem() {
+		s.b[s.k] = 'i'
+	}
+}
+
+// replaceFirst replaces the first of the suffixes the word ends with by its
+// replacement, if the stem before it has a measure above 0
+func (s *stemmer) replaceFirst(suffixes ...string) {
+	for i := 0; i < len(suffixes); i += 2 {
+		if s.ends(suffixes[i]) {
+			s.replace(suffixes[i+1])
+			return
+		}
+	}
+}
+
+// step2 maps double suffixes to single ones, e.g. -ization to -ize
+func (s *stemmer) step2() {
+	switch s.b[s.k-1] {
+	case 'a':
+		s.replaceFirst("ational", "ate", "tional", "tion")
+	case 'c':
+		s.replaceFirst("enci", "ence", "anci", "ance")
+	case 'e':
+		s.replaceFirst("izer", "ize")
+	case 'l':
+		s.replaceFirst("bli", "ble", "alli", "al", "entli", "ent", "eli", "e", "ousli", "ous")
+	case 'o':
+		s.replaceFirst("ization", "ize", "ation", "ate", "ator", "ate")
+	case 's':
+		s.replaceFirst("alism", "al", "iveness", "ive", "fulness", "ful", "ousness", "ous")
+	case 't':
+		s.replaceFirst("aliti", "al", "iviti", "ive", "biliti", "ble")
+	case 'g':
+		s.replaceFirst("logi", "log")
+	}
+}
+
+// step3 deals with -ic-, -full, -ness and the like
+func (s *stemmer) step3() {
+	switch s.b[s.k] {
+	case 'e':
+		s.replaceFirst("icate", "ic", "ative", "", "alize", "al")
+	case 'i':
+		s.replaceFirst("iciti", "ic")
+	case 'l':
+		s.replaceFirst("ical", "ic", "ful", "")
+	case 's':
+		s.replaceFirst("ness", "")
+	}
+}
+
+// step4 removes -ant, -ence and the like from stems with a measure above 1
+func (s *stemmer) step4() {
+	var suffixes []string
+	switch s.b[s.k-1] {
+	case 'a':
+		suffixes = []string{"al"}
+	case 'c':
+		suffixes = []string{"ance", "ence"}
+	case 'e':
+		suffixes = []string{"er"}
+	case 'i':
+		suffixes = []string{"ic"}
+	case 'l':
+		suffixes = []string{"able", "ible"}
+	case 'n':
+		suffixes = []string{"ant", "ement", "ment", "ent"}
+	case 'o':
+		if s.ends("ion") && s.j >= 0 && (s.b[s.j] == 's' || s.b[s.j] == 't') {
+			break
+		}
+		suffixes = []string{"ou"}
+	case 's':
+		suffixes = []string{"ism"}
+	case 't':
+		suffixes = []string{"ate", "iti"}
+	case 'u':
+		suffixes = []string{"ous"}
+	case 'v':
+		suffixes = []string{"ive"}
+	case 'z':
+		suffixes = []string{"ize"}
+	default:
+		return
+	}
+	if suffixes != nil {
+		matched := false
+		for _, suffix := range suffixes {
+			if s.ends(suffix) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+	}
+	if s.m() > 1 {
+		s.k = s.j
+	}
+}
+
+// step5 removes a final -e and turns -ll into -l in long enough stems
+func (s *stemmer) step5() {
+	s.j = s.k
+	if s.b[s.k] == 'e' {
+		a := s.m()
+		if a > 1 || a == 1 && !s.cvc(s.k-1) {
+			s.k--
+		}
+	}
+	if s.b[s.k] == 'l' && s.doubleC(s.k) && s.m() > 1 {
+		s.k--
+	}
+}
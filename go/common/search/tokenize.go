@@ -0,0 +1,68 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Token is a word of a text with the byte offsets it spans in the text.
+// Term is the word as it is indexed: in lower case and stemmed.
+type Token struct {
+	Term  string
+	Start int
+	End   int
+}
+
+// stopWords are left out of the index since nearly every text has them
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true,
+	"their": true, "then": true, "there": true, "these": true, "they": true,
+	"this": true, "to": true, "was": true, "will": true, "with": true,
+}
+
+// Tokenize splits text into words, which are runs of letters and digits,
+// and returns the ones that are not stop words
+func Tokenize(text string) []Token {
+	var tokens []Token
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = appendToken(tokens, text, start, i)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = appendToken(tokens, text, start, len(text))
+	}
+	return tokens
+}
+
+func appendToken(tokens []Token, text string, start int, end int) []Token {
+	word := strings.ToLower(text[start:end])
+	if stopWords[word] {
+		return tokens
+	}
+	return append(tokens, Token{Term: Stem(word), Start: start, End: end})
+}
+
+// Terms returns the distinct terms of text in the order they first appear
+func Terms(text string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, token := range Tokenize(text) {
+		if !seen[token.Term] {
+			seen[token.Term] = true
+			terms = append(terms, token.Term)
+		}
+	}
+	return terms
+}
@@ -5,14 +5,21 @@ import (
 	"fmt"
 )
 
+// Serializable is an item stored by the db drivers. Models become
+// Serializable by embedding Model; the drivers read them with ToJson, ToMap,
+// GetID and GetField, which go by the json tags of their fields, so models
+// need no methods of their own.
 type Serializable interface {
-	ToJson() (string, error)
-	ToMap() (map[string]any, error)
-	GetID() (string, error)
-	GetField(field string) (any, error)
+	serializable()
 }
 
-// Default function for turning a serializable into JSON
+// Model is embedded in models to make them Serializable. It has no fields, so
+// it adds nothing to their json.
+type Model struct{}
+
+func (Model) serializable() {}
+
+// ToJson turns a serializable into JSON
 func ToJson(object Serializable) (string, error) {
 	jsonData, err := json.Marshal(object)
 	jsonString := string(jsonData)
@@ -24,9 +31,9 @@ func ToJson(object Serializable) (string, error) {
 	return jsonString, nil
 }
 
-// Default function for turning serializable to Map
+// ToMap turns a serializable into a map keyed by its json field names
 func ToMap(object Serializable) (map[string]any, error) {
-	jsonData, err := object.ToJson()
+	jsonData, err := ToJson(object)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
+	"github.com/Hanasou/news_feed/go/common/grpc/userpb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/gateway/clients"
+	"github.com/Hanasou/news_feed/go/gateway/clients/grpc_clients"
+	"github.com/Hanasou/news_feed/go/gateway/config"
+	"github.com/Hanasou/news_feed/go/gateway/graph"
+	"github.com/Hanasou/news_feed/go/gateway/revocation"
+	todoconfig "github.com/Hanasou/news_feed/go/todo/config"
+	todocore "github.com/Hanasou/news_feed/go/todo/core"
+	todoserver "github.com/Hanasou/news_feed/go/todo/grpc"
+	userconfig "github.com/Hanasou/news_feed/go/user/config"
+	usercore "github.com/Hanasou/news_feed/go/user/core"
+	"github.com/Hanasou/news_feed/go/user/server/grpc_server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// sharedAuth is the auth config of both the user service and the gateway
+var sharedAuth = auth.Config{Secret: "integration-test-signing-key-of-32-bytes", Issuer: "news-feed"}
+
+// serveGrpc serves the services registered by register over an in-memory
+// connection and returns a connection to them
+func serveGrpc(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// services are connections to a user and a todo service
+type services struct {
+	user        *grpc.ClientConn
+	todo        *grpc.ClientConn
+	userService *usercore.UserService
+}
+
+// startServices runs the user and todo services
+func startServices(t *testing.T) services {
+	t.Helper()
+	return startServicesWithAuth(t, sharedAuth)
+}
+
+// startServicesWithAuth runs the user service issuing tokens as configured by
+// userAuth, and the todo service
+func startServicesWithAuth(t *testing.T, userAuth auth.Config) services {
+	t.Helper()
+	t.Setenv(auth.SecretEnv, "")
+
+	userService, err := usercore.InitializeService(&userconfig.UserServiceConfig{
+		Database: userconfig.DatabaseConfig{Type: "local", RootPath: t.TempDir(), Table: "users"},
+		Auth:     userAuth,
+	})
+	require.NoError(t, err)
+	userConn := serveGrpc(t, func(server *grpc.Server) {
+		userpb.RegisterUserServiceServer(server, grpc_server.NewGrpcUserServer(userService))
+	})
+
+	todoService, err := todocore.InitializeService(&todoconfig.TodoServiceConfig{
+		Database: todoconfig.DatabaseConfig{Type: "mem", RootPath: t.TempDir()},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { todoService.Close() })
+	todoConn := serveGrpc(t, func(server *grpc.Server) {
+		todopb.RegisterTodoServiceServer(server, todoserver.NewTodoServer(todoService))
+	})
+	return services{user: userConn, todo: todoConn, userService: userService}
+}
+
+// newGatewayFor returns a GraphQL client of a gateway in front of services
+func newGatewayFor(t *testing.T, services services) *client.Client {
+	t.Helper()
+	return newGatewayWithAuth(t, services, sharedAuth)
+}
+
+// newGatewayWithAuth returns a GraphQL client of a gateway in front of
+// services, validating tokens as configured by gatewayAuth
+func newGatewayWithAuth(t *testing.T, services services, gatewayAuth auth.Config) *client.Client {
+	t.Helper()
+	gatewayConfig := &config.GatewayConfig{Auth: gatewayAuth}
+	jwtService, err := auth.NewJWTServiceFromConfig(gatewayConfig.Auth)
+	require.NoError(t, err)
+	userClient := grpc_clients.NewUserClient(userpb.NewUserServiceClient(services.user))
+	resolver := &graph.Resolver{
+		Config:      gatewayConfig,
+		UserClient:  userClient,
+		TodoClient:  grpc_clients.NewTodoClient(todopb.NewTodoServiceClient(services.todo)),
+		Revocations: revocation.NewChecker(userClient, revocation.DefaultCacheSize, revocation.DefaultCacheTTL, false),
+	}
+	c := client.New(newHandler(resolver, jwtService))
+	c.SetCustomTarget("/query")
+	return c
+}
+
+// newGateway runs the user and todo services and returns a GraphQL client of
+// a gateway in front of them
+func newGateway(t *testing.T) *client.Client {
+	t.Helper()
+	return newGatewayFor(t, startServices(t))
+}
+
+type authPayload struct {
+	AccessToken  string
+	RefreshToken string
+	User         struct {
+		ID   string
+		Name string
+	}
+}
+
+func bearer(token string) client.Option {
+	return client.AddHeader("Authorization", "Bearer "+token)
+}
+
+func TestAuthentication_EndToEnd(t *testing.T) {
+	c := newGateway(t)
+
+	var created struct{ CreateUser struct{ ID string } }
+	c.MustPost(`mutation { createUser(input: {name: "alice", email: "alice@example.com", password: "correct horse", role: "user"}) { id } }`,
+		&created)
+	require.NotEmpty(t, created.CreateUser.ID)
+
+	// Users log in with their username or email
+	var login struct{ AuthenticateUser authPayload }
+	c.MustPost(`mutation { authenticateUser(input: {identifier: "alice@example.com", password: "correct horse"}) { user { id name } } }`,
+		&login)
+	assert.Equal(t, "alice", login.AuthenticateUser.User.Name)
+	c.MustPost(`mutation { authenticateUser(input: {identifier: "alice", password: "correct horse"}) { accessToken refreshToken user { id name } } }`,
+		&login)
+	assert.Equal(t, created.CreateUser.ID, login.AuthenticateUser.User.ID)
+	require.NotEmpty(t, login.AuthenticateUser.AccessToken)
+	assert.NotEmpty(t, login.AuthenticateUser.RefreshToken)
+
+	// The gateway accepts the tokens the user service issues
+	token := login.AuthenticateUser.AccessToken
+	var todo struct{ CreateTodo struct{ User_d string } }
+	c.MustPost(`mutation($userId: String!) { createTodo(input: {text: "buy milk", userId: $userId}) { user_d } }`,
+		&todo, client.Var("userId", created.CreateUser.ID), bearer(token))
+	assert.Equal(t, created.CreateUser.ID, todo.CreateTodo.User_d)
+
+	var listed struct{ Todos []struct{ Text string } }
+	c.MustPost(`{ todos { text } }`, &listed, bearer(token))
+	require.Len(t, listed.Todos, 1)
+	assert.Equal(t, "buy milk", listed.Todos[0].Text)
+}
+
+func TestAuthentication_Rejected(t *testing.T) {
+	c := newGateway(t)
+	var created struct{ CreateUser struct{ ID string } }
+	c.MustPost(`mutation { createUser(input: {name: "alice", email: "alice@example.com", password: "correct horse", role: "user"}) { id } }`,
+		&created)
+
+	// Wrong passwords and unknown users fail the same way
+	var login struct{ AuthenticateUser authPayload }
+	for _, input := range []string{
+		`{identifier: "alice", password: "wrong"}`,
+		`{identifier: "bob", password: "correct horse"}`,
+	} {
+		err := c.Post(`mutation { authenticateUser(input: `+input+`) { accessToken } }`, &login)
+		require.Error(t, err, input)
+		assert.Contains(t, err.Error(), "failed to authenticate user: invalid username or password", input)
+		assert.Contains(t, err.Error(), `"code":"Unauthenticated"`, input)
+	}
+
+	// Tokens signed with another key are refused before reaching a resolver
+	forged, err := auth.NewJWTService("a-different-signing-key-of-32-bytes", sharedAuth.Issuer).
+		GenerateTokenPair(&models.User{ID: created.CreateUser.ID, Username: "alice"})
+	require.NoError(t, err)
+	var listed struct{ Todos []struct{ Text string } }
+	err = c.Post(`{ todos { text } }`, &listed, bearer(forged.AccessToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+
+	err = c.Post(`{ todos { text } }`, &listed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "authentication required")
+}
+
+func TestAuthentication_SignupCannotPickRole(t *testing.T) {
+	c := newGateway(t)
+
+	var created struct{ CreateUser struct{ ID, Role string } }
+	c.MustPost(`mutation { createUser(input: {name: "mallory", email: "mallory@example.com", password: "correct horse", role: "admin"}) { id role } }`,
+		&created)
+	assert.Equal(t, models.Default.String(), created.CreateUser.Role)
+
+	// Nor can users make themselves admins afterwards
+	var login struct{ AuthenticateUser authPayload }
+	c.MustPost(`mutation { authenticateUser(input: {identifier: "mallory", password: "correct horse"}) { accessToken } }`, &login)
+	var promoted struct{ SetUserRole struct{ Role string } }
+	err := c.Post(`mutation($id: ID!) { setUserRole(id: $id, role: "admin") { role } }`,
+		&promoted, client.Var("id", created.CreateUser.ID), bearer(login.AuthenticateUser.AccessToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"code":"PermissionDenied"`)
+}
+
+func TestAuthentication_RefreshToken(t *testing.T) {
+	c := newGateway(t)
+	var created struct{ CreateUser struct{ ID string } }
+	c.MustPost(`mutation { createUser(input: {name: "alice", email: "alice@example.com", password: "correct horse", role: "user"}) { id } }`,
+		&created)
+	var login struct{ AuthenticateUser authPayload }
+	c.MustPost(`mutation { authenticateUser(input: {identifier: "alice", password: "correct horse"}) { refreshToken } }`, &login)
+
+	refresh := `mutation($token: String!) { refreshToken(refreshToken: $token) { accessToken refreshToken user { id name } } }`
+	var refreshed struct{ RefreshToken authPayload }
+	c.MustPost(refresh, &refreshed, client.Var("token", login.AuthenticateUser.RefreshToken))
+	assert.Equal(t, created.CreateUser.ID, refreshed.RefreshToken.User.ID)
+	assert.NotEqual(t, login.AuthenticateUser.RefreshToken, refreshed.RefreshToken.RefreshToken)
+
+	// The new access token is accepted
+	var listed struct{ Todos []struct{ Text string } }
+	c.MustPost(`{ todos { text } }`, &listed, bearer(refreshed.RefreshToken.AccessToken))
+
+	// Replaying a used refresh token fails and revokes the one issued for it
+	err := c.Post(refresh, &refreshed, client.Var("token", login.AuthenticateUser.RefreshToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token was already used")
+	assert.Contains(t, err.Error(), `"code":"Unauthenticated"`)
+	err = c.Post(refresh, &refreshed, client.Var("token", refreshed.RefreshToken.RefreshToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"code":"Unauthenticated"`)
+}
+
+func TestAuthentication_Logout(t *testing.T) {
+	services := startServices(t)
+	c := newGatewayFor(t, services)
+	c.MustPost(`mutation { createUser(input: {name: "alice", email: "alice@example.com", password: "correct horse", role: "user"}) { id } }`,
+		&struct{ CreateUser struct{ ID string } }{})
+	login := `mutation { authenticateUser(input: {identifier: "alice", password: "correct horse"}) { accessToken refreshToken } }`
+	var first, second struct{ AuthenticateUser authPayload }
+	c.MustPost(login, &first)
+	c.MustPost(login, &second)
+
+	var listed struct{ Todos []struct{ Text string } }
+	c.MustPost(`{ todos { text } }`, &listed, bearer(first.AuthenticateUser.AccessToken))
+
+	var loggedOut struct{ Logout bool }
+	c.MustPost(`mutation { logout }`, &loggedOut, bearer(first.AuthenticateUser.AccessToken))
+	assert.True(t, loggedOut.Logout)
+
+	// Neither token of the session works anymore
+	err := c.Post(`{ todos { text } }`, &listed, bearer(first.AuthenticateUser.AccessToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token has been revoked")
+	var refreshed struct{ RefreshToken authPayload }
+	err = c.Post(`mutation($token: String!) { refreshToken(refreshToken: $token) { accessToken } }`, &refreshed,
+		client.Var("token", first.AuthenticateUser.RefreshToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"code":"Unauthenticated"`)
+
+	// The revocation is kept by the user service, so other gateways see it
+	other := newGatewayFor(t, services)
+	err = other.Post(`{ todos { text } }`, &listed, bearer(first.AuthenticateUser.AccessToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token has been revoked")
+
+	// The other session is still logged in until logging out everywhere
+	c.MustPost(`{ todos { text } }`, &listed, bearer(second.AuthenticateUser.AccessToken))
+	var everywhere struct{ LogoutEverywhere int }
+	c.MustPost(`mutation { logoutEverywhere }`, &everywhere, bearer(second.AuthenticateUser.AccessToken))
+	assert.Equal(t, 1, everywhere.LogoutEverywhere)
+	err = c.Post(`{ todos { text } }`, &listed, bearer(second.AuthenticateUser.AccessToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token has been revoked")
+
+	err = c.Post(`mutation { logout }`, &loggedOut)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "authentication required")
+}
+
+func TestAuthentication_JWKS(t *testing.T) {
+	// Only the user service holds the private key; the gateway fetches the
+	// public keys from the JWKS document of the user service
+	keyPath := filepath.Join(t.TempDir(), "signing.pem")
+	_, err := auth.GenerateKeyFiles(keyPath, "EdDSA")
+	require.NoError(t, err)
+	services := startServicesWithAuth(t, auth.Config{Issuer: "news-feed", SigningKey: &auth.KeyFile{Path: keyPath}})
+	jwks := httptest.NewServer(auth.JWKSHandler(services.userService.PublicKeys()))
+	defer jwks.Close()
+	c := newGatewayWithAuth(t, services, auth.Config{Issuer: "news-feed", JWKSURL: jwks.URL + auth.JWKSPath})
+
+	var created struct{ CreateUser struct{ ID string } }
+	c.MustPost(`mutation { createUser(input: {name: "alice", email: "alice@example.com", password: "correct horse", role: "user"}) { id } }`,
+		&created)
+	var login struct{ AuthenticateUser authPayload }
+	c.MustPost(`mutation { authenticateUser(input: {identifier: "alice", password: "correct horse"}) { accessToken refreshToken } }`,
+		&login)
+	var listed struct{ Todos []struct{ Text string } }
+	c.MustPost(`{ todos { text } }`, &listed, bearer(login.AuthenticateUser.AccessToken))
+
+	// Refreshed tokens are signed with the same key
+	var refreshed struct{ RefreshToken authPayload }
+	c.MustPost(`mutation($token: String!) { refreshToken(refreshToken: $token) { accessToken } }`,
+		&refreshed, client.Var("token", login.AuthenticateUser.RefreshToken))
+	c.MustPost(`{ todos { text } }`, &listed, bearer(refreshed.RefreshToken.AccessToken))
+
+	// Tokens signed with a shared secret are refused
+	forged, err := auth.NewJWTService("a-different-signing-key-of-32-bytes", "news-feed").
+		GenerateTokenPair(&models.User{ID: created.CreateUser.ID, Username: "alice"})
+	require.NoError(t, err)
+	err = c.Post(`{ todos { text } }`, &listed, bearer(forged.AccessToken))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+}
+
+// unreachableUserClient fails every revocation check
+type unreachableUserClient struct {
+	clients.UserClient
+}
+
+func (unreachableUserClient) IsTokenRevoked(context.Context, string, string) (bool, error) {
+	return false, errors.New("user service is down")
+}
+
+func TestAuthentication_RevocationCheckFails(t *testing.T) {
+	jwtService, err := auth.NewJWTServiceFromConfig(sharedAuth)
+	require.NoError(t, err)
+	tokens, err := jwtService.GenerateTokenPair(&models.User{ID: "alice", Username: "alice"})
+	require.NoError(t, err)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	for _, tc := range []struct {
+		failOpen bool
+		status   int
+	}{
+		{failOpen: false, status: http.StatusServiceUnavailable},
+		{failOpen: true, status: http.StatusOK},
+	} {
+		checker := revocation.NewChecker(unreachableUserClient{}, revocation.DefaultCacheSize, revocation.DefaultCacheTTL,
+			tc.failOpen)
+		request := httptest.NewRequest(http.MethodPost, "/query", nil)
+		request.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		recorder := httptest.NewRecorder()
+		JWTMiddleware(jwtService, checker)(ok).ServeHTTP(recorder, request)
+		assert.Equal(t, tc.status, recorder.Code, "fail open: %v", tc.failOpen)
+	}
+}
@@ -3,6 +3,7 @@ package clients
 import (
 	"context"
 
+	"github.com/Hanasou/news_feed/go/common/db"
 	"github.com/Hanasou/news_feed/go/common/models"
 	"github.com/Hanasou/news_feed/go/common/models/responses"
 )
@@ -10,7 +11,34 @@ import (
 type UserClient interface {
 	CreateUser(context.Context, *models.User) (*responses.CreateUserResponse, error)
 	AuthenticateUser(context.Context, string, string) (*responses.AuthUserResponse, error)
+	// RefreshTokens exchanges a refresh token for new tokens
+	RefreshTokens(ctx context.Context, refreshToken string) (*responses.AuthUserResponse, error)
+	// Logout revokes accessToken and its session, or every session of the
+	// user with everywhere, and returns how many sessions it revoked
+	Logout(ctx context.Context, accessToken string, everywhere bool) (int, error)
+	// IsTokenRevoked tells whether the access token with the given jti and
+	// sid claims was revoked
+	IsTokenRevoked(ctx context.Context, tokenID string, sessionID string) (bool, error)
+	// SetUserRole gives the user with userId role on behalf of the admin
+	// accessToken belongs to
+	SetUserRole(ctx context.Context, accessToken string, userId string, role models.Role) (*models.User, error)
 }
 
+// TodoClient talks to the todo service. Every call is made on behalf of the
+// user with userId, and the calls on single todos fail unless the user owns
+// the todo.
 type TodoClient interface {
+	// CreateTodo creates todo for todo.UserId; the service chooses its id
+	CreateTodo(ctx context.Context, todo *models.Todo) (*responses.CreateTodoResponse, error)
+	GetTodos(ctx context.Context, userId string, page db.PageRequest) (*responses.GetTodosResponse, error)
+	GetTodo(ctx context.Context, userId string, id string) (*models.Todo, error)
+	// UpdateTodo sets the fields of the todo with update.Id named in fields,
+	// "text" and "done", or both if fields is empty. Unless expectedVersion
+	// is nil the update fails if the stored todo is at another version.
+	UpdateTodo(ctx context.Context, userId string, update *models.Todo, fields []string, expectedVersion *int64) (*models.Todo, error)
+	ToggleDone(ctx context.Context, userId string, id string) (*models.Todo, error)
+	DeleteTodo(ctx context.Context, userId string, id string) error
+	// DeleteTodos returns how many todos were deleted
+	DeleteTodos(ctx context.Context, userId string, ids []string) (int, error)
+	SearchTodos(ctx context.Context, userId string, query string, limit int) (*responses.SearchTodosResponse, error)
 }
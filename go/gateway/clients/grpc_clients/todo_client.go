@@ -4,8 +4,13 @@ package grpc_clients
 
 import (
 	"context"
+	"log"
 
+	"github.com/Hanasou/news_feed/go/common/db"
 	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/models/responses"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 type GrpcTodoClient struct {
@@ -16,12 +21,116 @@ func NewTodoClient(client todopb.TodoServiceClient) *GrpcTodoClient {
 	return &GrpcTodoClient{client: client}
 }
 
-func (c *GrpcTodoClient) CreateTodo(ctx context.Context, todo *todopb.Todo) (*todopb.CreateTodoResponse, error) {
-	req := &todopb.CreateTodoRequest{Todo: todo}
-	return c.client.CreateTodo(ctx, req)
+func (c *GrpcTodoClient) CreateTodo(ctx context.Context, todo *models.Todo) (*responses.CreateTodoResponse, error) {
+	req := &todopb.CreateTodoRequest{Todo: &todopb.Todo{Text: todo.Text, Done: todo.Done, UserId: todo.UserId}}
+	grpcTodoResponse, err := c.client.CreateTodo(ctx, req)
+	if err != nil {
+		log.Println("Error in CreateTodo from Todo service: ", err)
+		return nil, err
+	}
+	return &responses.CreateTodoResponse{
+		Response: grpcTodoResponse.Response,
+		Todo:     fromProto(grpcTodoResponse.Todo),
+	}, nil
 }
 
-func (c *GrpcTodoClient) GetTodos(ctx context.Context, userId string) (*todopb.GetTodosResponse, error) {
-	req := &todopb.GetTodosRequest{UserId: userId}
-	return c.client.GetTodos(ctx, req)
+func (c *GrpcTodoClient) GetTodos(ctx context.Context, userId string, page db.PageRequest) (*responses.GetTodosResponse, error) {
+	req := &todopb.GetTodosRequest{
+		UserId:         userId,
+		PageSize:       int32(page.PageSize),
+		PageToken:      page.PageToken,
+		OrderBy:        page.OrderBy,
+		Descending:     page.Descending,
+		IncludeDeleted: page.IncludeDeleted,
+	}
+	grpcTodosResponse, err := c.client.GetTodos(ctx, req)
+	if err != nil {
+		log.Println("Error in GetTodos from Todo service: ", err)
+		return nil, err
+	}
+	response := &responses.GetTodosResponse{NextPageToken: grpcTodosResponse.NextPageToken}
+	for _, todo := range grpcTodosResponse.Todos {
+		response.Todos = append(response.Todos, *fromProto(todo))
+	}
+	return response, nil
+}
+
+func (c *GrpcTodoClient) GetTodo(ctx context.Context, userId string, id string) (*models.Todo, error) {
+	grpcTodoResponse, err := c.client.GetTodo(ctx, &todopb.GetTodoRequest{Id: id, UserId: userId})
+	if err != nil {
+		log.Println("Error in GetTodo from Todo service: ", err)
+		return nil, err
+	}
+	return fromProto(grpcTodoResponse.Todo), nil
+}
+
+func (c *GrpcTodoClient) UpdateTodo(ctx context.Context, userId string, update *models.Todo, fields []string, expectedVersion *int64) (*models.Todo, error) {
+	req := &todopb.UpdateTodoRequest{
+		Todo:            &todopb.Todo{Id: update.Id, Text: update.Text, Done: update.Done},
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: fields},
+		UserId:          userId,
+		ExpectedVersion: expectedVersion,
+	}
+	grpcTodoResponse, err := c.client.UpdateTodo(ctx, req)
+	if err != nil {
+		log.Println("Error in UpdateTodo from Todo service: ", err)
+		return nil, err
+	}
+	return fromProto(grpcTodoResponse.Todo), nil
+}
+
+func (c *GrpcTodoClient) ToggleDone(ctx context.Context, userId string, id string) (*models.Todo, error) {
+	grpcTodoResponse, err := c.client.ToggleDone(ctx, &todopb.ToggleDoneRequest{Id: id, UserId: userId})
+	if err != nil {
+		log.Println("Error in ToggleDone from Todo service: ", err)
+		return nil, err
+	}
+	return fromProto(grpcTodoResponse.Todo), nil
+}
+
+func (c *GrpcTodoClient) DeleteTodo(ctx context.Context, userId string, id string) error {
+	if _, err := c.client.DeleteTodo(ctx, &todopb.DeleteTodoRequest{Id: id, UserId: userId}); err != nil {
+		log.Println("Error in DeleteTodo from Todo service: ", err)
+		return err
+	}
+	return nil
+}
+
+func (c *GrpcTodoClient) DeleteTodos(ctx context.Context, userId string, ids []string) (int, error) {
+	grpcDeleteResponse, err := c.client.DeleteTodos(ctx, &todopb.DeleteTodosRequest{Ids: ids, UserId: userId})
+	if err != nil {
+		log.Println("Error in DeleteTodos from Todo service: ", err)
+		return 0, err
+	}
+	return int(grpcDeleteResponse.Deleted), nil
+}
+
+func (c *GrpcTodoClient) SearchTodos(ctx context.Context, userId string, query string, limit int) (*responses.SearchTodosResponse, error) {
+	req := &todopb.SearchTodosRequest{UserId: userId, Query: query, Limit: int32(limit)}
+	grpcSearchResponse, err := c.client.SearchTodos(ctx, req)
+	if err != nil {
+		log.Println("Error in SearchTodos from Todo service: ", err)
+		return nil, err
+	}
+	response := &responses.SearchTodosResponse{}
+	for _, result := range grpcSearchResponse.Results {
+		response.Results = append(response.Results, responses.TodoSearchResult{
+			Todo:      *fromProto(result.Todo),
+			Score:     result.Score,
+			Highlight: result.Highlight,
+		})
+	}
+	return response, nil
+}
+
+func fromProto(todo *todopb.Todo) *models.Todo {
+	return &models.Todo{
+		Id:        todo.GetId(),
+		Text:      todo.GetText(),
+		Done:      todo.GetDone(),
+		UserId:    todo.GetUserId(),
+		Version:   todo.GetVersion(),
+		UpdatedAt: todo.GetUpdatedAt(),
+		DeletedAt: todo.GetDeletedAt(),
+	}
 }
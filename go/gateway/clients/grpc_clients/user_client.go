@@ -22,6 +22,7 @@ func NewUserClient(client userpb.UserServiceClient) *GrpcUserClient {
 
 func (c *GrpcUserClient) CreateUser(ctx context.Context, user *models.User) (*responses.CreateUserResponse, error) {
 
+	// The user service gives the user its id
 	newUser := &userpb.User{
 		Username: user.Username,
 		Email:    user.Email,
@@ -40,7 +41,7 @@ func (c *GrpcUserClient) CreateUser(ctx context.Context, user *models.User) (*re
 
 	return &responses.CreateUserResponse{
 		Response: grpcUserResponse.Response,
-		User:     user,
+		User:     fromProtoUser(grpcUserResponse.User),
 	}, nil
 }
 
@@ -51,20 +52,71 @@ func (c *GrpcUserClient) AuthenticateUser(ctx context.Context, identifier, passw
 		log.Println("Error in AuthenticateUser from User service: ", err)
 		return nil, err
 	}
-	user := &models.User{
-		ID:       grpcAuthResponse.User.Id,
-		Username: grpcAuthResponse.User.Username,
-		Email:    grpcAuthResponse.User.Email,
-		Password: grpcAuthResponse.User.Password,
-		Role:     models.RoleFromString(grpcAuthResponse.User.Role),
+	return toAuthUserResponse(grpcAuthResponse.AccessToken, grpcAuthResponse.RefreshToken, grpcAuthResponse.ExpiresTimestamp,
+		grpcAuthResponse.TokenType, grpcAuthResponse.User), nil
+}
+
+func (c *GrpcUserClient) RefreshTokens(ctx context.Context, refreshToken string) (*responses.AuthUserResponse, error) {
+	grpcRefreshResponse, err := c.client.RefreshTokens(ctx, &userpb.RefreshTokensRequest{RefreshToken: refreshToken})
+	if err != nil {
+		log.Println("Error in RefreshTokens from User service: ", err)
+		return nil, err
+	}
+	return toAuthUserResponse(grpcRefreshResponse.AccessToken, grpcRefreshResponse.RefreshToken, grpcRefreshResponse.ExpiresTimestamp,
+		grpcRefreshResponse.TokenType, grpcRefreshResponse.User), nil
+}
+
+func (c *GrpcUserClient) Logout(ctx context.Context, accessToken string, everywhere bool) (int, error) {
+	grpcLogoutResponse, err := c.client.Logout(ctx, &userpb.LogoutRequest{AccessToken: accessToken, Everywhere: everywhere})
+	if err != nil {
+		log.Println("Error in Logout from User service: ", err)
+		return 0, err
+	}
+	return int(grpcLogoutResponse.Sessions), nil
+}
+
+func (c *GrpcUserClient) IsTokenRevoked(ctx context.Context, tokenID string, sessionID string) (bool, error) {
+	grpcRevokedResponse, err := c.client.IsTokenRevoked(ctx, &userpb.IsTokenRevokedRequest{TokenId: tokenID, SessionId: sessionID})
+	if err != nil {
+		log.Println("Error in IsTokenRevoked from User service: ", err)
+		return false, err
 	}
+	return grpcRevokedResponse.Revoked, nil
+}
+
+func (c *GrpcUserClient) SetUserRole(ctx context.Context, accessToken string, userId string, role models.Role) (*models.User, error) {
+	grpcRoleResponse, err := c.client.SetUserRole(ctx, &userpb.SetUserRoleRequest{
+		AccessToken: accessToken,
+		UserId:      userId,
+		Role:        role.String(),
+	})
+	if err != nil {
+		log.Println("Error in SetUserRole from User service: ", err)
+		return nil, err
+	}
+	return fromProtoUser(grpcRoleResponse.User), nil
+}
+
+// toAuthUserResponse maps the tokens and user the user service issued
+func toAuthUserResponse(accessToken, refreshToken string, expiresIn int64, tokenType string, user *userpb.User) *responses.AuthUserResponse {
 	return &responses.AuthUserResponse{
 		TokenPair: &auth.TokenPair{
-			AccessToken:  grpcAuthResponse.AccessToken,
-			RefreshToken: grpcAuthResponse.RefreshToken,
-			ExpiresIn:    grpcAuthResponse.ExpiresTimestamp,
-			TokenType:    grpcAuthResponse.TokenType,
+			AccessToken:  accessToken,
+			RefreshToken: refreshToken,
+			ExpiresIn:    expiresIn,
+			TokenType:    tokenType,
 		},
-		User: user,
-	}, nil
+		User: fromProtoUser(user),
+	}
+}
+
+// fromProtoUser maps a user sent by the user service
+func fromProtoUser(user *userpb.User) *models.User {
+	return &models.User{
+		ID:       user.GetId(),
+		Username: user.GetUsername(),
+		Email:    user.GetEmail(),
+		Role:     models.RoleFromString(user.GetRole()),
+		Version:  user.GetVersion(),
+	}
 }
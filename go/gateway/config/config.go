@@ -4,16 +4,30 @@ import (
 	"log"
 	"os"
 
+	"github.com/Hanasou/news_feed/go/common/auth"
 	"github.com/Hanasou/news_feed/go/common/parsers"
 )
 
 type GatewayConfig struct {
 	Debug   bool          `json:"debug"`
 	Clients ClientsConfig `json:"clients"`
+	// Auth validates the tokens issued by the user service, so it must match
+	// the auth config of the user service
+	Auth       auth.Config      `json:"auth"`
+	Revocation RevocationConfig `json:"revocation"`
+}
+
+// RevocationConfig says how tokens revoked by logging out are checked
+type RevocationConfig struct {
+	// FailOpen takes tokens to be valid when the user service cannot be asked
+	// whether they were revoked, for as long as answers are cached. By
+	// default such requests are refused with a 503 instead.
+	FailOpen bool `json:"fail_open"`
 }
 
 type ClientsConfig struct {
 	UserClientConfig UserClientConfig `json:"user_client_config"`
+	TodoClientConfig TodoClientConfig `json:"todo_client_config"`
 }
 
 type UserClientConfig struct {
@@ -22,6 +36,12 @@ type UserClientConfig struct {
 	ServicePort int    `json:"service_port"`
 }
 
+type TodoClientConfig struct {
+	Protocol    string `json:"protocol"`
+	ServiceHost string `json:"service_host"`
+	ServicePort int    `json:"service_port"`
+}
+
 const configName = "gateway_config.json"
 
 func getConfigPath() string {
@@ -22,25 +22,41 @@ type NewTodo struct {
 }
 
 type NewUser struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
-	Role     string `json:"role"`
+	Name     string  `json:"name"`
+	Email    string  `json:"email"`
+	Password string  `json:"password"`
+	Role     *string `json:"role,omitempty"`
 }
 
 type Query struct {
 }
 
 type Todo struct {
-	ID    string `json:"id"`
-	Text  string `json:"text"`
-	Done  bool   `json:"done"`
-	UserD string `json:"user_d"`
+	ID        string `json:"id"`
+	Text      string `json:"text"`
+	Done      bool   `json:"done"`
+	UserD     string `json:"user_d"`
+	Version   int32  `json:"version"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type TodoSearchResult struct {
+	Todo      *Todo   `json:"todo"`
+	Score     float64 `json:"score"`
+	Highlight string  `json:"highlight"`
+}
+
+type UpdateTodo struct {
+	ID              string  `json:"id"`
+	Text            *string `json:"text,omitempty"`
+	Done            *bool   `json:"done,omitempty"`
+	ExpectedVersion *int32  `json:"expectedVersion,omitempty"`
 }
 
 type User struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Role    string `json:"role"`
+	Version int32  `json:"version"`
 }
@@ -8,9 +8,7 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/Hanasou/news_feed/go/common/auth"
 	"github.com/Hanasou/news_feed/go/common/models"
-	"github.com/Hanasou/news_feed/go/common/util"
 	"github.com/Hanasou/news_feed/go/gateway/graph/model"
 )
 
@@ -25,95 +23,192 @@ type mutationResolver struct {
 
 // CreateTodo is the resolver for the createTodo field.
 func (r *mutationResolver) CreateTodo(ctx context.Context, input model.NewTodo) (*model.Todo, error) {
-	// Require authentication for creating todos
-	claims, err := auth.GetClaimsFromContext(ctx)
+	userId, err := r.requestingUserID(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("authentication required: %w", err)
+		return nil, err
 	}
+	// Todos are created for the user making the request
+	if input.UserID != userId {
+		return nil, fmt.Errorf("can only create todos for yourself")
+	}
+
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return nil, err
+	}
+	response, err := todoClient.CreateTodo(ctx, &models.Todo{Text: input.Text, UserId: userId})
+	if err != nil {
+		return nil, serviceError("create todo", err)
+	}
+	return toGraphTodo(response.Todo), nil
+}
+
+// UpdateTodo is the resolver for the updateTodo field.
+func (r *mutationResolver) UpdateTodo(ctx context.Context, input model.UpdateTodo) (*model.Todo, error) {
+	userId, err := r.requestingUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the fields that are given are updated
+	update := &models.Todo{Id: input.ID}
+	fields := make([]string, 0, 2)
+	if input.Text != nil {
+		update.Text = *input.Text
+		fields = append(fields, "text")
+	}
+	if input.Done != nil {
+		update.Done = *input.Done
+		fields = append(fields, "done")
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("nothing to update: give text or done")
+	}
+	var expectedVersion *int64
+	if input.ExpectedVersion != nil {
+		version := int64(*input.ExpectedVersion)
+		expectedVersion = &version
+	}
+
+	todo, err := todoClient.UpdateTodo(ctx, userId, update, fields, expectedVersion)
+	if err != nil {
+		return nil, serviceError("update todo", err)
+	}
+	return toGraphTodo(todo), nil
+}
 
-	// Ensure user can only create todos for themselves (or allow admins to create for others)
-	if input.UserID != claims.UserID {
-		userRole, roleErr := auth.GetUserRoleFromContext(ctx)
-		if roleErr != nil || userRole != "admin" {
-			return nil, fmt.Errorf("can only create todos for yourself")
-		}
+// ToggleTodo is the resolver for the toggleTodo field.
+func (r *mutationResolver) ToggleTodo(ctx context.Context, id string) (*model.Todo, error) {
+	userId, err := r.requestingUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO: Implement actual todo creation logic
-	// For now, return a mock todo
-	return &model.Todo{
-		ID:    "new-todo-id",
-		Text:  input.Text,
-		Done:  false,
-		UserD: input.UserID,
-	}, nil
+	todo, err := todoClient.ToggleDone(ctx, userId, id)
+	if err != nil {
+		return nil, serviceError("toggle todo", err)
+	}
+	return toGraphTodo(todo), nil
 }
 
-// CreateUser is the resolver for the createUser field.
-func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser) (*model.User, error) {
-	// Hash the password
-	password, err := auth.HashPassword(input.Password)
+// DeleteTodo is the resolver for the deleteTodo field.
+func (r *mutationResolver) DeleteTodo(ctx context.Context, id string) (bool, error) {
+	userId, err := r.requestingUserID(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to hash password: %w", err)
+		return false, err
+	}
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return false, err
 	}
 
-	// Send information to user service
-	user := &models.User{
-		ID:       util.NewUUID(),
+	if err := todoClient.DeleteTodo(ctx, userId, id); err != nil {
+		return false, serviceError("delete todo", err)
+	}
+	return true, nil
+}
+
+// DeleteTodos is the resolver for the deleteTodos field.
+func (r *mutationResolver) DeleteTodos(ctx context.Context, ids []string) (int32, error) {
+	userId, err := r.requestingUserID(ctx)
+	if err != nil {
+		return 0, err
+	}
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := todoClient.DeleteTodos(ctx, userId, ids)
+	if err != nil {
+		return 0, serviceError("delete todos", err)
+	}
+	return int32(deleted), nil
+}
+
+// CreateUser is the resolver for the createUser field.
+func (r *mutationResolver) CreateUser(ctx context.Context, input model.NewUser) (*model.User, error) {
+	// Send information to user service, which hashes the password. The role
+	// of the input is ignored; new users get the default role.
+	response, err := r.UserClient.CreateUser(ctx, &models.User{
 		Username: input.Name,
 		Email:    input.Email,
-		Password: password,
-		Role:     models.RoleFromString(input.Role),
+		Password: input.Password,
+	})
+	if err != nil {
+		return nil, serviceError("create user", err)
 	}
-	r.UserClient.CreateUser(ctx, user)
+	return toGraphUser(response.User), nil
+}
 
-	return &model.User{
-		ID:    user.ID,
-		Name:  user.Username,
-		Email: user.Email,
-		Role:  user.Role.String(),
-	}, nil
+// SetUserRole is the resolver for the setUserRole field.
+func (r *mutationResolver) SetUserRole(ctx context.Context, id string, role string) (*model.User, error) {
+	// The user service checks that the caller is an admin
+	_, token, err := requestToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := r.UserClient.SetUserRole(ctx, token, id, models.Role(role))
+	if err != nil {
+		return nil, serviceError("set user role", err)
+	}
+	return toGraphUser(user), nil
 }
 
 // AuthenticateUser is the resolver for the authenticateUser field.
 func (r *mutationResolver) AuthenticateUser(ctx context.Context, input model.AuthenticateUser) (*model.AuthPayload, error) {
-	// TODO: In a real implementation, you would:
-	// 1. Look up the user by identifier (username/email)
-	// 2. Validate the password
-	// 3. Generate JWT tokens
-
-	// For demonstration, create a mock user
-	user := &models.User{
-		ID:       "user123",
-		Username: input.Identifier,
-		Email:    input.Identifier + "@example.com",
-		Role:     models.Default, // Use Default role instead of RoleUser
+	response, err := r.UserClient.AuthenticateUser(ctx, input.Identifier, input.Password)
+	if err != nil {
+		return nil, serviceError("authenticate user", err)
 	}
+	return toAuthPayload(response), nil
+}
 
-	// Hash the provided password (in real implementation, compare with stored hash)
-	hashedPassword, err := auth.HashPassword(input.Password)
+// RefreshToken is the resolver for the refreshToken field.
+func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string) (*model.AuthPayload, error) {
+	response, err := r.UserClient.RefreshTokens(ctx, refreshToken)
 	if err != nil {
-		return nil, fmt.Errorf("authentication failed: %w", err)
+		return nil, serviceError("refresh token", err)
 	}
-	user.Password = hashedPassword
-
-	// Create JWT service (in real implementation, inject this as a dependency)
-	jwtService := auth.NewJWTService("your-secret-key", "news-feed-gateway")
+	return toAuthPayload(response), nil
+}
 
-	// Generate token pair
-	tokens, err := jwtService.GenerateTokenPair(user)
+// Logout is the resolver for the logout field.
+func (r *mutationResolver) Logout(ctx context.Context) (bool, error) {
+	claims, token, err := requestToken(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate tokens: %w", err)
+		return false, err
+	}
+	if _, err := r.UserClient.Logout(ctx, token, false); err != nil {
+		return false, serviceError("log out", err)
 	}
+	if r.Revocations != nil {
+		r.Revocations.Revoked(claims)
+	}
+	return true, nil
+}
 
-	return &model.AuthPayload{
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		User: &model.User{
-			ID:    user.ID,
-			Name:  user.Username,
-			Email: user.Email,
-			Role:  string(user.Role),
-		},
-	}, nil
+// LogoutEverywhere is the resolver for the logoutEverywhere field.
+func (r *mutationResolver) LogoutEverywhere(ctx context.Context) (int32, error) {
+	claims, token, err := requestToken(ctx)
+	if err != nil {
+		return 0, err
+	}
+	sessions, err := r.UserClient.Logout(ctx, token, true)
+	if err != nil {
+		return 0, serviceError("log out", err)
+	}
+	if r.Revocations != nil {
+		r.Revocations.UserRevoked(claims.UserID)
+		r.Revocations.Revoked(claims)
+	}
+	return int32(sessions), nil
 }
@@ -9,37 +9,80 @@ import (
 	"fmt"
 
 	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/db"
 	"github.com/Hanasou/news_feed/go/gateway/graph/model"
 )
 
 // Todos is the resolver for the todos field.
 func (r *queryResolver) Todos(ctx context.Context) ([]*model.Todo, error) {
-	var username, userId string
-	if !r.Config.Debug {
-		// Require authentication for viewing todos
-		claims, err := auth.GetClaimsFromContext(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("authentication required: %w", err)
-		}
+	// Require authentication for viewing todos
+	userId, err := r.requestingUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return nil, err
+	}
 
-		// Log the authenticated user (for debugging)
-		fmt.Printf("User %s (%s) is requesting todos\n", claims.Username, claims.UserID)
-		username = claims.Username
-		userId = claims.UserID
-	} else {
-		username = "debug-username"
-		userId = "debug-user-id"
+	response, err := todoClient.GetTodos(ctx, userId, db.PageRequest{})
+	if err != nil {
+		return nil, serviceError("get todos", err)
+	}
+	todos := make([]*model.Todo, 0, len(response.Todos))
+	for _, todo := range response.Todos {
+		todos = append(todos, toGraphTodo(&todo))
+	}
+	return todos, nil
+}
+
+// Todo is the resolver for the todo field.
+func (r *queryResolver) Todo(ctx context.Context, id string) (*model.Todo, error) {
+	userId, err := r.requestingUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return nil, err
+	}
+
+	todo, err := todoClient.GetTodo(ctx, userId, id)
+	if err != nil {
+		return nil, serviceError("get todo", err)
+	}
+	return toGraphTodo(todo), nil
+}
+
+// SearchTodos is the resolver for the searchTodos field.
+func (r *queryResolver) SearchTodos(ctx context.Context, query string, limit *int32) ([]*model.TodoSearchResult, error) {
+	// Users can only search their own todos
+	userId, err := r.requestingUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	todoClient, err := r.todoClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var resultLimit int
+	if limit != nil {
+		resultLimit = int(*limit)
+	}
+	response, err := todoClient.SearchTodos(ctx, userId, query, resultLimit)
+	if err != nil {
+		return nil, serviceError("search todos", err)
+	}
+	results := make([]*model.TodoSearchResult, 0, len(response.Results))
+	for _, result := range response.Results {
+		results = append(results, &model.TodoSearchResult{
+			Todo:      toGraphTodo(&result.Todo),
+			Score:     result.Score,
+			Highlight: result.Highlight,
+		})
 	}
-	// TODO: Implement actual todo fetching logic
-	// For now, return a sample todo
-	return []*model.Todo{
-		{
-			ID:    "1",
-			Text:  fmt.Sprintf("Sample todo for user %s", username),
-			Done:  false,
-			UserD: userId, // Using UserD field as defined in the model
-		},
-	}, nil
+	return results, nil
 }
 
 // Users is the resolver for the users field.
@@ -1,8 +1,20 @@
 package graph
 
 import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/models/responses"
 	"github.com/Hanasou/news_feed/go/gateway/clients"
 	"github.com/Hanasou/news_feed/go/gateway/config"
+	"github.com/Hanasou/news_feed/go/gateway/graph/model"
+	"github.com/Hanasou/news_feed/go/gateway/revocation"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // This file will not be regenerated automatically.
@@ -13,4 +25,105 @@ type Resolver struct {
 	UserClient clients.UserClient
 	TodoClient clients.TodoClient
 	Config     *config.GatewayConfig
+	// Revocations, if set, is told about the tokens revoked by logging out
+	Revocations *revocation.Checker
+}
+
+// debugUserID is who requests are made as in debug mode when they are not
+// authenticated
+const debugUserID = "debug-user-id"
+
+// requestingUserID returns the id of the authenticated user making the
+// request
+func (r *Resolver) requestingUserID(ctx context.Context) (string, error) {
+	claims, err := auth.GetClaimsFromContext(ctx)
+	if err == nil {
+		return claims.UserID, nil
+	}
+	if r.Config.Debug {
+		return debugUserID, nil
+	}
+	return "", fmt.Errorf("authentication required: %w", err)
+}
+
+// requestToken returns the access token the request was made with and its
+// claims. Unlike requestingUserID it does not fall back to the debug user.
+func requestToken(ctx context.Context) (*auth.Claims, string, error) {
+	claims, err := auth.GetClaimsFromContext(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("authentication required: %w", err)
+	}
+	token, err := auth.GetAccessTokenFromContext(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("authentication required: %w", err)
+	}
+	return claims, token, nil
+}
+
+// todoClient returns the client of the todo service, or an error if the
+// gateway is not configured to talk to it
+func (r *Resolver) todoClient() (clients.TodoClient, error) {
+	if r.TodoClient == nil {
+		return nil, fmt.Errorf("todo service is not available")
+	}
+	return r.TodoClient, nil
+}
+
+// serviceError turns an error from a service call into a GraphQL error. The
+// gRPC status code, e.g. NotFound, is passed on as the "code" extension so
+// clients can tell errors apart.
+func serviceError(action string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+	message := st.Message()
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown:
+		// Details of failures inside the services are not for clients
+		message = "service unavailable"
+	}
+	return &gqlerror.Error{
+		Message:    fmt.Sprintf("failed to %s: %s", action, message),
+		Extensions: map[string]any{"code": st.Code().String()},
+	}
+}
+
+// formatUpdatedAt turns an update time in unix milliseconds, as kept by the
+// services, into the RFC 3339 string the schema exposes
+func formatUpdatedAt(unixMilli int64) string {
+	return time.UnixMilli(unixMilli).UTC().Format(time.RFC3339Nano)
+}
+
+// toAuthPayload maps the tokens issued by the user service to the schema's
+// AuthPayload
+func toAuthPayload(response *responses.AuthUserResponse) *model.AuthPayload {
+	return &model.AuthPayload{
+		AccessToken:  response.TokenPair.AccessToken,
+		RefreshToken: response.TokenPair.RefreshToken,
+		User:         toGraphUser(response.User),
+	}
+}
+
+// toGraphUser maps a user from the user service to the schema's User
+func toGraphUser(user *models.User) *model.User {
+	return &model.User{
+		ID:      user.ID,
+		Name:    user.Username,
+		Email:   user.Email,
+		Role:    user.Role.String(),
+		Version: int32(user.Version),
+	}
+}
+
+// toGraphTodo maps a todo from the todo service to the schema's Todo
+func toGraphTodo(todo *models.Todo) *model.Todo {
+	return &model.Todo{
+		ID:        todo.Id,
+		Text:      todo.Text,
+		Done:      todo.Done,
+		UserD:     todo.UserId,
+		Version:   int32(todo.Version),
+		UpdatedAt: formatUpdatedAt(todo.UpdatedAt),
+	}
 }
@@ -0,0 +1,214 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/gateway/clients/grpc_clients"
+	"github.com/Hanasou/news_feed/go/gateway/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeTodoServer keeps todos in memory and checks ownership like the todo
+// service does
+type fakeTodoServer struct {
+	todopb.UnimplementedTodoServiceServer
+	mu    sync.Mutex
+	todos map[string]*todopb.Todo
+}
+
+func (s *fakeTodoServer) CreateTodo(ctx context.Context, req *todopb.CreateTodoRequest) (*todopb.CreateTodoResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	todo := proto.Clone(req.Todo).(*todopb.Todo)
+	todo.Id = fmt.Sprintf("todo%d", len(s.todos)+1)
+	todo.Version = 1
+	s.todos[todo.Id] = todo
+	return &todopb.CreateTodoResponse{Response: "Todo created successfully", Todo: todo}, nil
+}
+
+func (s *fakeTodoServer) GetTodos(ctx context.Context, req *todopb.GetTodosRequest) (*todopb.GetTodosResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	response := &todopb.GetTodosResponse{}
+	for _, todo := range s.todos {
+		if todo.UserId == req.UserId {
+			response.Todos = append(response.Todos, todo)
+		}
+	}
+	return response, nil
+}
+
+func (s *fakeTodoServer) owned(userId string, id string) (*todopb.Todo, error) {
+	todo, ok := s.todos[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "item not found")
+	}
+	if todo.UserId != userId {
+		return nil, status.Error(codes.PermissionDenied, "todo belongs to another user")
+	}
+	return todo, nil
+}
+
+func (s *fakeTodoServer) UpdateTodo(ctx context.Context, req *todopb.UpdateTodoRequest) (*todopb.UpdateTodoResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	todo, err := s.owned(req.UserId, req.Todo.Id)
+	if err != nil {
+		return nil, err
+	}
+	if req.ExpectedVersion != nil && *req.ExpectedVersion != todo.Version {
+		return nil, status.Error(codes.Aborted, "version conflict")
+	}
+	for _, path := range req.UpdateMask.GetPaths() {
+		switch path {
+		case "text":
+			todo.Text = req.Todo.Text
+		case "done":
+			todo.Done = req.Todo.Done
+		}
+	}
+	todo.Version++
+	return &todopb.UpdateTodoResponse{Todo: todo}, nil
+}
+
+func (s *fakeTodoServer) DeleteTodo(ctx context.Context, req *todopb.DeleteTodoRequest) (*todopb.DeleteTodoResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.owned(req.UserId, req.Id); err != nil {
+		return nil, err
+	}
+	delete(s.todos, req.Id)
+	return &todopb.DeleteTodoResponse{Response: "Todo deleted successfully"}, nil
+}
+
+// newTodoClient serves a fakeTodoServer over an in-memory connection and
+// returns a GraphQL client of a gateway talking to it
+func newTodoClient(t *testing.T, debug bool) *client.Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	todopb.RegisterTodoServiceServer(server, &fakeTodoServer{todos: map[string]*todopb.Todo{}})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	resolver := &Resolver{
+		Config:     &config.GatewayConfig{Debug: debug},
+		TodoClient: grpc_clients.NewTodoClient(todopb.NewTodoServiceClient(conn)),
+	}
+	srv := handler.NewDefaultServer(NewExecutableSchema(Config{Resolvers: resolver}))
+	return client.New(srv)
+}
+
+// asUser makes a request as the user with the given id
+func asUser(userId string) client.Option {
+	return func(request *client.Request) {
+		claims := &auth.Claims{UserID: userId, Username: userId}
+		request.HTTP = request.HTTP.WithContext(auth.WithUserContext(request.HTTP.Context(), claims))
+	}
+}
+
+// asAdmin makes a request as the admin with the given id
+func asAdmin(userId string) client.Option {
+	return func(request *client.Request) {
+		claims := &auth.Claims{UserID: userId, Username: userId, Role: models.Admin}
+		request.HTTP = request.HTTP.WithContext(auth.WithUserContext(request.HTTP.Context(), claims))
+	}
+}
+
+type graphTodo struct {
+	ID      string
+	Text    string
+	Done    bool
+	User_d  string
+	Version int
+}
+
+func TestTodoResolvers_EndToEnd(t *testing.T) {
+	c := newTodoClient(t, false)
+
+	var created struct{ CreateTodo graphTodo }
+	c.MustPost(`mutation { createTodo(input: {text: "buy milk", userId: "user1"}) { id text done user_d version } }`,
+		&created, asUser("user1"))
+	assert.Equal(t, graphTodo{ID: "todo1", Text: "buy milk", User_d: "user1", Version: 1}, created.CreateTodo)
+	c.MustPost(`mutation { createTodo(input: {text: "not mine", userId: "user2"}) { id } }`, &created, asUser("user2"))
+
+	var listed struct{ Todos []graphTodo }
+	c.MustPost(`{ todos { id text } }`, &listed, asUser("user1"))
+	require.Len(t, listed.Todos, 1)
+	assert.Equal(t, "buy milk", listed.Todos[0].Text)
+
+	// Fields left out of the input keep their value
+	var updated struct{ UpdateTodo graphTodo }
+	c.MustPost(`mutation { updateTodo(input: {id: "todo1", done: true, expectedVersion: 1}) { text done version } }`,
+		&updated, asUser("user1"))
+	assert.Equal(t, graphTodo{Text: "buy milk", Done: true, Version: 2}, updated.UpdateTodo)
+
+	var deleted struct{ DeleteTodo bool }
+	c.MustPost(`mutation { deleteTodo(id: "todo1") }`, &deleted, asUser("user1"))
+	assert.True(t, deleted.DeleteTodo)
+}
+
+func TestTodoResolvers_Errors(t *testing.T) {
+	c := newTodoClient(t, false)
+	var created struct{ CreateTodo graphTodo }
+	c.MustPost(`mutation { createTodo(input: {text: "buy milk", userId: "user1"}) { id } }`, &created, asUser("user1"))
+
+	var response struct{ UpdateTodo graphTodo }
+	err := c.Post(`mutation { updateTodo(input: {id: "todo1", text: "stale", expectedVersion: 5}) { id } }`,
+		&response, asUser("user1"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `failed to update todo: version conflict`)
+	assert.Contains(t, err.Error(), `"code":"Aborted"`)
+
+	err = c.Post(`mutation { updateTodo(input: {id: "todo1", text: "not mine"}) { id } }`, &response, asUser("user2"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"code":"PermissionDenied"`)
+
+	// Todos cannot be created for other users, not even by admins
+	err = c.Post(`mutation { createTodo(input: {text: "not mine", userId: "user2"}) { id } }`, &created, asAdmin("admin"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can only create todos for yourself")
+
+	err = c.Post(`mutation { deleteTodo(id: "missing") }`, &response, asUser("user1"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"code":"NotFound"`)
+
+	err = c.Post(`{ todos { id } }`, &response)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "authentication required")
+}
+
+func TestTodoResolvers_DebugUser(t *testing.T) {
+	c := newTodoClient(t, true)
+	var created struct{ CreateTodo graphTodo }
+	c.MustPost(`mutation { createTodo(input: {text: "debugging", userId: "debug-user-id"}) { id } }`,
+		&created, asUser(debugUserID))
+
+	// Unauthenticated requests are made as the debug user
+	var listed struct{ Todos []graphTodo }
+	c.MustPost(`{ todos { id text } }`, &listed)
+	require.Len(t, listed.Todos, 1)
+	assert.Equal(t, "debugging", listed.Todos[0].Text)
+}
@@ -0,0 +1,91 @@
+// Package revocation tells the gateway whether access tokens were revoked by
+// logging out before they expired. The user service keeps the revoked
+// tokens; answers are cached so most requests do not have to ask it.
+package revocation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/cache"
+	"github.com/Hanasou/news_feed/go/gateway/clients"
+)
+
+const (
+	// DefaultCacheSize is how many tokens the answers are cached for
+	DefaultCacheSize = 10000
+	// DefaultCacheTTL is how long a token is taken to be valid before the
+	// user service is asked again. A token revoked through another gateway
+	// can be used here for up to that long.
+	DefaultCacheTTL = 30 * time.Second
+)
+
+type entry struct {
+	userID  string
+	revoked bool
+}
+
+// Checker checks tokens against the revocations kept by the user service
+type Checker struct {
+	client   clients.UserClient
+	cache    *cache.LRUCache[string, entry]
+	ttl      time.Duration
+	failOpen bool
+}
+
+// NewChecker caches the answers of client for up to size tokens, for ttl.
+// failOpen says what happens when client cannot be asked: unless it is set,
+// the check fails and so does the request (fail closed). If it is set,
+// tokens that are not known to be revoked are taken to be valid for ttl
+// (fail open), so an outage of the user service does not lock every user
+// out, at the cost of honoring tokens revoked through another gateway.
+func NewChecker(client clients.UserClient, size int, ttl time.Duration, failOpen bool) *Checker {
+	return &Checker{client: client, cache: cache.NewLRUCache[string, entry](size), ttl: ttl, failOpen: failOpen}
+}
+
+// IsRevoked reports whether the access token with claims was revoked. It
+// fails if the user service cannot be asked, unless the checker fails open.
+func (c *Checker) IsRevoked(ctx context.Context, claims *auth.Claims) (bool, error) {
+	if cached, ok := c.cache.Get(claims.ID); ok {
+		return cached.revoked, nil
+	}
+	revoked, err := c.client.IsTokenRevoked(ctx, claims.ID, claims.SessionID)
+	if err != nil {
+		if !c.failOpen {
+			return false, err
+		}
+		// The answer is cached like any other so the user service is not
+		// asked on every request while it is down
+		log.Printf("Could not check if token %s was revoked, taking it to be valid: %v", claims.ID, err)
+		revoked = false
+	}
+	c.put(claims, revoked)
+	return revoked, nil
+}
+
+// Revoked records that the access token with claims was revoked through this
+// gateway, which takes effect right away
+func (c *Checker) Revoked(claims *auth.Claims) {
+	c.put(claims, true)
+}
+
+// UserRevoked forgets the answers for the tokens of userID, after every
+// session of the user was revoked through this gateway
+func (c *Checker) UserRevoked(userID string) {
+	for _, tokenID := range c.cache.Keys() {
+		if cached, ok := c.cache.Get(tokenID); ok && cached.userID == userID {
+			c.cache.Delete(tokenID)
+		}
+	}
+}
+
+func (c *Checker) put(claims *auth.Claims, revoked bool) {
+	ttl := c.ttl
+	if revoked && claims.ExpiresAt != nil {
+		// Revoked tokens stay revoked until they expire
+		ttl = max(time.Until(claims.ExpiresAt.Time), ttl)
+	}
+	c.cache.PutWithTTL(claims.ID, entry{userID: claims.UserID, revoked: revoked}, ttl)
+}
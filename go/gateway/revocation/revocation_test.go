@@ -0,0 +1,137 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/models/responses"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeUserClient answers revocation checks from a set of revoked token ids,
+// or fails with err, and counts them
+type fakeUserClient struct {
+	revoked map[string]bool
+	err     error
+	checks  int
+}
+
+func (c *fakeUserClient) CreateUser(context.Context, *models.User) (*responses.CreateUserResponse, error) {
+	return nil, nil
+}
+
+func (c *fakeUserClient) AuthenticateUser(context.Context, string, string) (*responses.AuthUserResponse, error) {
+	return nil, nil
+}
+
+func (c *fakeUserClient) RefreshTokens(context.Context, string) (*responses.AuthUserResponse, error) {
+	return nil, nil
+}
+
+func (c *fakeUserClient) Logout(context.Context, string, bool) (int, error) {
+	return 0, nil
+}
+
+func (c *fakeUserClient) SetUserRole(context.Context, string, string, models.Role) (*models.User, error) {
+	return nil, nil
+}
+
+func (c *fakeUserClient) IsTokenRevoked(ctx context.Context, tokenID string, sessionID string) (bool, error) {
+	c.checks++
+	if c.err != nil {
+		return false, c.err
+	}
+	return c.revoked[tokenID], nil
+}
+
+func claims(tokenID string, userID string) *auth.Claims {
+	return &auth.Claims{
+		UserID:           userID,
+		RegisteredClaims: jwt.RegisteredClaims{ID: tokenID, ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	}
+}
+
+func TestChecker(t *testing.T) {
+	client := &fakeUserClient{revoked: map[string]bool{"token2": true}}
+	checker := NewChecker(client, 10, time.Minute, false)
+
+	// Answers are cached
+	for range 2 {
+		revoked, err := checker.IsRevoked(context.Background(), claims("token1", "alice"))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+		revoked, err = checker.IsRevoked(context.Background(), claims("token2", "alice"))
+		require.NoError(t, err)
+		assert.True(t, revoked)
+	}
+	assert.Equal(t, 2, client.checks)
+
+	// Revoking through the gateway takes effect right away
+	checker.Revoked(claims("token1", "alice"))
+	revoked, err := checker.IsRevoked(context.Background(), claims("token1", "alice"))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	_, err = checker.IsRevoked(context.Background(), claims("token3", "alice"))
+	require.NoError(t, err)
+	_, err = checker.IsRevoked(context.Background(), claims("token4", "bob"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, client.checks)
+
+	// Only the tokens of the user are checked again
+	checker.UserRevoked("alice")
+	client.revoked["token3"] = true
+	revoked, err = checker.IsRevoked(context.Background(), claims("token3", "alice"))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	_, err = checker.IsRevoked(context.Background(), claims("token4", "bob"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, client.checks)
+}
+
+func TestChecker_UserServiceDown(t *testing.T) {
+	errDown := errors.New("user service is down")
+
+	// Failing closed, every check fails until the user service is back
+	client := &fakeUserClient{revoked: map[string]bool{}, err: errDown}
+	checker := NewChecker(client, 10, time.Minute, false)
+	for range 2 {
+		_, err := checker.IsRevoked(context.Background(), claims("token1", "alice"))
+		assert.ErrorIs(t, err, errDown)
+	}
+	assert.Equal(t, 2, client.checks)
+	client.err = nil
+	revoked, err := checker.IsRevoked(context.Background(), claims("token1", "alice"))
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Failing open, tokens are taken to be valid for the cache TTL
+	client = &fakeUserClient{revoked: map[string]bool{"token1": true}, err: errDown}
+	checker = NewChecker(client, 10, 50*time.Millisecond, true)
+	checker.Revoked(claims("token2", "alice"))
+	for range 2 {
+		revoked, err := checker.IsRevoked(context.Background(), claims("token1", "alice"))
+		require.NoError(t, err)
+		assert.False(t, revoked)
+	}
+	assert.Equal(t, 1, client.checks)
+
+	// Tokens known to be revoked stay revoked
+	revoked, err = checker.IsRevoked(context.Background(), claims("token2", "alice"))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	// The user service is asked again once the answer expires
+	client.err = nil
+	time.Sleep(100 * time.Millisecond)
+	revoked, err = checker.IsRevoked(context.Background(), claims("token1", "alice"))
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	assert.Equal(t, 2, client.checks)
+}
@@ -12,11 +12,13 @@ import (
 	"github.com/99designs/gqlgen/graphql/handler/transport"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
 	"github.com/Hanasou/news_feed/go/common/grpc/userpb"
 	"github.com/Hanasou/news_feed/go/gateway/clients"
 	"github.com/Hanasou/news_feed/go/gateway/clients/grpc_clients"
 	"github.com/Hanasou/news_feed/go/gateway/config"
 	"github.com/Hanasou/news_feed/go/gateway/graph"
+	"github.com/Hanasou/news_feed/go/gateway/revocation"
 	"github.com/vektah/gqlparser/v2/ast"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -24,10 +26,10 @@ import (
 
 const defaultPort = "8080"
 
-// JWTMiddleware validates JWT tokens for GraphQL requests
-// TODO: Send request to user service to validate JWT
-// and fetch user information.
-func JWTMiddleware(jwtService *auth.JWTService) func(http.Handler) http.Handler {
+// JWTMiddleware validates JWT tokens for GraphQL requests. Unless
+// revocations is nil, tokens revoked by logging out are refused too; if
+// revocations cannot tell, the request is refused with a 503.
+func JWTMiddleware(jwtService *auth.JWTService, revocations *revocation.Checker) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Skip authentication for introspection queries and playground
@@ -58,8 +60,22 @@ func JWTMiddleware(jwtService *auth.JWTService) func(http.Handler) http.Handler
 				return
 			}
 
+			if revocations != nil {
+				revoked, err := revocations.IsRevoked(r.Context(), claims)
+				if err != nil {
+					log.Printf("Could not check if token was revoked: %v", err)
+					http.Error(w, "Could not check token", http.StatusServiceUnavailable)
+					return
+				}
+				if revoked {
+					http.Error(w, "Invalid token: token has been revoked", http.StatusUnauthorized)
+					return
+				}
+			}
+
 			// Add user info to request context
 			ctx := auth.WithUserContext(r.Context(), claims)
+			ctx = auth.WithAccessToken(ctx, token)
 			r = r.WithContext(ctx)
 
 			next.ServeHTTP(w, r)
@@ -78,38 +94,45 @@ func isIntrospectionQuery(r *http.Request) bool {
 }
 
 func main() {
-	// Initialize JWT service
-	secretKey := os.Getenv("JWT_SECRET")
-	if secretKey == "" {
-		// In production, always use environment variables for secrets
-		secretKey = "your-super-secret-key-min-32-chars-long"
-		log.Println("Warning: Using default JWT secret. Set JWT_SECRET environment variable in production.")
+	gatewayConfig, err := config.InitConfig()
+	if err != nil {
+		log.Fatalf("Failed to initialize config: %v", err)
 	}
 
-	jwtService := auth.NewJWTService(secretKey, "news-feed-gateway")
+	// Tokens are issued by the user service and validated here with the
+	// same key
+	jwtService, err := auth.NewJWTServiceFromConfig(gatewayConfig.Auth)
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT service: %v", err)
+	}
 
 	// Unfortunately this server is tightly coupled with GraphQL
 	// We'll just deal with that for now.
-	startGraphQlServer(jwtService)
+	startGraphQlServer(gatewayConfig, jwtService)
 	log.Println("GraphQL server started on port", defaultPort)
 	select {} // Keep the server running
 }
 
-func startGraphQlServer(jwtService *auth.JWTService) {
+func startGraphQlServer(gatewayConfig *config.GatewayConfig, jwtService *auth.JWTService) {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = defaultPort
 	}
 
-	gatewayConfig, err := config.InitConfig()
-	if err != nil {
-		log.Fatalf("Failed to initialize config: %v", err)
-	}
-
 	gqlResolver := createResolver(gatewayConfig)
+	gqlResolver.Revocations = revocation.NewChecker(gqlResolver.UserClient, revocation.DefaultCacheSize, revocation.DefaultCacheTTL,
+		gatewayConfig.Revocation.FailOpen)
 	log.Println("Created graphql resolver")
-	// TODO: Initialize clients here.
-	// Get client types from config file
+
+	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
+	log.Println("Now Serving Requests!")
+	log.Fatal(http.ListenAndServe(":"+port, newHandler(gqlResolver, jwtService)))
+}
+
+// newHandler serves the GraphQL playground at / and the GraphQL API at
+// /query, where requests bearing a token are authenticated with jwtService
+// and checked against the revocations of the resolver
+func newHandler(gqlResolver *graph.Resolver, jwtService *auth.JWTService) http.Handler {
 	srv := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: gqlResolver}))
 
 	srv.AddTransport(transport.Options{})
@@ -124,14 +147,12 @@ func startGraphQlServer(jwtService *auth.JWTService) {
 	})
 
 	// Create JWT middleware
-	jwtMiddleware := JWTMiddleware(jwtService)
-
-	http.Handle("/", playground.Handler("GraphQL playground", "/query"))
-	http.Handle("/query", jwtMiddleware(srv))
+	jwtMiddleware := JWTMiddleware(jwtService, gqlResolver.Revocations)
 
-	log.Printf("connect to http://localhost:%s/ for GraphQL playground", port)
-	log.Println("Now Serving Requests!")
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	mux := http.NewServeMux()
+	mux.Handle("/", playground.Handler("GraphQL playground", "/query"))
+	mux.Handle("/query", jwtMiddleware(srv))
+	return mux
 }
 
 func createResolver(config *config.GatewayConfig) *graph.Resolver {
@@ -139,6 +160,8 @@ func createResolver(config *config.GatewayConfig) *graph.Resolver {
 		Config: config,
 		UserClient: createUserClient(config.Clients.UserClientConfig.Protocol, config.Clients.UserClientConfig.ServiceHost,
 			config.Clients.UserClientConfig.ServicePort, config.Debug),
+		TodoClient: createTodoClient(config.Clients.TodoClientConfig.Protocol, config.Clients.TodoClientConfig.ServiceHost,
+			config.Clients.TodoClientConfig.ServicePort, config.Debug),
 	}
 	return gqlResolver
 }
@@ -146,21 +169,7 @@ func createResolver(config *config.GatewayConfig) *graph.Resolver {
 func createUserClient(clientType string, url string, port int, debug bool) clients.UserClient {
 	switch clientType {
 	case "grpc":
-		var conn *grpc.ClientConn
-		if debug {
-			grpcServiceUrl := url + ":" + strconv.Itoa(port)
-			log.Printf("Initializing grpc client. Connecting to: %s", grpcServiceUrl)
-			conn, err := grpc.NewClient(grpcServiceUrl, grpc.WithTransportCredentials(insecure.NewCredentials()))
-			if err != nil {
-				log.Fatalf("Failed to connect to User service: %v", err)
-			}
-			log.Println("Established connection to grpc server: ", grpcServiceUrl)
-			defer conn.Close()
-		} else {
-			// TODO: Set up a safe connection to the gRPC server.
-			log.Fatalf("Implement connection with real credentials")
-		}
-		return grpc_clients.NewUserClient(userpb.NewUserServiceClient(conn))
+		return grpc_clients.NewUserClient(userpb.NewUserServiceClient(dialGrpcService("User", url, port, debug)))
 	// case "rest":
 	// 	return createRestUserClient()
 	default:
@@ -168,3 +177,30 @@ func createUserClient(clientType string, url string, port int, debug bool) clien
 	}
 	return nil
 }
+
+func createTodoClient(clientType string, url string, port int, debug bool) clients.TodoClient {
+	switch clientType {
+	case "grpc":
+		return grpc_clients.NewTodoClient(todopb.NewTodoServiceClient(dialGrpcService("Todo", url, port, debug)))
+	default:
+		log.Fatalf("Unsupported client type: %s", clientType)
+	}
+	return nil
+}
+
+// dialGrpcService sets up the connection to a service's gRPC server. The
+// connection is kept open for as long as the gateway runs.
+func dialGrpcService(service string, url string, port int, debug bool) *grpc.ClientConn {
+	if !debug {
+		// TODO: Set up a safe connection to the gRPC server.
+		log.Fatalf("Implement connection with real credentials")
+	}
+	grpcServiceUrl := url + ":" + strconv.Itoa(port)
+	log.Printf("Initializing grpc client. Connecting to: %s", grpcServiceUrl)
+	conn, err := grpc.NewClient(grpcServiceUrl, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to connect to %s service: %v", service, err)
+	}
+	log.Println("Established connection to grpc server: ", grpcServiceUrl)
+	return conn
+}
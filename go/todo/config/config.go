@@ -0,0 +1,62 @@
+package config
+
+import (
+	"log"
+	"os"
+
+	"github.com/Hanasou/news_feed/go/common/parsers"
+)
+
+type TodoServiceConfig struct {
+	Database DatabaseConfig `json:"database"`
+	Server   ServerConfig   `json:"server"`
+}
+
+type DatabaseConfig struct {
+	Type       string `json:"type"` // "mem" (in memory, logged to disk), "sqlite" or "bolt"
+	RootPath   string `json:"root_path"`
+	SaveToDisk bool   `json:"save_to_disk"`
+	// Table defaults to "todos"
+	Table string `json:"table"`
+	// Deleted todos can be restored for TrashRetention, a duration such as
+	// "720h", before they are purged, which is checked every PurgeInterval.
+	// They default to 30 days and one hour.
+	TrashRetention string `json:"trash_retention"`
+	PurgeInterval  string `json:"purge_interval"`
+}
+
+type ServerConfig struct {
+	Type string `json:"type"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// ShutdownTimeout is how long requests in flight get to finish when the
+	// service is stopped, 30 seconds by default
+	ShutdownTimeout string `json:"shutdown_timeout"`
+}
+
+const configName = "todo_service_config.json"
+
+func getConfigPath() string {
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "./config/"
+	}
+	return configPath + configName
+}
+
+func InitConfig() (*TodoServiceConfig, error) {
+	result, err := parsers.ParseJSONFile(getConfigPath(), &TodoServiceConfig{})
+	if err != nil {
+		log.Printf("Error parsing %s: %s", configName, err)
+		return nil, err
+	}
+	return result.(*TodoServiceConfig), nil
+}
+
+// TableName returns the table the todos are stored in
+func (dbConfig DatabaseConfig) TableName() string {
+	if dbConfig.Table == "" {
+		return "todos"
+	}
+	return dbConfig.Table
+}
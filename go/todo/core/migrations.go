@@ -0,0 +1,69 @@
+package core
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/boltdb"
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/db/sqlitedb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/todo/config"
+)
+
+// todoMigrations bring stored todos up to date with models.Todo. Add new
+// migrations at the end; see db.Migration.
+var todoMigrations = []db.Migration[*models.Todo]{
+	{
+		// Conditional writes take an unversioned todo for a missing one
+		Version:     1,
+		Description: "Version todos stored before versions were tracked",
+		Migrate: func(todo *models.Todo) (bool, error) {
+			return todo.Version == 0, nil
+		},
+	},
+}
+
+// MigrateDb applies the pending migrations to the todos table. With dryRun
+// set it only reports what they would change.
+func MigrateDb(dbConfig config.DatabaseConfig, todoDb db.DbDriver[*models.Todo], dryRun bool) (*db.MigrationReport, error) {
+	versions, err := createSchemaVersionDb(dbConfig)
+	if err != nil {
+		log.Printf("Could not create database driver for table: %s, %v", db.SchemaVersionTable, err)
+		return nil, err
+	}
+	migrator := &db.Migrator[*models.Todo]{
+		Table:      dbConfig.TableName(),
+		Items:      todoDb,
+		Versions:   versions,
+		Migrations: todoMigrations,
+		DryRun:     dryRun,
+	}
+	return migrator.Run()
+}
+
+func createSchemaVersionDb(dbConfig config.DatabaseConfig) (db.DbDriver[*db.SchemaVersion], error) {
+	switch dbConfig.Type {
+	case "mem":
+		memDbDriver, err := memdb.Initialize[*db.SchemaVersion](db.SchemaVersionTable, dbConfig.RootPath, dbConfig.SaveToDisk)
+		if err != nil {
+			return nil, err
+		}
+		return memDbDriver, nil
+	case "sqlite":
+		sqliteDriver, err := sqlitedb.Initialize[*db.SchemaVersion](db.SchemaVersionTable, dbConfig.RootPath)
+		if err != nil {
+			return nil, err
+		}
+		return sqliteDriver, nil
+	case "bolt":
+		boltDriver, err := boltdb.Initialize[*db.SchemaVersion](db.SchemaVersionTable, dbConfig.RootPath)
+		if err != nil {
+			return nil, err
+		}
+		return boltDriver, nil
+	default:
+		return nil, errors.New("CreateDb in Todo service failed. Db type not supported: " + dbConfig.Type)
+	}
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/search"
+)
+
+const (
+	// DefaultSearchLimit is how many results a search returns if it does not
+	// ask for a number
+	DefaultSearchLimit = 20
+	// MaxSearchLimit is the most results a search returns
+	MaxSearchLimit = 100
+)
+
+// ErrInvalidSearch is returned for searches that cannot be run
+var ErrInvalidSearch = errors.New("invalid search")
+
+// ErrSearchUnsupported is returned for searches when the todo database
+// cannot stream its changes, which keeping the index up to date needs
+var ErrSearchUnsupported = errors.New("todo database does not support search")
+
+// followRetryInterval is how long the index waits before watching the table
+// again after watching failed
+const followRetryInterval = time.Second
+
+// TodoSearchResult is a todo matching a search, with the words that matched
+// highlighted in its text
+type TodoSearchResult struct {
+	Todo      *models.Todo
+	Score     float64
+	Highlight string
+}
+
+// todoIndex is a full-text index of the text of the todos that are not in
+// the trash, scoped by user. It follows the changes of the todo table, so it
+// sees every write however it is made.
+type todoIndex struct {
+	table db.Watchable[*models.Todo]
+	index *search.Index
+
+	mu sync.Mutex
+	// seq is the last change of the table the index reflects
+	seq     uint64
+	applied db.Broadcast
+}
+
+// startTodoIndex indexes the todos of table and keeps the index up to date
+// until ctx is done
+func startTodoIndex(ctx context.Context, table db.DbDriver[*models.Todo]) (*todoIndex, error) {
+	watchable, ok := table.(db.Watchable[*models.Todo])
+	if !ok {
+		return nil, ErrSearchUnsupported
+	}
+	ti := &todoIndex{table: watchable, index: search.NewIndex()}
+	if err := ti.rebuild(table); err != nil {
+		return nil, err
+	}
+	go ti.follow(ctx, table)
+	return ti, nil
+}
+
+// rebuild indexes the todos of table from scratch
+func (ti *todoIndex) rebuild(table db.DbDriver[*models.Todo]) error {
+	seq, err := ti.table.LatestSeq()
+	if err != nil {
+		return err
+	}
+	todos, err := table.GetAll()
+	if err != nil {
+		return err
+	}
+	ti.index.Clear()
+	for _, todo := range todos {
+		ti.add(todo)
+	}
+	ti.advance(seq)
+	log.Printf("Indexed %d todos for search", len(todos))
+	return nil
+}
+
+// follow applies the changes of the table to the index until ctx is done
+func (ti *todoIndex) follow(ctx context.Context, table db.DbDriver[*models.Todo]) {
+	for ctx.Err() == nil {
+		err := ti.watch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, db.ErrChangesExpired) {
+			log.Println("Search index fell behind the todo changes, indexing all todos again")
+			if err = ti.rebuild(table); err == nil {
+				continue
+			}
+		}
+		log.Printf("Following todo changes for search failed, retrying in %v: %v", followRetryInterval, err)
+		select {
+		case <-time.After(followRetryInterval):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// watch applies changes to the index until the subscription ends
+func (ti *todoIndex) watch(ctx context.Context) error {
+	ti.mu.Lock()
+	after := ti.seq
+	ti.mu.Unlock()
+	sub, err := ti.table.Watch(ctx, after)
+	if err != nil {
+		return err
+	}
+	for event := range sub.Events() {
+		if event.Op == db.Delete {
+			ti.index.Remove(event.ID)
+		} else {
+			ti.add(event.After)
+		}
+		ti.advance(event.Seq)
+	}
+	return sub.Err()
+}
+
+// add indexes todo, or takes it out of the index if it is in the trash
+func (ti *todoIndex) add(todo *models.Todo) {
+	if db.IsDeleted(todo) {
+		ti.index.Remove(todo.Id)
+		return
+	}
+	ti.index.Add(todo.Id, todo.UserId, todo.Text)
+}
+
+func (ti *todoIndex) advance(seq uint64) {
+	ti.mu.Lock()
+	ti.seq = seq
+	ti.mu.Unlock()
+	ti.applied.Notify()
+}
+
+// catchUp waits until the index reflects every change made to the table so
+// far, so a search sees the writes that came before it
+func (ti *todoIndex) catchUp(ctx context.Context) error {
+	latest, err := ti.table.LatestSeq()
+	if err != nil {
+		return err
+	}
+	for {
+		wait := ti.applied.Wait()
+		ti.mu.Lock()
+		seq := ti.seq
+		ti.mu.Unlock()
+		if seq >= latest {
+			return nil
+		}
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// SearchTodos returns the todos of userId whose text matches query, best
+// match first. A limit of 0 returns DefaultSearchLimit results. Todos in the
+// trash are not searched.
+func (service *TodoService) SearchTodos(ctx context.Context, userId string, query string, limit int) ([]TodoSearchResult, error) {
+	if service.search == nil {
+		return nil, ErrSearchUnsupported
+	}
+	if userId == "" {
+		return nil, fmt.Errorf("%w: a user id is required", ErrInvalidSearch)
+	}
+	if limit < 0 {
+		return nil, fmt.Errorf("%w: limit cannot be negative", ErrInvalidSearch)
+	}
+	if limit == 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	if err := service.search.catchUp(ctx); err != nil {
+		log.Printf("Search for %q failed: %v", query, err)
+		return nil, err
+	}
+	results := make([]TodoSearchResult, 0)
+	for _, hit := range service.search.index.Search(userId, query, limit) {
+		todo, err := service.todoTable.GetByID(hit.ID)
+		if errors.Is(err, db.ErrNotFound) {
+			// Removed since the search
+			continue
+		}
+		if err != nil {
+			log.Printf("Search for %q failed: %v", query, err)
+			return nil, err
+		}
+		if todo.UserId != userId {
+			continue
+		}
+		results = append(results, TodoSearchResult{
+			Todo:      todo,
+			Score:     hit.Score,
+			Highlight: search.Highlight(todo.Text, query, "<mark>", "</mark>"),
+		})
+	}
+	return results, nil
+}
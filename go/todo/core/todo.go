@@ -1,44 +1,153 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"time"
 
 	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/boltdb"
 	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/db/sqlitedb"
 	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/todo/config"
 )
 
+// DefaultTrashRetention is how long deleted todos can be restored before
+// they are purged
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// defaultPurgeInterval is how often the trash is emptied if the config does
+// not say
+const defaultPurgeInterval = time.Hour
+
 type TodoService struct {
 	todoTable db.DbDriver[*models.Todo]
+	// store is nil if the database does not support transactions
+	store *memdb.Store
+	// search is nil if the database does not support search
+	search *todoIndex
+	// stop ends the work the service does in the background
+	stop context.CancelFunc
 }
 
-func CreateDb(dbType string, table string, rootPath string, saveToDisk bool) (db.DbDriver[*models.Todo], error) {
-	if dbType == "mem" {
-		memDbDriver, err := memdb.Initialize[*models.Todo](table, rootPath, saveToDisk)
+func CreateDb(dbConfig config.DatabaseConfig) (db.DbDriver[*models.Todo], error) {
+	table := dbConfig.TableName()
+	switch dbConfig.Type {
+	case "mem":
+		// Bulk deletes are made in transactions of the store
+		store, err := memdb.OpenStore(dbConfig.RootPath, dbConfig.SaveToDisk)
+		if err != nil {
+			log.Printf("Could not open transaction log. Error: %v", err)
+			return nil, err
+		}
+		memDbDriver, err := memdb.Initialize[*models.Todo](table, dbConfig.RootPath, dbConfig.SaveToDisk,
+			memdb.WithIndex("user_id"), memdb.WithStore(store))
 		if err != nil {
 			log.Printf("Could not initialize db. Error: %v", err)
+			store.Close()
 			return nil, err
 		}
 		return memDbDriver, nil
-	} else {
-		return nil, errors.New("CreateDb in Todo service failed. Db type not supported: " + dbType)
+	case "sqlite":
+		sqliteDriver, err := sqlitedb.Initialize[*models.Todo](table, dbConfig.RootPath, sqlitedb.WithIndex("user_id"))
+		if err != nil {
+			log.Printf("Could not initialize db. Error: %v", err)
+			return nil, err
+		}
+		return sqliteDriver, nil
+	case "bolt":
+		boltDriver, err := boltdb.Initialize[*models.Todo](table, dbConfig.RootPath, boltdb.WithIndex("user_id"))
+		if err != nil {
+			log.Printf("Could not initialize db. Error: %v", err)
+			return nil, err
+		}
+		return boltDriver, nil
+	default:
+		return nil, errors.New("CreateDb in Todo service failed. Db type not supported: " + dbConfig.Type)
 	}
 }
 
-func InitializeService(dbType string, rootPath string, saveToDisk bool) (*TodoService, error) {
-	// TODO: Get tables from config
-	service := &TodoService{}
-	todoDb, err := CreateDb(dbType, "todos", rootPath, saveToDisk)
+func InitializeService(todoServiceConfig *config.TodoServiceConfig) (*TodoService, error) {
+	dbConfig := todoServiceConfig.Database
+	retention, purgeInterval, err := trashSettings(dbConfig)
 	if err != nil {
-		log.Printf("Could not create database driver for table: %s, %v", "todos", err)
 		return nil, err
 	}
-	service.todoTable = todoDb
+	if dbConfig.RootPath != "" {
+		if err := os.MkdirAll(dbConfig.RootPath, 0755); err != nil {
+			log.Printf("Could not create database directory: %v", err)
+			return nil, err
+		}
+	}
 
+	todoDb, err := CreateDb(dbConfig)
+	if err != nil {
+		log.Printf("Could not create database driver for table: %s, %v", dbConfig.TableName(), err)
+		return nil, err
+	}
+	if _, err := MigrateDb(dbConfig, todoDb, false); err != nil {
+		log.Printf("Could not migrate table: %s, %v", dbConfig.TableName(), err)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	service := &TodoService{todoTable: todoDb, stop: cancel}
+	if memDb, ok := todoDb.(*memdb.MemDb[*models.Todo]); ok {
+		service.store = memDb.Store()
+	}
+	service.search, err = startTodoIndex(ctx, todoDb)
+	if errors.Is(err, ErrSearchUnsupported) {
+		log.Printf("Search is off: %v", err)
+	} else if err != nil {
+		log.Printf("Could not index table: %s, %v", dbConfig.TableName(), err)
+		cancel()
+		return nil, err
+	}
+	if err := service.StartTrashPurge(ctx, retention, purgeInterval); err != nil {
+		log.Printf("Deleted todos are not purged: %v", err)
+	}
 	return service, nil
 }
 
+// trashSettings returns how long deleted todos are kept and how often the
+// trash is emptied
+func trashSettings(dbConfig config.DatabaseConfig) (time.Duration, time.Duration, error) {
+	retention, interval := DefaultTrashRetention, defaultPurgeInterval
+	var err error
+	if dbConfig.TrashRetention != "" {
+		if retention, err = time.ParseDuration(dbConfig.TrashRetention); err != nil {
+			log.Printf("Invalid trash retention %q: %v", dbConfig.TrashRetention, err)
+			return 0, 0, err
+		}
+	}
+	if dbConfig.PurgeInterval != "" {
+		if interval, err = time.ParseDuration(dbConfig.PurgeInterval); err != nil {
+			log.Printf("Invalid purge interval %q: %v", dbConfig.PurgeInterval, err)
+			return 0, 0, err
+		}
+	}
+	return retention, interval, nil
+}
+
+// Close stops the work the service does in the background and closes its
+// database
+func (service *TodoService) Close() error {
+	service.stop()
+	var err error
+	if closer, ok := service.todoTable.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if service.store != nil {
+		err = errors.Join(err, service.store.Close())
+	}
+	return err
+}
+
 func (service *TodoService) CreateTodo(todo *models.Todo) error {
 	err := service.todoTable.Upsert(todo)
 	if err != nil {
@@ -49,23 +158,266 @@ func (service *TodoService) CreateTodo(todo *models.Todo) error {
 	return nil
 }
 
+// CreateTodoIfVersion writes todo only if the stored todo is at version, 0
+// meaning it must not exist yet. A stale version fails with a
+// db.VersionConflictError.
+func (service *TodoService) CreateTodoIfVersion(todo *models.Todo, version int64) error {
+	err := service.todoTable.UpsertIfVersion(todo, version)
+	if err != nil {
+		log.Printf("Create todo failed: %v", err)
+		return err
+	}
+	log.Printf("Insert succeeded: %v", todo)
+	return nil
+}
+
+// RestoreTodo takes the todo of userId with the given id out of the trash
+// and returns it. Like the other calls on single todos it fails with
+// ErrNotOwner if the todo belongs to another user, and with db.ErrNotFound if
+// it is not in the trash.
+func (service *TodoService) RestoreTodo(userId string, id string) (*models.Todo, error) {
+	if userId == "" {
+		return nil, fmt.Errorf("%w: a user id is required", ErrInvalidTodo)
+	}
+	found, err := service.todoTable.Query(db.Query{
+		Where:          db.Where("id", db.Eq, id),
+		Limit:          1,
+		IncludeDeleted: true,
+	})
+	if err != nil {
+		log.Printf("Restore todo %s failed: %v", id, err)
+		return nil, err
+	}
+	if len(found.Items) == 0 {
+		log.Printf("Restore todo %s failed: no such todo", id)
+		return nil, db.ErrNotFound
+	}
+	if owner := found.Items[0].UserId; owner != userId {
+		log.Printf("User %s cannot access todo %s of user %s", userId, id, owner)
+		return nil, ErrNotOwner
+	}
+	if err := service.todoTable.Restore(id); err != nil {
+		log.Printf("Restore todo %s failed: %v", id, err)
+		return nil, err
+	}
+	todo, err := service.todoTable.GetByID(id)
+	if err != nil {
+		log.Printf("Restore todo %s failed: %v", id, err)
+		return nil, err
+	}
+	log.Printf("Restore succeeded: %v", todo)
+	return todo, nil
+}
+
+// StartTrashPurge permanently removes todos that have been in the trash for
+// longer than retention, checking every interval until ctx is done
+func (service *TodoService) StartTrashPurge(ctx context.Context, retention time.Duration, interval time.Duration) error {
+	purger, ok := service.todoTable.(db.Purger)
+	if !ok {
+		return errors.New("todo database cannot purge deleted todos")
+	}
+	go db.RunPurger(ctx, purger, retention, interval)
+	return nil
+}
+
+// ListTodos returns one page of the todos of userId, along with the token for
+// the next page
+func (service *TodoService) ListTodos(userId string, page db.PageRequest) ([]*models.Todo, string, error) {
+	if userId == "" {
+		return nil, "", fmt.Errorf("%w: a user id is required", ErrInvalidTodo)
+	}
+	if page.PageSize < 0 {
+		return nil, "", errors.New("page size cannot be negative")
+	}
+	result, err := service.todoTable.Query(page.Query(db.Where("user_id", db.Eq, userId)))
+	if err != nil {
+		log.Printf("Failed to list todos: %v", err)
+		return nil, "", err
+	}
+	return result.Items, result.NextCursor, nil
+}
+
+// GetTodos returns every todo of userId
 func (service *TodoService) GetTodos(userId string) ([]*models.Todo, error) {
-	filters := map[string]any{}
-	if userId != "" {
-		filters["UserId"] = userId
+	if userId == "" {
+		return nil, fmt.Errorf("%w: a user id is required", ErrInvalidTodo)
 	}
-	todos, err := service.todoTable.GetByFilter(filters)
+	todos, err := service.todoTable.GetByFilter(map[string]any{"user_id": userId})
 	if err != nil {
 		log.Printf("Failed to get todos: %v", err)
 		return nil, err
 	}
+	return todos, nil
+}
+
+// ErrNotOwner is returned when a user acts on a todo of another user
+var ErrNotOwner = errors.New("todo belongs to another user")
+
+// ErrInvalidTodo is returned for requests on todos that cannot be carried out
+var ErrInvalidTodo = errors.New("invalid todo request")
+
+// updateRetries is how often an unconditional update is tried again when
+// another write got in between reading and writing the todo
+const updateRetries = 3
+
+// GetTodo returns the todo with the given id, which has to belong to userId
+func (service *TodoService) GetTodo(userId string, id string) (*models.Todo, error) {
+	if userId == "" {
+		return nil, fmt.Errorf("%w: a user id is required", ErrInvalidTodo)
+	}
+	todo, err := service.todoTable.GetByID(id)
+	if err != nil {
+		log.Printf("Get todo %s failed: %v", id, err)
+		return nil, err
+	}
+	if todo.UserId != userId {
+		log.Printf("User %s cannot access todo %s of user %s", userId, id, todo.UserId)
+		return nil, ErrNotOwner
+	}
+	return todo, nil
+}
+
+// UpdateTodo sets the fields of the todo with update's id to those of
+// update. fields names the fields to set, "text" and "done"; an empty list
+// sets both. Unless expectedVersion is 0, the update fails with a
+// db.VersionConflictError if the stored todo is at another version.
+func (service *TodoService) UpdateTodo(userId string, update *models.Todo, fields []string, expectedVersion int64) (*models.Todo, error) {
+	if len(fields) == 0 {
+		fields = []string{"text", "done"}
+	}
+	for _, field := range fields {
+		if field != "text" && field != "done" {
+			return nil, fmt.Errorf("%w: field %q cannot be updated", ErrInvalidTodo, field)
+		}
+	}
+	return service.modifyTodo(userId, update.Id, expectedVersion, func(todo *models.Todo) {
+		for _, field := range fields {
+			switch field {
+			case "text":
+				todo.Text = update.Text
+			case "done":
+				todo.Done = update.Done
+			}
+		}
+	})
+}
+
+// ToggleDone marks the todo with the given id done if it is not, and not
+// done if it is
+func (service *TodoService) ToggleDone(userId string, id string) (*models.Todo, error) {
+	return service.modifyTodo(userId, id, 0, func(todo *models.Todo) {
+		todo.Done = !todo.Done
+	})
+}
+
+// modifyTodo applies modify to the todo with the given id and writes it if
+// it is still at the version it was read at, or at expectedVersion if that
+// is not 0
+func (service *TodoService) modifyTodo(userId string, id string, expectedVersion int64, modify func(*models.Todo)) (*models.Todo, error) {
+	for attempt := 1; ; attempt++ {
+		todo, err := service.GetTodo(userId, id)
+		if err != nil {
+			return nil, err
+		}
+		version := todo.Version
+		if expectedVersion != 0 {
+			version = expectedVersion
+		}
+		modify(todo)
+		err = service.todoTable.UpsertIfVersion(todo, version)
+		if errors.Is(err, db.ErrVersionConflict) && expectedVersion == 0 && attempt < updateRetries {
+			continue
+		}
+		if err != nil {
+			log.Printf("Update todo %s failed: %v", id, err)
+			return nil, err
+		}
+		log.Printf("Update succeeded: %v", todo)
+		return todo, nil
+	}
+}
+
+// DeleteTodo moves the todo with the given id to the trash
+func (service *TodoService) DeleteTodo(userId string, id string) error {
+	if _, err := service.GetTodo(userId, id); err != nil {
+		return err
+	}
+	if err := service.todoTable.Delete(id); err != nil {
+		log.Printf("Delete todo %s failed: %v", id, err)
+		return err
+	}
+	log.Printf("Delete succeeded: %s", id)
+	return nil
+}
+
+// DeleteTodos moves the todos with the given ids to the trash and returns
+// how many there were. Nothing is deleted if one of them is missing or
+// belongs to another user. With a "mem" database the todos are deleted in
+// one transaction, which fails with a db.VersionConflictError if one of them
+// changed meanwhile; other databases delete them one by one after checking
+// them all.
+func (service *TodoService) DeleteTodos(userId string, ids []string) (int, error) {
+	unique := make([]string, 0, len(ids))
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if service.store != nil {
+		return service.deleteTodosInTx(userId, unique)
+	}
 
-	// Filter by userId
-	var filteredTodos []*models.Todo
-	for _, todo := range todos {
-		if todo.UserId == userId {
-			filteredTodos = append(filteredTodos, todo)
+	for _, id := range unique {
+		if _, err := service.GetTodo(userId, id); err != nil {
+			return 0, err
+		}
+	}
+	for i, id := range unique {
+		if err := service.todoTable.Delete(id); err != nil {
+			log.Printf("Delete todo %s failed after deleting %d todos: %v", id, i, err)
+			return i, err
 		}
 	}
-	return filteredTodos, nil
+	log.Printf("Deleted %d todos", len(unique))
+	return len(unique), nil
+}
+
+// deleteTodosInTx moves the todos with the given ids to the trash in a single
+// transaction. Each todo is only deleted at the version its owner was checked
+// at.
+func (service *TodoService) deleteTodosInTx(userId string, ids []string) (int, error) {
+	if userId == "" {
+		return 0, fmt.Errorf("%w: a user id is required", ErrInvalidTodo)
+	}
+	tx := service.store.Begin()
+	todos, err := memdb.Within(tx, service.todoTable.(*memdb.MemDb[*models.Todo]))
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	now := time.Now()
+	for _, id := range ids {
+		todo, err := todos.GetByID(id)
+		if err == nil && todo.UserId != userId {
+			log.Printf("User %s cannot access todo %s of user %s", userId, id, todo.UserId)
+			err = ErrNotOwner
+		}
+		if err == nil {
+			todo.SetDeletedAt(now)
+			err = todos.UpsertIfVersion(todo, todo.Version)
+		}
+		if err != nil {
+			log.Printf("Delete todos failed at todo %s: %v", id, err)
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Delete todos failed: %v", err)
+		return 0, err
+	}
+	log.Printf("Deleted %d todos", len(ids))
+	return len(ids), nil
 }
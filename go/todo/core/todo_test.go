@@ -1,12 +1,26 @@
 package core
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
 	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/todo/config"
 	"github.com/stretchr/testify/require"
 )
 
+// memConfig configures a service with a "mem" database
+func memConfig(rootPath string, saveToDisk bool) *config.TodoServiceConfig {
+	return &config.TodoServiceConfig{
+		Database: config.DatabaseConfig{Type: "mem", RootPath: rootPath, SaveToDisk: saveToDisk},
+	}
+}
+
 func TestInitializeService(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -29,7 +43,9 @@ func TestInitializeService(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		newService, err := InitializeService(tt.dbType, tt.rootPath, false)
+		newService, err := InitializeService(&config.TodoServiceConfig{
+			Database: config.DatabaseConfig{Type: tt.dbType, RootPath: tt.rootPath},
+		})
 		if tt.wantErr {
 			require.Error(t, err, "Expected error for db type: %s", tt.dbType)
 		} else {
@@ -81,7 +97,7 @@ func TestTodoService_CreateTodo(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service, err := InitializeService("mem", "", false)
+			service, err := InitializeService(memConfig("", false))
 			require.NoError(t, err)
 
 			err = service.CreateTodo(tt.todo)
@@ -95,7 +111,7 @@ func TestTodoService_CreateTodo(t *testing.T) {
 }
 
 func TestTodoService_GetTodos(t *testing.T) {
-	service, err := InitializeService("mem", "", false)
+	service, err := InitializeService(memConfig("", false))
 	require.NoError(t, err)
 
 	// Create some todos
@@ -122,3 +138,333 @@ func TestTodoService_GetTodos(t *testing.T) {
 		require.Equal(t, false, todo.Done)
 	}
 }
+
+func TestTodoService_ListTodos(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+
+	for _, todo := range []*models.Todo{
+		{Id: "todo1", Text: "c", UserId: "user1"},
+		{Id: "todo2", Text: "a", UserId: "user1"},
+		{Id: "todo3", Text: "b", UserId: "user1"},
+		{Id: "todo4", Text: "d", UserId: "user2"},
+	} {
+		require.NoError(t, service.CreateTodo(todo))
+	}
+
+	page := db.PageRequest{OrderBy: "text", PageSize: 2}
+	todos, next, err := service.ListTodos("user1", page)
+	require.NoError(t, err)
+	require.Len(t, todos, 2)
+	require.Equal(t, "todo2", todos[0].Id)
+	require.Equal(t, "todo3", todos[1].Id)
+	require.NotEmpty(t, next)
+
+	page.PageToken = next
+	todos, next, err = service.ListTodos("user1", page)
+	require.NoError(t, err)
+	require.Len(t, todos, 1)
+	require.Equal(t, "todo1", todos[0].Id)
+	require.Empty(t, next)
+
+	// Todos are only listed for a user
+	_, _, err = service.ListTodos("", db.PageRequest{Descending: true})
+	require.ErrorIs(t, err, ErrInvalidTodo)
+	_, _, err = service.ListTodos("", db.PageRequest{IncludeDeleted: true})
+	require.ErrorIs(t, err, ErrInvalidTodo)
+	_, err = service.GetTodos("")
+	require.ErrorIs(t, err, ErrInvalidTodo)
+
+	_, _, err = service.ListTodos("user1", db.PageRequest{OrderBy: "UserId"})
+	require.ErrorIs(t, err, common.ErrUnknownField)
+}
+
+func TestTodoService_CreateTodoIfVersion(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+
+	todo := &models.Todo{Id: "todo1", Text: "first", UserId: "user1"}
+	require.NoError(t, service.CreateTodoIfVersion(todo, 0))
+	require.Equal(t, int64(1), todo.Version)
+
+	// A client still holding version 0 cannot overwrite the todo
+	err = service.CreateTodoIfVersion(&models.Todo{Id: "todo1", Text: "lost update"}, 0)
+	require.ErrorIs(t, err, db.ErrVersionConflict)
+
+	todo.Text = "edited"
+	require.NoError(t, service.CreateTodoIfVersion(todo, 1))
+	require.Equal(t, int64(2), todo.Version)
+}
+
+func TestTodoService_RestoreTodo(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, service.todoTable.Delete("todo1"))
+
+	todos, _, err := service.ListTodos("user1", db.PageRequest{})
+	require.NoError(t, err)
+	require.Empty(t, todos)
+	todos, _, err = service.ListTodos("user1", db.PageRequest{IncludeDeleted: true})
+	require.NoError(t, err)
+	require.Len(t, todos, 1)
+	require.NotZero(t, todos[0].DeletedAt)
+
+	// Other users cannot restore the todo
+	_, err = service.RestoreTodo("user2", "todo1")
+	require.ErrorIs(t, err, ErrNotOwner)
+	_, err = service.RestoreTodo("user1", "missing")
+	require.ErrorIs(t, err, db.ErrNotFound)
+	_, err = service.RestoreTodo("", "todo1")
+	require.ErrorIs(t, err, ErrInvalidTodo)
+
+	restored, err := service.RestoreTodo("user1", "todo1")
+	require.NoError(t, err)
+	require.Equal(t, "first", restored.Text)
+	require.Zero(t, restored.DeletedAt)
+
+	_, err = service.RestoreTodo("user1", "todo1")
+	require.ErrorIs(t, err, db.ErrNotFound)
+}
+
+func TestTodoService_TodosOfOtherUsers(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo2", Text: "trashed", UserId: "user1"}))
+	require.NoError(t, service.DeleteTodo("user1", "todo2"))
+
+	// Every call on a single todo of another user fails the same way
+	_, err = service.GetTodo("user2", "todo1")
+	require.ErrorIs(t, err, ErrNotOwner)
+	_, err = service.UpdateTodo("user2", &models.Todo{Id: "todo1", Text: "mine"}, nil, 0)
+	require.ErrorIs(t, err, ErrNotOwner)
+	_, err = service.ToggleDone("user2", "todo1")
+	require.ErrorIs(t, err, ErrNotOwner)
+	require.ErrorIs(t, service.DeleteTodo("user2", "todo1"), ErrNotOwner)
+	_, err = service.RestoreTodo("user2", "todo2")
+	require.ErrorIs(t, err, ErrNotOwner)
+}
+
+func TestTodoService_StartTrashPurge(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo1", UserId: "user1"}))
+	require.NoError(t, service.todoTable.Delete("todo1"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, service.StartTrashPurge(ctx, 0, time.Millisecond))
+	require.Eventually(t, func() bool {
+		todos, _, err := service.ListTodos("user1", db.PageRequest{IncludeDeleted: true})
+		return err == nil && len(todos) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestInitializeService_MigratesLegacyTodos(t *testing.T) {
+	rootPath := t.TempDir()
+	legacy := `[{"id":"todo1","text":"stored before versions","user_id":"user1"}]`
+	require.NoError(t, os.WriteFile(filepath.Join(rootPath, "todos.json"), []byte(legacy), 0644))
+
+	service, err := InitializeService(memConfig(rootPath, true))
+	require.NoError(t, err)
+	todos, err := service.GetTodos("user1")
+	require.NoError(t, err)
+	require.Len(t, todos, 1)
+	require.Equal(t, int64(1), todos[0].Version)
+
+	// A conditional create no longer overwrites the legacy todo
+	err = service.CreateTodoIfVersion(&models.Todo{Id: "todo1", UserId: "user1"}, 0)
+	require.ErrorIs(t, err, db.ErrVersionConflict)
+}
+
+func TestTodoService_SearchTodos(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	for _, todo := range []*models.Todo{
+		{Id: "todo1", Text: "Go running in the park", UserId: "user1"},
+		{Id: "todo2", Text: "Run errands, then run to the bank", UserId: "user1"},
+		{Id: "todo3", Text: "Call the bank", UserId: "user1"},
+		{Id: "todo4", Text: "Run a marathon", UserId: "user2"},
+	} {
+		require.NoError(t, service.CreateTodo(todo))
+	}
+	ctx := context.Background()
+
+	// Searches only see the todos of the user and writes made before them
+	results, err := service.SearchTodos(ctx, "user1", "runs", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "todo2", results[0].Todo.Id)
+	require.Equal(t, "todo1", results[1].Todo.Id)
+	require.Equal(t, "Go <mark>running</mark> in the park", results[1].Highlight)
+
+	require.NoError(t, service.todoTable.Delete("todo2"))
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo3", Text: "Run to the bank", UserId: "user1"}))
+	results, err = service.SearchTodos(ctx, "user1", "run", 1)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "todo3", results[0].Todo.Id)
+
+	_, err = service.RestoreTodo("user1", "todo2")
+	require.NoError(t, err)
+	results, err = service.SearchTodos(ctx, "user1", "errand", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+
+	results, err = service.SearchTodos(ctx, "user1", "marathon", 0)
+	require.NoError(t, err)
+	require.Empty(t, results)
+	_, err = service.SearchTodos(ctx, "", "run", 0)
+	require.ErrorIs(t, err, ErrInvalidSearch)
+}
+
+func TestTodoService_GetTodo(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+
+	todo, err := service.GetTodo("user1", "todo1")
+	require.NoError(t, err)
+	require.Equal(t, "first", todo.Text)
+
+	_, err = service.GetTodo("user2", "todo1")
+	require.ErrorIs(t, err, ErrNotOwner)
+	_, err = service.GetTodo("user1", "missing")
+	require.ErrorIs(t, err, db.ErrNotFound)
+	_, err = service.GetTodo("", "todo1")
+	require.ErrorIs(t, err, ErrInvalidTodo)
+}
+
+func TestTodoService_UpdateTodo(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+
+	// Only the fields in the mask change
+	todo, err := service.UpdateTodo("user1", &models.Todo{Id: "todo1", Text: "ignored", Done: true}, []string{"done"}, 0)
+	require.NoError(t, err)
+	require.Equal(t, "first", todo.Text)
+	require.True(t, todo.Done)
+	require.Equal(t, int64(2), todo.Version)
+
+	// No mask updates every field
+	todo, err = service.UpdateTodo("user1", &models.Todo{Id: "todo1", Text: "edited"}, nil, 2)
+	require.NoError(t, err)
+	require.Equal(t, "edited", todo.Text)
+	require.False(t, todo.Done)
+	require.Equal(t, "user1", todo.UserId)
+
+	_, err = service.UpdateTodo("user1", &models.Todo{Id: "todo1", Text: "stale"}, []string{"text"}, 2)
+	require.ErrorIs(t, err, db.ErrVersionConflict)
+	_, err = service.UpdateTodo("user1", &models.Todo{Id: "todo1", UserId: "user2"}, []string{"user_id"}, 0)
+	require.ErrorIs(t, err, ErrInvalidTodo)
+	_, err = service.UpdateTodo("user2", &models.Todo{Id: "todo1", Text: "not mine"}, []string{"text"}, 0)
+	require.ErrorIs(t, err, ErrNotOwner)
+
+	stored, err := service.GetTodo("user1", "todo1")
+	require.NoError(t, err)
+	require.Equal(t, "edited", stored.Text)
+}
+
+func TestTodoService_ToggleDone(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo1", Text: "first", UserId: "user1"}))
+
+	todo, err := service.ToggleDone("user1", "todo1")
+	require.NoError(t, err)
+	require.True(t, todo.Done)
+	todo, err = service.ToggleDone("user1", "todo1")
+	require.NoError(t, err)
+	require.False(t, todo.Done)
+	require.Equal(t, int64(3), todo.Version)
+
+	_, err = service.ToggleDone("user2", "todo1")
+	require.ErrorIs(t, err, ErrNotOwner)
+}
+
+func TestTodoService_DeleteTodos(t *testing.T) {
+	service, err := InitializeService(memConfig("", false))
+	require.NoError(t, err)
+	for _, todo := range []*models.Todo{
+		{Id: "todo1", UserId: "user1"},
+		{Id: "todo2", UserId: "user1"},
+		{Id: "todo3", UserId: "user1"},
+		{Id: "todo4", UserId: "user2"},
+	} {
+		require.NoError(t, service.CreateTodo(todo))
+	}
+
+	require.ErrorIs(t, service.DeleteTodo("user2", "todo1"), ErrNotOwner)
+	require.NoError(t, service.DeleteTodo("user1", "todo1"))
+	_, err = service.GetTodo("user1", "todo1")
+	require.ErrorIs(t, err, db.ErrNotFound)
+
+	// Nothing is deleted when one of the todos belongs to someone else
+	_, err = service.DeleteTodos("user1", []string{"todo2", "todo4"})
+	require.ErrorIs(t, err, ErrNotOwner)
+	todos, err := service.GetTodos("user1")
+	require.NoError(t, err)
+	require.Len(t, todos, 2)
+
+	deleted, err := service.DeleteTodos("user1", []string{"todo2", "todo3", "todo2"})
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	todos, _, err = service.ListTodos("user1", db.PageRequest{IncludeDeleted: true})
+	require.NoError(t, err)
+	require.Len(t, todos, 3)
+	for _, todo := range todos {
+		require.NotZero(t, todo.DeletedAt)
+	}
+}
+
+func TestTodoService_DeleteTodosIsLogged(t *testing.T) {
+	rootPath := t.TempDir()
+	service, err := InitializeService(memConfig(rootPath, true))
+	require.NoError(t, err)
+	for _, id := range []string{"todo1", "todo2"} {
+		require.NoError(t, service.CreateTodo(&models.Todo{Id: id, UserId: "user1"}))
+	}
+	deleted, err := service.DeleteTodos("user1", []string{"todo1", "todo2"})
+	require.NoError(t, err)
+	require.Equal(t, 2, deleted)
+	require.NoError(t, service.Close())
+	require.FileExists(t, filepath.Join(rootPath, "transactions.log"))
+
+	// The deletes are still there after a restart
+	service, err = InitializeService(memConfig(rootPath, true))
+	require.NoError(t, err)
+	defer service.Close()
+	todos, err := service.GetTodos("user1")
+	require.NoError(t, err)
+	require.Empty(t, todos)
+}
+
+func TestInitializeService_FromConfig(t *testing.T) {
+	serviceConfig := &config.TodoServiceConfig{
+		Database: config.DatabaseConfig{
+			Type:       "mem",
+			RootPath:   filepath.Join(t.TempDir(), "todo_db"),
+			SaveToDisk: true,
+			Table:      "my_todos",
+		},
+	}
+	service, err := InitializeService(serviceConfig)
+	require.NoError(t, err)
+	require.NoError(t, service.CreateTodo(&models.Todo{Id: "todo1", Text: "kept", UserId: "user1"}))
+	require.NoError(t, service.Close())
+	require.FileExists(t, filepath.Join(serviceConfig.Database.RootPath, "my_todos.log"))
+
+	// The todos are still there after a restart
+	service, err = InitializeService(serviceConfig)
+	require.NoError(t, err)
+	todo, err := service.GetTodo("user1", "todo1")
+	require.NoError(t, err)
+	require.Equal(t, "kept", todo.Text)
+	require.NoError(t, service.Close())
+
+	serviceConfig.Database.TrashRetention = "a month"
+	_, err = InitializeService(serviceConfig)
+	require.Error(t, err)
+}
@@ -4,11 +4,17 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"log"
 
+	"github.com/Hanasou/news_feed/go/common"
+	"github.com/Hanasou/news_feed/go/common/db"
 	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
 	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/util"
 	"github.com/Hanasou/news_feed/go/todo/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type TodoServer struct {
@@ -21,38 +27,156 @@ func NewTodoServer(service *core.TodoService) *TodoServer {
 }
 
 func (s *TodoServer) CreateTodo(ctx context.Context, req *todopb.CreateTodoRequest) (*todopb.CreateTodoResponse, error) {
+	if req.Todo.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "todo needs a user id")
+	}
+	// Ids are never taken from the client, so one client cannot overwrite
+	// the todos of another by reusing their id
 	todo := &models.Todo{
-		Id:     req.Todo.GetId(),
+		Id:     util.NewUUID(),
 		Text:   req.Todo.GetText(),
 		Done:   req.Todo.GetDone(),
 		UserId: req.Todo.GetUserId(),
 	}
+	if err := s.service.CreateTodoIfVersion(todo, 0); err != nil {
+		log.Printf("Failed to create todo: %v", err)
+		return nil, toStatus(err)
+	}
 
-	err := s.service.CreateTodo(todo)
+	return &todopb.CreateTodoResponse{Response: "Todo created successfully", Todo: toProto(todo)}, nil
+}
+
+func (s *TodoServer) GetTodo(ctx context.Context, req *todopb.GetTodoRequest) (*todopb.GetTodoResponse, error) {
+	todo, err := s.service.GetTodo(req.GetUserId(), req.GetId())
 	if err != nil {
-		log.Printf("Failed to create todo: %v", err)
-		return nil, err
+		log.Printf("Failed to get todo: %v", err)
+		return nil, toStatus(err)
+	}
+
+	return &todopb.GetTodoResponse{Todo: toProto(todo)}, nil
+}
+
+func (s *TodoServer) UpdateTodo(ctx context.Context, req *todopb.UpdateTodoRequest) (*todopb.UpdateTodoResponse, error) {
+	update := &models.Todo{
+		Id:   req.Todo.GetId(),
+		Text: req.Todo.GetText(),
+		Done: req.Todo.GetDone(),
+	}
+	todo, err := s.service.UpdateTodo(req.GetUserId(), update, req.GetUpdateMask().GetPaths(), req.GetExpectedVersion())
+	if err != nil {
+		log.Printf("Failed to update todo: %v", err)
+		return nil, toStatus(err)
+	}
+
+	return &todopb.UpdateTodoResponse{Todo: toProto(todo)}, nil
+}
+
+func (s *TodoServer) ToggleDone(ctx context.Context, req *todopb.ToggleDoneRequest) (*todopb.ToggleDoneResponse, error) {
+	todo, err := s.service.ToggleDone(req.GetUserId(), req.GetId())
+	if err != nil {
+		log.Printf("Failed to toggle todo: %v", err)
+		return nil, toStatus(err)
 	}
 
-	return &todopb.CreateTodoResponse{Response: "Todo created successfully"}, nil
+	return &todopb.ToggleDoneResponse{Todo: toProto(todo)}, nil
+}
+
+func (s *TodoServer) DeleteTodo(ctx context.Context, req *todopb.DeleteTodoRequest) (*todopb.DeleteTodoResponse, error) {
+	if err := s.service.DeleteTodo(req.GetUserId(), req.GetId()); err != nil {
+		log.Printf("Failed to delete todo: %v", err)
+		return nil, toStatus(err)
+	}
+
+	return &todopb.DeleteTodoResponse{Response: "Todo deleted successfully"}, nil
+}
+
+func (s *TodoServer) DeleteTodos(ctx context.Context, req *todopb.DeleteTodosRequest) (*todopb.DeleteTodosResponse, error) {
+	deleted, err := s.service.DeleteTodos(req.GetUserId(), req.GetIds())
+	if err != nil {
+		log.Printf("Failed to delete todos: %v", err)
+		return nil, toStatus(err)
+	}
+
+	return &todopb.DeleteTodosResponse{Response: "Todos deleted successfully", Deleted: int32(deleted)}, nil
 }
 
 func (s *TodoServer) GetTodos(ctx context.Context, req *todopb.GetTodosRequest) (*todopb.GetTodosResponse, error) {
-	todos, err := s.service.GetTodos(req.GetUserId())
+	todos, nextPageToken, err := s.service.ListTodos(req.GetUserId(), db.PageRequest{
+		OrderBy:        req.GetOrderBy(),
+		Descending:     req.GetDescending(),
+		PageSize:       int(req.GetPageSize()),
+		PageToken:      req.GetPageToken(),
+		IncludeDeleted: req.GetIncludeDeleted(),
+	})
 	if err != nil {
 		log.Printf("Failed to get todos: %v", err)
-		return nil, err
+		return nil, toStatus(err)
 	}
 
 	var todoList []*todopb.Todo
 	for _, todo := range todos {
-		todoList = append(todoList, &todopb.Todo{
-			Id:     todo.Id,
-			Text:   todo.Text,
-			Done:   todo.Done,
-			UserId: todo.UserId,
+		todoList = append(todoList, toProto(todo))
+	}
+
+	return &todopb.GetTodosResponse{Todos: todoList, NextPageToken: nextPageToken}, nil
+}
+
+func (s *TodoServer) RestoreTodo(ctx context.Context, req *todopb.RestoreTodoRequest) (*todopb.RestoreTodoResponse, error) {
+	todo, err := s.service.RestoreTodo(req.GetUserId(), req.GetId())
+	if err != nil {
+		log.Printf("Failed to restore todo: %v", err)
+		return nil, toStatus(err)
+	}
+
+	return &todopb.RestoreTodoResponse{Response: "Todo restored successfully", Todo: toProto(todo)}, nil
+}
+
+func (s *TodoServer) SearchTodos(ctx context.Context, req *todopb.SearchTodosRequest) (*todopb.SearchTodosResponse, error) {
+	results, err := s.service.SearchTodos(ctx, req.GetUserId(), req.GetQuery(), int(req.GetLimit()))
+	if err != nil {
+		log.Printf("Failed to search todos: %v", err)
+		return nil, toStatus(err)
+	}
+
+	response := &todopb.SearchTodosResponse{}
+	for _, result := range results {
+		response.Results = append(response.Results, &todopb.TodoSearchResult{
+			Todo:      toProto(result.Todo),
+			Score:     result.Score,
+			Highlight: result.Highlight,
 		})
 	}
+	return response, nil
+}
 
-	return &todopb.GetTodosResponse{Todos: todoList}, nil
+func toProto(todo *models.Todo) *todopb.Todo {
+	return &todopb.Todo{
+		Id:        todo.Id,
+		Text:      todo.Text,
+		Done:      todo.Done,
+		UserId:    todo.UserId,
+		Version:   todo.Version,
+		UpdatedAt: todo.UpdatedAt,
+		DeletedAt: todo.DeletedAt,
+	}
+}
+
+// toStatus maps errors from the service to gRPC status errors so clients can
+// tell them apart
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, db.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, db.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, common.ErrUnknownField), errors.Is(err, db.ErrInvalidQuery), errors.Is(err, core.ErrInvalidSearch),
+		errors.Is(err, core.ErrInvalidTodo):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, core.ErrNotOwner):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, core.ErrSearchUnsupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	default:
+		return err
+	}
 }
@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
+	"github.com/Hanasou/news_feed/go/todo/config"
+	"github.com/Hanasou/news_feed/go/todo/core"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestTodoServer_CreateTodoChoosesId(t *testing.T) {
+	service, err := core.InitializeService(&config.TodoServiceConfig{Database: config.DatabaseConfig{Type: "mem"}})
+	require.NoError(t, err)
+	server := NewTodoServer(service)
+	ctx := context.Background()
+
+	first, err := server.CreateTodo(ctx, &todopb.CreateTodoRequest{Todo: &todopb.Todo{Id: "chosen", Text: "first", UserId: "user1"}})
+	require.NoError(t, err)
+	require.NotEqual(t, "chosen", first.Todo.Id)
+	require.NotEmpty(t, first.Todo.Id)
+	require.Equal(t, int64(1), first.Todo.Version)
+
+	// Reusing an id creates another todo instead of overwriting the first
+	second, err := server.CreateTodo(ctx, &todopb.CreateTodoRequest{Todo: &todopb.Todo{Id: first.Todo.Id, Text: "second", UserId: "user2"}})
+	require.NoError(t, err)
+	require.NotEqual(t, first.Todo.Id, second.Todo.Id)
+
+	_, err = server.CreateTodo(ctx, &todopb.CreateTodoRequest{Todo: &todopb.Todo{Text: "no owner"}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.UpdateTodo(ctx, &todopb.UpdateTodoRequest{
+		Todo:       &todopb.Todo{Id: first.Todo.Id, Text: "not mine"},
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"text"}},
+		UserId:     "user2",
+	})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stale := int64(5)
+	_, err = server.UpdateTodo(ctx, &todopb.UpdateTodoRequest{
+		Todo:            &todopb.Todo{Id: first.Todo.Id, Text: "edited"},
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"text"}},
+		UserId:          "user1",
+		ExpectedVersion: &stale,
+	})
+	require.Equal(t, codes.Aborted, status.Code(err))
+
+	// Todos are only listed for a user, trashed or not
+	_, err = server.GetTodos(ctx, &todopb.GetTodosRequest{})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.GetTodos(ctx, &todopb.GetTodosRequest{IncludeDeleted: true})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.DeleteTodo(ctx, &todopb.DeleteTodoRequest{Id: first.Todo.Id, UserId: "user1"})
+	require.NoError(t, err)
+	_, err = server.GetTodo(ctx, &todopb.GetTodoRequest{Id: first.Todo.Id, UserId: "user1"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
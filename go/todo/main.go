@@ -1,7 +1,119 @@
 package main
 
-import "fmt"
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/grpc/todopb"
+	"github.com/Hanasou/news_feed/go/todo/config"
+	"github.com/Hanasou/news_feed/go/todo/core"
+	todogrpc "github.com/Hanasou/news_feed/go/todo/grpc"
+	"google.golang.org/grpc"
+)
+
+// defaultShutdownTimeout is how long requests in flight get to finish on
+// shutdown if the config does not say
+const defaultShutdownTimeout = 30 * time.Second
+
+func createServer(ctx context.Context, config *config.TodoServiceConfig, todoService *core.TodoService) {
+	switch config.Server.Type {
+	case "grpc":
+		createGrpcServer(ctx, config, todoService)
+	default:
+		log.Fatalf("Unsupported server: %s", config.Server.Type)
+	}
+}
+
+// createGrpcServer serves the todo service until ctx is done, then stops
+// taking new requests and waits for the ones in flight
+func createGrpcServer(ctx context.Context, config *config.TodoServiceConfig, todoService *core.TodoService) {
+	shutdownTimeout := defaultShutdownTimeout
+	if config.Server.ShutdownTimeout != "" {
+		var err error
+		if shutdownTimeout, err = time.ParseDuration(config.Server.ShutdownTimeout); err != nil {
+			log.Fatalf("Invalid shutdown timeout %q: %v", config.Server.ShutdownTimeout, err)
+		}
+	}
+
+	serviceUrl := config.Server.Host + ":" + strconv.Itoa(config.Server.Port)
+	lis, err := net.Listen("tcp", serviceUrl)
+	if err != nil {
+		log.Fatalln("Failed to listen to grpc service: ", err)
+	}
+	log.Println("Connected to: ", serviceUrl)
+
+	s := grpc.NewServer()
+	todopb.RegisterTodoServiceServer(s, todogrpc.NewTodoServer(todoService))
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(lis)
+	}()
+	log.Println("Now serving requests!")
+
+	select {
+	case err := <-served:
+		log.Fatalln("Failed to serve: ", err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %v for requests in flight", shutdownTimeout)
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		log.Println("Requests still running after the shutdown timeout, stopping them")
+		s.Stop()
+	}
+}
+
+var migrateDryRun = flag.Bool("migrate-dry-run", false, "report what the pending migrations would change and exit")
+
+// dryRunMigrations reports what the pending migrations would change
+func dryRunMigrations(config *config.TodoServiceConfig) {
+	todoDb, err := core.CreateDb(config.Database)
+	if err != nil {
+		log.Fatalln("Could not create database: ", err)
+	}
+	report, err := core.MigrateDb(config.Database, todoDb, true)
+	if err != nil {
+		log.Fatalln("Could not run migrations: ", err)
+	}
+	fmt.Println(report)
+}
 
 func main() {
-	fmt.Println("This is the main entry point for the Todo application.")
+	flag.Parse()
+	fmt.Println("Hello, from Todo service!")
+	config, err := config.InitConfig()
+	if err != nil {
+		log.Fatalln("Could not initialize configuration file: ", err)
+	}
+	if *migrateDryRun {
+		dryRunMigrations(config)
+		return
+	}
+	todoService, err := core.InitializeService(config)
+	if err != nil {
+		log.Fatalln("Could not initialize todo service: ", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	createServer(ctx, config, todoService)
+	if err := todoService.Close(); err != nil {
+		log.Println("Could not close todo service: ", err)
+	}
+	log.Println("Todo service stopped")
 }
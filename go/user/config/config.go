@@ -4,25 +4,63 @@ import (
 	"log"
 	"os"
 
+	"github.com/Hanasou/news_feed/go/common/auth"
 	"github.com/Hanasou/news_feed/go/common/parsers"
 )
 
 type UserServiceConfig struct {
-	Database DatabaseConfig `json:"database"`
-	Server   ServerConfig   `json:"server"`
+	Database    DatabaseConfig    `json:"database"`
+	Server      ServerConfig      `json:"server"`
+	Replication ReplicationConfig `json:"replication"`
+	// Auth is the key tokens are signed with, shared with the gateway
+	Auth auth.Config `json:"auth"`
 }
 
 type DatabaseConfig struct {
-	Type       string `json:"type"`
+	Type       string `json:"type"` // "local" (in memory, logged to disk), "sqlite" or "bolt"
 	RootPath   string `json:"root_path"`
 	SaveToDisk bool   `json:"save_to_disk"`
 	Table      string `json:"table"`
+	// Codec is how the "local" database stores users on disk: "json", the
+	// default, or the more compact "proto"
+	Codec string `json:"codec"`
+	// TTL, a duration such as "720h", makes records of a "local" database
+	// expire that long after they were last written. Expired records are
+	// removed every SweepInterval, one minute by default, along with token
+	// families and revoked tokens whose tokens expired.
+	TTL           string `json:"ttl"`
+	SweepInterval string `json:"sweep_interval"`
+}
+
+// ReplicationConfig makes a "local" database part of leader/follower
+// replication. The leader takes the writes and followers serve reads from a
+// copy; a follower can be promoted to leader with the replctl command.
+// Replication is off if Role is not set.
+type ReplicationConfig struct {
+	// Role is "leader" or "follower"
+	Role string `json:"role"`
+	// Host and Port are where the replication service listens, for the other
+	// nodes and replctl. It is kept off the port clients use, as anyone who
+	// can reach it can promote the node or point it at another leader, so
+	// the port should only be reachable from the other nodes. Host is that
+	// of the server if not set.
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// LeaderAddress is the host:port of the replication service of the
+	// leader a follower follows
+	LeaderAddress string `json:"leader_address"`
+	// RetryInterval is how long a follower waits before reconnecting to its
+	// leader, one second by default
+	RetryInterval string `json:"retry_interval"`
 }
 
 type ServerConfig struct {
 	Type string `json:"type"`
 	Host string `json:"host"`
 	Port int    `json:"port"`
+	// JWKSPort is the port of the HTTP server publishing the keys tokens are
+	// validated with, for tokens signed with asymmetric keys. It is off if 0.
+	JWKSPort int `json:"jwks_port"`
 }
 
 const configName = "user_service_config.json"
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/boltdb"
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/db/sqlitedb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/user/config"
+)
+
+// userMigrations bring stored users up to date with models.User. Add new
+// migrations at the end; see db.Migration.
+var userMigrations = []db.Migration[*models.User]{
+	{
+		Version:     1,
+		Description: "Give users without a valid role the default role",
+		Migrate: func(user *models.User) (bool, error) {
+			if user.Role.IsValid() {
+				return false, nil
+			}
+			user.Role = models.Default
+			return true, nil
+		},
+	},
+	{
+		// Conditional writes take an unversioned user for a missing one
+		Version:     2,
+		Description: "Version users stored before versions were tracked",
+		Migrate: func(user *models.User) (bool, error) {
+			return user.Version == 0, nil
+		},
+	},
+}
+
+// MigrateDb applies the pending migrations to the users table. With dryRun
+// set it only reports what they would change.
+func MigrateDb(dbConfig config.DatabaseConfig, userDb db.DbDriver[*models.User], dryRun bool) (*db.MigrationReport, error) {
+	versions, err := createSchemaVersionDb(dbConfig)
+	if err != nil {
+		log.Printf("Could not create database driver for table: %s, %v", db.SchemaVersionTable, err)
+		return nil, err
+	}
+	migrator := &db.Migrator[*models.User]{
+		Table:      dbConfig.Table,
+		Items:      userDb,
+		Versions:   versions,
+		Migrations: userMigrations,
+		DryRun:     dryRun,
+	}
+	return migrator.Run()
+}
+
+func createSchemaVersionDb(dbConfig config.DatabaseConfig) (db.DbDriver[*db.SchemaVersion], error) {
+	switch dbConfig.Type {
+	case "local":
+		memDbDriver, err := memdb.Initialize[*db.SchemaVersion](db.SchemaVersionTable, dbConfig.RootPath, dbConfig.SaveToDisk)
+		if err != nil {
+			return nil, err
+		}
+		return memDbDriver, nil
+	case "sqlite":
+		sqliteDriver, err := sqlitedb.Initialize[*db.SchemaVersion](db.SchemaVersionTable, dbConfig.RootPath)
+		if err != nil {
+			return nil, err
+		}
+		return sqliteDriver, nil
+	case "bolt":
+		boltDriver, err := boltdb.Initialize[*db.SchemaVersion](db.SchemaVersionTable, dbConfig.RootPath)
+		if err != nil {
+			return nil, err
+		}
+		return boltDriver, nil
+	default:
+		return nil, errors.New("CreateDb in User service failed. Db type not supported: " + dbConfig.Type)
+	}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/replication"
+	"github.com/Hanasou/news_feed/go/user/config"
+)
+
+// startReplication makes the tables of the service part of replication as
+// configured and returns the node, nil if replication is off. A follower
+// starts following right away.
+func (service *UserService) startReplication(serviceConfig *config.UserServiceConfig) (*replication.Node, error) {
+	replicationConfig := serviceConfig.Replication
+	if replicationConfig.Role == "" {
+		return nil, nil
+	}
+	if replicationConfig.Port == 0 {
+		return nil, errors.New("replication needs a port of its own")
+	}
+	users, usersOk := service.userTable.(*memdb.MemDb[*models.User])
+	families, familiesOk := service.tokenTable.(*memdb.MemDb[*models.TokenFamily])
+	revocations, revocationsOk := service.revocationTable.(*memdb.MemDb[*models.RevokedToken])
+	if !usersOk || !familiesOk || !revocationsOk {
+		return nil, errors.New("replication is not supported by db type: " + serviceConfig.Database.Type)
+	}
+	node := replication.NewNode(replication.MemDbTable(users), replication.MemDbTable(families), replication.MemDbTable(revocations))
+	if replicationConfig.RetryInterval != "" {
+		retryInterval, err := time.ParseDuration(replicationConfig.RetryInterval)
+		if err != nil {
+			log.Printf("Invalid retry interval %q: %v", replicationConfig.RetryInterval, err)
+			return nil, err
+		}
+		node.RetryInterval = retryInterval
+	}
+
+	switch replication.Role(replicationConfig.Role) {
+	case replication.Leader:
+		return node, nil
+	case replication.Follower:
+		if replicationConfig.LeaderAddress == "" {
+			return nil, errors.New("a follower needs the address of its leader")
+		}
+		if err := node.Follow(replicationConfig.LeaderAddress); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, errors.New("unknown replication role: " + replicationConfig.Role)
+	}
+}
+
+// createFollowerDir creates the directory of a new follower's database, which
+// starts out empty and is filled from the leader
+func createFollowerDir(serviceConfig *config.UserServiceConfig) error {
+	if serviceConfig.Replication.Role != string(replication.Follower) || !serviceConfig.Database.SaveToDisk {
+		return nil
+	}
+	return os.MkdirAll(serviceConfig.Database.RootPath, 0755)
+}
+
+// checkWritable returns replication.ErrNotLeader on followers, which only
+// serve reads
+func (service *UserService) checkWritable() error {
+	if service.replica == nil {
+		return nil
+	}
+	return service.replica.CheckLeader()
+}
+
+// ReplicationNode returns the replication node of the service, nil if
+// replication is off
+func (service *UserService) ReplicationNode() *replication.Node {
+	return service.replica
+}
@@ -0,0 +1,94 @@
+package core
+
+import (
+	"errors"
+	"log"
+
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+)
+
+// ErrInvalidAccessToken is returned for access tokens that are not valid
+var ErrInvalidAccessToken = errors.New("invalid access token")
+
+// Logout revokes accessToken and the session it belongs to, so that neither
+// it nor the refresh tokens of the session work anymore. With everywhere it
+// revokes every session of the user. It returns how many sessions it revoked.
+func (service *UserService) Logout(accessToken string, everywhere bool) (int, error) {
+	if err := service.checkWritable(); err != nil {
+		log.Printf("Logout failed: %v", err)
+		return 0, err
+	}
+	claims, err := service.jwtService.ValidateAccessToken(accessToken)
+	if err != nil {
+		log.Printf("Logout failed: %v", err)
+		return 0, ErrInvalidAccessToken
+	}
+
+	revoked := &models.RevokedToken{ID: claims.ID, UserID: claims.UserID, ExpiresAt: claims.ExpiresAt.UnixMilli()}
+	if err := service.revocationTable.Upsert(revoked); err != nil {
+		log.Printf("Logout failed: %v", err)
+		return 0, err
+	}
+
+	var families []*models.TokenFamily
+	if everywhere {
+		result, err := service.tokenTable.Query(db.Query{Where: db.Where("user_id", db.Eq, claims.UserID)})
+		if err != nil {
+			log.Printf("Logout failed: %v", err)
+			return 0, err
+		}
+		families = result.Items
+	} else if claims.SessionID != "" {
+		family, err := service.tokenTable.GetByID(claims.SessionID)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			log.Printf("Logout failed: %v", err)
+			return 0, err
+		}
+		if err == nil {
+			families = append(families, family)
+		}
+	}
+
+	sessions := 0
+	for _, family := range families {
+		if family.Revoked || family.UserID != claims.UserID {
+			continue
+		}
+		service.revokeFamily(family)
+		sessions++
+	}
+	log.Printf("User %s logged out of %d sessions", claims.UserID, sessions)
+	return sessions, nil
+}
+
+// IsTokenRevoked reports whether the access token with tokenID, issued for
+// the session with sessionID, was revoked by logging out or because the
+// session was revoked
+func (service *UserService) IsTokenRevoked(tokenID string, sessionID string) (bool, error) {
+	if tokenID == "" {
+		return false, ErrInvalidAccessToken
+	}
+	_, err := service.revocationTable.GetByID(tokenID)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, db.ErrNotFound) {
+		log.Printf("Checking token %s failed: %v", tokenID, err)
+		return false, err
+	}
+	if sessionID == "" {
+		return false, nil
+	}
+
+	family, err := service.tokenTable.GetByID(sessionID)
+	if errors.Is(err, db.ErrNotFound) {
+		// Sessions are only removed once their tokens expired
+		return true, nil
+	}
+	if err != nil {
+		log.Printf("Checking token %s failed: %v", tokenID, err)
+		return false, err
+	}
+	return family.Revoked, nil
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func accessClaims(t *testing.T, service *UserService, tokens *auth.TokenPair) *auth.Claims {
+	t.Helper()
+	claims, err := service.jwtService.ValidateAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+	return claims
+}
+
+func TestLogout(t *testing.T) {
+	service := newTestService(t)
+	session, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	other, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	claims := accessClaims(t, service, session)
+
+	revoked, err := service.IsTokenRevoked(claims.ID, claims.SessionID)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	sessions, err := service.Logout(session.AccessToken, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sessions)
+	revoked, err = service.IsTokenRevoked(claims.ID, claims.SessionID)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	_, _, err = service.RefreshTokens(session.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// The other session goes on
+	otherClaims := accessClaims(t, service, other)
+	revoked, err = service.IsTokenRevoked(otherClaims.ID, otherClaims.SessionID)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	_, _, err = service.RefreshTokens(other.RefreshToken)
+	assert.NoError(t, err)
+
+	_, err = service.Logout("not a token", false)
+	assert.ErrorIs(t, err, ErrInvalidAccessToken)
+	_, err = service.IsTokenRevoked("", "")
+	assert.ErrorIs(t, err, ErrInvalidAccessToken)
+}
+
+func TestLogout_Everywhere(t *testing.T) {
+	service := newTestService(t)
+	first, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	second, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	// Access tokens issued by refreshing belong to the same session
+	second, _, err = service.RefreshTokens(second.RefreshToken)
+	require.NoError(t, err)
+
+	sessions, err := service.Logout(first.AccessToken, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sessions)
+
+	for _, tokens := range []*auth.TokenPair{first, second} {
+		claims := accessClaims(t, service, tokens)
+		revoked, err := service.IsTokenRevoked(claims.ID, claims.SessionID)
+		require.NoError(t, err)
+		assert.True(t, revoked)
+		_, _, err = service.RefreshTokens(tokens.RefreshToken)
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	}
+
+	// Logging in again starts a new session
+	tokens, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	claims := accessClaims(t, service, tokens)
+	revoked, err := service.IsTokenRevoked(claims.ID, claims.SessionID)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
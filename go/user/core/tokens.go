@@ -0,0 +1,164 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/boltdb"
+	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/db/sqlitedb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/util"
+	"github.com/Hanasou/news_feed/go/user/config"
+)
+
+// Tables of refresh token families and revoked access tokens, kept next to
+// the users table
+const (
+	tokenFamilyTable  = "token_families"
+	revokedTokenTable = "revoked_tokens"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token cannot be exchanged
+// for new tokens
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrRefreshTokenReused is returned when a refresh token that was already
+// exchanged is used again. Its family is revoked, so the tokens issued in
+// exchange for it stop working too.
+var ErrRefreshTokenReused = fmt.Errorf("%w: token was already used", ErrInvalidRefreshToken)
+
+// createAuthTable creates table, one of the tables the service keeps tokens
+// in, in the database of the users table. Its items expire with their tokens,
+// or earlier with the TTL of the database.
+func createAuthTable[T db.Expirable](dbConfig config.DatabaseConfig, table string) (db.DbDriver[T], error) {
+	ttl, err := parseTTL(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dbConfig.Type {
+	case "local":
+		memDbDriver, err := memdb.Initialize[T](table, dbConfig.RootPath, dbConfig.SaveToDisk, memdb.WithTTL(ttl))
+		if err != nil {
+			return nil, err
+		}
+		return memDbDriver, nil
+	case "sqlite":
+		if ttl > 0 {
+			return nil, errors.New("CreateDb in User service failed. ttl is not supported by db type: " + dbConfig.Type)
+		}
+		sqliteDriver, err := sqlitedb.Initialize[T](table, dbConfig.RootPath)
+		if err != nil {
+			return nil, err
+		}
+		return sqliteDriver, nil
+	case "bolt":
+		if ttl > 0 {
+			return nil, errors.New("CreateDb in User service failed. ttl is not supported by db type: " + dbConfig.Type)
+		}
+		boltDriver, err := boltdb.Initialize[T](table, dbConfig.RootPath)
+		if err != nil {
+			return nil, err
+		}
+		return boltDriver, nil
+	default:
+		return nil, errors.New("CreateDb in User service failed. Db type not supported: " + dbConfig.Type)
+	}
+}
+
+// startTokenFamily issues tokens to a user who just logged in, starting a
+// new family of refresh tokens
+func (service *UserService) startTokenFamily(user *models.User) (*auth.TokenPair, error) {
+	tokenPair, claims, err := service.jwtService.GenerateTokenPairInFamily(user, util.NewUUID())
+	if err != nil {
+		return nil, err
+	}
+	family := &models.TokenFamily{
+		ID:        claims.Family,
+		UserID:    user.ID,
+		TokenID:   claims.ID,
+		ExpiresAt: claims.ExpiresAt.UnixMilli(),
+	}
+	if err := service.tokenTable.UpsertIfVersion(family, 0); err != nil {
+		return nil, err
+	}
+	return tokenPair, nil
+}
+
+// RefreshTokens exchanges refreshToken for new tokens, replacing it as the
+// latest token of its family. The user is read again, so changes such as a
+// new role show up in the new access token.
+func (service *UserService) RefreshTokens(refreshToken string) (*auth.TokenPair, *models.User, error) {
+	if err := service.checkWritable(); err != nil {
+		log.Printf("Refresh tokens failed: %v", err)
+		return nil, nil, err
+	}
+	claims, err := service.jwtService.ParseRefreshToken(refreshToken)
+	if err != nil {
+		log.Printf("Refresh tokens failed: %v", err)
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	family, err := service.tokenTable.GetByID(claims.Family)
+	if errors.Is(err, db.ErrNotFound) {
+		log.Printf("Refresh tokens failed: unknown token family %s", claims.Family)
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		log.Printf("Refresh tokens failed: %v", err)
+		return nil, nil, err
+	}
+	if family.Revoked || family.UserID != claims.Subject {
+		log.Printf("Refresh tokens failed: token family %s is revoked", family.ID)
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if family.TokenID != claims.ID {
+		log.Printf("Refresh token of family %s was used again, revoking the family", family.ID)
+		service.revokeFamily(family)
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	user, err := service.userTable.GetByID(claims.Subject)
+	if errors.Is(err, db.ErrNotFound) {
+		log.Printf("Refresh tokens failed: user %s no longer exists", claims.Subject)
+		service.revokeFamily(family)
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		log.Printf("Refresh tokens failed: %v", err)
+		return nil, nil, err
+	}
+
+	tokenPair, newClaims, err := service.jwtService.GenerateTokenPairInFamily(user, family.ID)
+	if err != nil {
+		log.Printf("Could not generate token pair: %v", err)
+		return nil, nil, err
+	}
+	version := family.Version
+	family.TokenID = newClaims.ID
+	family.ExpiresAt = newClaims.ExpiresAt.UnixMilli()
+	err = service.tokenTable.UpsertIfVersion(family, version)
+	if errors.Is(err, db.ErrVersionConflict) {
+		// The same token was exchanged by another request in the meantime
+		log.Printf("Refresh token of family %s was used twice at once, revoking the family", family.ID)
+		service.revokeFamily(family)
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		log.Printf("Refresh tokens failed: %v", err)
+		return nil, nil, err
+	}
+	return tokenPair, user, nil
+}
+
+// revokeFamily stops every refresh token of family from being exchanged
+func (service *UserService) revokeFamily(family *models.TokenFamily) {
+	family.Revoked = true
+	if err := service.tokenTable.Upsert(family); err != nil {
+		log.Printf("Could not revoke token family %s: %v", family.ID, err)
+	}
+}
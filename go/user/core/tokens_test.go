@@ -0,0 +1,151 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/user/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService returns a user service with one user, alice, whose password
+// is "password"
+func newTestService(t *testing.T) *UserService {
+	t.Helper()
+	t.Setenv(auth.SecretEnv, "")
+	service, err := InitializeService(&config.UserServiceConfig{
+		Database: config.DatabaseConfig{Type: "local", RootPath: t.TempDir(), Table: "users"},
+		Auth:     auth.Config{Secret: "a-test-signing-key-of-at-least-32-bytes"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, service.CreateUser(&models.User{
+		ID: "alice", Username: "alice", Email: "alice@example.com", Password: "password", Role: models.Default,
+	}))
+	return service
+}
+
+func TestRefreshTokens_Rotation(t *testing.T) {
+	service := newTestService(t)
+	first, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+
+	second, user, err := service.RefreshTokens(first.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.ID)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+	claims, err := service.jwtService.ValidateAccessToken(second.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.UserID)
+
+	// Each token in turn can be exchanged once
+	third, _, err := service.RefreshTokens(second.RefreshToken)
+	require.NoError(t, err)
+	_, _, err = service.RefreshTokens(third.RefreshToken)
+	require.NoError(t, err)
+
+	_, _, err = service.RefreshTokens("not a token")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, _, err = service.RefreshTokens(first.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshTokens_ReuseRevokesFamily(t *testing.T) {
+	service := newTestService(t)
+	stolen, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	other, _, err := service.AuthenticateUser("alice@example.com", "password")
+	require.NoError(t, err)
+
+	latest, _, err := service.RefreshTokens(stolen.RefreshToken)
+	require.NoError(t, err)
+
+	// Replaying the exchanged token revokes the tokens issued for it
+	_, _, err = service.RefreshTokens(stolen.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, _, err = service.RefreshTokens(latest.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// Other logins are not affected
+	_, _, err = service.RefreshTokens(other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRefreshTokens_ReloadsUser(t *testing.T) {
+	service := newTestService(t)
+	tokens, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+
+	alice, err := service.userTable.GetByID("alice")
+	require.NoError(t, err)
+	alice.Role = models.Admin
+	require.NoError(t, service.userTable.Upsert(alice))
+
+	tokens, user, err := service.RefreshTokens(tokens.RefreshToken)
+	require.NoError(t, err)
+	assert.Equal(t, models.Admin, user.Role)
+	claims, err := service.jwtService.ValidateAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, models.Admin, claims.Role)
+
+	// Removed users cannot refresh
+	require.NoError(t, service.userTable.Purge("alice"))
+	_, _, err = service.RefreshTokens(tokens.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestTokenTables_ExpireWithTheirTokens(t *testing.T) {
+	service := newTestService(t)
+	tokens, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	_, err = service.Logout(tokens.AccessToken, false)
+	require.NoError(t, err)
+
+	// Families go with their refresh token, revocations with the access token
+	for table, after := range map[db.Expirer]time.Duration{
+		service.tokenTable.(db.Expirer):      8 * 24 * time.Hour,
+		service.revocationTable.(db.Expirer): time.Hour,
+	} {
+		expired, err := table.ExpireDue(time.Now())
+		require.NoError(t, err)
+		assert.Zero(t, expired)
+		expired, err = table.ExpireDue(time.Now().Add(after))
+		require.NoError(t, err)
+		assert.Equal(t, 1, expired)
+	}
+}
+
+func TestPublicKeys(t *testing.T) {
+	assert.Nil(t, newTestService(t).PublicKeys())
+
+	keyPath := filepath.Join(t.TempDir(), "signing.pem")
+	kid, err := auth.GenerateKeyFiles(keyPath, "EdDSA")
+	require.NoError(t, err)
+	service, err := InitializeService(&config.UserServiceConfig{
+		Database: config.DatabaseConfig{Type: "local", RootPath: t.TempDir(), Table: "users"},
+		Auth:     auth.Config{SigningKey: &auth.KeyFile{Path: keyPath}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, service.CreateUser(&models.User{
+		ID: "alice", Username: "alice", Email: "alice@example.com", Password: "password", Role: models.Default,
+	}))
+
+	// Tokens are validated with the published keys
+	tokens, _, err := service.AuthenticateUser("alice", "password")
+	require.NoError(t, err)
+	require.Len(t, service.PublicKeys().Keys(), 1)
+	assert.Equal(t, kid, service.PublicKeys().Keys()[0].ID)
+	validating := auth.NewAsymmetricJWTService(nil, service.PublicKeys(), auth.DefaultIssuer)
+	claims, err := validating.ValidateAccessToken(tokens.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.UserID)
+
+	_, _, err = service.RefreshTokens(tokens.RefreshToken)
+	require.NoError(t, err)
+	_, err = service.Logout(tokens.AccessToken, false)
+	require.NoError(t, err)
+}
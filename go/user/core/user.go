@@ -1,53 +1,191 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/Hanasou/news_feed/go/common/auth"
 	"github.com/Hanasou/news_feed/go/common/db"
+	"github.com/Hanasou/news_feed/go/common/db/boltdb"
 	"github.com/Hanasou/news_feed/go/common/db/memdb"
+	"github.com/Hanasou/news_feed/go/common/db/sqlitedb"
 	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/replication"
 	"github.com/Hanasou/news_feed/go/user/config"
 )
 
 type UserService struct {
 	// Add fields for user service if needed
-	userTable  db.DbDriver[*models.User]
-	jwtService *auth.JWTService
+	userTable       db.DbDriver[*models.User]
+	tokenTable      db.DbDriver[*models.TokenFamily]
+	revocationTable db.DbDriver[*models.RevokedToken]
+	jwtService      *auth.JWTService
+	// replica is nil unless the users table is replicated
+	replica *replication.Node
 }
 
 func InitializeService(userServiceConfig *config.UserServiceConfig) (*UserService, error) {
-	service := &UserService{}
-	userDb, err := CreateDb(userServiceConfig.Database.Type, userServiceConfig.Database.Table,
-		userServiceConfig.Database.RootPath, userServiceConfig.Database.SaveToDisk)
+	jwtService, err := auth.NewJWTServiceFromConfig(userServiceConfig.Auth)
+	if err != nil {
+		log.Printf("Could not create JWT service: %v", err)
+		return nil, err
+	}
+	service := &UserService{jwtService: jwtService}
+	if err := createFollowerDir(userServiceConfig); err != nil {
+		log.Printf("Could not create database directory: %v", err)
+		return nil, err
+	}
+	userDb, err := CreateDb(userServiceConfig.Database)
 	if err != nil {
 		log.Printf("Could not create database driver for table: %s, %v", "users", err)
 		return nil, err
 	}
 	service.userTable = userDb
+	if service.tokenTable, err = createAuthTable[*models.TokenFamily](userServiceConfig.Database, tokenFamilyTable); err != nil {
+		log.Printf("Could not create database driver for table: %s, %v", tokenFamilyTable, err)
+		return nil, err
+	}
+	if service.revocationTable, err = createAuthTable[*models.RevokedToken](userServiceConfig.Database, revokedTokenTable); err != nil {
+		log.Printf("Could not create database driver for table: %s, %v", revokedTokenTable, err)
+		return nil, err
+	}
+	if service.replica, err = service.startReplication(userServiceConfig); err != nil {
+		log.Printf("Could not start replication: %v", err)
+		return nil, err
+	}
 
+	// Followers only apply the leader's changes. They take over its work
+	// when promoted.
+	if service.replica != nil && !service.replica.IsLeader() {
+		service.replica.OnPromote(func() error {
+			return service.startLeaderWork(userServiceConfig)
+		})
+		return service, nil
+	}
+	if err := service.startLeaderWork(userServiceConfig); err != nil {
+		return nil, err
+	}
 	return service, nil
 }
 
-func CreateDb(dbType string, table string, rootPath string, saveToDisk bool) (db.DbDriver[*models.User], error) {
-	if dbType == "local" {
-		memDbDriver, err := memdb.Initialize[*models.User](table, rootPath, saveToDisk)
+// startLeaderWork migrates the users table and starts removing expired users,
+// token families and revoked tokens, which only the instance taking writes
+// does
+func (service *UserService) startLeaderWork(userServiceConfig *config.UserServiceConfig) error {
+	if _, err := MigrateDb(userServiceConfig.Database, service.userTable, false); err != nil {
+		log.Printf("Could not migrate table: %s, %v", userServiceConfig.Database.Table, err)
+		return err
+	}
+
+	interval := defaultSweepInterval
+	if userServiceConfig.Database.SweepInterval != "" {
+		var err error
+		if interval, err = time.ParseDuration(userServiceConfig.Database.SweepInterval); err != nil {
+			log.Printf("Invalid sweep interval %q: %v", userServiceConfig.Database.SweepInterval, err)
+			return err
+		}
+	}
+	// Users only expire with a TTL, token families and revoked tokens also
+	// with their tokens
+	tables := []any{service.tokenTable, service.revocationTable}
+	if userServiceConfig.Database.TTL != "" {
+		tables = append(tables, service.userTable)
+	}
+	for _, table := range tables {
+		if expirer, ok := table.(db.Expirer); ok {
+			go db.RunExpirer(context.Background(), expirer, interval)
+		}
+	}
+	return nil
+}
+
+// defaultSweepInterval is how often expired users, token families and revoked
+// tokens are removed if the config does not say
+const defaultSweepInterval = time.Minute
+
+// parseTTL returns the TTL of the database, 0 if it has none
+func parseTTL(dbConfig config.DatabaseConfig) (time.Duration, error) {
+	if dbConfig.TTL == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(dbConfig.TTL)
+	if err != nil {
+		log.Printf("Invalid ttl %q: %v", dbConfig.TTL, err)
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func CreateDb(dbConfig config.DatabaseConfig) (db.DbDriver[*models.User], error) {
+	ttl, err := parseTTL(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	switch dbConfig.Type {
+	case "local":
+		codec := dbConfig.Codec
+		if codec == "" {
+			codec = memdb.JSONCodec.Name()
+		}
+		memDbCodec, err := memdb.LookupCodec(codec)
+		if err != nil {
+			log.Printf("Could not initialize db. Error: %v", err)
+			return nil, err
+		}
+		memDbDriver, err := memdb.Initialize[*models.User](dbConfig.Table, dbConfig.RootPath, dbConfig.SaveToDisk,
+			memdb.WithUniqueIndex("username"), memdb.WithUniqueIndex("email"), memdb.WithCodec(memDbCodec), memdb.WithTTL(ttl))
 		if err != nil {
 			log.Printf("Could not initialize db. Error: %v", err)
 			return nil, err
 		}
 		return memDbDriver, nil
-	} else {
-		return nil, errors.New("CreateDb in User service failed. Db type not supported: " + dbType)
+	case "sqlite":
+		if ttl > 0 {
+			return nil, errors.New("CreateDb in User service failed. ttl is not supported by db type: " + dbConfig.Type)
+		}
+		sqliteDriver, err := sqlitedb.Initialize[*models.User](dbConfig.Table, dbConfig.RootPath,
+			sqlitedb.WithUniqueIndex("username"), sqlitedb.WithUniqueIndex("email"))
+		if err != nil {
+			log.Printf("Could not initialize db. Error: %v", err)
+			return nil, err
+		}
+		return sqliteDriver, nil
+	case "bolt":
+		if ttl > 0 {
+			return nil, errors.New("CreateDb in User service failed. ttl is not supported by db type: " + dbConfig.Type)
+		}
+		boltDriver, err := boltdb.Initialize[*models.User](dbConfig.Table, dbConfig.RootPath,
+			boltdb.WithUniqueIndex("username"), boltdb.WithUniqueIndex("email"))
+		if err != nil {
+			log.Printf("Could not initialize db. Error: %v", err)
+			return nil, err
+		}
+		return boltDriver, nil
+	default:
+		return nil, errors.New("CreateDb in User service failed. Db type not supported: " + dbConfig.Type)
 	}
 }
 
+// ErrUserExists is returned when creating a user with the id of an existing
+// user
+var ErrUserExists = errors.New("user already exists")
+
+// CreateUser stores a new user with a hashed password. It fails with
+// ErrUserExists if a user with the same id exists.
 func (service *UserService) CreateUser(user *models.User) error {
 	if user == nil {
 		log.Println("Create user failed: user is nil")
 		return errors.New("user cannot be nil")
 	}
+	if err := service.checkWritable(); err != nil {
+		log.Printf("Create user failed: %v", err)
+		return err
+	}
 	if user.Username == "" || user.Password == "" || user.Email == "" {
 		log.Println("Create user failed: missing required fields")
 		return errors.New("user must have username, password, and email")
@@ -64,9 +202,13 @@ func (service *UserService) CreateUser(user *models.User) error {
 	}
 	user.Password = hashedPassword
 
-	// Insert user into the database
+	// Insert user into the database, never overwriting an existing user
 	log.Printf("Inserting user: %v", user)
-	err = service.userTable.Upsert(user)
+	err = service.userTable.UpsertIfVersion(user, 0)
+	if errors.Is(err, db.ErrVersionConflict) {
+		log.Printf("Create user failed: user %s exists", user.ID)
+		return ErrUserExists
+	}
 	if err != nil {
 		log.Printf("Create user failed: %v", err)
 		return err
@@ -75,61 +217,142 @@ func (service *UserService) CreateUser(user *models.User) error {
 	return nil
 }
 
+// ErrNotAdmin is returned when a user who is not an admin changes roles
+var ErrNotAdmin = errors.New("only admins can change roles")
+
+// ErrInvalidRole is returned when setting a role that does not exist
+var ErrInvalidRole = errors.New("invalid role")
+
+// SetUserRole gives the user with the given id role. accessToken is the
+// token of the user making the change, who must currently be an admin;
+// the role in the token is not trusted, as it may be outdated.
+func (service *UserService) SetUserRole(accessToken string, userId string, role models.Role) (*models.User, error) {
+	if err := service.checkWritable(); err != nil {
+		log.Printf("Set user role failed: %v", err)
+		return nil, err
+	}
+	claims, err := service.jwtService.ValidateAccessToken(accessToken)
+	if err != nil {
+		log.Printf("Set user role failed: %v", err)
+		return nil, ErrInvalidAccessToken
+	}
+	revoked, err := service.IsTokenRevoked(claims.ID, claims.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		log.Printf("Set user role failed: token %s was revoked", claims.ID)
+		return nil, ErrInvalidAccessToken
+	}
+	admin, err := service.userTable.GetByID(claims.UserID)
+	if err != nil && !errors.Is(err, db.ErrNotFound) {
+		log.Printf("Set user role failed: %v", err)
+		return nil, err
+	}
+	if err != nil || admin.Role != models.Admin {
+		log.Printf("Set user role failed: user %s is not an admin", claims.UserID)
+		return nil, ErrNotAdmin
+	}
+	if !role.IsValid() {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	user, err := service.userTable.GetByID(userId)
+	if err != nil {
+		log.Printf("Set user role failed: %v", err)
+		return nil, err
+	}
+	user.Role = role
+	if err := service.userTable.UpsertIfVersion(user, user.Version); err != nil {
+		log.Printf("Set user role failed: %v", err)
+		return nil, err
+	}
+	log.Printf("User %s set the role of user %s to %s", claims.UserID, userId, role)
+	return user, nil
+}
+
+// ErrInvalidCredentials is returned when a user cannot be authenticated. It
+// does not say whether the user exists or the password was wrong.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// AuthenticateUser checks the password of the user with userIdentifier, a
+// username or an email address, and issues the user a token pair
 func (service *UserService) AuthenticateUser(userIdentifier, password string) (*auth.TokenPair, *models.User, error) {
 	if userIdentifier == "" || password == "" {
 		log.Println("Authenticate user failed: missing username or password")
-		return nil, nil, errors.New("username and password must be provided")
+		return nil, nil, ErrInvalidCredentials
 	}
-
-	user, err := service.userTable.GetByField("username", userIdentifier)
-	if err != nil {
+	// Logging in starts a token family, which is a write
+	if err := service.checkWritable(); err != nil {
 		log.Printf("Authenticate user failed: %v", err)
 		return nil, nil, err
 	}
-	if user == nil {
+
+	field := "username"
+	if strings.Contains(userIdentifier, "@") {
+		field = "email"
+	}
+	user, err := service.userTable.GetByField(field, userIdentifier)
+	if errors.Is(err, db.ErrNotFound) {
 		log.Println("Authenticate user failed: user not found")
-		return nil, nil, nil
+		return nil, nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		log.Printf("Authenticate user failed: %v", err)
+		return nil, nil, err
 	}
 
 	// Check password
-	if err = auth.ValidatePassword(password, user.Password); err != nil {
+	if err = auth.ValidatePassword(user.Password, password); err != nil {
 		log.Println("Authenticate user failed: invalid password")
-		return nil, nil, nil
+		return nil, nil, ErrInvalidCredentials
 	}
 
-	tokenPair, err := service.jwtService.GenerateTokenPair(user)
+	tokenPair, err := service.startTokenFamily(user)
 	if err != nil {
 		log.Printf("Could not generate token pair: %v", err)
 		return nil, nil, err
 	}
 
-	log.Printf("User authenticated successfully: %v", user)
+	log.Printf("User authenticated successfully: %s", user.ID)
 	return tokenPair, user, nil
 }
 
+// PublicKeys returns the keys tokens issued by the service are validated
+// with, or nil if they are signed with a shared secret
+func (service *UserService) PublicKeys() *auth.KeySet {
+	return service.jwtService.PublicKeys()
+}
+
 func (service *UserService) GetUsers(idFilter, nameFilter, emailFilter, roleFilter string) ([]*models.User, error) {
-	users, err := service.userTable.GetAll()
-	if err != nil {
-		log.Printf("GetUsers failed: %v", err)
-		return nil, err
-	}
+	users, _, err := service.ListUsers(idFilter, nameFilter, emailFilter, roleFilter, db.PageRequest{})
+	return users, err
+}
 
-	filteredUsers := make([]*models.User, 0)
-	for _, user := range users {
-		if idFilter != "" && user.ID != idFilter {
-			continue
-		}
-		if nameFilter != "" && user.Username != nameFilter {
-			continue
-		}
-		if emailFilter != "" && user.Email != emailFilter {
-			continue
-		}
-		if roleFilter != "" && user.Role.String() != roleFilter {
-			continue
-		}
-		filteredUsers = append(filteredUsers, user)
+// ListUsers returns one page of the users matching every non-empty filter,
+// along with the token for the next page
+func (service *UserService) ListUsers(idFilter, nameFilter, emailFilter, roleFilter string, page db.PageRequest) ([]*models.User, string, error) {
+	if page.PageSize < 0 {
+		return nil, "", errors.New("page size cannot be negative")
+	}
+	conditions := []*db.Condition{}
+	if idFilter != "" {
+		conditions = append(conditions, db.Where("id", db.Eq, idFilter))
+	}
+	if nameFilter != "" {
+		conditions = append(conditions, db.Where("username", db.Eq, nameFilter))
+	}
+	if emailFilter != "" {
+		conditions = append(conditions, db.Where("email", db.Eq, emailFilter))
+	}
+	if roleFilter != "" {
+		conditions = append(conditions, db.Where("role", db.Eq, roleFilter))
 	}
 
-	return filteredUsers, nil
+	result, err := service.userTable.Query(page.Query(db.And(conditions...)))
+	if err != nil {
+		log.Printf("GetUsers failed: %v", err)
+		return nil, "", err
+	}
+	return result.Items, result.NextCursor, nil
 }
@@ -0,0 +1,45 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/user/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateUser_DoesNotOverwrite(t *testing.T) {
+	service := newTestService(t)
+
+	// Creating a user with the id of alice leaves her account as it was
+	err := service.CreateUser(&models.User{
+		ID: "alice", Username: "mallory", Email: "mallory@example.com", Password: "stolen", Role: models.Admin,
+	})
+	assert.ErrorIs(t, err, ErrUserExists)
+
+	alice, err := service.userTable.GetByID("alice")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", alice.Username)
+	assert.Equal(t, models.Default, alice.Role)
+	assert.NoError(t, auth.ValidatePassword(alice.Password, "password"))
+	_, _, err = service.AuthenticateUser("alice", "password")
+	assert.NoError(t, err)
+}
+
+func TestInitializeService_ReplicationNeedsItsOwnPort(t *testing.T) {
+	t.Setenv(auth.SecretEnv, "")
+	serviceConfig := &config.UserServiceConfig{
+		Database:    config.DatabaseConfig{Type: "local", RootPath: t.TempDir(), Table: "users"},
+		Auth:        auth.Config{Secret: "a-test-signing-key-of-at-least-32-bytes"},
+		Replication: config.ReplicationConfig{Role: "leader"},
+	}
+	_, err := InitializeService(serviceConfig)
+	assert.Error(t, err)
+
+	serviceConfig.Replication.Port = 50071
+	service, err := InitializeService(serviceConfig)
+	require.NoError(t, err)
+	assert.NotNil(t, service.ReplicationNode())
+}
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"strconv"
 
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/grpc/replicationpb"
 	"github.com/Hanasou/news_feed/go/common/grpc/userpb"
+	"github.com/Hanasou/news_feed/go/common/replication"
 	"github.com/Hanasou/news_feed/go/user/config"
 	"github.com/Hanasou/news_feed/go/user/core"
 	"github.com/Hanasou/news_feed/go/user/server/grpc_server"
@@ -39,15 +44,85 @@ func createGrpcServer(config *config.UserServiceConfig, userService *core.UserSe
 	}
 }
 
+// serveJWKS publishes the keys tokens are validated with over HTTP, so other
+// services can validate tokens without holding the signing key
+func serveJWKS(config *config.UserServiceConfig, userService *core.UserService) {
+	if config.Server.JWKSPort == 0 {
+		return
+	}
+	keys := userService.PublicKeys()
+	if keys == nil {
+		log.Println("Not serving JWKS: tokens are signed with a shared secret")
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET "+auth.JWKSPath, auth.JWKSHandler(keys))
+	jwksUrl := config.Server.Host + ":" + strconv.Itoa(config.Server.JWKSPort)
+	log.Printf("Serving JWKS at http://%s%s", jwksUrl, auth.JWKSPath)
+	go func() {
+		if err := http.ListenAndServe(jwksUrl, mux); err != nil {
+			log.Fatalln("Failed to serve JWKS: ", err)
+		}
+	}()
+}
+
+// serveReplication serves the replication service on a port of its own, which
+// unlike the port of the user service only the other nodes should reach
+func serveReplication(config *config.UserServiceConfig, userService *core.UserService) {
+	node := userService.ReplicationNode()
+	if node == nil {
+		return
+	}
+	host := config.Replication.Host
+	if host == "" {
+		host = config.Server.Host
+	}
+	replicationUrl := host + ":" + strconv.Itoa(config.Replication.Port)
+	lis, err := net.Listen("tcp", replicationUrl)
+	if err != nil {
+		log.Fatalln("Failed to listen to replication service: ", err)
+	}
+	s := grpc.NewServer()
+	replicationpb.RegisterReplicationServiceServer(s, replication.NewServer(node))
+	log.Println("Serving replication at: ", replicationUrl)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Fatalln("Failed to serve replication: ", err)
+		}
+	}()
+}
+
+var migrateDryRun = flag.Bool("migrate-dry-run", false, "report what the pending migrations would change and exit")
+
+// dryRunMigrations reports what the pending migrations would change
+func dryRunMigrations(config *config.UserServiceConfig) {
+	userDb, err := core.CreateDb(config.Database)
+	if err != nil {
+		log.Fatalln("Could not create database: ", err)
+	}
+	report, err := core.MigrateDb(config.Database, userDb, true)
+	if err != nil {
+		log.Fatalln("Could not run migrations: ", err)
+	}
+	fmt.Println(report)
+}
+
 func main() {
+	flag.Parse()
 	fmt.Println("Hello, from Users service!")
 	config, err := config.InitConfig()
 	if err != nil {
 		log.Fatalln("Could not initialize configuraiton file: ", err)
 	}
+	if *migrateDryRun {
+		dryRunMigrations(config)
+		return
+	}
 	userService, err := core.InitializeService(config)
 	if err != nil {
 		log.Fatalln("Could not initialize user service: ", err)
 	}
+	serveJWKS(config, userService)
+	serveReplication(config, userService)
 	createServer(config, userService)
 }
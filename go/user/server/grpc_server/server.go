@@ -2,11 +2,16 @@ package grpc_server
 
 import (
 	"context"
+	"errors"
 	"log"
 
+	"github.com/Hanasou/news_feed/go/common/db"
 	"github.com/Hanasou/news_feed/go/common/grpc/userpb"
 	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/common/util"
 	"github.com/Hanasou/news_feed/go/user/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type GrpcUserServer struct {
@@ -22,14 +27,21 @@ func NewGrpcUserServer(service *core.UserService) *GrpcUserServer {
 
 func (s *GrpcUserServer) CreateUser(ctx context.Context, request *userpb.CreateUserRequest) (*userpb.CreateUserResponse, error) {
 	responseMessage := "User failed to get created"
+	// Ids are given out here so clients cannot pick the id of another user,
+	// and the role of the request is ignored so they cannot make themselves
+	// admins. Roles are changed with SetUserRole.
 	user := &models.User{
-		ID:       request.User.Id,
+		ID:       util.NewUUID(),
 		Username: request.User.Username,
 		Email:    request.User.Email,
 		Password: request.User.Password,
-		Role:     models.RoleFromString(request.User.Role),
+		Role:     models.Default,
 	}
 	err := s.service.CreateUser(user)
+	if errors.Is(err, core.ErrUserExists) {
+		log.Println(responseMessage)
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
 	if err != nil {
 		log.Println(responseMessage)
 		return &userpb.CreateUserResponse{
@@ -40,12 +52,17 @@ func (s *GrpcUserServer) CreateUser(ctx context.Context, request *userpb.CreateU
 	responseMessage = "User succesfully added"
 	return &userpb.CreateUserResponse{
 		Response: responseMessage,
+		User:     toProtoUser(user),
 	}, nil
 }
 
 func (s *GrpcUserServer) AuthenticateUser(ctx context.Context, request *userpb.AuthenticateUserRequest) (*userpb.AuthenticateUserResponse, error) {
 	responseMessage := "User failed to get authenticated"
 	tokenPair, user, err := s.service.AuthenticateUser(request.Identifier, request.Password)
+	if errors.Is(err, core.ErrInvalidCredentials) {
+		log.Println(responseMessage)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
 	if err != nil {
 		log.Println(responseMessage)
 		return nil, err
@@ -55,37 +72,103 @@ func (s *GrpcUserServer) AuthenticateUser(ctx context.Context, request *userpb.A
 		RefreshToken:     tokenPair.RefreshToken,
 		ExpiresTimestamp: tokenPair.ExpiresIn,
 		TokenType:        tokenPair.TokenType,
-		User: &userpb.User{
-			Id:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Password: user.Password,
-			Role:     user.Role.String(),
-		},
+		User:             toProtoUser(user),
 	}
 	return response, nil
 }
 
+func (s *GrpcUserServer) RefreshTokens(ctx context.Context, request *userpb.RefreshTokensRequest) (*userpb.RefreshTokensResponse, error) {
+	tokenPair, user, err := s.service.RefreshTokens(request.RefreshToken)
+	if errors.Is(err, core.ErrInvalidRefreshToken) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userpb.RefreshTokensResponse{
+		AccessToken:      tokenPair.AccessToken,
+		RefreshToken:     tokenPair.RefreshToken,
+		ExpiresTimestamp: tokenPair.ExpiresIn,
+		TokenType:        tokenPair.TokenType,
+		User:             toProtoUser(user),
+	}, nil
+}
+
+func (s *GrpcUserServer) Logout(ctx context.Context, request *userpb.LogoutRequest) (*userpb.LogoutResponse, error) {
+	sessions, err := s.service.Logout(request.AccessToken, request.Everywhere)
+	if errors.Is(err, core.ErrInvalidAccessToken) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userpb.LogoutResponse{Sessions: int32(sessions)}, nil
+}
+
+func (s *GrpcUserServer) IsTokenRevoked(ctx context.Context, request *userpb.IsTokenRevokedRequest) (*userpb.IsTokenRevokedResponse, error) {
+	revoked, err := s.service.IsTokenRevoked(request.TokenId, request.SessionId)
+	if errors.Is(err, core.ErrInvalidAccessToken) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &userpb.IsTokenRevokedResponse{Revoked: revoked}, nil
+}
+
+func (s *GrpcUserServer) SetUserRole(ctx context.Context, request *userpb.SetUserRoleRequest) (*userpb.SetUserRoleResponse, error) {
+	user, err := s.service.SetUserRole(request.AccessToken, request.UserId, models.Role(request.Role))
+	switch {
+	case errors.Is(err, core.ErrInvalidAccessToken):
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, core.ErrNotAdmin):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, core.ErrInvalidRole):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, db.ErrNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, db.ErrVersionConflict):
+		return nil, status.Error(codes.Aborted, err.Error())
+	case err != nil:
+		return nil, err
+	}
+	return &userpb.SetUserRoleResponse{User: toProtoUser(user)}, nil
+}
+
 func (s *GrpcUserServer) GetUsers(ctx context.Context, request *userpb.GetUsersRequest) (*userpb.GetUsersResponse, error) {
-	users, err := s.service.GetUsers(request.IdFilter, request.NameFilter, request.EmailFilter, request.RoleFilter)
+	users, nextPageToken, err := s.service.ListUsers(request.IdFilter, request.NameFilter, request.EmailFilter, request.RoleFilter,
+		db.PageRequest{
+			OrderBy:    request.OrderBy,
+			Descending: request.Descending,
+			PageSize:   int(request.PageSize),
+			PageToken:  request.PageToken,
+		})
 	if err != nil {
 		log.Println("Failed to get users")
 		return nil, err
 	}
 	response := &userpb.GetUsersResponse{
-		Response: "Users retrieved successfully",
-		Users:    make([]*userpb.User, len(users)),
+		Response:      "Users retrieved successfully",
+		Users:         make([]*userpb.User, len(users)),
+		NextPageToken: nextPageToken,
 	}
 	for i, user := range users {
-		response.Users[i] = &userpb.User{
-			Id:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Password: user.Password,
-			Role:     user.Role.String(),
-		}
+		response.Users[i] = toProtoUser(user)
 	}
 	return response, nil
 }
 
+// toProtoUser converts user for responses. The password hash stays in the
+// user service.
+func toProtoUser(user *models.User) *userpb.User {
+	return &userpb.User{
+		Id:        user.ID,
+		Username:  user.Username,
+		Email:     user.Email,
+		Role:      user.Role.String(),
+		Version:   user.Version,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
 func (s *GrpcUserServer) mustEmbedUnimplementedUserServiceServer() {}
@@ -0,0 +1,89 @@
+package grpc_server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Hanasou/news_feed/go/common/auth"
+	"github.com/Hanasou/news_feed/go/common/grpc/userpb"
+	"github.com/Hanasou/news_feed/go/common/models"
+	"github.com/Hanasou/news_feed/go/user/config"
+	"github.com/Hanasou/news_feed/go/user/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newTestServer returns a server backed by a user service with no users
+func newTestServer(t *testing.T) (*GrpcUserServer, *core.UserService) {
+	t.Helper()
+	t.Setenv(auth.SecretEnv, "")
+	service, err := core.InitializeService(&config.UserServiceConfig{
+		Database: config.DatabaseConfig{Type: "local", RootPath: t.TempDir(), Table: "users"},
+		Auth:     auth.Config{Secret: "a-test-signing-key-of-at-least-32-bytes"},
+	})
+	require.NoError(t, err)
+	return NewGrpcUserServer(service), service
+}
+
+func TestGrpcUserServer_PasswordsStayInService(t *testing.T) {
+	server, _ := newTestServer(t)
+	ctx := context.Background()
+
+	created, err := server.CreateUser(ctx, &userpb.CreateUserRequest{User: &userpb.User{
+		Username: "alice", Email: "alice@example.com", Password: "password", Role: "user",
+	}})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.User.Id)
+	require.Empty(t, created.User.Password)
+
+	authenticated, err := server.AuthenticateUser(ctx, &userpb.AuthenticateUserRequest{Identifier: "alice", Password: "password"})
+	require.NoError(t, err)
+	require.Empty(t, authenticated.User.Password)
+
+	users, err := server.GetUsers(ctx, &userpb.GetUsersRequest{})
+	require.NoError(t, err)
+	require.Len(t, users.Users, 1)
+	require.Equal(t, created.User.Id, users.Users[0].Id)
+	require.Empty(t, users.Users[0].Password)
+}
+
+func TestGrpcUserServer_RolesAreSetByAdmins(t *testing.T) {
+	server, service := newTestServer(t)
+	ctx := context.Background()
+
+	// The role asked for at signup is ignored
+	created, err := server.CreateUser(ctx, &userpb.CreateUserRequest{User: &userpb.User{
+		Username: "mallory", Email: "mallory@example.com", Password: "password", Role: "admin",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, models.Default.String(), created.User.Role)
+	mallory, err := server.AuthenticateUser(ctx, &userpb.AuthenticateUserRequest{Identifier: "mallory", Password: "password"})
+	require.NoError(t, err)
+	assert.Equal(t, models.Default.String(), mallory.User.Role)
+
+	// Users cannot make themselves admins
+	_, err = server.SetUserRole(ctx, &userpb.SetUserRoleRequest{
+		AccessToken: mallory.AccessToken, UserId: created.User.Id, Role: "admin",
+	})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = server.SetUserRole(ctx, &userpb.SetUserRoleRequest{AccessToken: "forged", UserId: created.User.Id, Role: "admin"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// Admins can
+	require.NoError(t, service.CreateUser(&models.User{
+		ID: "root", Username: "root", Email: "root@example.com", Password: "password", Role: models.Admin,
+	}))
+	root, err := server.AuthenticateUser(ctx, &userpb.AuthenticateUserRequest{Identifier: "root", Password: "password"})
+	require.NoError(t, err)
+	_, err = server.SetUserRole(ctx, &userpb.SetUserRoleRequest{AccessToken: root.AccessToken, UserId: created.User.Id, Role: "owner"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = server.SetUserRole(ctx, &userpb.SetUserRoleRequest{AccessToken: root.AccessToken, UserId: "missing", Role: "admin"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	promoted, err := server.SetUserRole(ctx, &userpb.SetUserRoleRequest{
+		AccessToken: root.AccessToken, UserId: created.User.Id, Role: "admin",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.Admin.String(), promoted.User.Role)
+}